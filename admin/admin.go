@@ -0,0 +1,298 @@
+// Package admin serves the introspection of a server on a separated listener,
+//
+//	/debug/pprof/  the runtime profiles
+//	/debug/vars    the exported variables
+//	/metrics       the metrics in the Prometheus text format
+//	/services      the registered services and their methods
+//	/connections   the active connections
+//	/config        the configuration of the server
+//	/loglevel      the log level, changed with PUT or POST `level=debug`
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"runtime"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+// A Collector writes its metrics in the Prometheus text format.
+type Collector interface {
+	WritePrometheus(w io.Writer) error
+}
+
+type CollectorFunc func(w io.Writer) error
+
+func (f CollectorFunc) WritePrometheus(w io.Writer) error { return f(w) }
+
+// Admin is the configuration of the admin server.
+type Admin struct {
+	// The address the admin server listens on.
+	Addr net.Addr
+
+	// The collectors of the /metrics endpoint, besides the runtime metrics.
+	Collectors []Collector
+}
+
+var _ = (core.Admin)((*Admin)(nil))
+
+func NewAdmin(addr net.Addr, collectors ...Collector) *Admin {
+	return &Admin{Addr: addr, Collectors: collectors}
+}
+
+func (a *Admin) AdminServer(b *core.ServerBuilder, server core.Server, service core.Service) (core.Server, error) {
+	if a.Addr == nil {
+		return nil, &core.FieldError{Field: "Addr", Err: fmt.Errorf("missing address")}
+	}
+
+	return &adminServer{
+		Server: &http.Server{
+			Addr:    a.Addr.String(),
+			Handler: a.Handler(b, server, service),
+		},
+	}, nil
+}
+
+// Return the handler of the admin endpoints for the built server and its unfiltered service.
+func (a *Admin) Handler(b *core.ServerBuilder, server core.Server, service core.Service) http.Handler {
+	h := &handler{a, b, server, service, time.Now()}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/metrics", h.metrics)
+	mux.HandleFunc("/services", h.services)
+	mux.HandleFunc("/connections", h.connections)
+	mux.HandleFunc("/config", h.config)
+	mux.HandleFunc("/loglevel", h.logLevel)
+
+	return mux
+}
+
+type adminServer struct {
+	*http.Server
+}
+
+func (s *adminServer) Serve(ctxt context.Context) error {
+	done := make(chan error, 1)
+
+	go func() { done <- s.ListenAndServe() }()
+
+	select {
+	case err := <-done:
+		core.Errorf("admin server stopped, %s", err)
+
+		return err
+	case <-ctxt.Done():
+		s.Shutdown(context.Background())
+
+		return ctxt.Err()
+	}
+}
+
+type handler struct {
+	*Admin
+
+	builder *core.ServerBuilder
+	server  core.Server
+	service core.Service
+	started time.Time
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func (h *handler) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	h.writeRuntimeMetrics(w)
+
+	for _, c := range h.Collectors {
+		if err := c.WritePrometheus(w); err != nil {
+			core.Warnf("fail to collect metrics, %s", err)
+		}
+	}
+}
+
+func (h *handler) writeRuntimeMetrics(w io.Writer) {
+	var stats runtime.MemStats
+
+	runtime.ReadMemStats(&stats)
+
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	counter := func(name, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %v\n", name, help, name, name, value)
+	}
+
+	gauge("go_goroutines", "Number of goroutines that currently exist.", runtime.NumGoroutine())
+	gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", stats.Alloc)
+	gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", stats.HeapInuse)
+	gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", stats.Sys)
+	counter("go_memstats_mallocs_total", "Total number of mallocs.", stats.Mallocs)
+	counter("go_gc_cycles_total", "Number of completed GC cycles.", stats.NumGC)
+	gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", h.started.Unix())
+
+	if lister, ok := h.server.(core.ConnectionLister); ok {
+		gauge("bucky_server_connections", "Number of active connections.", len(lister.Connections()))
+	}
+}
+
+// A ServiceInfo describes a registered service and its methods.
+type ServiceInfo struct {
+	Name    string        `json:"name"`
+	Methods []*MethodInfo `json:"methods"`
+}
+
+type MethodInfo struct {
+	Name string   `json:"name"`
+	In   []string `json:"in"`
+	Out  []string `json:"out"`
+}
+
+func typeNames(types []reflect.Type) []string {
+	names := make([]string, len(types))
+
+	for i, t := range types {
+		names[i] = t.String()
+	}
+
+	return names
+}
+
+// Return the services described by the rpc metadata of a service, or the services served by its catalog.
+func Services(name string, service core.Service) []*ServiceInfo {
+	_, isCatalog := rpc.CatalogOf(service)
+
+	services := []*ServiceInfo{}
+
+	for _, metadata := range rpc.ServicesOf(service) {
+		info := &ServiceInfo{Name: metadata.Name()}
+
+		if name != "" && !isCatalog {
+			info.Name = name
+		}
+
+		for _, m := range metadata.Methods() {
+			info.Methods = append(info.Methods, &MethodInfo{m.Name, typeNames(m.In), typeNames(m.Out)})
+		}
+
+		services = append(services, info)
+	}
+
+	return services
+}
+
+func (h *handler) services(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, Services(h.builder.Name, h.service))
+}
+
+func (h *handler) connections(w http.ResponseWriter, r *http.Request) {
+	conns := []*core.Connection{}
+
+	if lister, ok := h.server.(core.ConnectionLister); ok {
+		conns = lister.Connections()
+	}
+
+	writeJson(w, http.StatusOK, conns)
+}
+
+// The Config reported by the admin server, without the secrets of the builder.
+type Config struct {
+	Name          string   `json:"name"`
+	Network       string   `json:"network,omitempty"`
+	Addr          string   `json:"addr,omitempty"`
+	Backlog       int      `json:"backlog,omitempty"`
+	Daemon        bool     `json:"daemon,omitempty"`
+	Codec         string   `json:"codec"`
+	Encoding      string   `json:"encoding,omitempty"`
+	TLS           bool     `json:"tls"`
+	CertFile      string   `json:"cert_file,omitempty"`
+	Filters       []string `json:"filters,omitempty"`
+	ShutdownDelay string   `json:"shutdown_delay,omitempty"`
+	LogLevel      string   `json:"log_level"`
+}
+
+func ConfigOf(b *core.ServerBuilder) *Config {
+	cfg := &Config{
+		Name:     b.Name,
+		Backlog:  b.Backlog,
+		Daemon:   b.Daemon,
+		Codec:    fmt.Sprintf("%T", b.Codec),
+		TLS:      b.TLSConfig != nil,
+		CertFile: b.CertFile,
+		LogLevel: core.LogLevel().String(),
+	}
+
+	if b.Addr != nil {
+		cfg.Network, cfg.Addr = b.Addr.Network(), b.Addr.String()
+	}
+
+	if b.Encoding != nil {
+		cfg.Encoding = b.Encoding.ContentType()
+	}
+
+	for _, f := range b.Filters {
+		cfg.Filters = append(cfg.Filters, fmt.Sprintf("%T", f))
+	}
+
+	if b.ShutdownDelay > 0 {
+		cfg.ShutdownDelay = b.ShutdownDelay.String()
+	}
+
+	return cfg
+}
+
+func (h *handler) config(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, ConfigOf(h.builder))
+}
+
+func (h *handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "PUT", "POST":
+		level, err := core.ParseLevel(r.FormValue("level"))
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		core.Infof("change log level from %s to %s", core.LogLevel(), level)
+
+		core.SetLogLevel(level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]core.Level{"level": core.LogLevel()})
+}
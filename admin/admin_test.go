@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/transport"
+)
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return s }
+
+func get(uri string) (int, string) {
+	for i := 0; i < 100; i++ {
+		res, err := http.Get(uri)
+
+		if err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		defer res.Body.Close()
+
+		body, _ := ioutil.ReadAll(res.Body)
+
+		return res.StatusCode, string(body)
+	}
+
+	return 0, ""
+}
+
+func TestAdmin(t *testing.T) {
+	Convey("serve the admin endpoints with a server", t, func() {
+		var b *core.ServerBuilder
+
+		ctxt, cancel := context.WithCancel(context.Background())
+
+		addrs, done, err := testutil.ServeAll(ctxt, 2, func(addrs []*net.TCPAddr) core.Server {
+			b = &core.ServerBuilder{
+				Name:         "echo",
+				Addr:         addrs[0],
+				CodecFactory: transport.TcpCodec,
+				Admin: NewAdmin(addrs[1], CollectorFunc(func(w io.Writer) error {
+					_, err := io.WriteString(w, "echo_custom 1\n")
+
+					return err
+				})),
+			}
+
+			server, err := b.BuildE(rpc.NativeFactory.Build(echoService{}))
+
+			So(err, ShouldBeNil)
+
+			return server
+		})
+
+		So(err, ShouldBeNil)
+
+		addr, base := addrs[0], "http://"+addrs[1].String()
+
+		code, body := get(base + "/services")
+
+		So(code, ShouldEqual, http.StatusOK)
+
+		var services []*ServiceInfo
+
+		So(json.Unmarshal([]byte(body), &services), ShouldBeNil)
+		So(services, ShouldResemble, []*ServiceInfo{
+			{"echo", []*MethodInfo{{"Echo", []string{"string"}, []string{"string"}}}},
+		})
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: transport.TcpCodec}).Build()
+
+		_, err = client.Apply(context.Background(), &core.Call{Method: "Echo", Args: []interface{}{"hello"}}).Get()
+
+		So(err, ShouldBeNil)
+
+		Convey("list the connections", func() {
+			_, body := get(base + "/connections")
+
+			var conns []*core.Connection
+
+			So(json.Unmarshal([]byte(body), &conns), ShouldBeNil)
+			So(conns, ShouldHaveLength, 1)
+			So(conns[0].LocalAddr, ShouldEqual, addr.String())
+		})
+
+		Convey("expose the metrics", func() {
+			code, body := get(base + "/metrics")
+
+			So(code, ShouldEqual, http.StatusOK)
+			So(body, ShouldContainSubstring, "\ngo_goroutines ")
+			So(body, ShouldContainSubstring, "\nbucky_server_connections 1\n")
+			So(body, ShouldEndWith, "echo_custom 1\n")
+		})
+
+		Convey("report the configuration", func() {
+			_, body := get(base + "/config")
+
+			var cfg Config
+
+			So(json.Unmarshal([]byte(body), &cfg), ShouldBeNil)
+			So(cfg.Name, ShouldEqual, "echo")
+			So(cfg.Addr, ShouldEqual, b.Addr.String())
+			So(cfg.TLS, ShouldBeFalse)
+		})
+
+		Convey("serve the profiles and variables", func() {
+			code, _ := get(base + "/debug/pprof/")
+
+			So(code, ShouldEqual, http.StatusOK)
+
+			code, body := get(base + "/debug/vars")
+
+			So(code, ShouldEqual, http.StatusOK)
+			So(body, ShouldContainSubstring, "memstats")
+		})
+
+		Convey("switch the log level", func() {
+			defer core.SetLogLevel(core.LogLevel())
+
+			res, err := http.Post(base+"/loglevel", "application/x-www-form-urlencoded", strings.NewReader("level=debug"))
+
+			So(err, ShouldBeNil)
+			res.Body.Close()
+			So(res.StatusCode, ShouldEqual, http.StatusOK)
+			So(core.LogLevel(), ShouldEqual, core.LevelDebug)
+
+			res, err = http.Post(base+"/loglevel", "application/x-www-form-urlencoded", strings.NewReader("level=verbose"))
+
+			So(err, ShouldBeNil)
+			res.Body.Close()
+			So(res.StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Reset(func() {
+			cancel()
+
+			So(<-done, ShouldEqual, context.Canceled)
+		})
+	})
+
+	Convey("build an admin server without address", t, func() {
+		_, err := (&core.ServerBuilder{
+			Name:         "echo",
+			Addr:         &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			CodecFactory: transport.TcpCodec,
+			Admin:        &Admin{},
+		}).BuildE(rpc.NativeFactory.Build(echoService{}))
+
+		So(err.Error(), ShouldEqual, "Admin: Addr: missing address")
+	})
+}
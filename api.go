@@ -2,7 +2,9 @@ package bucky
 
 import (
 	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/grpc"
 	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/jsonrpc"
 	"github.com/flier/bucky/rpc"
 	"github.com/flier/bucky/transport"
 )
@@ -17,17 +19,44 @@ func (b *ServerBuilder) Build(service Service) Server {
 	return ((*core.ServerBuilder)(b)).Build(service)
 }
 
+func (b *ServerBuilder) BuildE(service Service) (Server, error) {
+	return ((*core.ServerBuilder)(b)).BuildE(service)
+}
+
+func (b *ServerBuilder) Validate() error {
+	return ((*core.ServerBuilder)(b)).Validate()
+}
+
+type ClientBuilder core.ClientBuilder
+
+func (b *ClientBuilder) Build() Service {
+	return ((*core.ClientBuilder)(b)).Build()
+}
+
+func (b *ClientBuilder) BuildE() (Service, error) {
+	return ((*core.ClientBuilder)(b)).BuildE()
+}
+
+func (b *ClientBuilder) Validate() error {
+	return ((*core.ClientBuilder)(b)).Validate()
+}
+
 var (
 	Http = http.HttpCodec
 	Tcp  = transport.TcpCodec
 	Udp  = transport.UdpCodec
 	Unix = transport.UnixCodec
 
+	JsonRpcHttp = jsonrpc.HttpCodec
+	JsonRpcTcp  = jsonrpc.TcpCodec
+	Grpc        = grpc.GrpcCodec
+
 	Json       = core.JsonEncoding
 	JsonPretty = core.JsonPrettyEncoding
 	Xml        = core.XmlEncoding
 	XmlPretty  = core.XmlPrettyEncoding
 	Yaml       = core.YamlEncoding
+	Protobuf   = core.ProtobufEncoding
 )
 
 func Rpc(v interface{}) core.Service {
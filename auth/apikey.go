@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	DefaultAPIKeyHeader = "x-api-key"
+)
+
+// An APIKeyAuthenticator authenticates the calls carrying a known API key.
+type APIKeyAuthenticator struct {
+	// The header of the key, x-api-key by default.
+	Header string
+
+	// The principals by API key.
+	Keys map[string]*Principal
+}
+
+var _ = (Authenticator)((*APIKeyAuthenticator)(nil))
+
+func NewAPIKeyAuthenticator(keys map[string]*Principal) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Header: DefaultAPIKeyHeader, Keys: keys}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctxt context.Context, h core.Header) (*Principal, error) {
+	header := a.Header
+
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	key := h.Get(header)
+
+	if key == "" {
+		return nil, nil
+	}
+
+	var found *Principal
+
+	// compare every key in constant time, not to leak which one is closer
+	for k, p := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = p
+		}
+	}
+
+	if found == nil {
+		return nil, core.NewStatus(core.CodeUnauthenticated, "invalid API key")
+	}
+
+	principal := *found
+	principal.Method = "apikey"
+
+	return &principal, nil
+}
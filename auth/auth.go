@@ -0,0 +1,134 @@
+// Package auth authenticates the calls served by a service,
+// and attaches the credentials to the calls sent by a client.
+package auth
+
+import (
+	"strings"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	PrincipalKey = "auth.principal"
+
+	AuthorizationHeader = "authorization"
+)
+
+var (
+	ErrMissingCredentials = core.NewStatus(core.CodeUnauthenticated, "missing credentials")
+)
+
+// A Principal is the authenticated identity of the caller.
+type Principal struct {
+	// The name of the caller, such as a user name, the subject of a token or of a certificate.
+	Name string `json:"name" yaml:"name"`
+
+	// How the caller was authenticated, such as apikey, basic, jwt or mtls.
+	Method string `json:"method" yaml:"method"`
+
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+
+	// The claims of a token, or the attributes of the caller.
+	Claims map[string]interface{} `json:"claims,omitempty" yaml:"claims,omitempty"`
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the principal of the call, or nil if it wasn't authenticated.
+func PrincipalOf(ctxt context.Context) *Principal {
+	p, _ := ctxt.Value(PrincipalKey).(*Principal)
+
+	return p
+}
+
+func WithPrincipal(ctxt context.Context, p *Principal) context.Context {
+	return context.WithValue(ctxt, PrincipalKey, p)
+}
+
+// An Authenticator checks the credentials of an incoming call.
+//
+// It returns nil without error when the call doesn't carry its kind of credentials,
+// so that the next authenticator is tried.
+type Authenticator interface {
+	Authenticate(ctxt context.Context, h core.Header) (*Principal, error)
+}
+
+type AuthenticatorFunc func(ctxt context.Context, h core.Header) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctxt context.Context, h core.Header) (*Principal, error) {
+	return f(ctxt, h)
+}
+
+// An AuthFilter authenticates the served calls with the first authenticator accepting their credentials,
+// and rejects them with UNAUTHENTICATED otherwise.
+type AuthFilter struct {
+	Authenticators []Authenticator
+
+	// Serve the calls without credentials, without principal.
+	Optional bool
+
+	// Serve the methods without authentication, such as the health checks.
+	Skip func(method string) bool
+}
+
+var _ = (core.Filter)((*AuthFilter)(nil))
+
+func NewAuthFilter(authenticators ...Authenticator) *AuthFilter {
+	return &AuthFilter{Authenticators: authenticators}
+}
+
+func (f *AuthFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	if f.Skip != nil && f.Skip(core.MethodOf(req)) {
+		return service.Apply(ctxt, req)
+	}
+
+	h := core.IncomingHeader(ctxt)
+
+	if h == nil {
+		h = make(core.Header)
+	}
+
+	for _, a := range f.Authenticators {
+		principal, err := a.Authenticate(ctxt, h)
+
+		if err != nil {
+			if _, ok := err.(*core.Status); !ok {
+				err = core.NewStatus(core.CodeUnauthenticated, "%s", err)
+			}
+
+			return core.Rejected(err)
+		}
+
+		if principal != nil {
+			return service.Apply(WithPrincipal(ctxt, principal), req)
+		}
+	}
+
+	if f.Optional {
+		return service.Apply(ctxt, req)
+	}
+
+	return core.Rejected(ErrMissingCredentials)
+}
+
+// Return the credentials of the Authorization header with the given scheme, such as Basic or Bearer.
+func credentials(h core.Header, scheme string) (string, bool) {
+	value := h.Get(AuthorizationHeader)
+
+	if len(value) <= len(scheme) || !strings.EqualFold(value[:len(scheme)], scheme) || value[len(scheme)] != ' ' {
+		return "", false
+	}
+
+	return strings.TrimSpace(value[len(scheme)+1:]), true
+}
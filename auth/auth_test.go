@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/transport"
+)
+
+func header(kv ...string) core.Header {
+	h := make(core.Header)
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+
+	return h
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	Convey("authenticate with an API key", t, func() {
+		a := NewAPIKeyAuthenticator(map[string]*Principal{"secret": {Name: "alice", Roles: []string{"admin"}}})
+
+		p, err := a.Authenticate(context.Background(), header("X-Api-Key", "secret"))
+
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, &Principal{Name: "alice", Method: "apikey", Roles: []string{"admin"}})
+		So(p.HasRole("admin"), ShouldBeTrue)
+
+		p, err = a.Authenticate(context.Background(), header())
+
+		So(p, ShouldBeNil)
+		So(err, ShouldBeNil)
+
+		_, err = a.Authenticate(context.Background(), header("X-Api-Key", "guess"))
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+	})
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	Convey("authenticate with HTTP Basic credentials", t, func() {
+		a := NewBasicAuthenticator(map[string]string{"alice": "wonderland"})
+
+		basic := func(s string) core.Header {
+			return header("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(s)))
+		}
+
+		p, err := a.Authenticate(context.Background(), basic("alice:wonderland"))
+
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, &Principal{Name: "alice", Method: "basic"})
+
+		_, err = a.Authenticate(context.Background(), basic("alice:guess"))
+
+		So(err.Error(), ShouldEqual, "rpc error: code = UNAUTHENTICATED desc = invalid user or password")
+
+		_, err = a.Authenticate(context.Background(), basic("bob:"))
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+
+		_, err = a.Authenticate(context.Background(), basic("alice"))
+
+		So(err.Error(), ShouldEqual, "rpc error: code = UNAUTHENTICATED desc = malformed basic credentials")
+
+		p, err = a.Authenticate(context.Background(), header("Authorization", "Bearer token"))
+
+		So(p, ShouldBeNil)
+		So(err, ShouldBeNil)
+
+		a.Verify = func(user, password string) (*Principal, bool) { return nil, true }
+
+		_, err = a.Authenticate(context.Background(), basic("alice:wonderland"))
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+	})
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	Convey("authenticate with a JWT", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+
+		So(err, ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "auth")
+
+		So(err, ShouldBeNil)
+
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "jwks.json")
+
+		So(ioutil.WriteFile(path, []byte(`{"keys": [
+			{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": "`+base64.RawURLEncoding.EncodeToString([]byte("secret"))+`"},
+			{"kty": "RSA", "kid": "rsa", "n": "`+base64.RawURLEncoding.EncodeToString(key.N.Bytes())+`", "e": "AQAB"}
+		]}`), 0644), ShouldBeNil)
+
+		keys, err := LoadKeySet(path)
+
+		So(err, ShouldBeNil)
+
+		a := NewJWTAuthenticator(keys)
+		a.Issuer = "bucky"
+		a.Audience = "echo"
+
+		claims := func(extra ...interface{}) map[string]interface{} {
+			c := map[string]interface{}{"sub": "alice", "iss": "bucky", "aud": []string{"echo"}, "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"reader"}}
+
+			for i := 0; i+1 < len(extra); i += 2 {
+				c[extra[i].(string)] = extra[i+1]
+			}
+
+			return c
+		}
+
+		bearer := func(token string, err error) core.Header {
+			if err != nil {
+				panic(err)
+			}
+
+			return header("Authorization", "Bearer "+token)
+		}
+
+		p, err := a.Authenticate(context.Background(), bearer(SignHS256(claims(), "hmac", []byte("secret"))))
+
+		So(err, ShouldBeNil)
+		So(p.Name, ShouldEqual, "alice")
+		So(p.Method, ShouldEqual, "jwt")
+		So(p.Roles, ShouldResemble, []string{"reader"})
+
+		p, err = a.Authenticate(context.Background(), bearer(SignRS256(claims(), "rsa", key)))
+
+		So(err, ShouldBeNil)
+		So(p.Name, ShouldEqual, "alice")
+
+		_, err = a.Authenticate(context.Background(), header("Authorization", "Bearer garbage"))
+
+		So(err.Error(), ShouldEndWith, "malformed token")
+
+		for _, c := range []struct {
+			header core.Header
+			msg    string
+		}{
+			{bearer(SignHS256(claims(), "hmac", []byte("guess"))), "bad signature"},
+			{bearer(SignHS256(claims(), "rsa", []byte("secret"))), "bad signature"},
+			{bearer(SignHS256(claims("exp", time.Now().Add(-time.Hour).Unix()), "hmac", []byte("secret"))), "token expired"},
+			{bearer(SignHS256(claims("nbf", time.Now().Add(time.Hour).Unix()), "hmac", []byte("secret"))), "token not valid yet"},
+			{bearer(SignHS256(claims("iss", "other"), "hmac", []byte("secret"))), "unexpected issuer"},
+			{bearer(SignHS256(claims("aud", "other"), "hmac", []byte("secret"))), "unexpected audience"},
+		} {
+			_, err := a.Authenticate(context.Background(), c.header)
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+			So(err.Error(), ShouldEndWith, c.msg)
+		}
+
+		Convey("parse a malformed JWKS", func() {
+			_, err := ParseKeySet([]byte(`{"keys": [{"kty": "EC"}]}`))
+
+			So(err.Error(), ShouldEqual, "key 0: unsupported key type `EC`")
+		})
+	})
+}
+
+func TestMTLSAuthenticator(t *testing.T) {
+	Convey("authenticate with a client certificate", t, func() {
+		cert := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "echo-client"}, DNSNames: []string{"client.echo.svc"}}
+
+		withTLS := func(state *tls.ConnectionState) context.Context {
+			return core.WithIncomingCallInfo(context.Background(), &core.CallInfo{TLS: state})
+		}
+
+		a := NewMTLSAuthenticator()
+
+		p, err := a.Authenticate(withTLS(&tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}), header())
+
+		So(err, ShouldBeNil)
+		So(p.Name, ShouldEqual, "client.echo.svc")
+		So(p.Method, ShouldEqual, "mtls")
+
+		_, err = a.Authenticate(withTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}), header())
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+
+		p, err = a.Authenticate(withTLS(nil), header())
+
+		So(p, ShouldBeNil)
+		So(err, ShouldBeNil)
+
+		a.Identify = func(cert *x509.Certificate) (*Principal, error) { return nil, nil }
+
+		_, err = a.Authenticate(withTLS(&tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}), header())
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+	})
+}
+
+func TestAuthFilter(t *testing.T) {
+	Convey("authenticate the calls served over TCP", t, func() {
+		whoami := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+			if p := PrincipalOf(ctxt); p != nil {
+				return core.Resolved(p.Name)
+			}
+
+			return core.Resolved("anonymous")
+		})
+
+		f := NewAuthFilter(
+			NewAPIKeyAuthenticator(map[string]*Principal{"secret": {Name: "alice"}}),
+			NewBasicAuthenticator(map[string]string{"bob": "builder"}),
+		)
+
+		f.Skip = func(method string) bool { return method == "healthz" }
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{
+				Name:         "whoami",
+				Addr:         addr,
+				CodecFactory: transport.TcpCodec,
+				Filters:      []core.Filter{f},
+			}).Build(whoami)
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		call := func(method string, filters ...core.Filter) (interface{}, error) {
+			client := (&core.ClientBuilder{Uri: uri, CodecFactory: transport.TcpCodec, Filters: filters}).Build()
+
+			for i := 0; ; i++ {
+				result, err := client.Apply(ctxt, &core.Call{Method: method}).Get()
+
+				if core.CodeOf(err) != core.CodeUnavailable || i == 100 {
+					return result, err
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		result, err := call("whoami", APIKeyCredentials("secret"))
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "alice")
+
+		result, err = call("whoami", BasicCredentials("bob", "builder"))
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "bob")
+
+		_, err = call("whoami", BasicCredentials("bob", "guess"))
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnauthenticated)
+
+		_, err = call("whoami")
+
+		So(err, ShouldResemble, ErrMissingCredentials)
+
+		result, err = call("healthz")
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "anonymous")
+	})
+}
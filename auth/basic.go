@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A BasicAuthenticator authenticates the calls carrying HTTP Basic credentials.
+type BasicAuthenticator struct {
+	// Check the password of a user, and return its principal.
+	Verify func(user, password string) (*Principal, bool)
+}
+
+var _ = (Authenticator)((*BasicAuthenticator)(nil))
+
+// Return an authenticator checking the passwords of the users.
+func NewBasicAuthenticator(passwords map[string]string) *BasicAuthenticator {
+	return &BasicAuthenticator{func(user, password string) (*Principal, bool) {
+		expected, ok := passwords[user]
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 || !ok {
+			return nil, false
+		}
+
+		return &Principal{Name: user}, true
+	}}
+}
+
+func (a *BasicAuthenticator) Authenticate(ctxt context.Context, h core.Header) (*Principal, error) {
+	encoded, ok := credentials(h, "Basic")
+
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnauthenticated, "malformed basic credentials")
+	}
+
+	i := strings.IndexByte(string(data), ':')
+
+	if i < 0 {
+		return nil, core.NewStatus(core.CodeUnauthenticated, "malformed basic credentials")
+	}
+
+	found, ok := a.Verify(string(data[:i]), string(data[i+1:]))
+
+	if !ok || found == nil {
+		return nil, core.NewStatus(core.CodeUnauthenticated, "invalid user or password")
+	}
+
+	principal := *found
+	principal.Method = "basic"
+
+	return &principal, nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"encoding/base64"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// Return a client filter attaching the header returned by the function to the calls.
+func credentialsFilter(key string, value func() (string, error)) core.Filter {
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		v, err := value()
+
+		if err != nil {
+			return core.Rejected(core.NewStatus(core.CodeUnauthenticated, "fail to get credentials, %s", err))
+		}
+
+		return service.Apply(core.AppendOutgoingHeader(ctxt, key, v), req)
+	})
+}
+
+// Return a client filter attaching the API key to the calls, in the x-api-key header.
+func APIKeyCredentials(key string) core.Filter {
+	return credentialsFilter(DefaultAPIKeyHeader, func() (string, error) { return key, nil })
+}
+
+// Return a client filter attaching the HTTP Basic credentials to the calls.
+func BasicCredentials(user, password string) core.Filter {
+	encoded := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+
+	return credentialsFilter(AuthorizationHeader, func() (string, error) { return encoded, nil })
+}
+
+// Return a client filter attaching the bearer token returned by the source to the calls,
+// for example a token refreshed before it expires.
+func BearerCredentials(source func() (string, error)) core.Filter {
+	return credentialsFilter(AuthorizationHeader, func() (string, error) {
+		token, err := source()
+
+		return "Bearer " + token, err
+	})
+}
+
+// Return a client filter attaching the token to the calls.
+func TokenCredentials(token string) core.Filter {
+	return BearerCredentials(func() (string, error) { return token, nil })
+}
@@ -0,0 +1,597 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// An Expr is a condition evaluated against the attributes of a call, such as
+//
+//	principal.name == request.owner && "admin" in principal.roles
+//
+// it supports the literals (strings, numbers, true, false, null and [lists]),
+// the paths of fields and indexes (request.items[0].name), the comparisons (== != < <= > >=),
+// `in` for the membership in lists, maps and strings, and the logical operators (! && ||).
+//
+// A comparison with a missing field is false, unless it's compared with the null literal,
+// so that two missing fields aren't equal.
+type Expr struct {
+	source string
+	root   node
+}
+
+func (e *Expr) String() string { return e.source }
+
+// Evaluate the expression, the missing fields are null.
+func (e *Expr) Eval(env map[string]interface{}) (interface{}, error) {
+	return e.root.eval(env)
+}
+
+// Evaluate the expression as a condition.
+func (e *Expr) Test(env map[string]interface{}) (bool, error) {
+	v, err := e.Eval(env)
+
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+
+	if !ok {
+		return false, fmt.Errorf("condition `%s` is not a boolean", e.source)
+	}
+
+	return b, nil
+}
+
+func ParseExpr(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected `%s` at %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+
+	return &Expr{source, root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ".", ","}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			j := i + 1
+
+			for j < len(s) && rune(s[j]) != c {
+				if s[j] == '\\' {
+					j++
+				}
+
+				j++
+			}
+
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+
+			text := s[i : j+1]
+
+			if c == '\'' {
+				text = `"` + strings.Replace(text[1:len(text)-1], `"`, `\"`, -1) + `"`
+			}
+
+			unquoted, err := strconv.Unquote(text)
+
+			if err != nil {
+				return nil, fmt.Errorf("malformed string at %d", i)
+			}
+
+			tokens = append(tokens, token{tokenString, unquoted, i})
+			i = j + 1
+
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i + 1
+
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+
+			tokens = append(tokens, token{tokenNumber, s[i:j], i})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+
+			tokens = append(tokens, token{tokenIdent, s[i:j], i})
+			i = j
+
+		default:
+			found := false
+
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{tokenOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("unexpected `%c` at %d", c, i)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(kind tokenKind, texts ...string) bool {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != kind {
+		return false
+	}
+
+	for _, text := range texts {
+		if p.tokens[p.pos].text == text {
+			return true
+		}
+	}
+
+	return len(texts) == 0
+}
+
+func (p *parser) expect(text string) error {
+	if !p.peek(tokenOp, text) {
+		if p.pos < len(p.tokens) {
+			return fmt.Errorf("expected `%s` at %d", text, p.tokens[p.pos].pos)
+		}
+
+		return fmt.Errorf("expected `%s` at end", text)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+
+	for err == nil && p.peek(tokenOp, "||") {
+		p.pos++
+
+		var right node
+
+		if right, err = p.parseAnd(); err == nil {
+			left = &logicalNode{"||", left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+
+	for err == nil && p.peek(tokenOp, "&&") {
+		p.pos++
+
+		var right node
+
+		if right, err = p.parseNot(); err == nil {
+			left = &logicalNode{"&&", left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek(tokenOp, "!") {
+		p.pos++
+
+		operand, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(tokenOp, "==", "!=", "<", "<=", ">", ">=") || p.peek(tokenIdent, "in") {
+		op := p.tokens[p.pos].text
+		p.pos++
+
+		right, err := p.parsePrimary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &compareNode{op, left, right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch {
+	case t.kind == tokenString:
+		return &literalNode{t.text}, nil
+
+	case t.kind == tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("malformed number `%s` at %d", t.text, t.pos)
+		}
+
+		return &literalNode{n}, nil
+
+	case t.kind == tokenIdent && (t.text == "true" || t.text == "false"):
+		return &literalNode{t.text == "true"}, nil
+
+	case t.kind == tokenIdent && t.text == "null":
+		return &literalNode{nil}, nil
+
+	case t.kind == tokenIdent:
+		path := &pathNode{steps: []interface{}{t.text}}
+
+		for {
+			switch {
+			case p.peek(tokenOp, "."):
+				p.pos++
+
+				if !p.peek(tokenIdent) {
+					return nil, fmt.Errorf("expected a field name after `%s`", path)
+				}
+
+				path.steps = append(path.steps, p.tokens[p.pos].text)
+				p.pos++
+
+			case p.peek(tokenOp, "["):
+				p.pos++
+
+				index, err := p.parseOr()
+
+				if err != nil {
+					return nil, err
+				}
+
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+
+				path.steps = append(path.steps, index)
+
+			default:
+				return path, nil
+			}
+		}
+
+	case t.kind == tokenOp && t.text == "(":
+		inner, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return inner, p.expect(")")
+
+	case t.kind == tokenOp && t.text == "[":
+		list := &listNode{}
+
+		for !p.peek(tokenOp, "]") {
+			item, err := p.parseOr()
+
+			if err != nil {
+				return nil, err
+			}
+
+			list.items = append(list.items, item)
+
+			if !p.peek(tokenOp, ",") {
+				break
+			}
+
+			p.pos++
+		}
+
+		return list, p.expect("]")
+	}
+
+	return nil, fmt.Errorf("unexpected `%s` at %d", t.text, t.pos)
+}
+
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+func (n *literalNode) eval(env map[string]interface{}) (interface{}, error) { return n.value, nil }
+
+// Is the node the null literal?
+func isNull(n node) bool {
+	literal, ok := n.(*literalNode)
+
+	return ok && literal.value == nil
+}
+
+type listNode struct{ items []node }
+
+func (n *listNode) eval(env map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, len(n.items))
+
+	for i, item := range n.items {
+		v, err := item.eval(env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// A pathNode looks up a field by name or an element by index, its steps are names or index nodes.
+type pathNode struct{ steps []interface{} }
+
+func (n *pathNode) String() string {
+	var parts []string
+
+	for _, step := range n.steps {
+		if name, ok := step.(string); ok {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts, "[...]")
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func (n *pathNode) eval(env map[string]interface{}) (interface{}, error) {
+	var v interface{} = env
+
+	for _, step := range n.steps {
+		key := step
+
+		if index, ok := step.(node); ok {
+			var err error
+
+			if key, err = index.eval(env); err != nil {
+				return nil, err
+			}
+		}
+
+		switch c := v.(type) {
+		case map[string]interface{}:
+			name, ok := key.(string)
+
+			if !ok {
+				return nil, nil
+			}
+
+			v = c[name]
+		case []interface{}:
+			i, ok := key.(float64)
+
+			if !ok || i < 0 || int(i) >= len(c) {
+				return nil, nil
+			}
+
+			v = c[int(i)]
+		default:
+			return nil, nil
+		}
+	}
+
+	return v, nil
+}
+
+type notNode struct{ operand node }
+
+func (n *notNode) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := v.(bool)
+
+	if !ok {
+		return nil, fmt.Errorf("`!` expects a boolean, got %T", v)
+	}
+
+	return !b, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(env map[string]interface{}) (interface{}, error) {
+	for i, operand := range []node{n.left, n.right} {
+		v, err := operand.eval(env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := v.(bool)
+
+		if !ok {
+			return nil, fmt.Errorf("`%s` expects booleans, got %T", n.op, v)
+		}
+
+		// short circuit
+		if i == 0 && b == (n.op == "||") {
+			return b, nil
+		}
+
+		if i == 1 {
+			return b, nil
+		}
+	}
+
+	return false, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := n.right.eval(env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if (left == nil || right == nil) && !isNull(n.left) && !isNull(n.right) {
+		return false, nil
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		switch c := right.(type) {
+		case []interface{}:
+			for _, item := range c {
+				if reflect.DeepEqual(left, item) {
+					return true, nil
+				}
+			}
+		case map[string]interface{}:
+			if key, ok := left.(string); ok {
+				_, found := c[key]
+
+				return found, nil
+			}
+		case string:
+			if s, ok := left.(string); ok {
+				return strings.Contains(c, s), nil
+			}
+		}
+
+		return false, nil
+	}
+
+	var cmp int
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+
+		if !ok {
+			return false, nil
+		}
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+
+		if !ok {
+			return false, nil
+		}
+
+		cmp = strings.Compare(l, r)
+	default:
+		return false, nil
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
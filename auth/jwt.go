@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A JSONWebKey is a key of a JWKS, an oct secret for HS256 or an RSA public key for RS256.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	K   string `json:"k,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+// A KeySet holds the keys verifying the tokens.
+type KeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Parse a JWKS document.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var ks KeySet
+
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("malformed JWKS, %s", err)
+	}
+
+	for i, key := range ks.Keys {
+		switch key.Kty {
+		case "oct":
+			secret, err := decodeSegment(key.K)
+
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("key %d: malformed secret", i)
+			}
+
+			key.secret = secret
+		case "RSA":
+			n, err := decodeSegment(key.N)
+
+			if err != nil {
+				return nil, fmt.Errorf("key %d: malformed modulus", i)
+			}
+
+			e, err := decodeSegment(key.E)
+
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %d: malformed exponent", i)
+			}
+
+			key.publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		default:
+			return nil, fmt.Errorf("key %d: unsupported key type `%s`", i, key.Kty)
+		}
+	}
+
+	return &ks, nil
+}
+
+// Load a JWKS file.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeySet(data)
+}
+
+// Return the keys which may have signed a token with the given algorithm and key ID.
+func (ks *KeySet) lookup(alg, kid string) []*JSONWebKey {
+	var keys []*JSONWebKey
+
+	for _, key := range ks.Keys {
+		if (kid != "" && key.Kid != "" && key.Kid != kid) || (key.Alg != "" && key.Alg != alg) {
+			continue
+		}
+
+		if (alg == "HS256" && key.secret != nil) || (alg == "RS256" && key.publicKey != nil) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// A JWTAuthenticator authenticates the calls carrying a bearer JWT signed with HS256 or RS256.
+type JWTAuthenticator struct {
+	Keys *KeySet
+
+	// The expected issuer and audience of the tokens, if any.
+	Issuer, Audience string
+
+	// The clock skew tolerated when checking the expiration.
+	Leeway time.Duration
+
+	// The claim holding the roles of the principal, `roles` by default.
+	RolesClaim string
+}
+
+var _ = (Authenticator)((*JWTAuthenticator)(nil))
+
+func NewJWTAuthenticator(keys *KeySet) *JWTAuthenticator {
+	return &JWTAuthenticator{Keys: keys, Leeway: time.Minute, RolesClaim: "roles"}
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return core.NewStatus(core.CodeUnauthenticated, "invalid token, "+format, args...)
+}
+
+func (a *JWTAuthenticator) Authenticate(ctxt context.Context, h core.Header) (*Principal, error) {
+	token, ok := credentials(h, "Bearer")
+
+	if !ok {
+		return nil, nil
+	}
+
+	claims, err := a.Verify(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Method: "jwt", Claims: claims}
+
+	principal.Name, _ = claims["sub"].(string)
+
+	rolesClaim := a.RolesClaim
+
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+
+	switch roles := claims[rolesClaim].(type) {
+	case string:
+		principal.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, s)
+			}
+		}
+	}
+
+	return principal, nil
+}
+
+// Verify the signature and the registered claims of a token, and return its claims.
+func (a *JWTAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	data, err := decodeSegment(parts[0])
+
+	if err != nil {
+		return nil, invalidToken("malformed header")
+	}
+
+	var header jwtHeader
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+
+	signature, err := decodeSegment(parts[2])
+
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+
+	if header.Alg != "HS256" && header.Alg != "RS256" {
+		return nil, invalidToken("unsupported algorithm `%s`", header.Alg)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+	verified := false
+
+	for _, key := range a.Keys.lookup(header.Alg, header.Kid) {
+		if key.secret != nil {
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write(signed)
+
+			verified = subtle.ConstantTimeCompare(mac.Sum(nil), signature) == 1
+		} else {
+			verified = rsa.VerifyPKCS1v15(key.publicKey, crypto.SHA256, digest[:], signature) == nil
+		}
+
+		if verified {
+			break
+		}
+	}
+
+	if !verified {
+		return nil, invalidToken("bad signature")
+	}
+
+	if data, err = decodeSegment(parts[1]); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+
+	var claims map[string]interface{}
+
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+
+	if exp, ok := claims["exp"].(float64); ok && now.Add(-a.Leeway).Unix() >= int64(exp) {
+		return invalidToken("token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.Leeway).Unix() < int64(nbf) {
+		return invalidToken("token not valid yet")
+	}
+
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+
+	if a.Audience != "" {
+		found := false
+
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == a.Audience
+		case []interface{}:
+			for _, v := range aud {
+				found = found || v == a.Audience
+			}
+		}
+
+		if !found {
+			return invalidToken("unexpected audience")
+		}
+	}
+
+	return nil
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func sign(alg, kid string, claims map[string]interface{}, signer func(signed []byte) ([]byte, error)) (string, error) {
+	header, err := encodeSegment(&jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := encodeSegment(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer([]byte(header + "." + payload))
+
+	if err != nil {
+		return "", err
+	}
+
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Sign the claims with a HS256 secret.
+func SignHS256(claims map[string]interface{}, kid string, secret []byte) (string, error) {
+	return sign("HS256", kid, claims, func(signed []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+
+		return mac.Sum(nil), nil
+	})
+}
+
+// Sign the claims with a RS256 private key.
+func SignRS256(claims map[string]interface{}, kid string, key *rsa.PrivateKey) (string, error) {
+	return sign("RS256", kid, claims, func(signed []byte) ([]byte, error) {
+		digest := sha256.Sum256(signed)
+
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	})
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/x509"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// An MTLSAuthenticator identifies the callers by their verified client certificate,
+// the server must require them with tls.RequireAndVerifyClientCert.
+type MTLSAuthenticator struct {
+	// Return the principal of a certificate, named after its first URI SAN, such as a SPIFFE ID,
+	// its first DNS SAN or its common name by default.
+	Identify func(cert *x509.Certificate) (*Principal, error)
+}
+
+var _ = (Authenticator)((*MTLSAuthenticator)(nil))
+
+func NewMTLSAuthenticator() *MTLSAuthenticator {
+	return &MTLSAuthenticator{}
+}
+
+// Return the name of a certificate.
+func IdentityOf(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	default:
+		return cert.Subject.CommonName
+	}
+}
+
+func (a *MTLSAuthenticator) Authenticate(ctxt context.Context, h core.Header) (*Principal, error) {
+	info, ok := core.IncomingCallInfo(ctxt)
+
+	if !ok || info.TLS == nil || len(info.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	if len(info.TLS.VerifiedChains) == 0 {
+		return nil, core.NewStatus(core.CodeUnauthenticated, "unverified client certificate")
+	}
+
+	cert := info.TLS.VerifiedChains[0][0]
+
+	if a.Identify != nil {
+		found, err := a.Identify(cert)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found == nil {
+			return nil, core.NewStatus(core.CodeUnauthenticated, "unknown client certificate")
+		}
+
+		principal := *found
+		principal.Method = "mtls"
+
+		return &principal, nil
+	}
+
+	return &Principal{
+		Name:   IdentityOf(cert),
+		Method: "mtls",
+		Claims: map[string]interface{}{"subject": cert.Subject.String(), "issuer": cert.Issuer.String()},
+	}, nil
+}
@@ -0,0 +1,468 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+const (
+	// The role of the calls without principal.
+	AnonymousRole = "anonymous"
+)
+
+// A Permission allows to call the methods matching a pattern, such as `stringsvc.Get*` or `*`,
+// optionally when a condition on the call holds.
+//
+// It is written as a pattern, or as a mapping with the pattern and its condition.
+//
+//	permissions:
+//	  - stringsvc.Count
+//	  - method: stringsvc.Uppercase
+//	    when: principal.name == request.owner
+type Permission struct {
+	Method string `yaml:"method"`
+	When   string `yaml:"when,omitempty"`
+
+	condition *Expr
+}
+
+func (p *Permission) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&p.Method); err == nil {
+		return nil
+	}
+
+	type permission Permission
+
+	return unmarshal((*permission)(p))
+}
+
+// Does the permission match the method, named `service.Method`?
+func (p *Permission) Matches(method string) bool {
+	if p.Method == "*" {
+		return true
+	}
+
+	matched, _ := path.Match(strings.ToLower(p.Method), strings.ToLower(method))
+
+	return matched
+}
+
+// A Role is a set of permissions, and of the permissions of the roles it inherits.
+type Role struct {
+	Inherits    []string      `yaml:"inherits,omitempty"`
+	Permissions []*Permission `yaml:"permissions"`
+}
+
+// A Policy grants the roles of the principals the permission to call methods, the others are denied,
+// everyone has the permissions of the anonymous role.
+//
+//	roles:
+//	  reader:
+//	    permissions: [stringsvc.Count, "stringsvc.Get*"]
+//	  writer:
+//	    inherits: [reader]
+//	    permissions:
+//	      - method: stringsvc.Uppercase
+//	        when: request != "" && principal.name in ["alice", "bob"]
+//	  anonymous:
+//	    permissions: [stringsvc.Version]
+//
+// The conditions are evaluated with
+//
+//	principal  the name, method, roles and claims of the principal, null for an anonymous call
+//	service    the name of the service
+//	method     the name of the method
+//	request    the argument of a method with a single parameter, or the arguments otherwise
+//	args       the arguments
+type Policy struct {
+	Roles map[string]*Role `yaml:"roles"`
+}
+
+// Parse a YAML policy, and compile its conditions.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("malformed policy, %s", err)
+	}
+
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Load a YAML policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicy(data)
+}
+
+// Check the roles and compile the conditions of the policy.
+func (p *Policy) Compile() error {
+	var errs core.MultiError
+
+	names := make([]string, 0, len(p.Roles))
+
+	for name := range p.Roles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		role := p.Roles[name]
+
+		if role == nil {
+			p.Roles[name] = &Role{}
+			continue
+		}
+
+		for _, parent := range role.Inherits {
+			if _, ok := p.Roles[parent]; !ok {
+				errs.Add("roles."+name, "inherits unknown role `%s`", parent)
+			}
+		}
+
+		for i, perm := range role.Permissions {
+			if perm.Method == "" {
+				errs.Add(fmt.Sprintf("roles.%s.permissions.%d", name, i), "missing method")
+			}
+
+			if perm.When == "" {
+				continue
+			}
+
+			expr, err := ParseExpr(perm.When)
+
+			if err != nil {
+				errs.Add(fmt.Sprintf("roles.%s.permissions.%d", name, i), "invalid condition, %s", err)
+			} else {
+				perm.condition = expr
+			}
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// Return the permissions of the roles, and of the roles they inherit.
+func (p *Policy) permissions(roles []string) []*Permission {
+	var perms []*Permission
+
+	seen := make(map[string]bool)
+
+	for len(roles) > 0 {
+		name := roles[0]
+		roles = roles[1:]
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		if role := p.Roles[name]; role != nil {
+			perms = append(perms, role.Permissions...)
+			roles = append(roles, role.Inherits...)
+		}
+	}
+
+	return perms
+}
+
+// A Decision is the outcome of the authorization of a call.
+type Decision struct {
+	Principal *Principal
+	Service   string
+	Method    string
+	Allowed   bool
+	Reason    string
+}
+
+// Decide whether the principal may call the method, the attributes are evaluated lazily by the conditions.
+func (p *Policy) Decide(principal *Principal, service, method string, attrs func() (map[string]interface{}, error)) *Decision {
+	d := &Decision{Principal: principal, Service: service, Method: method}
+
+	roles := []string{AnonymousRole}
+
+	if principal != nil {
+		roles = append(append([]string(nil), principal.Roles...), AnonymousRole)
+	}
+
+	name := service + "." + method
+
+	var env map[string]interface{}
+
+	for _, perm := range p.permissions(roles) {
+		if !perm.Matches(name) {
+			continue
+		}
+
+		if perm.condition == nil {
+			d.Allowed = true
+
+			return d
+		}
+
+		if env == nil {
+			var err error
+
+			if env, err = attrs(); err != nil {
+				d.Reason = err.Error()
+
+				return d
+			}
+		}
+
+		allowed, err := perm.condition.Test(env)
+
+		// the other permissions, such as the ones of another role, may still allow the call
+		if err != nil {
+			d.Reason = err.Error()
+
+			continue
+		}
+
+		if allowed {
+			d.Allowed = true
+
+			return d
+		}
+
+		d.Reason = fmt.Sprintf("condition `%s` doesn't hold", perm.When)
+	}
+
+	if d.Reason == "" {
+		d.Reason = fmt.Sprintf("no permission to call %s", name)
+	}
+
+	return d
+}
+
+// A PolicyFilter authorizes the served calls, after their principal was authenticated.
+type PolicyFilter struct {
+	Policy *Policy
+
+	// The name of the service when the calls don't carry it.
+	Service string
+
+	// The metadata of the service, to canonicalize the method names and decode the arguments,
+	// the one attached to the context or the one of the filtered service is used otherwise.
+	Metadata rpc.Metadata
+
+	// Called with the denied calls.
+	Audit func(ctxt context.Context, decision *Decision)
+}
+
+var _ = (core.Filter)((*PolicyFilter)(nil))
+
+func NewPolicyFilter(policy *Policy, metadata rpc.Metadata) *PolicyFilter {
+	return &PolicyFilter{Policy: policy, Metadata: metadata}
+}
+
+func (f *PolicyFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	metadata, m, ok := resolveMethod(ctxt, f.Metadata, service, call.Method)
+
+	name, method := call.Service, call.Method
+
+	if name == "" {
+		name = f.Service
+	}
+
+	if metadata != nil && name == "" {
+		name = metadata.Name()
+	}
+
+	if ok {
+		method = m.Name
+	}
+
+	principal := PrincipalOf(ctxt)
+
+	d := f.Policy.Decide(principal, name, method, func() (map[string]interface{}, error) {
+		return attributesOf(principal, name, method, call, m)
+	})
+
+	if d.Allowed {
+		return service.Apply(ctxt, req)
+	}
+
+	if f.Audit != nil {
+		f.Audit(ctxt, d)
+	}
+
+	if principal == nil {
+		return core.Rejected(core.NewStatus(core.CodeUnauthenticated, "%s", d.Reason))
+	}
+
+	return core.Rejected(core.NewStatus(core.CodePermissionDenied, "%s", d.Reason))
+}
+
+// A RoleFilter authorizes the served calls to the methods requiring roles in their options,
+// after their principal was authenticated.
+//
+// The calls to the methods which can't be resolved, such as the unknown methods, are denied.
+type RoleFilter struct {
+	// The metadata of the service, the one attached to the context or the one of the filtered service,
+	// or of the service of a namespaced method served by a mux, is used otherwise.
+	Metadata rpc.Metadata
+}
+
+var _ = (core.Filter)((*RoleFilter)(nil))
+
+func NewRoleFilter(metadata rpc.Metadata) *RoleFilter {
+	return &RoleFilter{metadata}
+}
+
+func (f *RoleFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	_, m, ok := resolveMethod(ctxt, f.Metadata, service, core.MethodOf(req))
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodePermissionDenied, "method `%s` can't be authorized", core.MethodOf(req)))
+	}
+
+	if len(m.Options.Roles) == 0 {
+		return service.Apply(ctxt, req)
+	}
+
+	principal := PrincipalOf(ctxt)
+
+	if principal == nil {
+		return core.Rejected(core.NewStatus(core.CodeUnauthenticated, "method `%s` requires authentication", m.Name))
+	}
+
+	for _, role := range m.Options.Roles {
+		if principal.HasRole(role) {
+			return service.Apply(ctxt, req)
+		}
+	}
+
+	return core.Rejected(core.NewStatus(core.CodePermissionDenied, "method `%s` requires one of the roles %s", m.Name, strings.Join(m.Options.Roles, ", ")))
+}
+
+// Resolve the metadata and the method of a call, with the metadata of a filter, the one attached to the context,
+// or the one of the filtered service.
+func resolveMethod(ctxt context.Context, metadata rpc.Metadata, service core.Service, method string) (rpc.Metadata, *rpc.Method, bool) {
+	if metadata == nil {
+		metadata = rpc.MetadataOf(ctxt)
+	}
+
+	if metadata == nil {
+		return rpc.Resolve(service, method)
+	}
+
+	m, ok := metadata.Method(method)
+
+	return metadata, m, ok
+}
+
+// Return the attributes of a call evaluated by the conditions, as JSON values.
+func attributesOf(principal *Principal, service, method string, call *core.Call, m *rpc.Method) (map[string]interface{}, error) {
+	var args []interface{}
+
+	if call.Args != nil {
+		args = call.Args
+	} else if len(call.Payload) > 0 {
+		encoding := call.Encoding
+
+		if encoding == nil {
+			encoding = core.JsonEncoding
+		}
+
+		var v interface{}
+
+		if err := encoding.Unmarshal(call.Payload, &v); err != nil {
+			return nil, core.NewStatus(core.CodeInvalidArgument, "fail to decode arguments, %s", err)
+		}
+
+		if list, ok := v.([]interface{}); ok && (m == nil || len(m.In) != 1) {
+			args = list
+		} else {
+			args = []interface{}{v}
+		}
+	}
+
+	var request interface{} = args
+
+	if len(args) == 1 {
+		request = args[0]
+	}
+
+	env := map[string]interface{}{
+		"service": service,
+		"method":  method,
+		"request": request,
+		"args":    args,
+	}
+
+	if principal != nil {
+		env["principal"] = principal
+	}
+
+	// normalize the values as JSON values, to compare numbers and access the fields by their JSON names
+	data, err := json.Marshal(normalize(env))
+
+	if err != nil {
+		return nil, err
+	}
+
+	env = nil
+
+	return env, json.Unmarshal(data, &env)
+}
+
+// Convert the maps decoded from YAML, which may have non string keys.
+func normalize(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(c))
+
+		for key, value := range c {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+
+		for key, value := range c {
+			m[key] = normalize(value)
+		}
+
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(c))
+
+		for i, value := range c {
+			list[i] = normalize(value)
+		}
+
+		return list
+	}
+
+	return v
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+func TestExpr(t *testing.T) {
+	Convey("evaluate expressions", t, func() {
+		env := map[string]interface{}{
+			"principal": map[string]interface{}{"name": "alice", "roles": []interface{}{"reader", "writer"}},
+			"request":   map[string]interface{}{"owner": "alice", "size": float64(42), "items": []interface{}{map[string]interface{}{"name": "a"}}},
+		}
+
+		for source, expected := range map[string]interface{}{
+			`principal.name == request.owner`:                   true,
+			`principal.name != 'bob'`:                           true,
+			`"writer" in principal.roles`:                       true,
+			`"admin" in principal.roles`:                        false,
+			`"owner" in request`:                                true,
+			`request.size >= 42 && request.size < 100`:          true,
+			`request.size > 42 || request.items[0].name == "a"`: true,
+			`!(request.size <= -1)`:                             true,
+			`request.missing == null`:                           true,
+			`null != request.owner`:                             true,
+			`request.missing == principal.missing`:              false,
+			`request.missing != "alice"`:                        false,
+			`request.missing < 1`:                               false,
+			`request.items[1].name`:                             nil,
+			`request.owner in ["alice", "bob"]`:                 true,
+			`"li" in principal.name`:                            true,
+		} {
+			expr, err := ParseExpr(source)
+
+			So(err, ShouldBeNil)
+
+			v, err := expr.Eval(env)
+
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, expected)
+		}
+
+		for _, source := range []string{`request.owner ==`, `(true`, `"unterminated`, `a # b`, `[1, 2`} {
+			_, err := ParseExpr(source)
+
+			So(err, ShouldNotBeNil)
+		}
+
+		expr, _ := ParseExpr(`request.owner && true`)
+
+		_, err := expr.Test(env)
+
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type documentService struct{}
+
+type Document struct {
+	Owner string `json:"owner"`
+	Body  string `json:"body"`
+}
+
+func (documentService) Get(id int) string              { return "document" }
+func (documentService) Count() int                     { return 1 }
+func (documentService) Update(doc *Document) string    { return "updated" }
+func (documentService) Delete(id int, force bool) bool { return true }
+
+const testPolicy = `
+roles:
+  reader:
+    permissions: [documents.Get, "documents.Count"]
+  writer:
+    inherits: [reader]
+    permissions:
+      - method: documents.Update
+        when: principal.name == request.owner
+      - method: documents.Delete
+        when: args[1] == false
+  admin:
+    permissions: ["*"]
+  anonymous:
+    permissions: [documents.Count]
+`
+
+func TestPolicy(t *testing.T) {
+	Convey("parse a policy", t, func() {
+		policy, err := ParsePolicy([]byte(testPolicy))
+
+		So(err, ShouldBeNil)
+		So(policy.Roles["writer"].Permissions[0].When, ShouldEqual, "principal.name == request.owner")
+
+		Convey("parse an invalid policy", func() {
+			_, err := ParsePolicy([]byte("roles:\n  writer:\n    inherits: [nobody]\n    permissions:\n      - method: a.b\n        when: a ==\n"))
+
+			So(err.Error(), ShouldStartWith, "2 errors occurred:")
+			So(err.Error(), ShouldContainSubstring, "roles.writer: inherits unknown role `nobody`")
+			So(err.Error(), ShouldContainSubstring, "roles.writer.permissions.0: invalid condition")
+		})
+	})
+
+	Convey("authorize the calls", t, func() {
+		policy, _ := ParsePolicy([]byte(testPolicy))
+
+		target := rpc.NativeFactory.Build(documentService{})
+
+		var denials []*Decision
+
+		f := NewPolicyFilter(policy, target.(rpc.Describer).Metadata())
+		f.Service = "documents"
+		f.Audit = func(ctxt context.Context, d *Decision) { denials = append(denials, d) }
+
+		call := func(p *Principal, method, payload string) error {
+			ctxt := context.Background()
+
+			if p != nil {
+				ctxt = WithPrincipal(ctxt, p)
+			}
+
+			_, err := f.Apply(ctxt, &core.Call{Method: method, Payload: []byte(payload), Encoding: core.JsonEncoding}, target).Get()
+
+			return err
+		}
+
+		alice := &Principal{Name: "alice", Roles: []string{"writer"}}
+
+		So(call(alice, "get", "1"), ShouldBeNil)
+		So(call(alice, "Update", `{"owner": "alice"}`), ShouldBeNil)
+		So(call(alice, "Delete", `[1, false]`), ShouldBeNil)
+		So(call(&Principal{Name: "root", Roles: []string{"admin"}}, "Delete", `[1, true]`), ShouldBeNil)
+		So(call(nil, "count", ""), ShouldBeNil)
+		So(denials, ShouldBeEmpty)
+
+		err := call(alice, "Update", `{"owner": "bob"}`)
+
+		So(err, ShouldResemble, core.NewStatus(core.CodePermissionDenied, "condition `principal.name == request.owner` doesn't hold"))
+
+		So(core.CodeOf(call(&Principal{Name: "carol", Roles: []string{"reader"}}, "Update", `{}`)), ShouldEqual, core.CodePermissionDenied)
+		So(core.CodeOf(call(nil, "Get", "1")), ShouldEqual, core.CodeUnauthenticated)
+
+		So(denials, ShouldHaveLength, 3)
+		So(denials[1].Reason, ShouldEqual, "no permission to call documents.Update")
+		So(denials[2].Principal, ShouldBeNil)
+		So(denials[2].Method, ShouldEqual, "Get")
+
+		Convey("try the other permissions after a failed condition", func() {
+			policy, err := ParsePolicy([]byte(`
+roles:
+  broken:
+    permissions:
+      - method: documents.Get
+        when: request.owner
+  reader:
+    permissions: [documents.Get]
+`))
+
+			So(err, ShouldBeNil)
+
+			attrs := func() (map[string]interface{}, error) { return map[string]interface{}{}, nil }
+
+			d := policy.Decide(&Principal{Name: "alice", Roles: []string{"broken", "reader"}}, "documents", "Get", attrs)
+
+			So(d.Allowed, ShouldBeTrue)
+
+			d = policy.Decide(&Principal{Name: "alice", Roles: []string{"broken"}}, "documents", "Get", attrs)
+
+			So(d.Allowed, ShouldBeFalse)
+			So(d.Reason, ShouldEqual, "condition `request.owner` is not a boolean")
+		})
+
+		Convey("fail to decode the arguments", func() {
+			err := call(alice, "Update", `{`)
+
+			So(core.CodeOf(err), ShouldEqual, core.CodePermissionDenied)
+			So(strings.Contains(err.Error(), "fail to decode arguments"), ShouldBeTrue)
+		})
+	})
+}
+
+type adminService struct{ documentService }
+
+func (adminService) MethodOptions() map[string]*rpc.MethodOptions {
+	return map[string]*rpc.MethodOptions{
+		"Delete": {Roles: []string{"admin", "owner"}},
+	}
+}
+
+func TestRoleFilter(t *testing.T) {
+	Convey("authorize the calls by the roles of the methods", t, func() {
+		target := rpc.NativeFactory.Build(adminService{})
+
+		f := NewRoleFilter(rpc.Describe(target))
+
+		call := func(p *Principal, method, payload string) error {
+			ctxt := context.Background()
+
+			if p != nil {
+				ctxt = WithPrincipal(ctxt, p)
+			}
+
+			_, err := f.Apply(ctxt, &core.Call{Method: method, Payload: []byte(payload), Encoding: core.JsonEncoding}, target).Get()
+
+			return err
+		}
+
+		So(call(nil, "Get", "1"), ShouldBeNil)
+		So(call(&Principal{Name: "root", Roles: []string{"owner"}}, "delete", "[1, true]"), ShouldBeNil)
+
+		So(call(nil, "Delete", "[1, true]"), ShouldResemble, core.NewStatus(core.CodeUnauthenticated, "method `Delete` requires authentication"))
+		So(call(&Principal{Name: "alice", Roles: []string{"writer"}}, "Delete", "[1, true]"), ShouldResemble,
+			core.NewStatus(core.CodePermissionDenied, "method `Delete` requires one of the roles admin, owner"))
+		So(call(nil, "Rename", "[]"), ShouldResemble, core.NewStatus(core.CodePermissionDenied, "method `Rename` can't be authorized"))
+
+		Convey("resolve the metadata of the served service", func() {
+			alice := core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+				return service.Apply(WithPrincipal(ctxt, &Principal{Name: "alice", Roles: []string{"writer"}}), req)
+			})
+
+			serve := func(service core.Service) *httptest.Server {
+				server := (&core.ServerBuilder{
+					Name:    "documents",
+					Addr:    &net.TCPAddr{},
+					Codec:   http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "documents", Addr: &net.TCPAddr{}}),
+					Filters: []core.Filter{alice, NewRoleFilter(nil)},
+				}).Build(service)
+
+				return httptest.NewServer(server.(nethttp.Handler))
+			}
+
+			post := func(server *httptest.Server, method, payload string) int {
+				resp, err := nethttp.Post(server.URL+method, "application/json", strings.NewReader(payload))
+
+				So(err, ShouldBeNil)
+
+				resp.Body.Close()
+
+				return resp.StatusCode
+			}
+
+			server := serve(target)
+			defer server.Close()
+
+			So(post(server, "/get", "1"), ShouldEqual, nethttp.StatusOK)
+			So(post(server, "/delete", "[1, true]"), ShouldEqual, nethttp.StatusForbidden)
+			So(post(server, "/rename", "[]"), ShouldEqual, nethttp.StatusForbidden)
+
+			mux := rpc.NewMux()
+			mux.Handle("documents", "v1", target)
+
+			muxServer := serve(mux)
+			defer muxServer.Close()
+
+			So(post(muxServer, "/documents.v1/get", "1"), ShouldEqual, nethttp.StatusOK)
+			So(post(muxServer, "/documents.v1/delete", "[1, true]"), ShouldEqual, nethttp.StatusForbidden)
+			So(post(muxServer, "/documents.v2/delete", "[1, true]"), ShouldEqual, nethttp.StatusForbidden)
+		})
+	})
+}
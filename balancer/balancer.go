@@ -0,0 +1,277 @@
+package balancer
+
+import (
+	"io"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/filter"
+)
+
+var (
+	ErrNoEndpoint = core.NewStatus(core.CodeUnavailable, "no endpoint available")
+)
+
+// A Dialer creates the client service of an endpoint.
+type Dialer func(endpoint *core.Endpoint) (core.Service, error)
+
+// Return a Dialer building the clients like the given builder, with the address of the endpoint as host.
+func NewDialer(template *core.ClientBuilder) Dialer {
+	return func(endpoint *core.Endpoint) (core.Service, error) {
+		b := *template
+
+		u := url.URL{}
+
+		if template.Uri != nil {
+			u = *template.Uri
+		}
+
+		u.Host = endpoint.Address
+
+		b.Uri = &u
+
+		return b.BuildE()
+	}
+}
+
+// A Member is an endpoint of the balancer with its client service.
+type Member struct {
+	Endpoint *core.Endpoint
+	Service  core.Service
+
+	outstanding int64
+	removed     int32
+}
+
+// Return the number of calls in flight.
+func (m *Member) Outstanding() int64 { return atomic.LoadInt64(&m.outstanding) }
+
+// Count a call in flight, fail if the member was removed since it was picked.
+func (m *Member) acquire() bool {
+	atomic.AddInt64(&m.outstanding, 1)
+
+	// a removal seeing the call in flight leaves the close to its release
+	if atomic.LoadInt32(&m.removed) != 0 {
+		m.release()
+
+		return false
+	}
+
+	return true
+}
+
+func (m *Member) release() {
+	if atomic.AddInt64(&m.outstanding, -1) == 0 && atomic.LoadInt32(&m.removed) != 0 {
+		m.close()
+	}
+}
+
+func (m *Member) remove() {
+	atomic.StoreInt32(&m.removed, 1)
+
+	if m.Outstanding() == 0 {
+		m.close()
+	}
+}
+
+func (m *Member) close() {
+	if closer, ok := m.Service.(io.Closer); ok && atomic.CompareAndSwapInt32(&m.removed, 1, 2) {
+		closer.Close()
+	}
+}
+
+// A Balancer is a client service spreading the calls over a set of endpoints.
+//
+// The set may be updated at runtime, the calls in flight complete on the removed endpoints,
+// which are closed afterward.
+type Balancer struct {
+	Strategy Strategy
+	Dialer   Dialer
+
+	// The breakers of the endpoints, if any, eject the failing ones from the set.
+	Breakers *filter.BreakerGroup
+
+	lock    sync.Mutex
+	members map[string]*Member
+	picker  atomic.Value // Picker
+	closed  bool
+}
+
+var _ = (core.Service)((*Balancer)(nil))
+var _ = (io.Closer)((*Balancer)(nil))
+
+func NewBalancer(strategy Strategy, dialer Dialer) *Balancer {
+	if strategy == nil {
+		strategy = RoundRobin
+	}
+
+	b := &Balancer{
+		Strategy: strategy,
+		Dialer:   dialer,
+		members:  make(map[string]*Member),
+	}
+
+	b.picker.Store(strategy.NewPicker(nil))
+
+	return b
+}
+
+// Replace the set of endpoints, return the errors of the endpoints which couldn't be dialed.
+func (b *Balancer) Update(endpoints []*core.Endpoint) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// the updates racing with the close, such as the ones of a discovery, are ignored
+	if b.closed {
+		return nil
+	}
+
+	var errs core.MultiError
+
+	members := make(map[string]*Member, len(endpoints))
+	var list []*Member
+
+	for _, endpoint := range endpoints {
+		m, exists := b.members[endpoint.Address]
+
+		if !exists || !sameEndpoint(m.Endpoint, endpoint) {
+			service, err := b.Dialer(endpoint)
+
+			if err != nil {
+				errs.Merge(endpoint.Address, err)
+				continue
+			}
+
+			m = &Member{Endpoint: endpoint, Service: service}
+		}
+
+		members[endpoint.Address] = m
+		list = append(list, m)
+	}
+
+	// the new members are picked before the old ones are removed
+	b.picker.Store(b.Strategy.NewPicker(list))
+
+	for addr, m := range b.members {
+		if members[addr] != m {
+			m.remove()
+
+			if b.Breakers != nil && members[addr] == nil {
+				b.Breakers.Remove(addr)
+			}
+		}
+	}
+
+	b.members = members
+
+	return errs.ErrorOrNil()
+}
+
+// Is an endpoint dialed like another one? The clients may be dialed from the metadata, such as a TLS server name.
+func sameEndpoint(a, b *core.Endpoint) bool {
+	if a.Weight != b.Weight || a.Zone != b.Zone || len(a.Metadata) != len(b.Metadata) {
+		return false
+	}
+
+	for key, value := range a.Metadata {
+		if other, ok := b.Metadata[key]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Remove every member, which is closed once its calls in flight complete.
+func (b *Balancer) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	b.picker.Store(b.Strategy.NewPicker(nil))
+
+	for addr, m := range b.members {
+		m.remove()
+
+		if b.Breakers != nil {
+			b.Breakers.Remove(addr)
+		}
+	}
+
+	b.members = make(map[string]*Member)
+
+	return nil
+}
+
+// Return the current members.
+func (b *Balancer) Members() []*Member {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	members := make([]*Member, 0, len(b.members))
+
+	for _, m := range b.members {
+		members = append(members, m)
+	}
+
+	return members
+}
+
+func (b *Balancer) available(m *Member) bool {
+	return b.Breakers == nil || b.Breakers.Get(m.Endpoint.Address).Available()
+}
+
+func (b *Balancer) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	for {
+		m := b.pick(ctxt, req)
+
+		if m == nil {
+			return core.Rejected(ErrNoEndpoint)
+		}
+
+		// the member removed by an update since it was picked is skipped for the new members
+		if !m.acquire() {
+			continue
+		}
+
+		var future *promise.Future
+
+		if b.Breakers != nil {
+			future = filter.Guard(b.Breakers.Get(m.Endpoint.Address), ctxt, req, m.Service)
+		} else {
+			future = m.Service.Apply(ctxt, req)
+		}
+
+		return core.Finally(future, func(interface{}, error) { m.release() })
+	}
+}
+
+func (b *Balancer) pick(ctxt context.Context, req core.Request) *Member {
+	picker := b.picker.Load().(Picker)
+
+	var m *Member
+
+	// the other attempts of the call, such as the hedged copies, go to the endpoints not tried yet
+	if tried := filter.TriedEndpointsOf(ctxt); tried != nil {
+		m = picker.Pick(ctxt, req, func(m *Member) bool { return !tried.Has(m.Endpoint.Address) && b.available(m) })
+
+		if m != nil {
+			tried.Add(m.Endpoint.Address)
+		}
+	}
+
+	if m == nil {
+		m = picker.Pick(ctxt, req, b.available)
+	}
+
+	return m
+}
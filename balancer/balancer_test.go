@@ -0,0 +1,287 @@
+package balancer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/filter"
+)
+
+type endpointService struct {
+	addr    string
+	pending *promise.Promise
+	closed  chan struct{}
+}
+
+func (s *endpointService) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	if s.pending != nil {
+		return s.pending.Future
+	}
+
+	if s.addr == "bad" {
+		return core.Rejected(core.NewStatus(core.CodeUnavailable, "unavailable"))
+	}
+
+	return core.Resolved(s.addr)
+}
+
+func (s *endpointService) Close() error {
+	close(s.closed)
+
+	return nil
+}
+
+func newTestBalancer(strategy Strategy, addrs ...string) (*Balancer, map[string]*endpointService) {
+	services := make(map[string]*endpointService)
+
+	b := NewBalancer(strategy, func(endpoint *core.Endpoint) (core.Service, error) {
+		if endpoint.Address == "" {
+			return nil, errors.New("empty address")
+		}
+
+		s := &endpointService{addr: endpoint.Address, closed: make(chan struct{})}
+
+		services[endpoint.Address] = s
+
+		return s, nil
+	})
+
+	var endpoints []*core.Endpoint
+
+	for _, addr := range addrs {
+		endpoints = append(endpoints, core.NewEndpoint(addr))
+	}
+
+	b.Update(endpoints)
+
+	return b, services
+}
+
+// A racingStrategy updates the endpoints once, after its first pick.
+type racingStrategy struct {
+	update func()
+	raced  bool
+}
+
+func (s *racingStrategy) NewPicker(members []*Member) Picker {
+	return &racingPicker{s, RoundRobin.NewPicker(members)}
+}
+
+type racingPicker struct {
+	strategy *racingStrategy
+	Picker
+}
+
+func (p *racingPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	m := p.Picker.Pick(ctxt, req, available)
+
+	if !p.strategy.raced {
+		p.strategy.raced = true
+		p.strategy.update()
+	}
+
+	return m
+}
+
+func isClosed(s *endpointService, timeout time.Duration) bool {
+	select {
+	case <-s.closed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func call(b *Balancer, method string, args ...interface{}) interface{} {
+	result, _ := b.Apply(context.Background(), &core.Call{Method: method, Args: args}).Get()
+
+	return result
+}
+
+func TestBalancer(t *testing.T) {
+	Convey("balance without endpoint", t, func() {
+		b, _ := newTestBalancer(nil)
+
+		_, err := b.Apply(context.Background(), &core.Call{}).Get()
+
+		So(err, ShouldEqual, ErrNoEndpoint)
+	})
+
+	Convey("balance with round robin", t, func() {
+		b, _ := newTestBalancer(RoundRobin, "a", "b", "c")
+
+		So([]interface{}{call(b, "m"), call(b, "m"), call(b, "m"), call(b, "m")}, ShouldResemble, []interface{}{"a", "b", "c", "a"})
+
+		Convey("update the endpoints", func() {
+			So(b.Update([]*core.Endpoint{core.NewEndpoint("c"), core.NewEndpoint("")}), ShouldNotBeNil)
+			So(b.Members(), ShouldHaveLength, 1)
+			So(call(b, "m"), ShouldEqual, "c")
+		})
+	})
+
+	Convey("balance with weighted random", t, func() {
+		b, _ := newTestBalancer(WeightedRandom)
+
+		b.Update([]*core.Endpoint{{Address: "a", Weight: 1}, {Address: "b", Weight: 0}, {Address: "c", Weight: 8}})
+
+		counts := make(map[interface{}]int)
+
+		for i := 0; i < 1000; i++ {
+			counts[call(b, "m")]++
+		}
+
+		So(counts["c"], ShouldBeGreaterThan, counts["a"]+counts["b"])
+	})
+
+	Convey("balance with least outstanding requests", t, func() {
+		for _, strategy := range []Strategy{LeastOutstanding, PowerOfTwoChoices} {
+			b, _ := newTestBalancer(strategy, "a", "b")
+
+			for _, m := range b.Members() {
+				if m.Endpoint.Address == "a" {
+					m.acquire()
+				}
+			}
+
+			So(call(b, "m"), ShouldEqual, "b")
+			So(call(b, "m"), ShouldEqual, "b")
+		}
+	})
+
+	Convey("balance with consistent hash", t, func() {
+		b, _ := newTestBalancer(ConsistentHash(nil, 0), "a", "b", "c", "d")
+
+		first := call(b, "m", "key")
+
+		for i := 0; i < 10; i++ {
+			So(call(b, "m", "key"), ShouldEqual, first)
+		}
+
+		b.Update([]*core.Endpoint{core.NewEndpoint("a"), core.NewEndpoint("b"), core.NewEndpoint("c"), core.NewEndpoint("d"), core.NewEndpoint("e")})
+
+		if next := call(b, "m", "key"); next != "e" {
+			So(next, ShouldEqual, first)
+		}
+	})
+
+	Convey("keep the in-flight calls of a removed endpoint", t, func() {
+		b, services := newTestBalancer(RoundRobin, "a")
+
+		services["a"].pending = promise.NewPromise()
+
+		future := b.Apply(context.Background(), &core.Call{})
+
+		b.Update(nil)
+
+		So(isClosed(services["a"], 0), ShouldBeFalse)
+
+		services["a"].pending.Resolve("a")
+
+		result, err := future.Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a")
+		So(isClosed(services["a"], time.Second), ShouldBeTrue)
+	})
+
+	Convey("close the members", t, func() {
+		b, services := newTestBalancer(RoundRobin, "a", "b")
+
+		So(b.Close(), ShouldBeNil)
+		So(isClosed(services["a"], time.Second), ShouldBeTrue)
+		So(isClosed(services["b"], time.Second), ShouldBeTrue)
+		So(b.Members(), ShouldBeEmpty)
+
+		_, err := b.Apply(context.Background(), &core.Call{}).Get()
+
+		So(err, ShouldEqual, ErrNoEndpoint)
+
+		b.Update([]*core.Endpoint{core.NewEndpoint("c")})
+
+		So(b.Members(), ShouldBeEmpty)
+	})
+
+	Convey("pick again when the picked member is removed", t, func() {
+		var b *Balancer
+		var services map[string]*endpointService
+
+		// the endpoints are updated between the pick and the call
+		racing := &racingStrategy{update: func() { b.Update([]*core.Endpoint{core.NewEndpoint("b")}) }}
+
+		b, services = newTestBalancer(racing, "a")
+
+		So(call(b, "m"), ShouldEqual, "b")
+		So(isClosed(services["a"], time.Second), ShouldBeTrue)
+	})
+
+	Convey("dial again the endpoints whose metadata changed", t, func() {
+		b, services := newTestBalancer(RoundRobin, "a")
+
+		old := services["a"]
+
+		endpoint := core.NewEndpoint("a")
+		endpoint.Metadata = map[string]string{"tls": "a.example.com"}
+
+		b.Update([]*core.Endpoint{endpoint})
+
+		So(services["a"], ShouldNotEqual, old)
+		So(isClosed(old, time.Second), ShouldBeTrue)
+
+		b.Update([]*core.Endpoint{{Address: "a", Weight: 1, Metadata: map[string]string{"tls": "a.example.com"}}})
+
+		So(isClosed(services["a"], 0), ShouldBeFalse)
+	})
+
+	Convey("eject a failing endpoint", t, func() {
+		b, _ := newTestBalancer(RoundRobin, "bad", "good")
+
+		b.Breakers = filter.NewBreakerGroup(&filter.BreakerConfig{
+			FailureRateThreshold:  0.5,
+			SlowCallRateThreshold: 1,
+			WindowSize:            2,
+			MinimumCalls:          2,
+			OpenTimeout:           time.Minute,
+			FailureCodes:          filter.DefaultFailureCodes,
+		})
+
+		for i := 0; i < 4; i++ {
+			call(b, "m")
+		}
+
+		So(b.Breakers.Get("bad").State(), ShouldEqual, filter.StateOpen)
+		So(b.Breakers.Get("good").State(), ShouldEqual, filter.StateClosed)
+
+		for i := 0; i < 4; i++ {
+			So(call(b, "m"), ShouldEqual, "good")
+		}
+	})
+
+	Convey("send the other attempts of a call to the endpoints not tried yet", t, func() {
+		b, _ := newTestBalancer(ConsistentHash(CallKey, DefaultHashReplicas), "a", "b", "c")
+
+		ctxt := filter.WithTriedEndpoints(context.Background(), &filter.TriedEndpoints{})
+
+		seen := make(map[interface{}]bool)
+
+		for i := 0; i < 3; i++ {
+			result, err := b.Apply(ctxt, &core.Call{Method: "m"}).Get()
+
+			So(err, ShouldBeNil)
+
+			seen[result] = true
+		}
+
+		So(seen, ShouldHaveLength, 3)
+
+		result, err := b.Apply(ctxt, &core.Call{Method: "m"}).Get()
+
+		So(err, ShouldBeNil)
+		So(seen[result], ShouldBeTrue)
+	})
+}
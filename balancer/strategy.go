@@ -0,0 +1,286 @@
+package balancer
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+var (
+	RoundRobin        Strategy = &roundRobin{}
+	WeightedRandom    Strategy = &weightedRandom{}
+	LeastOutstanding  Strategy = &leastOutstanding{}
+	PowerOfTwoChoices Strategy = &powerOfTwoChoices{}
+
+	// The number of virtual nodes per unit of weight on the ring of ConsistentHash.
+	DefaultHashReplicas = 100
+)
+
+// Return the strategy with the given name, such as `round_robin` or `consistent_hash`.
+func StrategyByName(name string) (Strategy, bool) {
+	switch name {
+	case "round_robin":
+		return RoundRobin, true
+	case "weighted_random":
+		return WeightedRandom, true
+	case "least_outstanding":
+		return LeastOutstanding, true
+	case "p2c", "power_of_two_choices":
+		return PowerOfTwoChoices, true
+	case "consistent_hash":
+		return ConsistentHash(nil, 0), true
+	}
+
+	return nil, false
+}
+
+// A Strategy decides how the calls are spread over the endpoints.
+type Strategy interface {
+	// Return a picker for the members, called whenever the set of endpoints changes.
+	NewPicker(members []*Member) Picker
+}
+
+// A Picker chooses the member which handles a call.
+type Picker interface {
+	// Return an available member, or nil if none is available.
+	Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member
+}
+
+type roundRobin struct{}
+
+func (s *roundRobin) NewPicker(members []*Member) Picker {
+	return &roundRobinPicker{members: members}
+}
+
+type roundRobinPicker struct {
+	members []*Member
+	next    uint32
+}
+
+func (p *roundRobinPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	n := len(p.members)
+
+	for i := 0; i < n; i++ {
+		m := p.members[int(atomic.AddUint32(&p.next, 1)-1)%n]
+
+		if available(m) {
+			return m
+		}
+	}
+
+	return nil
+}
+
+type weightedRandom struct{}
+
+func (s *weightedRandom) NewPicker(members []*Member) Picker {
+	return &weightedRandomPicker{members}
+}
+
+type weightedRandomPicker struct {
+	members []*Member
+}
+
+func (p *weightedRandomPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	total := 0
+
+	candidates := make([]*Member, 0, len(p.members))
+
+	for _, m := range p.members {
+		if available(m) {
+			candidates = append(candidates, m)
+			total += m.Endpoint.EffectiveWeight()
+		}
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+
+	for _, m := range candidates {
+		if n -= m.Endpoint.EffectiveWeight(); n < 0 {
+			return m
+		}
+	}
+
+	return candidates[len(candidates)-1]
+}
+
+type leastOutstanding struct{}
+
+func (s *leastOutstanding) NewPicker(members []*Member) Picker {
+	return &leastOutstandingPicker{members}
+}
+
+type leastOutstandingPicker struct {
+	members []*Member
+}
+
+func (p *leastOutstandingPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	var best *Member
+	var ties int
+
+	offset := 0
+
+	if len(p.members) > 0 {
+		offset = rand.Intn(len(p.members))
+	}
+
+	for i := range p.members {
+		m := p.members[(offset+i)%len(p.members)]
+
+		if !available(m) {
+			continue
+		}
+
+		if best == nil || less(m, best) {
+			best, ties = m, 1
+		} else if !less(best, m) {
+			if ties++; rand.Intn(ties) == 0 {
+				best = m
+			}
+		}
+	}
+
+	return best
+}
+
+// Is the member less loaded than the other one, considering their weights?
+func less(m, other *Member) bool {
+	return m.Outstanding()*int64(other.Endpoint.EffectiveWeight()) < other.Outstanding()*int64(m.Endpoint.EffectiveWeight())
+}
+
+type powerOfTwoChoices struct{}
+
+func (s *powerOfTwoChoices) NewPicker(members []*Member) Picker {
+	return &powerOfTwoChoicesPicker{members}
+}
+
+type powerOfTwoChoicesPicker struct {
+	members []*Member
+}
+
+func (p *powerOfTwoChoicesPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	candidates := make([]*Member, 0, len(p.members))
+
+	for _, m := range p.members {
+		if available(m) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+
+	if j >= i {
+		j++
+	}
+
+	if less(candidates[j], candidates[i]) {
+		return candidates[j]
+	}
+
+	return candidates[i]
+}
+
+// Return the key of a call, the calls with the same key go to the same endpoint.
+type KeyFunc func(ctxt context.Context, req core.Request) string
+
+// Use the method and the encoded arguments of a call as its key.
+func CallKey(ctxt context.Context, req core.Request) string {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return ""
+	}
+
+	payload := call.Payload
+
+	if payload == nil {
+		payload, _ = call.EncodeArgs()
+	}
+
+	return call.Method + ":" + string(payload)
+}
+
+type consistentHash struct {
+	key      KeyFunc
+	replicas int
+}
+
+// Return a strategy hashing the key of the calls on a ring of the endpoints,
+// with virtual nodes in proportion to their weight.
+func ConsistentHash(key KeyFunc, replicas int) Strategy {
+	if key == nil {
+		key = CallKey
+	}
+
+	if replicas <= 0 {
+		replicas = DefaultHashReplicas
+	}
+
+	return &consistentHash{key, replicas}
+}
+
+func (s *consistentHash) NewPicker(members []*Member) Picker {
+	p := &consistentHashPicker{key: s.key}
+
+	for _, m := range members {
+		for i := 0; i < s.replicas*m.Endpoint.EffectiveWeight(); i++ {
+			p.ring = append(p.ring, node{crc32.ChecksumIEEE([]byte(m.Endpoint.Address + "#" + strconv.Itoa(i))), m})
+		}
+	}
+
+	sort.Sort(p.ring)
+
+	return p
+}
+
+type node struct {
+	hash   uint32
+	member *Member
+}
+
+type ring []node
+
+func (r ring) Len() int           { return len(r) }
+func (r ring) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r ring) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+type consistentHashPicker struct {
+	key  KeyFunc
+	ring ring
+}
+
+func (p *consistentHashPicker) Pick(ctxt context.Context, req core.Request, available func(m *Member) bool) *Member {
+	if len(p.ring) == 0 {
+		return nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(p.key(ctxt, req)))
+
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= hash })
+
+	for i := 0; i < len(p.ring); i++ {
+		if m := p.ring[(start+i)%len(p.ring)].member; available(m) {
+			return m
+		}
+	}
+
+	return nil
+}
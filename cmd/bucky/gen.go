@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/flier/bucky/gen"
+)
+
+var genCommand = cli.Command{
+	Name:      "gen",
+	Usage:     "generate the client, the server adapter and the mock of an interface",
+	ArgsUsage: "<interface>",
+	Description: `Generate the code of a Go interface served by bucky, such as
+
+   //go:generate bucky gen StringService
+
+The generated file holds the request and the response of each method, with the real parameter names,
+a typed client, a server adapter naming the parameters of the methods, and a mock.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "package, p",
+			Value: ".",
+			Usage: "the package of the interface",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "the file to write, or `-` for the standard output, `<interface>_bucky.go` in the package by default",
+		},
+	},
+	Action: func(c *cli.Context) {
+		if c.NArg() != 1 {
+			fatalf("missing the name of the interface")
+		}
+
+		iface := c.Args().First()
+
+		code, dir, err := gen.Generate(&gen.Config{Package: c.String("package"), Interface: iface})
+
+		if err != nil {
+			fatalf("fail to generate the code of `%s`, %s", iface, err)
+		}
+
+		output := c.String("output")
+
+		if output == "" {
+			output = gen.OutputOf(dir, iface)
+		}
+
+		if output == "-" {
+			os.Stdout.Write(code)
+		} else if err := ioutil.WriteFile(output, code, 0644); err != nil {
+			fatalf("fail to write the generated code, %s", err)
+		}
+	},
+}
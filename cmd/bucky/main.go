@@ -7,5 +7,14 @@ import (
 )
 
 func main() {
-	cli.NewApp().Run(os.Args)
+	app := cli.NewApp()
+
+	app.Name = "bucky"
+	app.Usage = "the tools of the bucky services"
+	app.Commands = []cli.Command{
+		genCommand,
+		openapiCommand,
+	}
+
+	app.Run(os.Args)
 }
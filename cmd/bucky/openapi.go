@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/flier/bucky/openapi"
+)
+
+var openapiCommand = cli.Command{
+	Name:      "openapi",
+	Usage:     "write the OpenAPI document served by a server",
+	ArgsUsage: "<url>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: "openapi.json",
+			Usage: "the file to write, or `-` for the standard output",
+		},
+	},
+	Action: func(c *cli.Context) {
+		if c.NArg() != 1 {
+			fatalf("missing the url of the server")
+		}
+
+		doc, err := fetchDocument(c.Args().First())
+
+		if err != nil {
+			fatalf("fail to fetch the OpenAPI document, %s", err)
+		}
+
+		data, err := json.MarshalIndent(doc, "", "  ")
+
+		if err != nil {
+			fatalf("fail to encode the OpenAPI document, %s", err)
+		}
+
+		data = append(data, '\n')
+
+		if output := c.String("output"); output == "-" {
+			os.Stdout.Write(data)
+		} else if err := ioutil.WriteFile(output, data, 0644); err != nil {
+			fatalf("fail to write the OpenAPI document, %s", err)
+		}
+	},
+}
+
+// Fetch the OpenAPI document served by the server, as the /openapi.json path.
+func fetchDocument(url string) (*openapi.Document, error) {
+	resp, err := http.Get(strings.TrimSuffix(url, "/") + "/" + openapi.DocumentMethod)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var doc openapi.Document
+
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "bucky: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -3,6 +3,8 @@ package core
 import (
 	"crypto/tls"
 	"net"
+	"net/url"
+	"time"
 )
 
 type ServiceBuilder interface {
@@ -20,23 +22,194 @@ type ServerBuilder struct {
 	TLSConfig         *tls.Config
 	CertFile, KeyFile string
 	Transport         Transport
+	Filters           []Filter
+
+	// Called once the server starts shutting down, while it still serves the calls.
+	ShutdownHooks []func()
+
+	// How long the server keeps serving after the shutdown hooks were called,
+	// so that the load balancers notice it isn't ready anymore.
+	ShutdownDelay time.Duration
+
+	// The optional admin server, started and stopped with the server.
+	Admin Admin
+}
+
+// Check the builder and return every configuration problem found.
+func (b *ServerBuilder) Validate() error {
+	var errs MultiError
+
+	if b.Name == "" {
+		errs.Add("Name", "no name was specified")
+	}
+
+	if b.Addr == nil {
+		errs.Add("Addr", "no address was specified")
+	}
+
+	if b.Backlog < 0 {
+		errs.Add("Backlog", "negative backlog %d", b.Backlog)
+	}
+
+	if b.Codec == nil {
+		if b.CodecFactory == nil {
+			errs.Add("Codec", "neither Codec nor CodecFactory was specified")
+		}
+
+		validateKeyPair(&errs, b.TLSConfig, b.CertFile, b.KeyFile)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// Build a server for the service, or return the configuration problems.
+func (b *ServerBuilder) BuildE(service Service) (Server, error) {
+	var errs MultiError
+
+	errs.Merge("", b.Validate())
+
+	if service == nil {
+		errs.Add("Service", "no service was specified")
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.ErrorOrNil()
+	}
+
+	if b.Codec == nil {
+		b.Codec = b.CodecFactory.ServerCodec(b.codecConfig())
+
+		if b.Codec == nil {
+			return nil, &FieldError{"CodecFactory", errNoServerCodec}
+		}
+	}
+
+	dispatcher := b.Codec.ServerDispatcher(b.Transport, WithFilters(service, b.Filters...))
+	server := dispatcher
+
+	if len(b.ShutdownHooks) > 0 || b.ShutdownDelay > 0 {
+		server = &gracefulServer{server, b.ShutdownHooks, b.ShutdownDelay}
+	}
+
+	if b.Admin != nil {
+		admin, err := b.Admin.AdminServer(b, dispatcher, service)
+
+		if err != nil {
+			return nil, &FieldError{"Admin", err}
+		}
+
+		server = &serverGroup{server, []Server{admin}}
+	}
+
+	return server, nil
 }
 
+// Build a server for the service, panic if the builder is misconfigured.
 func (b *ServerBuilder) Build(service Service) Server {
-	Assert(b.Name, "No Name was specified")
-	Assert(b.Addr, "No Addr was specified")
+	server, err := b.BuildE(service)
 
-	if b.Codec == nil && b.CodecFactory != nil {
-		b.Codec = b.CodecFactory.ServerCodec(&ServerCodecConfig{
-			Name:      b.Name,
-			Addr:      b.Addr,
-			TLSConfig: b.TLSConfig,
-			CertFile:  b.CertFile,
-			KeyFile:   b.KeyFile,
-		})
+	if err != nil {
+		panic(err)
 	}
 
-	Assert(b.Codec, "No Codec was specified")
+	return server
+}
+
+func (b *ServerBuilder) codecConfig() *ServerCodecConfig {
+	return &ServerCodecConfig{
+		Name:      b.Name,
+		Addr:      b.Addr,
+		Encoding:  b.Encoding,
+		TLSConfig: b.TLSConfig,
+		CertFile:  b.CertFile,
+		KeyFile:   b.KeyFile,
+	}
+}
+
+// A SchemeHandler builds the client service of the URIs with a custom scheme,
+// such as the logical names resolved by service discovery.
+type SchemeHandler func(b *ClientBuilder) (Service, error)
 
-	return b.Codec.ServerDispatcher(b.Transport, service)
+var schemeHandlers = make(map[string]SchemeHandler)
+
+// Register the handler of a custom URI scheme, usually from the init function of a package.
+func RegisterScheme(scheme string, handler SchemeHandler) {
+	schemeHandlers[scheme] = handler
+}
+
+type ClientBuilder struct {
+	Name         string
+	Uri          *url.URL
+	KeepAlives   bool
+	Encoding     Encoding
+	Codec        ClientCodec
+	CodecFactory CodecFactory
+	TLSConfig    *tls.Config
+	Transport    Transport
+	Filters      []Filter
+}
+
+// Check the builder and return every configuration problem found.
+func (b *ClientBuilder) Validate() error {
+	var errs MultiError
+
+	if b.Codec == nil {
+		if b.CodecFactory == nil {
+			errs.Add("Codec", "neither Codec nor CodecFactory was specified")
+		}
+
+		errs.Merge("", b.codecConfig().Validate())
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// Build a client service, or return the configuration problems.
+func (b *ClientBuilder) BuildE() (Service, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	if b.Codec == nil && b.Uri != nil {
+		if handler := schemeHandlers[b.Uri.Scheme]; handler != nil {
+			client, err := handler(b)
+
+			if err != nil {
+				return nil, &FieldError{"Uri", err}
+			}
+
+			return WithFilters(client, b.Filters...), nil
+		}
+	}
+
+	if b.Codec == nil {
+		b.Codec = b.CodecFactory.ClientCodec(b.codecConfig())
+
+		if b.Codec == nil {
+			return nil, &FieldError{"CodecFactory", errNoClientCodec}
+		}
+	}
+
+	return WithFilters(b.Codec.ClientDispatcher(b.Transport), b.Filters...), nil
+}
+
+// Build a client service, panic if the builder is misconfigured.
+func (b *ClientBuilder) Build() Service {
+	client, err := b.BuildE()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+func (b *ClientBuilder) codecConfig() *ClientCodecConfig {
+	return &ClientCodecConfig{
+		Name:       b.Name,
+		Uri:        b.Uri,
+		KeepAlives: b.KeepAlives,
+		Encoding:   b.Encoding,
+		TLSConfig:  b.TLSConfig,
+	}
 }
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+)
+
+func TestServerBuilder(t *testing.T) {
+	Convey("validate an empty ServerBuilder", t, func() {
+		b := &ServerBuilder{}
+
+		err := b.Validate()
+
+		So(err, ShouldHaveSameTypeAs, MultiError{})
+		So(err.(MultiError), ShouldHaveLength, 3)
+		So(err.Error(), ShouldContainSubstring, "Name: no name was specified")
+		So(err.Error(), ShouldContainSubstring, "Addr: no address was specified")
+		So(err.Error(), ShouldContainSubstring, "Codec: neither Codec nor CodecFactory was specified")
+
+		Convey("build without service", func() {
+			server, err := b.BuildE(nil)
+
+			So(server, ShouldBeNil)
+			So(err.(MultiError), ShouldHaveLength, 4)
+			So(err.Error(), ShouldContainSubstring, "Service: no service was specified")
+		})
+
+		Convey("build with panic", func() {
+			So(func() { b.Build(nil) }, ShouldPanic)
+		})
+	})
+
+	Convey("validate TLS settings", t, func() {
+		b := &ServerBuilder{
+			Name:         "test",
+			Addr:         &net.TCPAddr{Port: 8080},
+			CodecFactory: &nullCodecFactory{},
+			TLSConfig:    &tls.Config{},
+		}
+
+		So(b.Validate().Error(), ShouldEqual, "CertFile: TLS is enabled but no certificate was specified")
+
+		b.CertFile = "not-exists.pem"
+
+		err := b.Validate()
+
+		So(err.(MultiError), ShouldHaveLength, 2)
+		So(err.Error(), ShouldContainSubstring, "CertFile: stat not-exists.pem")
+		So(err.Error(), ShouldContainSubstring, "KeyFile: CertFile was specified without KeyFile")
+	})
+
+	Convey("build with a codec factory without server codec", t, func() {
+		b := &ServerBuilder{
+			Name:         "test",
+			Addr:         &net.TCPAddr{Port: 8080},
+			CodecFactory: &nullCodecFactory{},
+		}
+
+		server, err := b.BuildE(&nullService{})
+
+		So(server, ShouldBeNil)
+		So(err, ShouldResemble, &FieldError{"CodecFactory", errNoServerCodec})
+	})
+}
+
+func TestClientBuilder(t *testing.T) {
+	Convey("build with a codec without URI", t, func() {
+		b := &ClientBuilder{Codec: &nullClientCodec{}}
+
+		client, err := b.BuildE()
+
+		So(err, ShouldBeNil)
+		So(client, ShouldHaveSameTypeAs, &nullService{})
+	})
+}
+
+func TestMultiError(t *testing.T) {
+	Convey("merge nested errors", t, func() {
+		var inner, outer MultiError
+
+		inner.Add("CertFile", "missing")
+		inner.Add("KeyFile", "missing")
+
+		outer.Add("Name", "missing")
+		outer.Merge("Codec", inner)
+		outer.Merge("Codec", nil)
+
+		So(outer, ShouldHaveLength, 3)
+		So(outer.Error(), ShouldEqual, "3 errors occurred:\n  * Name: missing\n  * Codec.CertFile: missing\n  * Codec.KeyFile: missing")
+		So(MultiError{}.ErrorOrNil(), ShouldBeNil)
+		So(inner[:1].ErrorOrNil(), ShouldEqual, inner[0])
+	})
+}
+
+type nullCodecFactory struct{}
+
+func (f *nullCodecFactory) ClientCodec(cfg *ClientCodecConfig) ClientCodec { return nil }
+
+func (f *nullCodecFactory) ServerCodec(cfg *ServerCodecConfig) ServerCodec { return nil }
+
+type nullClientCodec struct{}
+
+func (c *nullClientCodec) ClientDispatcher(transport Transport) Service { return &nullService{} }
+
+type nullService struct{}
+
+func (s *nullService) Apply(ctxt context.Context, req Request) *promise.Future { return nil }
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A Call is the request of a method invocation passed through the Service pipeline.
+//
+// The arguments are kept encoded in Payload by the server codecs
+// until the dispatcher knows their types and decodes them into Args.
+//
+// A streaming call exchanges its messages through the Stream,
+// the future of the call settles with the final result once the method returned.
+type Call struct {
+	Service  string
+	Method   string
+	Args     []interface{}
+	Payload  []byte
+	Named    bool // the payload is an object of the arguments keyed by the parameter names
+	Encoding Encoding
+	Reply    interface{} // the value the client decodes the result into, if any
+	Stream   Stream      // the messages of a streaming call, nil for the unary ones
+}
+
+var _ = (Request)((*Call)(nil))
+
+func (c *Call) encoding() Encoding {
+	if c.Encoding == nil {
+		return JsonEncoding
+	}
+
+	return c.Encoding
+}
+
+// Encode the arguments, a single argument is encoded as itself and the others as a list.
+func (c *Call) EncodeArgs() ([]byte, error) {
+	switch len(c.Args) {
+	case 0:
+		return nil, nil
+	case 1:
+		return c.encoding().Marshal(c.Args[0])
+	default:
+		return c.encoding().Marshal(c.Args)
+	}
+}
+
+// Decode the payload into arguments of the given types, unless they were decoded already.
+func (c *Call) DecodeArgs(types []reflect.Type) ([]interface{}, error) {
+	if c.Args != nil || len(types) == 0 {
+		return c.Args, nil
+	}
+
+	var args []interface{}
+
+	if len(types) == 1 {
+		v := reflect.New(types[0])
+
+		if len(c.Payload) > 0 {
+			if err := c.encoding().Unmarshal(c.Payload, v.Interface()); err != nil {
+				return nil, NewStatus(CodeInvalidArgument, "fail to decode argument, %s", err)
+			}
+		}
+
+		args = []interface{}{v.Elem().Interface()}
+	} else {
+		var values []interface{}
+
+		if len(c.Payload) > 0 {
+			if err := c.encoding().Unmarshal(c.Payload, &values); err != nil {
+				return nil, NewStatus(CodeInvalidArgument, "fail to decode arguments, %s", err)
+			}
+		}
+
+		if len(values) > len(types) {
+			return nil, NewStatus(CodeInvalidArgument, "too many arguments, expected %d, got %d", len(types), len(values))
+		}
+
+		for i, t := range types {
+			v := reflect.New(t)
+
+			if i < len(values) {
+				if err := c.convert(values[i], v.Interface()); err != nil {
+					return nil, NewStatus(CodeInvalidArgument, "fail to decode argument #%d, %s", i, err)
+				}
+			}
+
+			args = append(args, v.Elem().Interface())
+		}
+	}
+
+	c.Args = args
+
+	return args, nil
+}
+
+// Decode the payload, an object of the arguments keyed by the given parameter names, unless they were decoded already.
+//
+// The object is decoded as the argument itself when the names are unknown and there is a single parameter.
+func (c *Call) DecodeNamedArgs(names []string, types []reflect.Type) ([]interface{}, error) {
+	if c.Args != nil || len(types) == 0 {
+		return c.Args, nil
+	}
+
+	if len(names) != len(types) {
+		if len(types) == 1 {
+			return c.DecodeArgs(types)
+		}
+
+		return nil, NewStatus(CodeInvalidArgument, "the parameters of `%s` have no names", c.Method)
+	}
+
+	values := make(map[string]interface{})
+
+	if len(c.Payload) > 0 {
+		if err := c.encoding().Unmarshal(c.Payload, &values); err != nil {
+			return nil, NewStatus(CodeInvalidArgument, "fail to decode arguments, %s", err)
+		}
+	}
+
+	args := make([]interface{}, len(types))
+
+	for i, t := range types {
+		v := reflect.New(t)
+
+		for name, value := range values {
+			if strings.EqualFold(name, names[i]) {
+				if err := c.convert(value, v.Interface()); err != nil {
+					return nil, NewStatus(CodeInvalidArgument, "fail to decode argument `%s`, %s", names[i], err)
+				}
+
+				delete(values, name)
+				break
+			}
+		}
+
+		args[i] = v.Elem().Interface()
+	}
+
+	for name := range values {
+		return nil, NewStatus(CodeInvalidArgument, "unknown argument `%s`", name)
+	}
+
+	c.Args = args
+
+	return args, nil
+}
+
+func (c *Call) convert(value, ptr interface{}) error {
+	data, err := c.encoding().Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	return c.encoding().Unmarshal(data, ptr)
+}
+
+func (c *Call) String() string {
+	if c.Service == "" {
+		return c.Method
+	}
+
+	return fmt.Sprintf("%s.%s", c.Service, c.Method)
+}
+
+// Return the method name of a request, or an empty string if it isn't a Call.
+func MethodOf(req Request) string {
+	if call, ok := req.(*Call); ok {
+		return call.Method
+	}
+
+	return ""
+}
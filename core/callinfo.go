@@ -0,0 +1,114 @@
+package core
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	IncomingCallInfoKey = "core.callinfo.incoming"
+	OutgoingCallInfoKey = "core.callinfo.outgoing"
+)
+
+// A CallInfo describes a call as seen by the codec serving or sending it.
+//
+// The server codecs attach an incoming one to the context of the calls they dispatch,
+// the client codecs fill the outgoing one attached by the client filters, if any.
+type CallInfo struct {
+	// The name of the codec, such as http or tcp.
+	Codec string
+
+	// The address of the remote peer.
+	Peer string
+
+	// The size of the encoded request.
+	RequestSize int
+
+	// The state of the TLS connection, if any, with the certificates of the peer.
+	TLS *tls.ConnectionState
+
+	lock      sync.Mutex
+	completed bool
+	response  int
+	callbacks []func(info *CallInfo)
+}
+
+// Register a callback called once the response was encoded or decoded by the codec.
+func (i *CallInfo) OnComplete(callback func(info *CallInfo)) {
+	i.lock.Lock()
+
+	if !i.completed {
+		i.callbacks = append(i.callbacks, callback)
+		i.lock.Unlock()
+
+		return
+	}
+
+	i.lock.Unlock()
+
+	callback(i)
+}
+
+// Record the size of the response, called by the codec once.
+func (i *CallInfo) Complete(responseSize int) {
+	i.lock.Lock()
+
+	if i.completed {
+		i.lock.Unlock()
+
+		return
+	}
+
+	i.completed = true
+	i.response = responseSize
+
+	callbacks := i.callbacks
+	i.callbacks = nil
+	i.lock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(i)
+	}
+}
+
+// Return the size of the encoded response, once completed.
+func (i *CallInfo) ResponseSize() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.response
+}
+
+func IncomingCallInfo(ctxt context.Context) (*CallInfo, bool) {
+	info, ok := ctxt.Value(IncomingCallInfoKey).(*CallInfo)
+
+	return info, ok
+}
+
+func WithIncomingCallInfo(ctxt context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctxt, IncomingCallInfoKey, info)
+}
+
+func OutgoingCallInfo(ctxt context.Context) (*CallInfo, bool) {
+	info, ok := ctxt.Value(OutgoingCallInfoKey).(*CallInfo)
+
+	return info, ok
+}
+
+func WithOutgoingCallInfo(ctxt context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctxt, OutgoingCallInfoKey, info)
+}
+
+// Return the outgoing call info of the context, or attach a new one,
+// so that the client filters share the info filled by the codec.
+func EnsureOutgoingCallInfo(ctxt context.Context) (context.Context, *CallInfo) {
+	if info, ok := OutgoingCallInfo(ctxt); ok {
+		return ctxt, info
+	}
+
+	info := &CallInfo{}
+
+	return WithOutgoingCallInfo(ctxt, info), info
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"net"
 	"net/url"
+	"os"
 )
 
 type ClientCodec interface {
@@ -18,17 +19,69 @@ type ClientCodecConfig struct {
 	Name       string
 	Uri        *url.URL
 	KeepAlives bool
+	Encoding   Encoding
 	TLSConfig  *tls.Config
 }
 
+func (c *ClientCodecConfig) Validate() error {
+	var errs MultiError
+
+	if c.Uri == nil {
+		errs.Add("Uri", "no uri was specified")
+	} else if c.Uri.Scheme == "" {
+		errs.Add("Uri", "missing scheme in uri `%s`", c.Uri)
+	}
+
+	return errs.ErrorOrNil()
+}
+
 type ServerCodecConfig struct {
 	Name              string
 	Addr              net.Addr
 	KeepAlives        bool
+	Encoding          Encoding
 	TLSConfig         *tls.Config
 	CertFile, KeyFile string
 }
 
+func (c *ServerCodecConfig) Validate() error {
+	var errs MultiError
+
+	if c.Name == "" {
+		errs.Add("Name", "no name was specified")
+	}
+
+	if c.Addr == nil {
+		errs.Add("Addr", "no address was specified")
+	}
+
+	validateKeyPair(&errs, c.TLSConfig, c.CertFile, c.KeyFile)
+
+	return errs.ErrorOrNil()
+}
+
+func validateKeyPair(errs *MultiError, cfg *tls.Config, certFile, keyFile string) {
+	if certFile == "" && keyFile == "" {
+		if cfg != nil && len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+			errs.Add("CertFile", "TLS is enabled but no certificate was specified")
+		}
+
+		return
+	}
+
+	if certFile == "" {
+		errs.Add("CertFile", "KeyFile was specified without CertFile")
+	} else if _, err := os.Stat(certFile); err != nil {
+		errs.Add("CertFile", "%s", err)
+	}
+
+	if keyFile == "" {
+		errs.Add("KeyFile", "CertFile was specified without KeyFile")
+	} else if _, err := os.Stat(keyFile); err != nil {
+		errs.Add("KeyFile", "%s", err)
+	}
+}
+
 type CodecFactory interface {
 	ClientCodec(cfg *ClientCodecConfig) ClientCodec
 
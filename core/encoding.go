@@ -3,7 +3,10 @@ package core
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"reflect"
 
+	"github.com/golang/protobuf/proto"
 	"gopkg.in/yaml.v2"
 )
 
@@ -13,9 +16,12 @@ var (
 	XmlEncoding        = &xmlEncoding{}
 	XmlPrettyEncoding  = &xmlEncoding{Indent: "  "}
 	YamlEncoding       = &yamlEncoding{}
+	ProtobufEncoding   = &protobufEncoding{}
 )
 
 type Encoding interface {
+	ContentType() string
+
 	Marshal(v interface{}) ([]byte, error)
 
 	Unmarshal(data []byte, v interface{}) error
@@ -25,6 +31,8 @@ type jsonEncoding struct {
 	Prefix, Indent string
 }
 
+func (e *jsonEncoding) ContentType() string { return "application/json" }
+
 func (e *jsonEncoding) Marshal(v interface{}) ([]byte, error) {
 	return json.Marshal(v)
 }
@@ -37,6 +45,8 @@ type xmlEncoding struct {
 	Prefix, Indent string
 }
 
+func (e *xmlEncoding) ContentType() string { return "application/xml" }
+
 func (e *xmlEncoding) Marshal(v interface{}) ([]byte, error) {
 	return xml.Marshal(v)
 }
@@ -48,6 +58,8 @@ func (e *xmlEncoding) Unmarshal(data []byte, v interface{}) error {
 type yamlEncoding struct {
 }
 
+func (e *yamlEncoding) ContentType() string { return "application/x-yaml" }
+
 func (e *yamlEncoding) Marshal(v interface{}) ([]byte, error) {
 	return yaml.Marshal(v)
 }
@@ -55,3 +67,39 @@ func (e *yamlEncoding) Marshal(v interface{}) ([]byte, error) {
 func (e *yamlEncoding) Unmarshal(data []byte, v interface{}) error {
 	return yaml.Unmarshal(data, v)
 }
+
+// A protobufEncoding encodes the protobuf messages, it decodes into a message or a pointer to a message pointer.
+type protobufEncoding struct {
+}
+
+func (e *protobufEncoding) ContentType() string { return "application/x-protobuf" }
+
+func (e *protobufEncoding) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a protobuf message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (e *protobufEncoding) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if m, ok := reflect.New(rv.Elem().Type().Elem()).Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+
+			rv.Elem().Set(reflect.ValueOf(m))
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%T isn't a protobuf message", v)
+}
@@ -1,6 +1,34 @@
 package core
 
-import ()
+import (
+	"fmt"
+)
 
-type Endpoint interface {
+// An Endpoint is an addressable instance of a service.
+type Endpoint struct {
+	Address  string            `json:"address" yaml:"address"`
+	Weight   int               `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Zone     string            `json:"zone,omitempty" yaml:"zone,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+func NewEndpoint(address string) *Endpoint {
+	return &Endpoint{Address: address, Weight: 1}
+}
+
+// Return the weight of the endpoint, which defaults to 1.
+func (e *Endpoint) EffectiveWeight() int {
+	if e.Weight <= 0 {
+		return 1
+	}
+
+	return e.Weight
+}
+
+func (e *Endpoint) String() string {
+	if e.Zone == "" {
+		return e.Address
+	}
+
+	return fmt.Sprintf("%s@%s", e.Address, e.Zone)
 }
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	errNoServerCodec = errors.New("codec factory doesn't support server codec")
+	errNoClientCodec = errors.New("codec factory doesn't support client codec")
+)
+
+// A FieldError describes a problem with a single configuration field.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+// A MultiError collects every problem found while validating a configuration.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	if len(m) == 1 {
+		return m[0].Error()
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%d errors occurred:", len(m))
+
+	for _, err := range m {
+		fmt.Fprintf(&buf, "\n  * %s", err)
+	}
+
+	return buf.String()
+}
+
+// Record a problem with the given field.
+func (m *MultiError) Add(field, format string, args ...interface{}) {
+	*m = append(*m, &FieldError{field, fmt.Errorf(format, args...)})
+}
+
+// Merge the errors of a nested configuration, prefixing their field paths with the given path.
+func (m *MultiError) Merge(path string, err error) {
+	switch e := err.(type) {
+	case nil:
+	case MultiError:
+		for _, err := range e {
+			m.Merge(path, err)
+		}
+	case *FieldError:
+		*m = append(*m, &FieldError{joinFieldPath(path, e.Field), e.Err})
+	default:
+		*m = append(*m, &FieldError{path, err})
+	}
+}
+
+// Return nil if no error was recorded, the first error if only one, or the MultiError itself.
+func (m MultiError) ErrorOrNil() error {
+	switch len(m) {
+	case 0:
+		return nil
+	case 1:
+		return m[0]
+	default:
+		return m
+	}
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	if field == "" {
+		return path
+	}
+
+	return path + "." + field
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+)
+
+// A Filter decorates a Service, it may change the request, the response or both.
+type Filter interface {
+	Apply(ctxt context.Context, req Request, service Service) *promise.Future
+}
+
+type FilterFunc func(ctxt context.Context, req Request, service Service) *promise.Future
+
+func (f FilterFunc) Apply(ctxt context.Context, req Request, service Service) *promise.Future {
+	return f(ctxt, req, service)
+}
+
+type ServiceFunc func(ctxt context.Context, req Request) *promise.Future
+
+func (f ServiceFunc) Apply(ctxt context.Context, req Request) *promise.Future {
+	return f(ctxt, req)
+}
+
+type filteredService struct {
+	filter  Filter
+	service Service
+}
+
+func (s *filteredService) Apply(ctxt context.Context, req Request) *promise.Future {
+	return s.filter.Apply(ctxt, req, s.service)
+}
+
+// Return the service wrapped by a filter, or nil if the service isn't wrapped.
+func Unwrap(service Service) Service {
+	if s, ok := service.(*filteredService); ok {
+		return s.service
+	}
+
+	return nil
+}
+
+// Wrap the service with the filters, the first filter sees the request first.
+func WithFilters(service Service, filters ...Filter) Service {
+	for i := len(filters) - 1; i >= 0; i-- {
+		if filters[i] != nil {
+			service = &filteredService{filters[i], service}
+		}
+	}
+
+	return service
+}
+
+// Return a future rejected with the error.
+func Rejected(err error) *promise.Future {
+	result := promise.NewPromise()
+
+	result.Reject(err)
+
+	return result.Future
+}
+
+// Return a future resolved with the value.
+func Resolved(v interface{}) *promise.Future {
+	result := promise.NewPromise()
+
+	result.Resolve(v)
+
+	return result.Future
+}
+
+// Return a future settled as the given one, or rejected with the context error once the context is done.
+func WithContext(ctxt context.Context, future *promise.Future) *promise.Future {
+	if ctxt.Done() == nil {
+		return future
+	}
+
+	result := promise.NewPromise()
+
+	go func() {
+		select {
+		case r := <-future.GetChan():
+			settle(result, r)
+		case <-ctxt.Done():
+			result.Reject(StatusOf(ctxt.Err()))
+
+			future.Cancel()
+		}
+	}()
+
+	return result.Future
+}
+
+// Return a future settled as the given one, once the callback observed its outcome.
+func Finally(future *promise.Future, callback func(result interface{}, err error)) *promise.Future {
+	result := promise.NewPromise()
+
+	go func() {
+		r := <-future.GetChan()
+
+		switch r.Typ {
+		case promise.RESULT_SUCCESS:
+			callback(r.Result, nil)
+		case promise.RESULT_FAILURE:
+			err, _ := r.Result.(error)
+			callback(nil, err)
+		default:
+			callback(nil, promise.CANCELLED)
+		}
+
+		settle(result, r)
+	}()
+
+	return result.Future
+}
+
+func settle(result *promise.Promise, r *promise.PromiseResult) {
+	switch r.Typ {
+	case promise.RESULT_SUCCESS:
+		result.Resolve(r.Result)
+	case promise.RESULT_FAILURE:
+		if err, ok := r.Result.(error); ok {
+			result.Reject(err)
+		} else {
+			result.Reject(NewStatus(CodeUnknown, "%v", r.Result))
+		}
+	default:
+		result.Cancel()
+	}
+}
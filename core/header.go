@@ -0,0 +1,79 @@
+package core
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	IncomingHeaderKey = "core.header.incoming"
+	OutgoingHeaderKey = "core.header.outgoing"
+)
+
+// A Header represents the metadata carried with a call across the wire,
+// as HTTP headers or frame metadata, the keys are case insensitive.
+type Header map[string][]string
+
+func (h Header) Get(key string) string {
+	if values := h[strings.ToLower(key)]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (h Header) Set(key, value string) {
+	h[strings.ToLower(key)] = []string{value}
+}
+
+func (h Header) Add(key, value string) {
+	key = strings.ToLower(key)
+
+	h[key] = append(h[key], value)
+}
+
+func (h Header) Del(key string) {
+	delete(h, strings.ToLower(key))
+}
+
+func (h Header) Clone() Header {
+	clone := make(Header, len(h))
+
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+
+	return clone
+}
+
+// Return the header received with the call, or nil.
+func IncomingHeader(ctxt context.Context) Header {
+	h, _ := ctxt.Value(IncomingHeaderKey).(Header)
+
+	return h
+}
+
+func WithIncomingHeader(ctxt context.Context, h Header) context.Context {
+	return context.WithValue(ctxt, IncomingHeaderKey, h)
+}
+
+// Return the header to send with the call, or nil.
+func OutgoingHeader(ctxt context.Context) Header {
+	h, _ := ctxt.Value(OutgoingHeaderKey).(Header)
+
+	return h
+}
+
+func WithOutgoingHeader(ctxt context.Context, h Header) context.Context {
+	return context.WithValue(ctxt, OutgoingHeaderKey, h)
+}
+
+// Return a context whose outgoing header also holds the given key and value.
+func AppendOutgoingHeader(ctxt context.Context, key, value string) context.Context {
+	h := OutgoingHeader(ctxt).Clone()
+
+	h.Set(key, value)
+
+	return WithOutgoingHeader(ctxt, h)
+}
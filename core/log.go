@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// The Level of a log message, the messages below the current level are discarded.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) (err error) {
+	*l, err = ParseLevel(string(text))
+
+	return
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(name, s) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level `%s`", s)
+}
+
+var (
+	// The logger of the framework.
+	Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	logLevel = int32(LevelInfo)
+)
+
+func LogLevel() Level {
+	return Level(atomic.LoadInt32(&logLevel))
+}
+
+// Change the log level at runtime, for example from the admin server.
+func SetLogLevel(level Level) {
+	atomic.StoreInt32(&logLevel, int32(level))
+}
+
+func Logf(level Level, format string, args ...interface{}) {
+	if level >= LogLevel() {
+		Logger.Printf("["+level.String()+"] "+format, args...)
+	}
+}
+
+func Debugf(format string, args ...interface{}) { Logf(LevelDebug, format, args...) }
+func Infof(format string, args ...interface{})  { Logf(LevelInfo, format, args...) }
+func Warnf(format string, args ...interface{})  { Logf(LevelWarn, format, args...) }
+func Errorf(format string, args ...interface{}) { Logf(LevelError, format, args...) }
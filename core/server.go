@@ -1,9 +1,118 @@
 package core
 
 import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
 	"golang.org/x/net/context"
 )
 
 type Server interface {
 	Serve(ctxt context.Context) error
 }
+
+// A gracefulServer calls its hooks once the context is done,
+// and keeps serving for a while before shutting down the underlying server.
+type gracefulServer struct {
+	Server
+
+	hooks []func()
+	delay time.Duration
+}
+
+func (s *gracefulServer) Serve(ctxt context.Context) error {
+	inner, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.Server.Serve(inner)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctxt.Done():
+	}
+
+	for _, hook := range s.hooks {
+		hook()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.delay):
+	}
+
+	cancel()
+
+	<-done
+
+	return ctxt.Err()
+}
+
+// A Connection describes a client connected to a server.
+type Connection struct {
+	LocalAddr  string    `json:"local_addr" yaml:"local_addr"`
+	RemoteAddr string    `json:"remote_addr" yaml:"remote_addr"`
+	Since      time.Time `json:"since" yaml:"since"`
+}
+
+// A ConnectionLister is implemented by the servers which can list their active connections.
+type ConnectionLister interface {
+	Connections() []*Connection
+}
+
+// Return the connections accepted at the given times, oldest first.
+func SortConnections(conns map[net.Conn]time.Time) []*Connection {
+	result := make([]*Connection, 0, len(conns))
+
+	for conn, since := range conns {
+		result = append(result, &Connection{conn.LocalAddr().String(), conn.RemoteAddr().String(), since})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Since.Before(result[j].Since) })
+
+	return result
+}
+
+// An Admin serves the introspection of a server on a separated listener.
+type Admin interface {
+	// Return the server of the admin endpoints for the built server and its unfiltered service.
+	AdminServer(b *ServerBuilder, server Server, service Service) (Server, error)
+}
+
+// A serverGroup serves the main server with its companions, which are stopped with it.
+type serverGroup struct {
+	Server
+
+	companions []Server
+}
+
+func (g *serverGroup) Serve(ctxt context.Context) error {
+	inner, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	for _, s := range g.companions {
+		wg.Add(1)
+
+		go func(s Server) {
+			defer wg.Done()
+
+			s.Serve(inner)
+		}(s)
+	}
+
+	err := g.Server.Serve(ctxt)
+
+	cancel()
+
+	wg.Wait()
+
+	return err
+}
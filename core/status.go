@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+)
+
+// A Code classifies the outcome of a call, shared by every codec on the wire.
+type Code int
+
+const (
+	CodeOK Code = iota
+	CodeCanceled
+	CodeUnknown
+	CodeInvalidArgument
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodeAlreadyExists
+	CodePermissionDenied
+	CodeResourceExhausted
+	CodeFailedPrecondition
+	CodeAborted
+	CodeOutOfRange
+	CodeUnimplemented
+	CodeInternal
+	CodeUnavailable
+	CodeDataLoss
+	CodeUnauthenticated
+)
+
+var codeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+
+	return fmt.Sprintf("CODE(%d)", int(c))
+}
+
+// Parse the name of a code, as returned by Code.String.
+func ParseCode(name string) (Code, bool) {
+	for i, n := range codeNames {
+		if n == name {
+			return Code(i), true
+		}
+	}
+
+	return CodeUnknown, false
+}
+
+// A Status is the error returned by a failed call, which survives the trip across the wire.
+type Status struct {
+	Code    Code                   `json:"code" xml:"code" yaml:"code"`
+	Message string                 `json:"message" xml:"message" yaml:"message"`
+	Details map[string]interface{} `json:"details,omitempty" xml:"-" yaml:"details,omitempty"`
+}
+
+func NewStatus(code Code, format string, args ...interface{}) *Status {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", s.Code, s.Message)
+}
+
+// Attach a detail to the status.
+func (s *Status) WithDetail(key string, value interface{}) *Status {
+	if s.Details == nil {
+		s.Details = make(map[string]interface{})
+	}
+
+	s.Details[key] = value
+
+	return s
+}
+
+const (
+	// The detail holding how long the caller should wait before retrying, as a duration string.
+	RetryAfterDetail = "retry_after"
+)
+
+// Attach how long the caller should wait before retrying the call.
+func (s *Status) WithRetryAfter(d time.Duration) *Status {
+	return s.WithDetail(RetryAfterDetail, d.String())
+}
+
+// Return how long the caller should wait before retrying a failed call, if the server said so.
+func RetryAfterOf(err error) (time.Duration, bool) {
+	s, ok := err.(*Status)
+
+	if !ok {
+		return 0, false
+	}
+
+	v, ok := s.Details[RetryAfterDetail].(string)
+
+	if !ok {
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(v)
+
+	return d, err == nil
+}
+
+// Return the status of the error, converting well known errors to their codes.
+func StatusOf(err error) *Status {
+	switch err {
+	case nil:
+		return &Status{Code: CodeOK}
+	case context.DeadlineExceeded:
+		return &Status{Code: CodeDeadlineExceeded, Message: err.Error()}
+	case context.Canceled, promise.CANCELLED:
+		return &Status{Code: CodeCanceled, Message: err.Error()}
+	}
+
+	if s, ok := err.(*Status); ok {
+		return s
+	}
+
+	return &Status{Code: CodeUnknown, Message: err.Error()}
+}
+
+// Return the code of the error.
+func CodeOf(err error) Code {
+	return StatusOf(err).Code
+}
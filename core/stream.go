@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+)
+
+const (
+	// The number of messages a stream buffers before the sender blocks.
+	DefaultStreamWindow = 16
+)
+
+var (
+	errSendClosed = NewStatus(CodeFailedPrecondition, "send on a closed stream")
+)
+
+// A Stream exchanges the messages of a streaming call.
+//
+// A call is streaming when it has a Stream, the client sends its messages and receives the ones
+// of the server through it, while the future of the call settles with the final result.
+type Stream interface {
+	// Send a message, blocking while the peer has too many messages pending.
+	Send(v interface{}) error
+
+	// Receive the next message into the pointer, or return io.EOF once the peer closed its side.
+	Recv(v interface{}) error
+
+	// Close the sending side, the peer receives io.EOF after the messages sent before.
+	CloseSend() error
+}
+
+// A RawMessage is a message received from the wire, decoded when it's received.
+type RawMessage struct {
+	Data     []byte
+	Encoding Encoding
+}
+
+// Return the encoded message, as is if it's a RawMessage of the same encoding.
+func EncodeMessage(v interface{}, encoding Encoding) ([]byte, error) {
+	if raw, ok := v.(*RawMessage); ok && (raw.Encoding == encoding || raw.Encoding.ContentType() == encoding.ContentType()) {
+		return raw.Data, nil
+	}
+
+	return encoding.Marshal(v)
+}
+
+// Store a received message into the pointer, decoding a RawMessage unless the pointer takes any value.
+func DecodeMessage(msg, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("receive into %T, not a pointer", ptr)
+	}
+
+	v = v.Elem()
+
+	if msg == nil {
+		v.Set(reflect.Zero(v.Type()))
+
+		return nil
+	}
+
+	if raw, ok := msg.(*RawMessage); ok && v.Kind() != reflect.Interface {
+		return raw.Encoding.Unmarshal(raw.Data, ptr)
+	}
+
+	if m := reflect.ValueOf(msg); m.Type().AssignableTo(v.Type()) {
+		v.Set(m)
+
+		return nil
+	}
+
+	data, err := JsonEncoding.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return JsonEncoding.Unmarshal(data, ptr)
+}
+
+type pipeQueue struct {
+	ch     chan interface{}
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (q *pipeQueue) close() { q.once.Do(func() { close(q.closed) }) }
+
+// A pipeEnd is one end of a pipe, it sends to its peer's queue and receives from its own.
+type pipeEnd struct {
+	ctxt context.Context
+	in   *pipeQueue
+	out  *pipeQueue
+}
+
+// Return the two ends of an in memory stream, the sender blocks once the window of messages is pending.
+//
+// Once the context is done, the ends fail to send and receive the pending messages before failing too.
+func NewPipe(ctxt context.Context, window int) (Stream, Stream) {
+	if window <= 0 {
+		window = DefaultStreamWindow
+	}
+
+	a := &pipeQueue{ch: make(chan interface{}, window), closed: make(chan struct{})}
+	b := &pipeQueue{ch: make(chan interface{}, window), closed: make(chan struct{})}
+
+	return &pipeEnd{ctxt, a, b}, &pipeEnd{ctxt, b, a}
+}
+
+func (p *pipeEnd) Send(v interface{}) error {
+	select {
+	case <-p.out.closed:
+		return errSendClosed
+	case <-p.ctxt.Done():
+		return StatusOf(p.ctxt.Err())
+	default:
+	}
+
+	select {
+	case p.out.ch <- v:
+		return nil
+	case <-p.out.closed:
+		return errSendClosed
+	case <-p.ctxt.Done():
+		return StatusOf(p.ctxt.Err())
+	}
+}
+
+func (p *pipeEnd) Recv(v interface{}) error {
+	var msg interface{}
+
+	select {
+	case msg = <-p.in.ch:
+	case <-p.in.closed:
+		select {
+		case msg = <-p.in.ch:
+		default:
+			return io.EOF
+		}
+	case <-p.ctxt.Done():
+		select {
+		case msg = <-p.in.ch:
+		default:
+			select {
+			case <-p.in.closed:
+				return io.EOF
+			default:
+				return StatusOf(p.ctxt.Err())
+			}
+		}
+	}
+
+	if err := DecodeMessage(msg, v); err != nil {
+		return NewStatus(CodeInvalidArgument, "fail to decode message, %s", err)
+	}
+
+	return nil
+}
+
+func (p *pipeEnd) CloseSend() error {
+	p.out.close()
+
+	return nil
+}
+
+// Open a streaming call, and return the stream of the caller with the future of the final result.
+//
+// The stream fails to send once the call is done, while the messages received before can still be received.
+func OpenStream(ctxt context.Context, service Service, call *Call) (Stream, *promise.Future) {
+	ctxt, cancel := context.WithCancel(ctxt)
+
+	local, remote := NewPipe(ctxt, DefaultStreamWindow)
+
+	call.Stream = remote
+
+	return local, Finally(service.Apply(ctxt, call), func(interface{}, error) { cancel() })
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+)
+
+const (
+	// The header carrying the remaining time of the caller's deadline.
+	TimeoutHeader = "bucky-timeout"
+)
+
+// A TimeoutFilter bounds every call with a deadline,
+// the default timeout of the service may be overridden per method.
+//
+// It may be used on both sides, a client will propagate the deadline to the server,
+// a server will stop waiting for the service once the deadline has passed.
+type TimeoutFilter struct {
+	Timeout time.Duration
+	Methods map[string]time.Duration
+}
+
+var _ = (Filter)((*TimeoutFilter)(nil))
+
+// Return the timeout of the method, or the default one if it wasn't overridden.
+func (f *TimeoutFilter) TimeoutOf(method string) time.Duration {
+	if timeout, exists := f.Methods[method]; exists {
+		return timeout
+	}
+
+	return f.Timeout
+}
+
+func (f *TimeoutFilter) Apply(ctxt context.Context, req Request, service Service) *promise.Future {
+	timeout := f.TimeoutOf(MethodOf(req))
+
+	if timeout <= 0 {
+		return service.Apply(ctxt, req)
+	}
+
+	ctxt, cancel := context.WithTimeout(ctxt, timeout)
+
+	if err := ctxt.Err(); err != nil {
+		cancel()
+
+		return Rejected(StatusOf(err))
+	}
+
+	return Finally(WithContext(ctxt, service.Apply(ctxt, req)), func(interface{}, error) { cancel() })
+}
+
+// Store the remaining time before the context deadline in the header.
+func InjectDeadline(ctxt context.Context, h Header) {
+	if deadline, ok := ctxt.Deadline(); ok {
+		h.Set(TimeoutHeader, EncodeTimeout(deadline.Sub(time.Now())))
+	}
+}
+
+// Rebuild the caller's deadline from the header,
+// or return a DeadlineExceeded status if it has already expired.
+func ExtractDeadline(ctxt context.Context, h Header) (context.Context, context.CancelFunc, error) {
+	value := h.Get(TimeoutHeader)
+
+	if value == "" {
+		ctxt, cancel := context.WithCancel(ctxt)
+
+		return ctxt, cancel, nil
+	}
+
+	timeout, err := DecodeTimeout(value)
+
+	if err != nil {
+		return nil, nil, NewStatus(CodeInvalidArgument, "malformed %s header `%s`", TimeoutHeader, value)
+	}
+
+	if timeout <= 0 {
+		return nil, nil, NewStatus(CodeDeadlineExceeded, "deadline expired before the call was started")
+	}
+
+	ctxt, cancel := context.WithDeadline(ctxt, time.Now().Add(timeout))
+
+	return ctxt, cancel, nil
+}
+
+// Encode a timeout as the value of the timeout header, with millisecond precision.
+func EncodeTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "0s"
+	}
+
+	if timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+
+	return (timeout / time.Millisecond * time.Millisecond).String()
+}
+
+func DecodeTimeout(value string) (time.Duration, error) {
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+)
+
+func TestTimeoutFilter(t *testing.T) {
+	Convey("create TimeoutFilter", t, func() {
+		f := &TimeoutFilter{
+			Timeout: time.Second,
+			Methods: map[string]time.Duration{"slow": 10 * time.Millisecond},
+		}
+
+		So(f.TimeoutOf("fast"), ShouldEqual, time.Second)
+		So(f.TimeoutOf("slow"), ShouldEqual, 10*time.Millisecond)
+
+		var deadline time.Time
+
+		service := ServiceFunc(func(ctxt context.Context, req Request) *promise.Future {
+			deadline, _ = ctxt.Deadline()
+
+			return promise.NewPromise().Future
+		})
+
+		Convey("apply to a slow method", func() {
+			_, err := f.Apply(context.Background(), &Call{Method: "slow"}, service).Get()
+
+			So(CodeOf(err), ShouldEqual, CodeDeadlineExceeded)
+			So(deadline.IsZero(), ShouldBeFalse)
+		})
+
+		Convey("apply with an expired context", func() {
+			ctxt, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+			defer cancel()
+
+			time.Sleep(time.Millisecond)
+
+			_, err := f.Apply(ctxt, &Call{Method: "fast"}, service).Get()
+
+			So(CodeOf(err), ShouldEqual, CodeDeadlineExceeded)
+			So(deadline.IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	Convey("inject and extract a deadline", t, func() {
+		h := make(Header)
+
+		ctxt, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		InjectDeadline(ctxt, h)
+
+		timeout, err := DecodeTimeout(h.Get(TimeoutHeader))
+
+		So(err, ShouldBeNil)
+		So(timeout, ShouldBeBetweenOrEqual, time.Minute-time.Second, time.Minute)
+
+		ctxt, cancel, err = ExtractDeadline(context.Background(), h)
+		defer cancel()
+
+		So(err, ShouldBeNil)
+
+		deadline, ok := ctxt.Deadline()
+
+		So(ok, ShouldBeTrue)
+		So(deadline.Sub(time.Now()), ShouldBeBetweenOrEqual, time.Minute-time.Second, time.Minute)
+	})
+
+	Convey("extract an expired deadline", t, func() {
+		h := Header{TimeoutHeader: []string{EncodeTimeout(-time.Second)}}
+
+		_, _, err := ExtractDeadline(context.Background(), h)
+
+		So(CodeOf(err), ShouldEqual, CodeDeadlineExceeded)
+	})
+
+	Convey("extract without deadline", t, func() {
+		ctxt, cancel, err := ExtractDeadline(context.Background(), Header{})
+		defer cancel()
+
+		So(err, ShouldBeNil)
+
+		_, ok := ctxt.Deadline()
+
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,211 @@
+package discovery
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/balancer"
+	"github.com/flier/bucky/core"
+)
+
+const (
+	Scheme = "discovery"
+)
+
+var (
+	// How long a client built for a discovery URI waits for the first set of endpoints.
+	InitialTimeout = 5 * time.Second
+
+	// The delay between the fetches of the endpoints when a resolver has none, such as a zero TTL or interval.
+	DefaultPollInterval = 5 * time.Second
+
+	resolversLock sync.RWMutex
+	resolvers     = make(map[string]Resolver)
+)
+
+// A Resolver resolves the logical name of a service into its endpoints.
+type Resolver interface {
+	// Return a stream of endpoint sets, updated whenever the set changes, until the context is done.
+	Resolve(ctxt context.Context, name string) (<-chan []*core.Endpoint, error)
+}
+
+// Register a resolver under a name, the `default` one is used unless the URI asks for another one.
+func Register(name string, resolver Resolver) {
+	resolversLock.Lock()
+	resolvers[name] = resolver
+	resolversLock.Unlock()
+}
+
+func lookup(name string) (Resolver, bool) {
+	resolversLock.RLock()
+	resolver, exists := resolvers[name]
+	resolversLock.RUnlock()
+
+	return resolver, exists
+}
+
+func init() {
+	core.RegisterScheme(Scheme, NewClient)
+}
+
+// Build a balanced client for a URI like `discovery://stringsvc?scheme=http&balancer=round_robin&resolver=default`,
+// whose endpoints are resolved by the named resolver and dialed with the codec of the builder.
+func NewClient(b *core.ClientBuilder) (core.Service, error) {
+	query := b.Uri.Query()
+
+	name := query.Get("resolver")
+
+	if name == "" {
+		name = "default"
+	}
+
+	resolver, exists := lookup(name)
+
+	if !exists {
+		return nil, fmt.Errorf("unknown resolver `%s`", name)
+	}
+
+	strategy := balancer.RoundRobin
+
+	if name := query.Get("balancer"); name != "" {
+		if strategy, exists = balancer.StrategyByName(name); !exists {
+			return nil, fmt.Errorf("unknown balancer `%s`", name)
+		}
+	}
+
+	template := *b
+	template.Filters = nil
+
+	u := *b.Uri
+	u.Scheme = query.Get("scheme")
+	u.RawQuery = ""
+
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+
+	template.Uri = &u
+
+	lb := balancer.NewBalancer(strategy, balancer.NewDialer(&template))
+
+	ctxt, cancel := context.WithCancel(context.Background())
+
+	ready, err := Watch(ctxt, resolver, b.Uri.Host, lb)
+
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	select {
+	case <-ready:
+	case <-time.After(InitialTimeout):
+	}
+
+	return &discoveryClient{lb, cancel}, nil
+}
+
+type discoveryClient struct {
+	*balancer.Balancer
+
+	cancel context.CancelFunc
+}
+
+var _ = (io.Closer)((*discoveryClient)(nil))
+
+// Stop watching the endpoints, and close their clients.
+func (c *discoveryClient) Close() error {
+	c.cancel()
+
+	return c.Balancer.Close()
+}
+
+// Keep the endpoints of the balancer up to date with the resolved ones until the context is done,
+// the returned channel is closed after the first update.
+func Watch(ctxt context.Context, resolver Resolver, name string, lb *balancer.Balancer) (<-chan struct{}, error) {
+	updates, err := resolver.Resolve(ctxt, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ready := make(chan struct{})
+
+	go func() {
+		first := true
+
+		for endpoints := range updates {
+			lb.Update(endpoints)
+
+			if first {
+				close(ready)
+
+				first = false
+			}
+		}
+	}()
+
+	return ready, nil
+}
+
+type fetchFunc func(ctxt context.Context) ([]*core.Endpoint, time.Duration, error)
+
+// Fetch the endpoints until the context is done, after the delay returned by each fetch or DefaultPollInterval,
+// and emit them whenever they changed.
+func poll(ctxt context.Context, fetch fetchFunc, onError func(err error)) <-chan []*core.Endpoint {
+	updates := make(chan []*core.Endpoint, 1)
+
+	go func() {
+		defer close(updates)
+
+		var last []*core.Endpoint
+		var emitted bool
+
+		for {
+			endpoints, delay, err := fetch(ctxt)
+
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+			} else {
+				sort.Sort(endpointsByAddress(endpoints))
+
+				if !emitted || !reflect.DeepEqual(endpoints, last) {
+					select {
+					case updates <- endpoints:
+					case <-ctxt.Done():
+						return
+					}
+
+					last, emitted = endpoints, true
+				}
+			}
+
+			if delay <= 0 {
+				delay = DefaultPollInterval
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-ctxt.Done():
+				return
+			}
+		}
+	}()
+
+	return updates
+}
+
+type endpointsByAddress []*core.Endpoint
+
+func (s endpointsByAddress) Len() int           { return len(s) }
+func (s endpointsByAddress) Less(i, j int) bool { return s[i].Address < s[j].Address }
+func (s endpointsByAddress) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/balancer"
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+type stringService struct{}
+
+func (stringService) Uppercase(s string) string { return strings.ToUpper(s) }
+
+func serve(v interface{}) *httptest.Server {
+	codec := http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "test", Addr: &net.TCPAddr{}})
+
+	return httptest.NewServer(codec.ServerDispatcher(nil, rpc.NativeFactory.Build(v)).(nethttp.Handler))
+}
+
+func TestFileResolver(t *testing.T) {
+	Convey("resolve endpoints from a file", t, func() {
+		dir, err := ioutil.TempDir("", "discovery")
+
+		So(err, ShouldBeNil)
+
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "services.yaml")
+
+		So(ioutil.WriteFile(path, []byte("stringsvc:\n  - address: 10.0.0.1:8080\n    weight: 2\n"), 0644), ShouldBeNil)
+
+		r := &FileResolver{Path: path, Interval: 10 * time.Millisecond}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, err := r.Resolve(ctxt, "stringsvc")
+
+		So(err, ShouldBeNil)
+		So(<-updates, ShouldResemble, []*core.Endpoint{{Address: "10.0.0.1:8080", Weight: 2}})
+
+		So(ioutil.WriteFile(path, []byte("stringsvc:\n  - address: 10.0.0.2:8080\n    zone: b\n  - address: 10.0.0.1:8080\n"), 0644), ShouldBeNil)
+
+		So(<-updates, ShouldResemble, []*core.Endpoint{{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080", Zone: "b"}})
+
+		Convey("resolve from a missing file", func() {
+			_, err := (&FileResolver{Path: filepath.Join(dir, "missing.json")}).Resolve(ctxt, "stringsvc")
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPoll(t *testing.T) {
+	Convey("poll the endpoints without delay", t, func() {
+		var fetches int32
+
+		ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		updates := poll(ctxt, func(ctxt context.Context) ([]*core.Endpoint, time.Duration, error) {
+			atomic.AddInt32(&fetches, 1)
+
+			return nil, 0, nil
+		}, nil)
+
+		for range updates {
+		}
+
+		So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	Convey("register endpoints", t, func() {
+		r := NewRegistry()
+
+		So(r.Register(&Registration{Service: "stringsvc", Endpoint: core.NewEndpoint("b:80")}), ShouldBeNil)
+		So(r.Register(&Registration{Service: "stringsvc", Endpoint: core.NewEndpoint("a:80")}), ShouldBeNil)
+		So(r.Register(&Registration{Service: "stringsvc"}), ShouldNotBeNil)
+		So(r.Services(), ShouldResemble, []string{"stringsvc"})
+		So(r.Lookup("stringsvc"), ShouldResemble, []*core.Endpoint{core.NewEndpoint("a:80"), core.NewEndpoint("b:80")})
+
+		So(r.Deregister(&Registration{Service: "stringsvc", Endpoint: core.NewEndpoint("a:80")}), ShouldBeNil)
+		So(r.Lookup("stringsvc"), ShouldResemble, []*core.Endpoint{core.NewEndpoint("b:80")})
+
+		r.DefaultTTL = -time.Second
+
+		So(r.Register(&Registration{Service: "stringsvc", Endpoint: core.NewEndpoint("a:80")}), ShouldBeNil)
+		So(r.Lookup("stringsvc"), ShouldResemble, []*core.Endpoint{core.NewEndpoint("b:80")})
+	})
+
+	Convey("call a service discovered from a registry", t, func() {
+		registry := serve(NewRegistry())
+		defer registry.Close()
+
+		stringsvc := serve(stringService{})
+		defer stringsvc.Close()
+
+		registryUri, _ := url.Parse(registry.URL)
+
+		client := (&core.ClientBuilder{Uri: registryUri, CodecFactory: http.HttpCodec}).Build()
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		So(Announce(ctxt, client, &Registration{Service: "stringsvc", Endpoint: core.NewEndpoint(strings.TrimPrefix(stringsvc.URL, "http://"))}), ShouldBeNil)
+
+		Register("registry", &RegistryResolver{Client: client, Interval: 10 * time.Millisecond})
+
+		uri, _ := url.Parse("discovery://stringsvc?resolver=registry&balancer=p2c")
+
+		service, err := (&core.ClientBuilder{Uri: uri, CodecFactory: http.HttpCodec}).BuildE()
+
+		So(err, ShouldBeNil)
+
+		var reply string
+
+		_, err = service.Apply(ctxt, &core.Call{Method: "Uppercase", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+		So(err, ShouldBeNil)
+		So(reply, ShouldEqual, "HELLO")
+
+		Convey("close the clients of the endpoints", func() {
+			So(service.(io.Closer).Close(), ShouldBeNil)
+
+			_, err := service.Apply(ctxt, &core.Call{Method: "Uppercase", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+			So(err, ShouldEqual, balancer.ErrNoEndpoint)
+		})
+
+		Convey("build with an unknown resolver", func() {
+			uri, _ := url.Parse("discovery://stringsvc?resolver=unknown")
+
+			_, err := (&core.ClientBuilder{Uri: uri, CodecFactory: http.HttpCodec}).BuildE()
+
+			So(err.Error(), ShouldEqual, "Uri: unknown resolver `unknown`")
+		})
+	})
+}
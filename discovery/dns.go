@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A DNSResolver resolves the endpoints from the SRV records of the service,
+// or from the A and AAAA records of the name when no Service is given.
+//
+// The standard resolver doesn't expose the TTL of the records,
+// so the records are refreshed after TTL, which should match the one of the zone.
+type DNSResolver struct {
+	Service, Proto string // the SRV service and protocol, such as `http` and `tcp`
+	Port           int    // the port of the endpoints resolved from A records
+	TTL            time.Duration
+	Resolver       *net.Resolver
+	OnError        func(err error)
+}
+
+var _ = (Resolver)((*DNSResolver)(nil))
+
+func NewDNSResolver(service, proto string) *DNSResolver {
+	return &DNSResolver{Service: service, Proto: proto, TTL: 30 * time.Second, Resolver: net.DefaultResolver}
+}
+
+func (r *DNSResolver) Resolve(ctxt context.Context, name string) (<-chan []*core.Endpoint, error) {
+	return poll(ctxt, func(ctxt context.Context) ([]*core.Endpoint, time.Duration, error) {
+		endpoints, err := r.lookup(ctxt, name)
+
+		return endpoints, r.TTL, err
+	}, r.OnError), nil
+}
+
+func (r *DNSResolver) lookup(ctxt context.Context, name string) ([]*core.Endpoint, error) {
+	resolver := r.Resolver
+
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	if r.Service == "" {
+		addrs, err := resolver.LookupHost(ctxt, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints := make([]*core.Endpoint, len(addrs))
+
+		for i, addr := range addrs {
+			endpoints[i] = core.NewEndpoint(net.JoinHostPort(addr, strconv.Itoa(r.Port)))
+		}
+
+		return endpoints, nil
+	}
+
+	_, records, err := resolver.LookupSRV(ctxt, r.Service, r.Proto, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*core.Endpoint
+
+	// the records are sorted by priority, only the most preferred ones are used
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			break
+		}
+
+		endpoints = append(endpoints, &core.Endpoint{
+			Address: net.JoinHostPort(srv.Target, strconv.Itoa(int(srv.Port))),
+			Weight:  int(srv.Weight),
+		})
+	}
+
+	return endpoints, nil
+}
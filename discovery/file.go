@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/flier/bucky/core"
+)
+
+// A FileResolver reads the endpoints from a YAML or JSON file, which maps service names to their endpoints,
+//
+//	stringsvc:
+//	  - address: 10.0.0.1:8080
+//	    weight: 2
+//	    zone: us-east-1a
+//
+// The file is watched and the endpoints are updated whenever it changes.
+type FileResolver struct {
+	Path     string
+	Interval time.Duration
+	OnError  func(err error)
+}
+
+var _ = (Resolver)((*FileResolver)(nil))
+
+func NewFileResolver(path string) *FileResolver {
+	return &FileResolver{Path: path, Interval: 5 * time.Second}
+}
+
+func (r *FileResolver) Resolve(ctxt context.Context, name string) (<-chan []*core.Endpoint, error) {
+	if _, err := os.Stat(r.Path); err != nil {
+		return nil, err
+	}
+
+	var modified time.Time
+	var size int64
+	var endpoints []*core.Endpoint
+
+	return poll(ctxt, func(ctxt context.Context) ([]*core.Endpoint, time.Duration, error) {
+		info, err := os.Stat(r.Path)
+
+		if err != nil {
+			return nil, r.Interval, err
+		}
+
+		if info.ModTime().Equal(modified) && info.Size() == size {
+			return endpoints, r.Interval, nil
+		}
+
+		services, err := r.load()
+
+		if err != nil {
+			return nil, r.Interval, err
+		}
+
+		modified, size, endpoints = info.ModTime(), info.Size(), services[name]
+
+		return endpoints, r.Interval, nil
+	}, r.OnError), nil
+}
+
+func (r *FileResolver) load() (map[string][]*core.Endpoint, error) {
+	data, err := ioutil.ReadFile(r.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var services map[string][]*core.Endpoint
+
+	if filepath.Ext(r.Path) == ".json" {
+		err = json.Unmarshal(data, &services)
+	} else {
+		err = yaml.Unmarshal(data, &services)
+	}
+
+	return services, err
+}
@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A Registration announces an endpoint of a service, which expires after TTL seconds
+// unless it is registered again.
+type Registration struct {
+	Service  string         `json:"service" yaml:"service"`
+	Endpoint *core.Endpoint `json:"endpoint" yaml:"endpoint"`
+	TTL      int            `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// A Registry keeps the endpoints registered by the services,
+// it is a plain object meant to be served as a bucky service with bucky.Rpc.
+type Registry struct {
+	DefaultTTL time.Duration
+
+	lock     sync.Mutex
+	services map[string]map[string]*entry
+}
+
+type entry struct {
+	endpoint *core.Endpoint
+	expires  time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{DefaultTTL: 30 * time.Second, services: make(map[string]map[string]*entry)}
+}
+
+// Register or refresh an endpoint of a service.
+func (r *Registry) Register(reg *Registration) error {
+	if reg == nil || reg.Service == "" {
+		return core.NewStatus(core.CodeInvalidArgument, "no service was specified")
+	}
+
+	if reg.Endpoint == nil || reg.Endpoint.Address == "" {
+		return core.NewStatus(core.CodeInvalidArgument, "no endpoint address was specified")
+	}
+
+	ttl := time.Duration(reg.TTL) * time.Second
+
+	if ttl <= 0 {
+		ttl = r.DefaultTTL
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	endpoints, exists := r.services[reg.Service]
+
+	if !exists {
+		endpoints = make(map[string]*entry)
+
+		r.services[reg.Service] = endpoints
+	}
+
+	endpoints[reg.Endpoint.Address] = &entry{reg.Endpoint, time.Now().Add(ttl)}
+
+	return nil
+}
+
+// Remove an endpoint of a service.
+func (r *Registry) Deregister(reg *Registration) error {
+	if reg == nil || reg.Endpoint == nil {
+		return core.NewStatus(core.CodeInvalidArgument, "no endpoint was specified")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if endpoints, exists := r.services[reg.Service]; exists {
+		delete(endpoints, reg.Endpoint.Address)
+
+		if len(endpoints) == 0 {
+			delete(r.services, reg.Service)
+		}
+	}
+
+	return nil
+}
+
+// Return the live endpoints of a service.
+func (r *Registry) Lookup(service string) []*core.Endpoint {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+
+	endpoints := make([]*core.Endpoint, 0, len(r.services[service]))
+
+	for addr, e := range r.services[service] {
+		if now.After(e.expires) {
+			delete(r.services[service], addr)
+		} else {
+			endpoints = append(endpoints, e.endpoint)
+		}
+	}
+
+	sort.Sort(endpointsByAddress(endpoints))
+
+	return endpoints
+}
+
+// Return the names of the registered services.
+func (r *Registry) Services() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.services))
+
+	for name := range r.services {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// A RegistryResolver polls a registry service for the endpoints.
+type RegistryResolver struct {
+	Client   core.Service
+	Interval time.Duration
+	OnError  func(err error)
+}
+
+var _ = (Resolver)((*RegistryResolver)(nil))
+
+func NewRegistryResolver(client core.Service) *RegistryResolver {
+	return &RegistryResolver{Client: client, Interval: 10 * time.Second}
+}
+
+func (r *RegistryResolver) Resolve(ctxt context.Context, name string) (<-chan []*core.Endpoint, error) {
+	return poll(ctxt, func(ctxt context.Context) ([]*core.Endpoint, time.Duration, error) {
+		var endpoints []*core.Endpoint
+
+		result, err := r.Client.Apply(ctxt, &core.Call{Method: "Lookup", Args: []interface{}{name}, Reply: &endpoints}).Get()
+
+		if err != nil {
+			return nil, r.Interval, err
+		}
+
+		if direct, ok := result.([]*core.Endpoint); ok {
+			endpoints = direct
+		}
+
+		return endpoints, r.Interval, nil
+	}, r.OnError), nil
+}
+
+// Register the endpoint to the registry service, and keep it registered until the context is done.
+func Announce(ctxt context.Context, client core.Service, reg *Registration) error {
+	call := func(ctxt context.Context, method string) error {
+		_, err := client.Apply(ctxt, &core.Call{Method: method, Args: []interface{}{reg}}).Get()
+
+		return err
+	}
+
+	if err := call(ctxt, "Register"); err != nil {
+		return err
+	}
+
+	ttl := time.Duration(reg.TTL) * time.Second
+
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+
+	go func() {
+		for {
+			select {
+			case <-time.After(ttl / 3):
+				call(ctxt, "Register")
+			case <-ctxt.Done():
+				ctxt, cancel := context.WithTimeout(context.Background(), ttl/3)
+
+				call(ctxt, "Deregister")
+
+				cancel()
+
+				return
+			}
+		}
+	}()
+
+	return nil
+}
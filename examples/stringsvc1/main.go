@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"log"
 	"net"
 	"strings"
 
@@ -12,10 +13,12 @@ import (
 
 var ErrEmpty = errors.New("empty string")
 
+//go:generate bucky gen StringService
+
 type StringService interface {
-	Uppercase(string) (string, error)
+	Uppercase(s string) (string, error)
 
-	Count(string) int
+	Count(s string) int
 }
 
 type stringService struct {
@@ -42,5 +45,11 @@ func main() {
 		Encoding:     bucky.Json,
 	}
 
-	builder.Build(bucky.Rpc(&stringService{})).Serve(ctxt)
+	server, err := builder.BuildE(bucky.Rpc(NewStringServiceServer(&stringService{})))
+
+	if err != nil {
+		log.Fatalf("fail to build server, %s", err)
+	}
+
+	server.Serve(ctxt)
 }
@@ -0,0 +1,173 @@
+// Code generated by bucky gen. DO NOT EDIT.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+	"golang.org/x/net/context"
+)
+
+// StringServiceCountRequest is the request of StringService.Count.
+type StringServiceCountRequest struct {
+	S string `json:"s"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StringServiceCountRequest) Args() []interface{} {
+	return []interface{}{req.S}
+}
+
+// StringServiceCountResponse is the response of StringService.Count.
+type StringServiceCountResponse struct {
+	Result int `json:"result"`
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StringServiceCountResponse) Results() []interface{} {
+	return []interface{}{&resp.Result}
+}
+
+// StringServiceUppercaseRequest is the request of StringService.Uppercase.
+type StringServiceUppercaseRequest struct {
+	S string `json:"s"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StringServiceUppercaseRequest) Args() []interface{} {
+	return []interface{}{req.S}
+}
+
+// StringServiceUppercaseResponse is the response of StringService.Uppercase.
+type StringServiceUppercaseResponse struct {
+	Result string `json:"result"`
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StringServiceUppercaseResponse) Results() []interface{} {
+	return []interface{}{&resp.Result}
+}
+
+// StringServiceClient calls the methods of a StringService served by bucky.
+type StringServiceClient struct {
+	Service core.Service
+}
+
+func NewStringServiceClient(service core.Service) *StringServiceClient {
+	return &StringServiceClient{service}
+}
+
+// Call StringService.Count.
+func (client *StringServiceClient) Count(ctxt context.Context, s string) (int, error) {
+	req := &StringServiceCountRequest{S: s}
+
+	var resp StringServiceCountResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Count", req.Args(), resp.Results()...)
+
+	return resp.Result, err
+}
+
+// Call StringService.Uppercase.
+func (client *StringServiceClient) Uppercase(ctxt context.Context, s string) (string, error) {
+	req := &StringServiceUppercaseRequest{S: s}
+
+	var resp StringServiceUppercaseResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Uppercase", req.Args(), resp.Results()...)
+
+	return resp.Result, err
+}
+
+// StringServiceServer serves an implementation of StringService, naming the parameters of its methods.
+type StringServiceServer struct {
+	Impl StringService
+}
+
+var _ = (rpc.ParamNamer)((*StringServiceServer)(nil))
+var _ = (rpc.MethodOptioner)((*StringServiceServer)(nil))
+
+func NewStringServiceServer(impl StringService) *StringServiceServer {
+	return &StringServiceServer{impl}
+}
+
+func (server *StringServiceServer) Count(s string) int {
+	return server.Impl.Count(s)
+}
+
+func (server *StringServiceServer) Uppercase(s string) (string, error) {
+	return server.Impl.Uppercase(s)
+}
+
+// Return the names of the parameters, without the context and the streams.
+func (server *StringServiceServer) ParamNames() map[string][]string {
+	return map[string][]string{
+		"Count":     {"s"},
+		"Uppercase": {"s"},
+	}
+}
+
+// Return the options of the methods, set by the implementation.
+func (server *StringServiceServer) MethodOptions() map[string]*rpc.MethodOptions {
+	if optioner, ok := server.Impl.(rpc.MethodOptioner); ok {
+		return optioner.MethodOptions()
+	}
+
+	return nil
+}
+
+// StringServiceMock mocks a StringService, its methods call the functions of the same name and record their requests.
+type StringServiceMock struct {
+	CountFunc     func(s string) int
+	UppercaseFunc func(s string) (string, error)
+
+	lock  sync.Mutex
+	calls struct {
+		Count     []*StringServiceCountRequest
+		Uppercase []*StringServiceUppercaseRequest
+	}
+}
+
+var _ = (StringService)((*StringServiceMock)(nil))
+
+func (mock *StringServiceMock) Count(s string) int {
+	mock.lock.Lock()
+	mock.calls.Count = append(mock.calls.Count, &StringServiceCountRequest{S: s})
+	mock.lock.Unlock()
+
+	if mock.CountFunc == nil {
+		panic("StringServiceMock.CountFunc isn't set")
+	}
+
+	return mock.CountFunc(s)
+}
+
+// Return the requests of the Count calls.
+func (mock *StringServiceMock) CountCalls() []*StringServiceCountRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StringServiceCountRequest(nil), mock.calls.Count...)
+}
+
+func (mock *StringServiceMock) Uppercase(s string) (string, error) {
+	mock.lock.Lock()
+	mock.calls.Uppercase = append(mock.calls.Uppercase, &StringServiceUppercaseRequest{S: s})
+	mock.lock.Unlock()
+
+	if mock.UppercaseFunc == nil {
+		panic("StringServiceMock.UppercaseFunc isn't set")
+	}
+
+	return mock.UppercaseFunc(s)
+}
+
+// Return the requests of the Uppercase calls.
+func (mock *StringServiceMock) UppercaseCalls() []*StringServiceUppercaseRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StringServiceUppercaseRequest(nil), mock.calls.Uppercase...)
+}
@@ -0,0 +1,272 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/trace"
+)
+
+// The Format of the access log records.
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatLogfmt
+)
+
+// A RedactRule replaces the value of the fields matching a pattern regardless of case,
+// such as `header.authorization` or `header.x-*`, or drops them if the replacement is empty.
+type RedactRule struct {
+	Pattern     string
+	Replacement string
+}
+
+// A Field of an access log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// An AccessLogFilter writes a structured record per call, such as
+//
+//	time=2006-01-02T15:04:05.999Z service=echo method=Echo peer=127.0.0.1:51234 latency_ms=0.42 status=OK request_size=7 response_size=7 trace_id=4bf92f3577b34da6a3ce929d0e0e4736
+//
+// the failed calls also log their error message.
+//
+// The filter should follow the tracing filter, which attaches the span of the call.
+type AccessLogFilter struct {
+	Writer io.Writer
+	Format Format
+
+	// The name of the service when the calls don't carry it, such as on the client side.
+	Service string
+
+	// Log the calls sent by a client rather than served by a server.
+	Client bool
+
+	// The fraction of the calls logged per status code, SampleRate for the others.
+	SampleRates map[core.Code]float64
+	SampleRate  float64
+
+	// The incoming or outgoing headers logged as `header.<name>` fields.
+	Headers []string
+
+	// The rules applied to the fields, the first matching rule wins.
+	Redact []RedactRule
+
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+var _ = (core.Filter)((*AccessLogFilter)(nil))
+
+func NewAccessLogFilter(w io.Writer, format Format) *AccessLogFilter {
+	return &AccessLogFilter{Writer: w, Format: format, SampleRate: 1}
+}
+
+func (f *AccessLogFilter) sampled(code core.Code) bool {
+	rate, ok := f.SampleRates[code]
+
+	if !ok {
+		rate = f.SampleRate
+	}
+
+	if rate >= 1 {
+		return true
+	}
+
+	if rate <= 0 {
+		return false
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.random == nil {
+		f.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return f.random.Float64() < rate
+}
+
+func (f *AccessLogFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	started := time.Now()
+
+	var info *core.CallInfo
+	var h core.Header
+
+	if f.Client {
+		ctxt, info = core.EnsureOutgoingCallInfo(ctxt)
+		h = core.OutgoingHeader(ctxt)
+	} else {
+		info, _ = core.IncomingCallInfo(ctxt)
+		h = core.IncomingHeader(ctxt)
+	}
+
+	return core.Finally(service.Apply(ctxt, req), func(result interface{}, err error) {
+		latency := time.Since(started)
+		status := core.StatusOf(err)
+
+		if !f.sampled(status.Code) {
+			return
+		}
+
+		name := f.Service
+
+		if call, ok := req.(*core.Call); ok && call.Service != "" {
+			name = call.Service
+		}
+
+		fields := []Field{
+			{"time", started.UTC().Format(time.RFC3339Nano)},
+			{"service", name},
+			{"method", core.MethodOf(req)},
+			{"peer", ""},
+			{"latency_ms", float64(latency.Nanoseconds()/1000) / 1000},
+			{"status", status.Code.String()},
+		}
+
+		if err != nil {
+			fields = append(fields, Field{"error", status.Message})
+		}
+
+		if span := trace.SpanOf(ctxt); span != nil {
+			fields = append(fields, Field{"trace_id", span.TraceID.String()})
+		} else if sc, ok := trace.Extract(h); ok {
+			fields = append(fields, Field{"trace_id", sc.TraceID.String()})
+		}
+
+		for _, key := range f.Headers {
+			if value := h.Get(key); value != "" {
+				fields = append(fields, Field{"header." + strings.ToLower(key), value})
+			}
+		}
+
+		withSizes := func(info *core.CallInfo) []Field {
+			fields[3].Value = info.Peer
+
+			return append(fields, Field{"request_size", info.RequestSize}, Field{"response_size", info.ResponseSize()})
+		}
+
+		switch {
+		case info == nil:
+			f.write(fields)
+		case f.Client:
+			// the client codecs have filled the info before the call completed
+			f.write(withSizes(info))
+		default:
+			// the response of a served call is encoded once the filters have completed
+			info.OnComplete(func(info *core.CallInfo) { f.write(withSizes(info)) })
+		}
+	})
+}
+
+// Apply the redaction rules to the fields, and drop the empty ones.
+func (f *AccessLogFilter) redact(fields []Field) []Field {
+	redacted := make([]Field, 0, len(fields))
+
+	for _, field := range fields {
+		key := strings.ToLower(field.Key)
+
+		for _, rule := range f.Redact {
+			if matched, _ := path.Match(strings.ToLower(rule.Pattern), key); matched {
+				field.Value = rule.Replacement
+				break
+			}
+		}
+
+		if field.Value != "" {
+			redacted = append(redacted, field)
+		}
+	}
+
+	return redacted
+}
+
+func (f *AccessLogFilter) write(fields []Field) {
+	var buf bytes.Buffer
+
+	switch f.Format {
+	case FormatLogfmt:
+		FormatLogfmtRecord(&buf, f.redact(fields))
+	default:
+		FormatJSONRecord(&buf, f.redact(fields))
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, err := f.Writer.Write(buf.Bytes()); err != nil {
+		core.Warnf("fail to write access log, %s", err)
+	}
+}
+
+// Write the fields as a JSON object on a line, in their order.
+func FormatJSONRecord(buf *bytes.Buffer, fields []Field) {
+	buf.WriteByte('{')
+
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(field.Key)
+		value, err := json.Marshal(field.Value)
+
+		if err != nil {
+			value, _ = json.Marshal(err.Error())
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteString("}\n")
+}
+
+// Write the fields as logfmt key=value pairs on a line, quoting the values when needed.
+func FormatLogfmtRecord(buf *bytes.Buffer, fields []Field) {
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+
+		var value string
+
+		switch v := field.Value.(type) {
+		case string:
+			value = v
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			value = strconv.Itoa(v)
+		default:
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n\\") {
+			value = strconv.Quote(value)
+		}
+
+		buf.WriteString(value)
+	}
+
+	buf.WriteByte('\n')
+}
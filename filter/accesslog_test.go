@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/trace"
+	"github.com/flier/bucky/transport"
+)
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Lines() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return strings.ToUpper(s) }
+
+func TestAccessLogFilter(t *testing.T) {
+	Convey("log the calls served over TCP", t, func() {
+		var logs syncBuffer
+
+		accessLog := NewAccessLogFilter(&logs, FormatJSON)
+		accessLog.Headers = []string{"Authorization", "User-Agent"}
+		accessLog.Redact = []RedactRule{{"header.authorization", "[REDACTED]"}}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{
+				Name:         "echo",
+				Addr:         addr,
+				CodecFactory: transport.TcpCodec,
+				Filters:      []core.Filter{trace.NewTracer("echo", nil).ServerFilter(), accessLog},
+			}).Build(rpc.NativeFactory.Build(echoService{}))
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: transport.TcpCodec}).Build()
+
+		call := core.AppendOutgoingHeader(core.AppendOutgoingHeader(ctxt, "Authorization", "Bearer secret"), "User-Agent", "test")
+
+		for i := 0; i < 100; i++ {
+			if _, err = client.Apply(call, &core.Call{Method: "Echo", Args: []interface{}{"hello"}}).Get(); core.CodeOf(err) != core.CodeUnavailable {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		So(err, ShouldBeNil)
+
+		var record map[string]interface{}
+
+		So(json.Unmarshal([]byte(logs.Lines()[0]), &record), ShouldBeNil)
+		So(record["service"], ShouldEqual, "echo")
+		So(record["method"], ShouldEqual, "Echo")
+		So(record["peer"], ShouldStartWith, "127.0.0.1:")
+		So(record["status"], ShouldEqual, "OK")
+		So(record["request_size"], ShouldEqual, 7)
+		So(record["response_size"], ShouldEqual, 7)
+		So(record["trace_id"], ShouldHaveLength, 32)
+		So(record["header.authorization"], ShouldEqual, "[REDACTED]")
+		So(record["header.user-agent"], ShouldEqual, "test")
+		So(record, ShouldContainKey, "latency_ms")
+		So(record, ShouldContainKey, "time")
+		So(record, ShouldNotContainKey, "error")
+	})
+
+	Convey("redact the fields regardless of case", t, func() {
+		accessLog := NewAccessLogFilter(ioutil.Discard, FormatJSON)
+		accessLog.Redact = []RedactRule{{"header.Authorization", "[REDACTED]"}, {"HEADER.X-*", ""}}
+
+		So(accessLog.redact([]Field{
+			{"header.authorization", "Bearer secret"},
+			{"Header.Authorization", "Bearer secret"},
+			{"header.x-api-key", "secret"},
+			{"header.user-agent", "test"},
+		}), ShouldResemble, []Field{
+			{"header.authorization", "[REDACTED]"},
+			{"Header.Authorization", "[REDACTED]"},
+			{"header.user-agent", "test"},
+		})
+	})
+
+	Convey("log the failed calls sent by a client in logfmt", t, func() {
+		var logs syncBuffer
+
+		accessLog := NewAccessLogFilter(&logs, FormatLogfmt)
+		accessLog.Client = true
+		accessLog.Service = "echo"
+		accessLog.SampleRates = map[core.Code]float64{core.CodeOK: 0}
+		accessLog.Redact = []RedactRule{{"time", ""}, {"latency_ms", ""}}
+
+		service, _ := failing(core.CodeNotFound)
+
+		_, err := accessLog.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeNotFound)
+
+		_, err = accessLog.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(logs.Lines(), ShouldResemble, []string{
+			`service=echo method=Get status=NOT_FOUND error="attempt 1 failed" request_size=0 response_size=0`,
+		})
+	})
+}
@@ -0,0 +1,476 @@
+package filter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+type WindowType int
+
+const (
+	CountWindow WindowType = iota // the last WindowSize calls
+	TimeWindow                    // the calls of the last WindowDuration
+)
+
+var (
+	DefaultFailureCodes = []core.Code{
+		core.CodeUnknown,
+		core.CodeDeadlineExceeded,
+		core.CodeInternal,
+		core.CodeUnavailable,
+		core.CodeDataLoss,
+	}
+
+	DefaultBreakerConfig = &BreakerConfig{
+		FailureRateThreshold:  0.5,
+		SlowCallRateThreshold: 1,
+		SlowCallDuration:      time.Minute,
+		WindowType:            CountWindow,
+		WindowSize:            100,
+		MinimumCalls:          10,
+		OpenTimeout:           30 * time.Second,
+		HalfOpenCalls:         5,
+		FailureCodes:          DefaultFailureCodes,
+	}
+
+	ErrBreakerOpen = core.NewStatus(core.CodeUnavailable, "circuit breaker is open")
+)
+
+type BreakerConfig struct {
+	// The failure rate, between 0 and 1, above which the breaker opens, 0 disables it.
+	FailureRateThreshold float64
+
+	// The rate of calls slower than SlowCallDuration, between 0 and 1, above which the breaker opens, 0 disables it.
+	SlowCallRateThreshold float64
+	SlowCallDuration      time.Duration
+
+	// The sliding window of the calls used to compute the rates.
+	WindowType     WindowType
+	WindowSize     int
+	WindowDuration time.Duration
+
+	// The minimum number of calls in the window before the rates are considered.
+	MinimumCalls int
+
+	// How long the breaker stays open before letting trial calls through.
+	OpenTimeout time.Duration
+
+	// The number of trial calls which must succeed to close the breaker again.
+	HalfOpenCalls int
+
+	// The status codes counted as failures.
+	FailureCodes []core.Code
+
+	// Called after the state of a breaker changed, for example to raise an alert,
+	// the changes of a breaker are reported one at a time and in order, from another goroutine.
+	OnStateChange func(name string, from, to BreakerState)
+}
+
+// Does the rate of some calls reach the threshold? A threshold of 0 is disabled.
+func exceeds(count, calls int, threshold float64) bool {
+	return threshold > 0 && float64(count)/float64(calls) >= threshold
+}
+
+func (c *BreakerConfig) newWindow() slidingWindow {
+	if c.WindowType == TimeWindow {
+		return newTimeWindow(c.WindowDuration)
+	}
+
+	return newCountWindow(c.WindowSize)
+}
+
+func (c *BreakerConfig) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	code := core.CodeOf(err)
+
+	for _, c := range c.FailureCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A CircuitBreaker stops calling a failing service for a while, and lets a few trial calls
+// through afterward to find out whether it recovered.
+type CircuitBreaker struct {
+	Name string
+
+	cfg      *BreakerConfig
+	lock     sync.Mutex
+	state    BreakerState
+	window   slidingWindow
+	openedAt time.Time
+	trials   int
+	passed   int
+
+	changes   []stateChange
+	notifying bool
+}
+
+type stateChange struct {
+	from, to BreakerState
+}
+
+func NewCircuitBreaker(name string, cfg *BreakerConfig) *CircuitBreaker {
+	if cfg == nil {
+		cfg = DefaultBreakerConfig
+	}
+
+	return &CircuitBreaker{Name: name, cfg: cfg, window: cfg.newWindow()}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.checkOpenTimeout(time.Now())
+
+	return b.state
+}
+
+// Would a call be permitted? It doesn't take a trial permit, unlike Allow.
+func (b *CircuitBreaker) Available() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.checkOpenTimeout(time.Now())
+
+	return b.state == StateClosed || (b.state == StateHalfOpen && b.trials < b.cfg.HalfOpenCalls)
+}
+
+// Ask permission for a call, which must be followed by Record once it completed.
+func (b *CircuitBreaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.checkOpenTimeout(time.Now())
+
+	switch b.state {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		if b.trials < b.cfg.HalfOpenCalls {
+			b.trials++
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record the outcome of a permitted call.
+func (b *CircuitBreaker) Record(elapsed time.Duration, err error) {
+	failed := b.cfg.isFailure(err)
+	slow := b.cfg.SlowCallDuration > 0 && elapsed >= b.cfg.SlowCallDuration
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+
+	switch b.state {
+	case StateClosed:
+		b.window.record(now, failed, slow)
+
+		calls, failures, slows := b.window.totals(now)
+
+		if calls >= b.cfg.MinimumCalls && calls > 0 &&
+			(exceeds(failures, calls, b.cfg.FailureRateThreshold) || exceeds(slows, calls, b.cfg.SlowCallRateThreshold)) {
+			b.transit(StateOpen, now)
+		}
+
+	case StateHalfOpen:
+		if failed || slow {
+			b.transit(StateOpen, now)
+		} else if b.passed++; b.passed >= b.cfg.HalfOpenCalls {
+			b.transit(StateClosed, now)
+		}
+	}
+}
+
+// Force the breaker back to the closed state.
+func (b *CircuitBreaker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.transit(StateClosed, time.Now())
+}
+
+func (b *CircuitBreaker) checkOpenTimeout(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.transit(StateHalfOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) transit(state BreakerState, now time.Time) {
+	from := b.state
+
+	if from == state {
+		return
+	}
+
+	b.state = state
+	b.trials = 0
+	b.passed = 0
+
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.window.reset()
+	}
+
+	if b.cfg.OnStateChange != nil {
+		b.changes = append(b.changes, stateChange{from, state})
+
+		if !b.notifying {
+			b.notifying = true
+
+			go b.notify()
+		}
+	}
+}
+
+// Report the state changes in order, until none is left.
+func (b *CircuitBreaker) notify() {
+	for {
+		b.lock.Lock()
+
+		if len(b.changes) == 0 {
+			b.notifying = false
+			b.lock.Unlock()
+
+			return
+		}
+
+		change := b.changes[0]
+		b.changes = b.changes[1:]
+
+		b.lock.Unlock()
+
+		b.cfg.OnStateChange(b.Name, change.from, change.to)
+	}
+}
+
+// A BreakerGroup holds a breaker per key, such as one per endpoint,
+// so that a failing backend gets ejected without tripping the whole client.
+type BreakerGroup struct {
+	cfg      *BreakerConfig
+	lock     sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewBreakerGroup(cfg *BreakerConfig) *BreakerGroup {
+	return &BreakerGroup{cfg: cfg, breakers: make(map[string]*CircuitBreaker)}
+}
+
+// Return the breaker of the key, create it if it doesn't exist.
+func (g *BreakerGroup) Get(key string) *CircuitBreaker {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	b, exists := g.breakers[key]
+
+	if !exists {
+		b = NewCircuitBreaker(key, g.cfg)
+
+		g.breakers[key] = b
+	}
+
+	return b
+}
+
+// Remove the breaker of a key which isn't used anymore.
+func (g *BreakerGroup) Remove(key string) {
+	g.lock.Lock()
+	delete(g.breakers, key)
+	g.lock.Unlock()
+}
+
+// Return the state of every breaker.
+func (g *BreakerGroup) States() map[string]BreakerState {
+	g.lock.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(g.breakers))
+	for _, b := range g.breakers {
+		breakers = append(breakers, b)
+	}
+	g.lock.Unlock()
+
+	states := make(map[string]BreakerState, len(breakers))
+
+	for _, b := range breakers {
+		states[b.Name] = b.State()
+	}
+
+	return states
+}
+
+// A BreakerFilter rejects the calls with ErrBreakerOpen while its breaker is open.
+type BreakerFilter struct {
+	Breaker *CircuitBreaker
+}
+
+var _ = (core.Filter)((*BreakerFilter)(nil))
+
+func NewBreakerFilter(name string, cfg *BreakerConfig) *BreakerFilter {
+	return &BreakerFilter{NewCircuitBreaker(name, cfg)}
+}
+
+func (f *BreakerFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	return Guard(f.Breaker, ctxt, req, service)
+}
+
+// Call the service if the breaker permits it, and record the outcome.
+func Guard(b *CircuitBreaker, ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	if !b.Allow() {
+		return core.Rejected(ErrBreakerOpen)
+	}
+
+	started := time.Now()
+
+	return core.Finally(service.Apply(ctxt, req), func(result interface{}, err error) {
+		b.Record(time.Since(started), err)
+	})
+}
+
+type slidingWindow interface {
+	record(now time.Time, failed, slow bool)
+
+	totals(now time.Time) (calls, failures, slows int)
+
+	reset()
+}
+
+type outcome struct {
+	calls, failures, slows int
+}
+
+func (o *outcome) add(failed, slow bool) {
+	o.calls++
+
+	if failed {
+		o.failures++
+	}
+
+	if slow {
+		o.slows++
+	}
+}
+
+type countWindow struct {
+	outcomes []outcome
+	next     int
+	total    outcome
+}
+
+func newCountWindow(size int) *countWindow {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &countWindow{outcomes: make([]outcome, size)}
+}
+
+func (w *countWindow) record(now time.Time, failed, slow bool) {
+	old := w.outcomes[w.next]
+
+	w.total.calls -= old.calls
+	w.total.failures -= old.failures
+	w.total.slows -= old.slows
+
+	w.outcomes[w.next] = outcome{}
+	w.outcomes[w.next].add(failed, slow)
+	w.total.add(failed, slow)
+
+	w.next = (w.next + 1) % len(w.outcomes)
+}
+
+func (w *countWindow) totals(now time.Time) (int, int, int) {
+	return w.total.calls, w.total.failures, w.total.slows
+}
+
+func (w *countWindow) reset() {
+	w.outcomes = make([]outcome, len(w.outcomes))
+	w.next = 0
+	w.total = outcome{}
+}
+
+const timeWindowBuckets = 10
+
+type timeWindow struct {
+	width   time.Duration
+	buckets [timeWindowBuckets]outcome
+	epochs  [timeWindowBuckets]int64
+}
+
+func newTimeWindow(d time.Duration) *timeWindow {
+	if d <= 0 {
+		d = time.Minute
+	}
+
+	return &timeWindow{width: d / timeWindowBuckets}
+}
+
+func (w *timeWindow) record(now time.Time, failed, slow bool) {
+	epoch := now.UnixNano() / int64(w.width)
+	i := epoch % timeWindowBuckets
+
+	if w.epochs[i] != epoch {
+		w.epochs[i] = epoch
+		w.buckets[i] = outcome{}
+	}
+
+	w.buckets[i].add(failed, slow)
+}
+
+func (w *timeWindow) totals(now time.Time) (calls, failures, slows int) {
+	epoch := now.UnixNano() / int64(w.width)
+
+	for i, b := range w.buckets {
+		if epoch-w.epochs[i] < timeWindowBuckets {
+			calls += b.calls
+			failures += b.failures
+			slows += b.slows
+		}
+	}
+
+	return
+}
+
+func (w *timeWindow) reset() {
+	w.buckets = [timeWindowBuckets]outcome{}
+	w.epochs = [timeWindowBuckets]int64{}
+}
@@ -0,0 +1,161 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	Convey("create CircuitBreaker", t, func() {
+		changes := make(chan BreakerState, 10)
+
+		cfg := &BreakerConfig{
+			FailureRateThreshold:  0.5,
+			SlowCallRateThreshold: 1,
+			SlowCallDuration:      time.Second,
+			WindowSize:            4,
+			MinimumCalls:          4,
+			OpenTimeout:           20 * time.Millisecond,
+			HalfOpenCalls:         2,
+			FailureCodes:          DefaultFailureCodes,
+			OnStateChange:         func(name string, from, to BreakerState) { changes <- to },
+		}
+
+		b := NewCircuitBreaker("test", cfg)
+
+		So(b.State(), ShouldEqual, StateClosed)
+
+		unavailable := core.NewStatus(core.CodeUnavailable, "unavailable")
+
+		Convey("open after too many failures", func() {
+			for _, err := range []error{nil, unavailable, nil, core.NewStatus(core.CodeNotFound, "not found")} {
+				So(b.Allow(), ShouldBeTrue)
+				b.Record(0, err)
+			}
+
+			So(b.State(), ShouldEqual, StateClosed)
+
+			So(b.Allow(), ShouldBeTrue)
+			b.Record(0, unavailable)
+
+			So(b.State(), ShouldEqual, StateOpen)
+			So(<-changes, ShouldEqual, StateOpen)
+			So(b.Allow(), ShouldBeFalse)
+			So(b.Available(), ShouldBeFalse)
+
+			Convey("half open after the open timeout", func() {
+				time.Sleep(cfg.OpenTimeout)
+
+				So(b.State(), ShouldEqual, StateHalfOpen)
+				So(b.Allow(), ShouldBeTrue)
+				So(b.Allow(), ShouldBeTrue)
+				So(b.Allow(), ShouldBeFalse)
+
+				Convey("close after the trial calls succeeded", func() {
+					b.Record(0, nil)
+					b.Record(0, nil)
+
+					So(b.State(), ShouldEqual, StateClosed)
+					So(<-changes, ShouldEqual, StateHalfOpen)
+					So(<-changes, ShouldEqual, StateClosed)
+				})
+
+				Convey("open again after a trial call failed", func() {
+					b.Record(0, unavailable)
+
+					So(b.State(), ShouldEqual, StateOpen)
+				})
+			})
+		})
+
+		Convey("open after too many slow calls", func() {
+			for i := 0; i < 4; i++ {
+				b.Record(time.Second, nil)
+			}
+
+			So(b.State(), ShouldEqual, StateOpen)
+		})
+	})
+
+	Convey("create a breaker without slow call threshold", t, func() {
+		b := NewCircuitBreaker("test", &BreakerConfig{
+			FailureRateThreshold: 0.5,
+			WindowSize:           10,
+			MinimumCalls:         5,
+			OpenTimeout:          time.Minute,
+			FailureCodes:         DefaultFailureCodes,
+		})
+
+		for i := 0; i < 5; i++ {
+			So(b.Allow(), ShouldBeTrue)
+			b.Record(0, nil)
+		}
+
+		So(b.State(), ShouldEqual, StateClosed)
+	})
+
+	Convey("create a breaker with a time window", t, func() {
+		b := NewCircuitBreaker("test", &BreakerConfig{
+			FailureRateThreshold:  0.5,
+			SlowCallRateThreshold: 1,
+			WindowType:            TimeWindow,
+			WindowDuration:        100 * time.Millisecond,
+			MinimumCalls:          2,
+			OpenTimeout:           time.Minute,
+			FailureCodes:          DefaultFailureCodes,
+		})
+
+		b.Record(0, core.NewStatus(core.CodeInternal, "internal"))
+
+		time.Sleep(150 * time.Millisecond)
+
+		b.Record(0, nil)
+
+		So(b.State(), ShouldEqual, StateClosed)
+
+		b.Record(0, core.NewStatus(core.CodeInternal, "internal"))
+
+		So(b.State(), ShouldEqual, StateOpen)
+	})
+}
+
+func TestBreakerFilter(t *testing.T) {
+	Convey("create BreakerFilter", t, func() {
+		f := NewBreakerFilter("test", &BreakerConfig{
+			FailureRateThreshold:  0.5,
+			SlowCallRateThreshold: 1,
+			WindowSize:            1,
+			MinimumCalls:          1,
+			OpenTimeout:           time.Minute,
+			FailureCodes:          DefaultFailureCodes,
+		})
+
+		service, calls := failing(core.CodeUnavailable)
+
+		_, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+
+		_, err = f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+		So(err, ShouldEqual, ErrBreakerOpen)
+		So(*calls, ShouldEqual, 1)
+	})
+
+	Convey("create BreakerGroup", t, func() {
+		g := NewBreakerGroup(nil)
+
+		So(g.Get("a"), ShouldEqual, g.Get("a"))
+		So(g.Get("a"), ShouldNotEqual, g.Get("b"))
+		So(g.States(), ShouldResemble, map[string]BreakerState{"a": StateClosed, "b": StateClosed})
+
+		g.Remove("a")
+
+		So(g.States(), ShouldResemble, map[string]BreakerState{"b": StateClosed})
+	})
+}
@@ -0,0 +1,276 @@
+package filter
+
+import (
+	"container/list"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	CacheControlKey = "filter.cache_control"
+)
+
+// CacheControl holds the hints a service gives about caching the result of a call,
+// the methods do nothing on a nil CacheControl, when the call isn't cached.
+type CacheControl struct {
+	lock    sync.Mutex
+	maxAge  time.Duration
+	noStore bool
+}
+
+// Cache the result for the given duration instead of the TTL of the method.
+func (c *CacheControl) SetMaxAge(d time.Duration) {
+	if c != nil {
+		c.lock.Lock()
+		c.maxAge = d
+		c.lock.Unlock()
+	}
+}
+
+// Don't cache the result, for example when it's personalized or incomplete.
+func (c *CacheControl) SetNoStore() {
+	if c != nil {
+		c.lock.Lock()
+		c.noStore = true
+		c.lock.Unlock()
+	}
+}
+
+func (c *CacheControl) hints() (time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.maxAge, c.noStore
+}
+
+// Return the cache control of the call, or nil if it isn't cached.
+func CacheControlOf(ctxt context.Context) *CacheControl {
+	c, _ := ctxt.Value(CacheControlKey).(*CacheControl)
+
+	return c
+}
+
+func WithCacheControl(ctxt context.Context, c *CacheControl) context.Context {
+	return context.WithValue(ctxt, CacheControlKey, c)
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	size    int
+	expires time.Time
+}
+
+// A CacheFilter caches the successful results of the calls for the TTL of their method,
+// and evicts the least recently used ones beyond its size limits.
+//
+// The services may change the TTL of a result, or keep it out of the cache, with CacheControlOf.
+// The cached values are shared, they must not be modified by the callers.
+//
+// Put a SingleflightFilter after it to compute a missing result only once.
+type CacheFilter struct {
+	// The TTL of the results per method, the other methods use DefaultTTL, and aren't cached without it.
+	// The method names are matched regardless of their case, like the HTTP servers do.
+	TTLs       map[string]time.Duration
+	DefaultTTL time.Duration
+
+	// The key of the calls, CallerKey when nil.
+	// A key shared by many principals must only be used before the authentication.
+	Key RequestKeyFunc
+
+	// The maximum number of cached results, and of their encoded size in bytes, unlimited when zero.
+	MaxEntries, MaxBytes int
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int
+}
+
+var _ = (core.Filter)((*CacheFilter)(nil))
+
+func NewCacheFilter(ttl time.Duration, maxEntries int) *CacheFilter {
+	return &CacheFilter{
+		TTLs:       make(map[string]time.Duration),
+		DefaultTTL: ttl,
+		MaxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (f *CacheFilter) ttl(method string) time.Duration {
+	if ttl, ok := f.TTLs[method]; ok {
+		return ttl
+	}
+
+	for name, ttl := range f.TTLs {
+		if strings.EqualFold(name, method) {
+			return ttl
+		}
+	}
+
+	return f.DefaultTTL
+}
+
+// Create the cache of a filter which wasn't built by NewCacheFilter.
+func (f *CacheFilter) lazyInit() {
+	if f.lru == nil {
+		f.lru = list.New()
+		f.entries = make(map[string]*list.Element)
+	}
+}
+
+// Return the number of cached results.
+func (f *CacheFilter) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.lazyInit()
+
+	return f.lru.Len()
+}
+
+// Remove all the cached results.
+func (f *CacheFilter) Purge() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.lru = list.New()
+	f.entries = make(map[string]*list.Element)
+	f.bytes = 0
+}
+
+func (f *CacheFilter) get(key string, now time.Time) (interface{}, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	e, ok := f.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+
+	if now.After(entry.expires) {
+		f.remove(e)
+
+		return nil, false
+	}
+
+	f.lru.MoveToFront(e)
+
+	return entry.value, true
+}
+
+func (f *CacheFilter) put(entry *cacheEntry) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.MaxBytes > 0 && entry.size > f.MaxBytes {
+		return
+	}
+
+	f.lazyInit()
+
+	if e, ok := f.entries[entry.key]; ok {
+		f.remove(e)
+	}
+
+	f.entries[entry.key] = f.lru.PushFront(entry)
+	f.bytes += entry.size
+
+	for (f.MaxEntries > 0 && f.lru.Len() > f.MaxEntries) || (f.MaxBytes > 0 && f.bytes > f.MaxBytes) {
+		f.remove(f.lru.Back())
+	}
+}
+
+func (f *CacheFilter) remove(e *list.Element) {
+	entry := f.lru.Remove(e).(*cacheEntry)
+
+	delete(f.entries, entry.key)
+
+	f.bytes -= entry.size
+}
+
+func (f *CacheFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok || call.Stream != nil || f.ttl(call.Method) <= 0 {
+		return service.Apply(ctxt, req)
+	}
+
+	key, err := keyOf(f.Key, ctxt, call)
+
+	if err != nil {
+		return service.Apply(ctxt, req)
+	}
+
+	if value, ok := f.get(key, time.Now()); ok {
+		if call.Reply == nil {
+			return core.Resolved(value)
+		}
+
+		if reply := reflect.ValueOf(call.Reply).Elem(); reflect.TypeOf(value) == reply.Type() {
+			reply.Set(reflect.ValueOf(value))
+
+			return core.Resolved(call.Reply)
+		}
+	}
+
+	control := &CacheControl{}
+
+	return core.Finally(service.Apply(WithCacheControl(ctxt, control), req), func(result interface{}, err error) {
+		if err != nil {
+			return
+		}
+
+		ttl, noStore := control.hints()
+
+		if noStore {
+			return
+		}
+
+		if ttl <= 0 {
+			ttl = f.ttl(call.Method)
+		}
+
+		value := result
+
+		if call.Reply != nil {
+			if result != call.Reply {
+				return
+			}
+
+			value = reflect.ValueOf(call.Reply).Elem().Interface()
+		}
+
+		entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+
+		if f.MaxBytes > 0 {
+			encoding := call.Encoding
+
+			if encoding == nil {
+				encoding = core.JsonEncoding
+			}
+
+			data, err := encoding.Marshal(value)
+
+			if err != nil {
+				return
+			}
+
+			entry.size = len(data)
+		}
+
+		f.put(entry)
+	})
+}
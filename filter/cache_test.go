@@ -0,0 +1,266 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/auth"
+	"github.com/flier/bucky/core"
+)
+
+// Return a service uppercasing its argument, which counts its calls and waits for the gate to open.
+func lookupService(gate chan struct{}) (core.Service, *int32) {
+	var calls int32
+
+	return core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+		call := req.(*core.Call)
+
+		atomic.AddInt32(&calls, 1)
+
+		return promise.Start(func() (interface{}, error) {
+			if gate != nil {
+				select {
+				case <-gate:
+				case <-ctxt.Done():
+					return nil, ctxt.Err()
+				}
+			}
+
+			if call.Args[0] == "private" {
+				CacheControlOf(ctxt).SetNoStore()
+			} else if call.Args[0] == "volatile" {
+				CacheControlOf(ctxt).SetMaxAge(time.Nanosecond)
+			}
+
+			result := strings.ToUpper(call.Args[0].(string))
+
+			if reply, ok := call.Reply.(*string); ok {
+				*reply = result
+
+				return reply, nil
+			}
+
+			return result, nil
+		})
+	}), &calls
+}
+
+func TestSingleflightFilter(t *testing.T) {
+	Convey("collapse the concurrent identical calls", t, func() {
+		f := NewSingleflightFilter()
+
+		gate := make(chan struct{})
+
+		service, calls := lookupService(gate)
+
+		var wg sync.WaitGroup
+
+		replies := make([]string, 5)
+
+		for i := range replies {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"hello"}, Reply: &replies[i]}, service).Get()
+			}(i)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		So(atomic.LoadInt32(calls), ShouldEqual, 1)
+
+		close(gate)
+
+		wg.Wait()
+
+		So(replies, ShouldResemble, []string{"HELLO", "HELLO", "HELLO", "HELLO", "HELLO"})
+
+		result, err := f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"hello"}}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "HELLO")
+		So(atomic.LoadInt32(calls), ShouldEqual, 2)
+
+		Convey("keep the calls of the principals apart", func() {
+			gate := make(chan struct{})
+
+			service, calls := lookupService(gate)
+
+			var wg sync.WaitGroup
+
+			for _, name := range []string{"alice", "bob"} {
+				wg.Add(1)
+
+				go func(ctxt context.Context) {
+					defer wg.Done()
+
+					f.Apply(ctxt, &core.Call{Method: "Lookup", Args: []interface{}{"hello"}}, service).Get()
+				}(auth.WithPrincipal(context.Background(), &auth.Principal{Name: name, Method: "basic"}))
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			So(atomic.LoadInt32(calls), ShouldEqual, 2)
+
+			close(gate)
+
+			wg.Wait()
+		})
+
+		Convey("cancel the shared call once all the callers gave up", func() {
+			service, calls := lookupService(make(chan struct{}))
+
+			ctxt, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := f.Apply(ctxt, &core.Call{Method: "Lookup", Args: []interface{}{"hello"}}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+
+			other, _ := lookupService(nil)
+
+			_, err = f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"hello"}}, other).Get()
+
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		})
+	})
+
+	Convey("collapse the calls with a filter built without constructor", t, func() {
+		f := &SingleflightFilter{}
+
+		service, _ := lookupService(nil)
+
+		result, err := f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"hello"}}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "HELLO")
+	})
+}
+
+func TestCacheFilter(t *testing.T) {
+	Convey("cache the results of the calls", t, func() {
+		f := NewCacheFilter(time.Minute, 2)
+
+		service, calls := lookupService(nil)
+
+		lookup := func(arg string) string {
+			var reply string
+
+			result, err := f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{arg}, Reply: &reply}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, &reply)
+
+			return reply
+		}
+
+		So(lookup("a"), ShouldEqual, "A")
+		So(lookup("a"), ShouldEqual, "A")
+		So(atomic.LoadInt32(calls), ShouldEqual, 1)
+
+		result, err := f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"a"}}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "A")
+		So(atomic.LoadInt32(calls), ShouldEqual, 1)
+
+		Convey("evict the least recently used results", func() {
+			lookup("b")
+			lookup("a")
+			lookup("c")
+
+			So(f.Len(), ShouldEqual, 2)
+			So(atomic.LoadInt32(calls), ShouldEqual, 3)
+
+			lookup("a")
+			lookup("b")
+
+			So(atomic.LoadInt32(calls), ShouldEqual, 4)
+		})
+
+		Convey("limit the size of the results", func() {
+			f = NewCacheFilter(time.Minute, 0)
+			f.MaxBytes = 10
+
+			lookup("a")
+			lookup("bb")
+			lookup("ccc")
+
+			So(f.Len(), ShouldEqual, 2)
+
+			lookup("long enough to be dropped")
+
+			So(f.Len(), ShouldEqual, 2)
+		})
+
+		Convey("follow the hints of the service", func() {
+			lookup("private")
+			lookup("private")
+			lookup("volatile")
+			lookup("volatile")
+
+			So(atomic.LoadInt32(calls), ShouldEqual, 5)
+		})
+
+		Convey("keep the results of the principals apart", func() {
+			ctxt := auth.WithPrincipal(context.Background(), &auth.Principal{Name: "alice", Method: "basic"})
+
+			_, err := f.Apply(ctxt, &core.Call{Method: "Lookup", Args: []interface{}{"a"}}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(calls), ShouldEqual, 2)
+		})
+
+		Convey("use the TTL of the method", func() {
+			f.TTLs["Lookup"] = 0
+
+			lookup("a")
+			lookup("b")
+
+			So(atomic.LoadInt32(calls), ShouldEqual, 3)
+
+			// the HTTP servers lowercase the method names
+			_, err := f.Apply(context.Background(), &core.Call{Method: "lookup", Args: []interface{}{"a"}}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(calls), ShouldEqual, 4)
+
+			f.Purge()
+
+			So(f.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("cache the results with a filter built without constructor", t, func() {
+		f := &CacheFilter{DefaultTTL: time.Minute}
+
+		So(f.Len(), ShouldEqual, 0)
+
+		service, calls := lookupService(nil)
+
+		for i := 0; i < 2; i++ {
+			result, err := f.Apply(context.Background(), &core.Call{Method: "Lookup", Args: []interface{}{"a"}}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "A")
+		}
+
+		So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		So(f.Len(), ShouldEqual, 1)
+
+		f = &CacheFilter{}
+		f.Purge()
+
+		So(f.Len(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,206 @@
+package filter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A LimitAlgorithm adapts the number of concurrent calls to the latency and the failures of the calls.
+type LimitAlgorithm interface {
+	// The current limit.
+	Limit() int
+
+	// Update the limit with the outcome of a call, dropped if it was rejected or timed out,
+	// while inFlight calls were running.
+	Update(rtt time.Duration, inFlight int, dropped bool)
+}
+
+// Keep a limit within its bounds, and at least at 1 so that some calls are still admitted to sample the latency.
+func clampLimit(limit float64, min, max int) float64 {
+	if min < 1 {
+		min = 1
+	}
+
+	return math.Max(float64(min), math.Min(limit, float64(max)))
+}
+
+// An AIMDLimit increases the limit by one while the calls succeed below the latency threshold,
+// and multiplies it by the backoff ratio when they fail or get slow, it's never below 1.
+type AIMDLimit struct {
+	MinLimit, MaxLimit int
+	BackoffRatio       float64
+	Threshold          time.Duration
+
+	lock  sync.Mutex
+	limit float64
+}
+
+var _ = (LimitAlgorithm)((*AIMDLimit)(nil))
+
+func NewAIMDLimit(initial, min, max int, threshold time.Duration) *AIMDLimit {
+	if min < 1 {
+		min = 1
+	}
+
+	return &AIMDLimit{MinLimit: min, MaxLimit: max, BackoffRatio: 0.9, Threshold: threshold, limit: clampLimit(float64(initial), min, max)}
+}
+
+func (l *AIMDLimit) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return int(l.limit)
+}
+
+func (l *AIMDLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	switch {
+	case dropped || (l.Threshold > 0 && rtt > l.Threshold):
+		l.limit *= l.BackoffRatio
+	case float64(inFlight)*2 >= l.limit:
+		// only grow when the limit is in use, not while the traffic is low
+		l.limit++
+	}
+
+	l.limit = clampLimit(l.limit, l.MinLimit, l.MaxLimit)
+}
+
+// A GradientLimit compares the latency of the calls with its long term average,
+// and shrinks the limit as the latency grows, when the calls start queueing, it's never below 1.
+type GradientLimit struct {
+	MinLimit, MaxLimit int
+
+	// How much the latency may grow before the limit shrinks, 2 tolerates twice the average latency.
+	Tolerance float64
+
+	// The weight of a new limit, from 0 to 1.
+	Smoothing float64
+
+	// The number of samples of the long term average latency.
+	Window int
+
+	lock    sync.Mutex
+	limit   float64
+	longRTT float64
+}
+
+var _ = (LimitAlgorithm)((*GradientLimit)(nil))
+
+func NewGradientLimit(initial, min, max int) *GradientLimit {
+	if min < 1 {
+		min = 1
+	}
+
+	return &GradientLimit{MinLimit: min, MaxLimit: max, Tolerance: 1.5, Smoothing: 0.2, Window: 100, limit: clampLimit(float64(initial), min, max)}
+}
+
+func (l *GradientLimit) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return int(l.limit)
+}
+
+func (l *GradientLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	short := float64(rtt)
+
+	if l.longRTT == 0 {
+		l.longRTT = short
+	} else {
+		l.longRTT += (short - l.longRTT) / float64(l.Window)
+	}
+
+	// don't grow while the traffic is low, the latency tells nothing about the limit
+	if !dropped && float64(inFlight)*2 < l.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.Tolerance*l.longRTT/short))
+
+	if dropped {
+		gradient = 0.5
+	}
+
+	// leave room for a queue, so that the limit can grow while the latency is stable
+	queue := math.Sqrt(l.limit)
+	limit := l.limit*gradient + queue
+
+	l.limit = l.limit*(1-l.Smoothing) + limit*l.Smoothing
+	l.limit = clampLimit(l.limit, l.MinLimit, l.MaxLimit)
+}
+
+var (
+	// The codes telling that the server is overloaded.
+	DefaultDroppedCodes = []core.Code{core.CodeDeadlineExceeded, core.CodeResourceExhausted, core.CodeUnavailable}
+)
+
+// A ConcurrencyLimitFilter sheds the calls over the adaptive limit of concurrent calls,
+// with a retryable RESOURCE_EXHAUSTED status, before the server falls over.
+type ConcurrencyLimitFilter struct {
+	Algorithm LimitAlgorithm
+
+	// The codes updating the limit as dropped calls.
+	DroppedCodes []core.Code
+
+	// The delay suggested to the rejected callers.
+	RetryAfter time.Duration
+
+	lock     sync.Mutex
+	inFlight int
+}
+
+var _ = (core.Filter)((*ConcurrencyLimitFilter)(nil))
+
+func NewConcurrencyLimitFilter(algorithm LimitAlgorithm) *ConcurrencyLimitFilter {
+	return &ConcurrencyLimitFilter{Algorithm: algorithm, DroppedCodes: DefaultDroppedCodes, RetryAfter: 100 * time.Millisecond}
+}
+
+// Return the number of calls in flight.
+func (f *ConcurrencyLimitFilter) InFlight() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.inFlight
+}
+
+func (f *ConcurrencyLimitFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	f.lock.Lock()
+
+	if f.inFlight >= f.Algorithm.Limit() {
+		f.lock.Unlock()
+
+		return core.Rejected(core.NewStatus(core.CodeResourceExhausted, "concurrency limit exceeded").WithRetryAfter(f.RetryAfter))
+	}
+
+	f.inFlight++
+	inFlight := f.inFlight
+
+	f.lock.Unlock()
+
+	started := time.Now()
+
+	return core.Finally(service.Apply(ctxt, req), func(result interface{}, err error) {
+		f.lock.Lock()
+		f.inFlight--
+		f.lock.Unlock()
+
+		code, dropped := core.CodeOf(err), false
+
+		for _, c := range f.DroppedCodes {
+			dropped = dropped || c == code
+		}
+
+		f.Algorithm.Update(time.Since(started), inFlight, dropped)
+	})
+}
@@ -0,0 +1,322 @@
+package filter
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+const (
+	TriedEndpointsKey = "filter.tried_endpoints"
+)
+
+// TriedEndpoints records the endpoints tried by the attempts of a call,
+// so that the balancer sends the next attempts to the other endpoints.
+type TriedEndpoints struct {
+	lock  sync.Mutex
+	addrs map[string]bool
+}
+
+func (t *TriedEndpoints) Add(addr string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.addrs == nil {
+		t.addrs = make(map[string]bool)
+	}
+
+	t.addrs[addr] = true
+}
+
+func (t *TriedEndpoints) Has(addr string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.addrs[addr]
+}
+
+// Return the endpoints tried by the attempts of the call, or nil.
+func TriedEndpointsOf(ctxt context.Context) *TriedEndpoints {
+	t, _ := ctxt.Value(TriedEndpointsKey).(*TriedEndpoints)
+
+	return t
+}
+
+func WithTriedEndpoints(ctxt context.Context, t *TriedEndpoints) context.Context {
+	return context.WithValue(ctxt, TriedEndpointsKey, t)
+}
+
+// A LatencyTracker keeps the latencies of the recent calls to estimate their percentiles.
+type LatencyTracker struct {
+	lock    sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func NewLatencyTracker(size int) *LatencyTracker {
+	return &LatencyTracker{samples: make([]time.Duration, size)}
+}
+
+func (t *LatencyTracker) Observe(d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % len(t.samples)
+	t.full = t.full || t.next == 0
+}
+
+// Return the number of samples.
+func (t *LatencyTracker) Count() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.full {
+		return len(t.samples)
+	}
+
+	return t.next
+}
+
+// Return the latency below which the given fraction of the samples are, such as 0.95 for the p95.
+func (t *LatencyTracker) Percentile(p float64) (time.Duration, bool) {
+	t.lock.Lock()
+
+	n := t.next
+
+	if t.full {
+		n = len(t.samples)
+	}
+
+	sorted := append([]time.Duration(nil), t.samples[:n]...)
+
+	t.lock.Unlock()
+
+	if n == 0 {
+		return 0, false
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(p*float64(n)+0.5) - 1
+
+	if i < 0 {
+		i = 0
+	} else if i >= n {
+		i = n - 1
+	}
+
+	return sorted[i], true
+}
+
+// A HedgePolicy decides which calls are hedged and when.
+type HedgePolicy struct {
+	// The maximum number of copies of a call, including the first one.
+	MaxAttempts int
+
+	// A copy is sent once the previous one hasn't answered within this percentile of the latencies,
+	Percentile float64
+
+	// or within this delay, until enough latencies were sampled.
+	Delay time.Duration
+
+	// The number of latencies sampled before using the percentile.
+	MinSamples int
+
+	// Only the idempotent methods are hedged, as the options of the methods tell when nil,
+	// with the metadata attached to the context or the one of the service.
+	Idempotent func(method string) bool
+}
+
+var (
+	DefaultHedgePolicy = &HedgePolicy{
+		MaxAttempts: 2,
+		Percentile:  0.95,
+		Delay:       100 * time.Millisecond,
+		MinSamples:  100,
+	}
+)
+
+// A HedgeFilter sends copies of the calls to idempotent methods which haven't answered
+// within a percentile of their latency, takes the first success and cancels the other copies.
+//
+// The copies are sent to the endpoints not tried yet by the balancer, within a budget
+// which keeps the hedging from doubling the load of a struggling service.
+type HedgeFilter struct {
+	Policy *HedgePolicy
+	Budget *RetryBudget
+
+	lock     sync.Mutex
+	trackers map[string]*LatencyTracker
+}
+
+var _ = (core.Filter)((*HedgeFilter)(nil))
+
+// Return a hedge filter, whose budget allows a copy for every ten calls by default.
+func NewHedgeFilter(policy *HedgePolicy, budget *RetryBudget) *HedgeFilter {
+	if policy == nil {
+		policy = DefaultHedgePolicy
+	}
+
+	if budget == nil {
+		budget = NewRetryBudget(0.1, 1, 10)
+	}
+
+	return &HedgeFilter{Policy: policy, Budget: budget, trackers: make(map[string]*LatencyTracker)}
+}
+
+func (f *HedgeFilter) tracker(method string) *LatencyTracker {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	t, ok := f.trackers[method]
+
+	if !ok {
+		size := f.Policy.MinSamples * 10
+
+		if size < 100 {
+			size = 100
+		}
+
+		t = NewLatencyTracker(size)
+		f.trackers[method] = t
+	}
+
+	return t
+}
+
+// Return the delay before sending another copy of a call to the method.
+func (f *HedgeFilter) DelayOf(method string) time.Duration {
+	t := f.tracker(method)
+
+	if t.Count() >= f.Policy.MinSamples {
+		if d, ok := t.Percentile(f.Policy.Percentile); ok {
+			return d
+		}
+	}
+
+	return f.Policy.Delay
+}
+
+type attempt struct {
+	call    *core.Call
+	started time.Time
+	result  interface{}
+	err     error
+}
+
+// Return a copy of the call for an attempt, decoding its result into its own reply.
+func cloneCall(call *core.Call) *core.Call {
+	clone := *call
+
+	if call.Reply != nil {
+		clone.Reply = reflect.New(reflect.TypeOf(call.Reply).Elem()).Interface()
+	}
+
+	return &clone
+}
+
+// Is the method idempotent, by the policy or by its options?
+func (f *HedgeFilter) idempotent(ctxt context.Context, service core.Service, method string) bool {
+	if f.Policy.Idempotent != nil {
+		return f.Policy.Idempotent(method)
+	}
+
+	if md := rpc.MetadataOf(ctxt); md != nil {
+		return rpc.Idempotent(md)(method)
+	}
+
+	_, m, ok := rpc.Resolve(service, method)
+
+	return ok && m.Options.Idempotent
+}
+
+func (f *HedgeFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok || call.Stream != nil || f.Policy.MaxAttempts < 2 || !f.idempotent(ctxt, service, call.Method) {
+		return service.Apply(ctxt, req)
+	}
+
+	f.Budget.Deposit()
+
+	tracker := f.tracker(call.Method)
+	delay := f.DelayOf(call.Method)
+
+	return core.WithContext(ctxt, promise.Start(func() (interface{}, error) {
+		ctxt, cancel := context.WithCancel(ctxt)
+		defer cancel() // cancel the other copies
+
+		if TriedEndpointsOf(ctxt) == nil {
+			ctxt = WithTriedEndpoints(ctxt, &TriedEndpoints{})
+		}
+
+		results := make(chan *attempt, f.Policy.MaxAttempts)
+
+		send := func() {
+			a := &attempt{call: cloneCall(call), started: time.Now()}
+
+			go func() {
+				a.result, a.err = service.Apply(ctxt, a.call).Get()
+
+				results <- a
+			}()
+		}
+
+		send()
+
+		sent, pending := 1, 1
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		var last *attempt
+
+		for pending > 0 {
+			select {
+			case a := <-results:
+				pending--
+
+				if a.err == nil {
+					tracker.Observe(time.Since(a.started))
+
+					if call.Reply != nil && a.result == a.call.Reply {
+						reflect.ValueOf(call.Reply).Elem().Set(reflect.ValueOf(a.call.Reply).Elem())
+
+						return call.Reply, nil
+					}
+
+					return a.result, nil
+				}
+
+				last = a
+
+				// a failed copy is replaced at once, unless the call was canceled
+				if ctxt.Err() == nil && sent < f.Policy.MaxAttempts && f.Budget.Withdraw() {
+					send()
+					sent++
+					pending++
+				}
+
+			case <-timer.C:
+				if sent < f.Policy.MaxAttempts && f.Budget.Withdraw() {
+					send()
+					sent++
+					pending++
+
+					timer.Reset(delay)
+				}
+			}
+		}
+
+		return last.result, last.err
+	}))
+}
@@ -0,0 +1,170 @@
+package filter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	Convey("estimate the percentiles of the latencies", t, func() {
+		tracker := NewLatencyTracker(100)
+
+		_, ok := tracker.Percentile(0.5)
+
+		So(ok, ShouldBeFalse)
+
+		for i := 200; i > 0; i-- {
+			tracker.Observe(time.Duration(i) * time.Millisecond)
+		}
+
+		So(tracker.Count(), ShouldEqual, 100)
+
+		p50, _ := tracker.Percentile(0.5)
+		p95, _ := tracker.Percentile(0.95)
+		p100, _ := tracker.Percentile(1)
+
+		So(p50, ShouldEqual, 50*time.Millisecond)
+		So(p95, ShouldEqual, 95*time.Millisecond)
+		So(p100, ShouldEqual, 100*time.Millisecond)
+	})
+}
+
+// Return a service whose first call hangs until canceled, and the next ones answer at once.
+func slowFirst() (core.Service, *int32, chan error) {
+	var calls int32
+
+	canceled := make(chan error, 1)
+
+	return core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+		call := req.(*core.Call)
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return promise.Start(func() (interface{}, error) {
+				<-ctxt.Done()
+
+				canceled <- ctxt.Err()
+
+				return nil, ctxt.Err()
+			})
+		}
+
+		if reply, ok := call.Reply.(*string); ok {
+			*reply = "fast"
+
+			return core.Resolved(reply)
+		}
+
+		return core.Resolved("fast")
+	}), &calls, canceled
+}
+
+type catalogService struct{}
+
+func (catalogService) Get() string { return "" }
+func (catalogService) Create()     {}
+
+func (catalogService) MethodOptions() map[string]*rpc.MethodOptions {
+	return map[string]*rpc.MethodOptions{"Get": {Idempotent: true}}
+}
+
+func TestHedgeFilter(t *testing.T) {
+	Convey("hedge the idempotent methods of the metadata by default", t, func() {
+		f := NewHedgeFilter(&HedgePolicy{MaxAttempts: 2, Delay: 10 * time.Millisecond, MinSamples: 10}, nil)
+
+		ctxt := rpc.WithMetadata(context.Background(), rpc.Describe(rpc.NativeFactory.Build(catalogService{})))
+
+		service, calls, _ := slowFirst()
+
+		_, err := f.Apply(ctxt, &core.Call{Method: "get"}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(atomic.LoadInt32(calls), ShouldEqual, 2)
+
+		service, calls, _ = slowFirst()
+
+		ctxt, cancel := context.WithTimeout(ctxt, 50*time.Millisecond)
+		defer cancel()
+
+		_, err = f.Apply(ctxt, &core.Call{Method: "Create"}, service).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+		So(atomic.LoadInt32(calls), ShouldEqual, 1)
+	})
+
+	Convey("hedge the calls to idempotent methods", t, func() {
+		f := NewHedgeFilter(&HedgePolicy{
+			MaxAttempts: 3,
+			Percentile:  0.9,
+			Delay:       10 * time.Millisecond,
+			MinSamples:  10,
+			Idempotent:  func(method string) bool { return method == "Get" },
+		}, nil)
+
+		Convey("take the first success and cancel the others", func() {
+			service, calls, canceled := slowFirst()
+
+			var reply string
+
+			result, err := f.Apply(context.Background(), &core.Call{Method: "Get", Reply: &reply}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, &reply)
+			So(reply, ShouldEqual, "fast")
+			So(atomic.LoadInt32(calls), ShouldEqual, 2)
+			So(<-canceled, ShouldEqual, context.Canceled)
+		})
+
+		Convey("don't hedge a non idempotent method", func() {
+			service, calls, _ := slowFirst()
+
+			ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := f.Apply(ctxt, &core.Call{Method: "Create"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+			So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		})
+
+		Convey("stop hedging once the budget is exhausted", func() {
+			f.Budget = NewRetryBudget(0, 0, 0)
+
+			service, calls, _ := slowFirst()
+
+			ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := f.Apply(ctxt, &core.Call{Method: "Get"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+			So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		})
+
+		Convey("replace a failed copy at once", func() {
+			service, calls := failing(core.CodeUnavailable, core.CodeUnavailable)
+
+			result, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "ok")
+			So(*calls, ShouldEqual, 3)
+		})
+
+		Convey("delay the copies by the percentile of the latencies", func() {
+			for i := 0; i < 10; i++ {
+				f.tracker("Get").Observe(time.Duration(i+1) * time.Second)
+			}
+
+			So(f.DelayOf("Get"), ShouldEqual, 9*time.Second)
+			So(f.DelayOf("List"), ShouldEqual, 10*time.Millisecond)
+		})
+	})
+}
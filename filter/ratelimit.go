@@ -0,0 +1,264 @@
+package filter
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/auth"
+	"github.com/flier/bucky/core"
+)
+
+// A Limiter decides whether a call with the given key may proceed now,
+// or how long it should wait before being retried.
+type Limiter interface {
+	Allow(key string, now time.Time) (bool, time.Duration)
+}
+
+// The idle keys are forgotten after a while, so that the limiters don't grow without bound.
+const limiterIdleTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// A TokenBucketLimiter allows Rate calls per second per key, with bursts of Burst calls.
+type TokenBucketLimiter struct {
+	Rate  float64
+	Burst int
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+var _ = (Limiter)((*TokenBucketLimiter)(nil))
+
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket)}
+}
+
+func (l *TokenBucketLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.tokens+elapsed.Seconds()*l.Rate, float64(l.Burst))
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return true, 0
+	}
+
+	if l.Rate <= 0 {
+		return false, limiterIdleTimeout
+	}
+
+	return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < limiterIdleTimeout {
+		return
+	}
+
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > limiterIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type rateWindow struct {
+	start             time.Time
+	current, previous int
+}
+
+// A SlidingWindowLimiter allows Limit calls per key within any Window,
+// estimated from the counts of the current and previous fixed windows.
+type SlidingWindowLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	lock    sync.Mutex
+	windows map[string]*rateWindow
+	swept   time.Time
+}
+
+var _ = (Limiter)((*SlidingWindowLimiter)(nil))
+
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{Limit: limit, Window: window, windows: make(map[string]*rateWindow)}
+}
+
+func (l *SlidingWindowLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	start := now.Truncate(l.Window)
+
+	if l.windows == nil {
+		l.windows = make(map[string]*rateWindow)
+	}
+
+	w, ok := l.windows[key]
+
+	if !ok {
+		w = &rateWindow{start: start}
+		l.windows[key] = w
+	}
+
+	switch elapsed := start.Sub(w.start); {
+	case elapsed >= 2*l.Window:
+		w.start, w.current, w.previous = start, 0, 0
+	case elapsed >= l.Window:
+		w.start, w.current, w.previous = start, 0, w.current
+	}
+
+	// the calls of the previous window are weighted by its overlap with the sliding window
+	overlap := 1 - float64(now.Sub(start))/float64(l.Window)
+	count := float64(w.previous)*overlap + float64(w.current)
+
+	if count < float64(l.Limit) {
+		w.current++
+
+		return true, 0
+	}
+
+	remaining := start.Add(l.Window).Sub(now)
+
+	// wait until enough calls of the previous window have slid out, or until the next window
+	if w.previous > 0 {
+		excess := count - float64(l.Limit)
+		wait := time.Duration(excess/float64(w.previous)*float64(l.Window)).Truncate(time.Millisecond) + time.Millisecond
+
+		if wait < remaining {
+			return false, wait
+		}
+	}
+
+	return false, remaining
+}
+
+func (l *SlidingWindowLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < limiterIdleTimeout {
+		return
+	}
+
+	l.swept = now
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) > 2*l.Window && now.Sub(w.start) > limiterIdleTimeout {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// A RateKey partitions the calls limited together.
+type RateKey func(ctxt context.Context, req core.Request) string
+
+var (
+	// Limit the calls of every method together.
+	ByServer RateKey = func(ctxt context.Context, req core.Request) string { return "" }
+
+	// Limit the calls of each method, whose name is lowercased like the HTTP servers do.
+	ByMethod RateKey = func(ctxt context.Context, req core.Request) string { return strings.ToLower(core.MethodOf(req)) }
+
+	// Limit the calls of each principal, the anonymous calls are limited together.
+	ByPrincipal RateKey = func(ctxt context.Context, req core.Request) string {
+		if p := auth.PrincipalOf(ctxt); p != nil {
+			return p.Method + ":" + p.Name
+		}
+
+		return ""
+	}
+
+	// Limit the calls of each principal to each method.
+	ByMethodAndPrincipal RateKey = func(ctxt context.Context, req core.Request) string {
+		return ByMethod(ctxt, req) + "/" + ByPrincipal(ctxt, req)
+	}
+)
+
+// A RateLimitFilter rejects the calls over their limit with RESOURCE_EXHAUSTED,
+// and tells the callers when to retry them.
+type RateLimitFilter struct {
+	Limiter Limiter
+	Key     RateKey
+
+	// The limiters of some methods, which replace the default one.
+	// The method names are matched regardless of their case, like the HTTP servers do.
+	Methods map[string]Limiter
+}
+
+var _ = (core.Filter)((*RateLimitFilter)(nil))
+
+func NewRateLimitFilter(limiter Limiter, key RateKey) *RateLimitFilter {
+	if key == nil {
+		key = ByServer
+	}
+
+	return &RateLimitFilter{Limiter: limiter, Key: key}
+}
+
+func (f *RateLimitFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	limiter := f.Limiter
+
+	if l, ok := f.methodLimiter(core.MethodOf(req)); ok {
+		limiter = l
+	}
+
+	if limiter == nil {
+		return service.Apply(ctxt, req)
+	}
+
+	key := ""
+
+	if f.Key != nil {
+		key = f.Key(ctxt, req)
+	}
+
+	if ok, retryAfter := limiter.Allow(key, time.Now()); !ok {
+		return core.Rejected(core.NewStatus(core.CodeResourceExhausted, "rate limit exceeded").WithRetryAfter(retryAfter))
+	}
+
+	return service.Apply(ctxt, req)
+}
+
+func (f *RateLimitFilter) methodLimiter(method string) (Limiter, bool) {
+	if l, ok := f.Methods[method]; ok {
+		return l, true
+	}
+
+	for name, l := range f.Methods {
+		if strings.EqualFold(name, method) {
+			return l, true
+		}
+	}
+
+	return nil, false
+}
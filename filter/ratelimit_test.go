@@ -0,0 +1,296 @@
+package filter
+
+import (
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/auth"
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	Convey("limit the rate with a token bucket", t, func() {
+		l := NewTokenBucketLimiter(10, 2)
+		now := time.Now()
+
+		ok, _ := l.Allow("a", now)
+		So(ok, ShouldBeTrue)
+		ok, _ = l.Allow("a", now)
+		So(ok, ShouldBeTrue)
+
+		ok, retryAfter := l.Allow("a", now)
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, 100*time.Millisecond)
+
+		ok, _ = l.Allow("b", now)
+		So(ok, ShouldBeTrue)
+
+		ok, _ = l.Allow("a", now.Add(100*time.Millisecond))
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("limit the rate with a limiter built without constructor", t, func() {
+		l := &TokenBucketLimiter{Rate: 10, Burst: 1}
+		now := time.Now()
+
+		ok, _ := l.Allow("a", now)
+		So(ok, ShouldBeTrue)
+
+		ok, retryAfter := l.Allow("a", now)
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, 100*time.Millisecond)
+	})
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	Convey("limit the rate with a sliding window", t, func() {
+		l := NewSlidingWindowLimiter(4, time.Second)
+		start := time.Now().Truncate(time.Second)
+
+		for i := 0; i < 4; i++ {
+			ok, _ := l.Allow("a", start.Add(100*time.Millisecond))
+			So(ok, ShouldBeTrue)
+		}
+
+		ok, retryAfter := l.Allow("a", start.Add(100*time.Millisecond))
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, 900*time.Millisecond)
+
+		// half of the previous window still counts
+		ok, _ = l.Allow("a", start.Add(1500*time.Millisecond))
+		So(ok, ShouldBeTrue)
+		ok, _ = l.Allow("a", start.Add(1500*time.Millisecond))
+		So(ok, ShouldBeTrue)
+
+		ok, retryAfter = l.Allow("a", start.Add(1500*time.Millisecond))
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, time.Millisecond)
+
+		ok, _ = l.Allow("a", start.Add(1501*time.Millisecond))
+		So(ok, ShouldBeTrue)
+
+		ok, retryAfter = l.Allow("a", start.Add(1501*time.Millisecond))
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, 250*time.Millisecond)
+
+		ok, _ = l.Allow("a", start.Add(5*time.Second))
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("limit the rate with a limiter built without constructor", t, func() {
+		l := &SlidingWindowLimiter{Limit: 1, Window: time.Second}
+		start := time.Now().Truncate(time.Second)
+
+		ok, _ := l.Allow("a", start)
+		So(ok, ShouldBeTrue)
+
+		ok, retryAfter := l.Allow("a", start)
+
+		So(ok, ShouldBeFalse)
+		So(retryAfter, ShouldEqual, time.Second)
+	})
+}
+
+type limitedService struct{}
+
+func (limitedService) Get() string       { return "ok" }
+func (limitedService) Unlimited() string { return "ok" }
+
+func TestRateLimitFilter(t *testing.T) {
+	Convey("limit the calls of each principal", t, func() {
+		f := NewRateLimitFilter(NewTokenBucketLimiter(1, 1), ByPrincipal)
+		f.Methods = map[string]Limiter{"Unlimited": NewTokenBucketLimiter(1000, 1000)}
+
+		service, calls := failing()
+
+		alice := auth.WithPrincipal(context.Background(), &auth.Principal{Name: "alice"})
+		bob := auth.WithPrincipal(context.Background(), &auth.Principal{Name: "bob"})
+
+		_, err := f.Apply(alice, &core.Call{Method: "Get"}, service).Get()
+		So(err, ShouldBeNil)
+
+		_, err = f.Apply(bob, &core.Call{Method: "Get"}, service).Get()
+		So(err, ShouldBeNil)
+
+		_, err = f.Apply(alice, &core.Call{Method: "Get"}, service).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeResourceExhausted)
+
+		retryAfter, ok := core.RetryAfterOf(err)
+
+		So(ok, ShouldBeTrue)
+		So(retryAfter, ShouldBeBetween, 900*time.Millisecond, time.Second+time.Millisecond)
+
+		_, err = f.Apply(alice, &core.Call{Method: "Unlimited"}, service).Get()
+		So(err, ShouldBeNil)
+
+		So(*calls, ShouldEqual, 3)
+	})
+
+	Convey("limit the calls served over HTTP", t, func() {
+		f := NewRateLimitFilter(NewTokenBucketLimiter(1, 1), ByMethod)
+		f.Methods = map[string]Limiter{"Unlimited": NewTokenBucketLimiter(1000, 1000)}
+
+		codec := http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "limited", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, core.WithFilters(rpc.NativeFactory.Build(limitedService{}), f)).(nethttp.Handler))
+		defer server.Close()
+
+		post := func(method string) int {
+			resp, err := nethttp.Post(server.URL+"/"+method, "application/json", nil)
+
+			So(err, ShouldBeNil)
+
+			resp.Body.Close()
+
+			return resp.StatusCode
+		}
+
+		So(post("Get"), ShouldEqual, nethttp.StatusOK)
+		So(post("Get"), ShouldEqual, nethttp.StatusTooManyRequests)
+
+		for i := 0; i < 3; i++ {
+			So(post("Unlimited"), ShouldEqual, nethttp.StatusOK)
+		}
+	})
+
+	Convey("retry after the delay told by the server", t, func() {
+		calls := 0
+
+		service := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+			calls++
+
+			if calls == 1 {
+				return core.Rejected(core.NewStatus(core.CodeResourceExhausted, "slow down").WithRetryAfter(50 * time.Millisecond))
+			}
+
+			return core.Resolved("ok")
+		})
+
+		f := NewRetryFilter(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}, nil)
+
+		started := time.Now()
+
+		result, err := f.Apply(context.Background(), &core.Call{Method: "Create"}, service).Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "ok")
+		So(time.Since(started), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+	})
+}
+
+func TestConcurrencyLimitFilter(t *testing.T) {
+	Convey("adapt the limit with AIMD", t, func() {
+		l := NewAIMDLimit(10, 2, 20, 100*time.Millisecond)
+
+		l.Update(10*time.Millisecond, 8, false)
+		So(l.Limit(), ShouldEqual, 11)
+
+		l.Update(10*time.Millisecond, 1, false)
+		So(l.Limit(), ShouldEqual, 11)
+
+		l.Update(time.Second, 8, false)
+		So(l.Limit(), ShouldEqual, 9)
+
+		for i := 0; i < 100; i++ {
+			l.Update(10*time.Millisecond, 8, true)
+		}
+
+		So(l.Limit(), ShouldEqual, 2)
+	})
+
+	Convey("adapt the limit with the latency gradient", t, func() {
+		l := NewGradientLimit(20, 5, 100)
+
+		for i := 0; i < 50; i++ {
+			l.Update(10*time.Millisecond, 20, false)
+		}
+
+		grown := l.Limit()
+
+		So(grown, ShouldBeGreaterThan, 20)
+
+		for i := 0; i < 20; i++ {
+			l.Update(100*time.Millisecond, grown, false)
+		}
+
+		So(l.Limit(), ShouldBeLessThan, grown)
+	})
+
+	Convey("keep admitting a call with a minimum limit of 0", t, func() {
+		aimd := NewAIMDLimit(10, 0, 20, 0)
+		gradient := NewGradientLimit(10, 0, 20)
+
+		So(aimd.MinLimit, ShouldEqual, 1)
+		So(gradient.MinLimit, ShouldEqual, 1)
+
+		for _, l := range []LimitAlgorithm{aimd, gradient, &AIMDLimit{MaxLimit: 20, BackoffRatio: 0.5}} {
+			for i := 0; i < 100; i++ {
+				l.Update(10*time.Millisecond, 10, true)
+			}
+
+			So(l.Limit(), ShouldBeGreaterThanOrEqualTo, 1)
+		}
+
+		So(aimd.Limit(), ShouldEqual, 1)
+	})
+
+	Convey("shed the calls over the limit", t, func() {
+		releases := map[string]chan struct{}{"first": make(chan struct{}), "second": make(chan struct{})}
+
+		service := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+			release := releases[core.MethodOf(req)]
+
+			return promise.Start(func() (interface{}, error) {
+				<-release
+
+				return "ok", nil
+			})
+		})
+
+		f := NewConcurrencyLimitFilter(NewAIMDLimit(2, 1, 10, 0))
+
+		first := f.Apply(context.Background(), &core.Call{Method: "first"}, service)
+		second := f.Apply(context.Background(), &core.Call{Method: "second"}, service)
+
+		So(f.InFlight(), ShouldEqual, 2)
+
+		_, err := f.Apply(context.Background(), &core.Call{Method: "third"}, service).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeResourceExhausted)
+
+		retryAfter, _ := core.RetryAfterOf(err)
+
+		So(retryAfter, ShouldEqual, 100*time.Millisecond)
+
+		// the calls complete in order, so that each of them sees the limit grown by the previous one
+		close(releases["first"])
+
+		_, err = first.Get()
+		So(err, ShouldBeNil)
+		So(f.InFlight(), ShouldEqual, 1)
+		So(f.Algorithm.Limit(), ShouldEqual, 3)
+
+		close(releases["second"])
+
+		_, err = second.Get()
+		So(err, ShouldBeNil)
+
+		So(f.InFlight(), ShouldEqual, 0)
+		So(f.Algorithm.Limit(), ShouldEqual, 4)
+	})
+}
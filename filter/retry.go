@@ -0,0 +1,210 @@
+package filter
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+var (
+	DefaultRetryableCodes = []core.Code{core.CodeUnavailable, core.CodeResourceExhausted, core.CodeAborted}
+
+	DefaultRetryPolicy = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: DefaultRetryableCodes,
+	}
+)
+
+// A RetryPolicy decides whether and when a failed call should be retried.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// The backoff before the first retry, multiplied after each attempt up to MaxBackoff.
+	InitialBackoff, MaxBackoff time.Duration
+	Multiplier                 float64
+
+	// The fraction of the backoff which is randomized, between 0 and 1.
+	Jitter float64
+
+	// The status codes worth retrying for the idempotent methods.
+	RetryableCodes []core.Code
+
+	// Is the method idempotent? Only ResourceExhausted, which means the call was
+	// rejected before being executed, is retried for the other methods.
+	Idempotent func(method string) bool
+}
+
+// Should the call be retried after the given attempt failed with the error?
+func (p *RetryPolicy) ShouldRetry(method string, attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	code := core.CodeOf(err)
+
+	if p.Idempotent == nil || !p.Idempotent(method) {
+		return code == core.CodeResourceExhausted
+	}
+
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the delay before the next attempt.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(backoff)
+}
+
+// A RetryBudget is a token bucket limiting the retries to a fraction of the calls,
+// so that a struggling server isn't flooded by retry storms.
+type RetryBudget struct {
+	// The tokens deposited by each call, 0.1 allows a retry for every ten calls.
+	Ratio float64
+
+	// The tokens deposited each second, which allows a few retries at low traffic.
+	RefillRate float64
+
+	// The maximum number of tokens.
+	Max float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewRetryBudget(ratio, refillRate, max float64) *RetryBudget {
+	return &RetryBudget{
+		Ratio:      ratio,
+		RefillRate: refillRate,
+		Max:        max,
+		tokens:     max,
+		last:       time.Now(),
+	}
+}
+
+// Record a call.
+func (b *RetryBudget) Deposit() {
+	b.lock.Lock()
+	b.refill(b.Ratio)
+	b.lock.Unlock()
+}
+
+// Take a token for a retry, return false if the budget is exhausted.
+func (b *RetryBudget) Withdraw() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(0)
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+func (b *RetryBudget) refill(tokens float64) {
+	now := time.Now()
+
+	if !b.last.IsZero() {
+		tokens += now.Sub(b.last).Seconds() * b.RefillRate
+	}
+
+	b.last = now
+	b.tokens = math.Min(b.tokens+tokens, b.Max)
+}
+
+// A RetryFilter retries the failed calls according to its policy,
+// within the retry budget and the deadline of the caller.
+type RetryFilter struct {
+	Policy *RetryPolicy
+	Budget *RetryBudget
+}
+
+var _ = (core.Filter)((*RetryFilter)(nil))
+
+func NewRetryFilter(policy *RetryPolicy, budget *RetryBudget) *RetryFilter {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+
+	return &RetryFilter{policy, budget}
+}
+
+func (f *RetryFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	if call, ok := req.(*core.Call); ok && call.Stream != nil {
+		// the messages of a stream can't be sent again
+		return service.Apply(ctxt, req)
+	}
+
+	if f.Budget != nil {
+		f.Budget.Deposit()
+	}
+
+	method := core.MethodOf(req)
+
+	return promise.Start(func() (interface{}, error) {
+		for attempt := 1; ; attempt++ {
+			result, err := service.Apply(ctxt, req).Get()
+
+			if err == nil || ctxt.Err() != nil || !f.Policy.ShouldRetry(method, attempt, err) {
+				return result, err
+			}
+
+			backoff := f.Policy.Backoff(attempt)
+
+			// the server knows better when it can serve the call again
+			if retryAfter, ok := core.RetryAfterOf(err); ok && retryAfter > backoff {
+				backoff = retryAfter
+			}
+
+			if deadline, ok := ctxt.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+				return result, err
+			}
+
+			if f.Budget != nil && !f.Budget.Withdraw() {
+				return result, err
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctxt.Done():
+				return result, err
+			}
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+func failing(codes ...core.Code) (core.Service, *int) {
+	calls := 0
+
+	return core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+		calls++
+
+		if calls <= len(codes) {
+			return core.Rejected(core.NewStatus(codes[calls-1], "attempt %d failed", calls))
+		}
+
+		return core.Resolved("ok")
+	}), &calls
+}
+
+func TestRetryFilter(t *testing.T) {
+	Convey("create RetryFilter", t, func() {
+		policy := &RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Multiplier:     2,
+			RetryableCodes: DefaultRetryableCodes,
+			Idempotent:     func(method string) bool { return method == "Get" },
+		}
+
+		f := NewRetryFilter(policy, nil)
+
+		Convey("retry an idempotent method", func() {
+			service, calls := failing(core.CodeUnavailable, core.CodeAborted)
+
+			result, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "ok")
+			So(*calls, ShouldEqual, 3)
+		})
+
+		Convey("give up after max attempts", func() {
+			service, calls := failing(core.CodeUnavailable, core.CodeUnavailable, core.CodeUnavailable)
+
+			_, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+			So(*calls, ShouldEqual, 3)
+		})
+
+		Convey("don't retry a non retryable error", func() {
+			service, calls := failing(core.CodeInvalidArgument)
+
+			_, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeInvalidArgument)
+			So(*calls, ShouldEqual, 1)
+		})
+
+		Convey("retry a non idempotent method only if it wasn't executed", func() {
+			service, calls := failing(core.CodeResourceExhausted, core.CodeUnavailable)
+
+			_, err := f.Apply(context.Background(), &core.Call{Method: "Put"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+			So(*calls, ShouldEqual, 2)
+		})
+
+		Convey("stop before the deadline of the caller", func() {
+			policy.InitialBackoff = time.Second
+
+			ctxt, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			service, calls := failing(core.CodeUnavailable)
+
+			_, err := f.Apply(ctxt, &core.Call{Method: "Get"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+			So(*calls, ShouldEqual, 1)
+		})
+
+		Convey("stop when the budget is exhausted", func() {
+			f.Budget = NewRetryBudget(0, 0, 1)
+
+			service, calls := failing(core.CodeUnavailable, core.CodeUnavailable)
+
+			_, err := f.Apply(context.Background(), &core.Call{Method: "Get"}, service).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+			So(*calls, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("compute backoff", t, func() {
+		p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+
+		So(p.Backoff(1), ShouldEqual, 100*time.Millisecond)
+		So(p.Backoff(2), ShouldEqual, 200*time.Millisecond)
+		So(p.Backoff(5), ShouldEqual, time.Second)
+
+		p.Jitter = 0.5
+
+		So(p.Backoff(2), ShouldBeBetweenOrEqual, 100*time.Millisecond, 200*time.Millisecond)
+	})
+}
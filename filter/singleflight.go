@@ -0,0 +1,207 @@
+package filter
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A RequestKeyFunc returns the key identifying the identical calls, which share their result.
+type RequestKeyFunc func(ctxt context.Context, call *core.Call) (string, error)
+
+// Return the key identifying the identical calls, made of the method and the encoded arguments.
+func RequestKey(call *core.Call) (string, error) {
+	payload := call.Payload
+
+	if payload == nil {
+		var err error
+
+		if payload, err = call.EncodeArgs(); err != nil {
+			return "", err
+		}
+	}
+
+	return call.String() + ":" + string(payload), nil
+}
+
+// Return the key identifying the identical calls of a principal, made of the principal and the request key,
+// so that the result of an authenticated call is only shared with the calls of the same principal.
+func CallerKey(ctxt context.Context, call *core.Call) (string, error) {
+	key, err := RequestKey(call)
+
+	if err != nil {
+		return "", err
+	}
+
+	return ByPrincipal(ctxt, call) + "/" + key, nil
+}
+
+// A detached context keeps the values of its parent but not its deadline or cancellation,
+// so that a shared call outlives the caller which started it.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+type flight struct {
+	future  *promise.Future
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// A SingleflightFilter collapses the concurrent identical calls into a single one,
+// whose result is shared by all the callers, each of them gets a copy of the reply.
+//
+// The shared call is canceled once all its callers gave up.
+type SingleflightFilter struct {
+	// Collapse the calls to the methods it accepts, all of them when nil.
+	Methods func(method string) bool
+
+	// The key of the calls, CallerKey when nil.
+	//
+	// The shared call runs with the context of its first caller, such as its principal,
+	// so a key shared by many principals must only be used before the authentication.
+	Key RequestKeyFunc
+
+	lock    sync.Mutex
+	flights map[string]*flight
+}
+
+var _ = (core.Filter)((*SingleflightFilter)(nil))
+
+func NewSingleflightFilter() *SingleflightFilter {
+	return &SingleflightFilter{flights: make(map[string]*flight)}
+}
+
+func (f *SingleflightFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok || call.Stream != nil || (f.Methods != nil && !f.Methods(call.Method)) {
+		return service.Apply(ctxt, req)
+	}
+
+	key, err := keyOf(f.Key, ctxt, call)
+
+	if err != nil {
+		return service.Apply(ctxt, req)
+	}
+
+	f.lock.Lock()
+
+	if f.flights == nil {
+		f.flights = make(map[string]*flight)
+	}
+
+	fl, ok := f.flights[key]
+
+	if !ok {
+		shared, cancel := context.WithCancel(detached{ctxt})
+
+		p := promise.NewPromise()
+
+		fl = &flight{future: p.Future, cancel: cancel}
+
+		f.flights[key] = fl
+
+		go func() {
+			r := <-service.Apply(shared, cloneCall(call)).GetChan()
+
+			f.lock.Lock()
+			if f.flights[key] == fl {
+				delete(f.flights, key)
+			}
+			f.lock.Unlock()
+
+			settleResult(p, r)
+		}()
+	}
+
+	fl.waiters++
+
+	f.lock.Unlock()
+
+	result := promise.NewPromise()
+
+	go func() {
+		select {
+		case r := <-fl.future.GetChan():
+			if r.Typ == promise.RESULT_SUCCESS && call.Reply != nil {
+				copyReply(call.Reply, r.Result)
+
+				result.Resolve(call.Reply)
+			} else {
+				settleResult(result, r)
+			}
+
+		case <-ctxt.Done():
+			f.leave(key, fl)
+
+			result.Reject(core.StatusOf(ctxt.Err()))
+		}
+	}()
+
+	return result.Future
+}
+
+func keyOf(key RequestKeyFunc, ctxt context.Context, call *core.Call) (string, error) {
+	if key == nil {
+		key = CallerKey
+	}
+
+	return key(ctxt, call)
+}
+
+// The caller gave up, cancel the shared call if it was the last one.
+func (f *SingleflightFilter) leave(key string, fl *flight) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if fl.waiters--; fl.waiters == 0 {
+		if f.flights[key] == fl {
+			delete(f.flights, key)
+		}
+
+		fl.cancel()
+	}
+}
+
+// Copy the value pointed by the shared reply into the reply of a caller, when their types match.
+func copyReply(reply, shared interface{}) {
+	dst := reflect.ValueOf(reply)
+	src := reflect.ValueOf(shared)
+
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return
+	}
+
+	if src.Kind() == reflect.Ptr && !src.IsNil() {
+		src = src.Elem()
+	}
+
+	if src.IsValid() && src.Type().AssignableTo(dst.Elem().Type()) {
+		dst.Elem().Set(src)
+	}
+}
+
+func settleResult(result *promise.Promise, r *promise.PromiseResult) {
+	switch r.Typ {
+	case promise.RESULT_SUCCESS:
+		result.Resolve(r.Result)
+	case promise.RESULT_FAILURE:
+		if err, ok := r.Result.(error); ok {
+			result.Reject(err)
+		} else {
+			result.Reject(core.NewStatus(core.CodeUnknown, "%v", r.Result))
+		}
+	default:
+		result.Cancel()
+	}
+}
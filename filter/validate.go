@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/validate"
+)
+
+// A ValidationFilter checks the arguments of the served calls against the rules of their struct tags,
+// before they reach the method, see the validate package for the rules.
+//
+// The arguments are decoded once by the filter, and a call violating the rules is rejected
+// with an INVALID_ARGUMENT status listing every violation, also in its `violations` detail.
+type ValidationFilter struct {
+	// The metadata of the service, to decode the arguments,
+	// the one of the filtered service is used otherwise.
+	Metadata rpc.Metadata
+}
+
+var _ = (core.Filter)((*ValidationFilter)(nil))
+
+func NewValidationFilter(metadata rpc.Metadata) *ValidationFilter {
+	return &ValidationFilter{metadata}
+}
+
+func (f *ValidationFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return service.Apply(ctxt, req)
+	}
+
+	metadata := f.Metadata
+
+	if metadata == nil {
+		metadata = rpc.Describe(service)
+	}
+
+	if metadata == nil {
+		return service.Apply(ctxt, req)
+	}
+
+	m, ok := metadata.Method(call.Method)
+
+	if !ok {
+		return service.Apply(ctxt, req)
+	}
+
+	c := *call
+
+	var args []interface{}
+	var err error
+
+	if c.Named {
+		args, err = c.DecodeNamedArgs(m.Params, m.In)
+	} else {
+		args, err = c.DecodeArgs(m.In)
+	}
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	switch err := validate.Args(m.Params, args).(type) {
+	case nil:
+	case validate.Violations:
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "invalid arguments of `%s`, %s", m.Name, err).WithDetail("violations", err))
+	default:
+		return core.Rejected(core.NewStatus(core.CodeInternal, "%s", err))
+	}
+
+	// the dispatcher doesn't decode the arguments again
+	c.Args = args
+
+	return service.Apply(ctxt, &c)
+}
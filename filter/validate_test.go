@@ -0,0 +1,54 @@
+package filter
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/validate"
+)
+
+type signup struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+type accountService struct{}
+
+func (s *accountService) Signup(req *signup) string { return "welcome " + req.Name }
+
+func TestValidationFilter(t *testing.T) {
+	Convey("validate the arguments before they reach the method", t, func() {
+		service := core.WithFilters(rpc.NativeFactory.Build(&accountService{}), NewValidationFilter(nil))
+
+		result, err := service.Apply(context.Background(), &core.Call{
+			Method:  "Signup",
+			Payload: []byte(`{"name": "bob", "email": "bob@example.com"}`),
+		}).Get()
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "welcome bob")
+
+		Convey("reject the invalid arguments with their violations", func() {
+			_, err := service.Apply(context.Background(), &core.Call{
+				Method:  "Signup",
+				Payload: []byte(`{"email": "bob"}`),
+			}).Get()
+
+			So(err, ShouldResemble, core.NewStatus(core.CodeInvalidArgument,
+				"invalid arguments of `Signup`, name is required; email must be an email address").WithDetail("violations", validate.Violations{
+				{Field: "name", Rule: "required", Message: "is required"},
+				{Field: "email", Rule: "email", Message: "must be an email address"},
+			}))
+		})
+
+		Convey("reject the undecodable arguments", func() {
+			_, err := service.Apply(context.Background(), &core.Call{Method: "Signup", Payload: []byte(`[`)}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeInvalidArgument)
+		})
+	})
+}
@@ -0,0 +1,533 @@
+// Package gen generates the compile-time checked code of a Go interface served by bucky, for `bucky gen`,
+//
+//	<I><M>Request   the parameters of a method, with their real names
+//	<I><M>Response  the results of a method
+//	<I>Client       a typed client calling the methods of a service, with a context and an error
+//	<I>Server       an adapter serving an implementation, which names the parameters of its methods
+//	<I>Mock         a mock calling the functions of its fields, and recording the requests
+//
+// The streaming methods are served by the adapter and mocked, but they're called with core.OpenStream.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// The Config of a generation.
+type Config struct {
+	// The directory of the package, the current directory if empty.
+	Dir string
+
+	// The package of the interface, such as `.` or `github.com/flier/bucky/examples/stringsvc1`.
+	Package string
+
+	// The name of the interface, such as `StringService`.
+	Interface string
+}
+
+// Return the file of the generated code, such as `stringservice_bucky.go` in the directory of the package.
+func OutputOf(dir, iface string) string {
+	return filepath.Join(dir, strings.ToLower(iface)+"_bucky.go")
+}
+
+// Generate the code of an interface, return it with the directory of its package.
+func Generate(cfg *Config) (code []byte, dir string, err error) {
+	pattern := cfg.Package
+
+	if pattern == "" {
+		pattern = "."
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedTypes,
+		Dir:  cfg.Dir,
+	}, pattern)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("fail to load package `%s`, %s", pattern, err)
+	}
+
+	if len(pkgs) != 1 {
+		return nil, "", fmt.Errorf("package `%s` matches %d packages", pattern, len(pkgs))
+	}
+
+	pkg := pkgs[0]
+
+	// the type errors are tolerated, such as the ones of a stale generated file
+	if pkg.Types == nil || len(pkg.GoFiles) == 0 {
+		return nil, "", fmt.Errorf("fail to load package `%s`, %v", pattern, pkg.Errors)
+	}
+
+	obj := pkg.Types.Scope().Lookup(cfg.Interface)
+
+	if obj == nil {
+		return nil, "", fmt.Errorf("interface `%s` not found in package `%s`", cfg.Interface, pkg.PkgPath)
+	}
+
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+
+	if !ok {
+		return nil, "", fmt.Errorf("`%s` isn't an interface", cfg.Interface)
+	}
+
+	code, err = generate(pkg.Types, cfg.Interface, iface)
+
+	return code, filepath.Dir(pkg.GoFiles[0]), err
+}
+
+type param struct {
+	Ident    string // the identifier of the parameter in the generated code
+	Field    string
+	JSON     string
+	Type     string
+	Variadic bool
+	Chan     bool
+}
+
+// Return the argument of a call, spread when it's variadic.
+func (p *param) Arg() string {
+	if p.Variadic {
+		return p.Ident + "..."
+	}
+
+	return p.Ident
+}
+
+// Return the declaration of the parameter in a signature.
+func (p *param) Decl() string {
+	if p.Variadic {
+		return p.Ident + " ..." + strings.TrimPrefix(p.Type, "[]")
+	}
+
+	return p.Ident + " " + p.Type
+}
+
+type method struct {
+	Name    string
+	Context string // the type of the context parameter, if the method takes one
+	Params  []*param
+	Results []*param
+	Error   bool
+}
+
+// Return the signature of the method, as declared by the interface, with the generated parameter names.
+func (m *method) Signature() string {
+	var params, results []string
+
+	if m.Context != "" {
+		params = append(params, "ctxt "+m.Context)
+	}
+
+	for _, p := range m.Params {
+		params = append(params, p.Decl())
+	}
+
+	for _, r := range m.Results {
+		results = append(results, r.Type)
+	}
+
+	if m.Error {
+		results = append(results, "error")
+	}
+
+	signature := "(" + strings.Join(params, ", ") + ")"
+
+	switch len(results) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " " + results[0]
+	default:
+		return signature + " (" + strings.Join(results, ", ") + ")"
+	}
+}
+
+// Return the parameters which are sent as arguments, without the context and the streams.
+func (m *method) Args() []*param {
+	var args []*param
+
+	for _, p := range m.Params {
+		if !p.Chan {
+			args = append(args, p)
+		}
+	}
+
+	return args
+}
+
+// Return the arguments of a call to the method, with the context.
+func (m *method) CallArgs() string {
+	var args []string
+
+	if m.Context != "" {
+		args = append(args, "ctxt")
+	}
+
+	for _, p := range m.Params {
+		args = append(args, p.Arg())
+	}
+
+	return strings.Join(args, ", ")
+}
+
+func (m *method) Streaming() bool {
+	return len(m.Args()) != len(m.Params)
+}
+
+// Return the results of the typed client.
+func (m *method) ClientResults() string {
+	var results []string
+
+	for _, r := range m.Results {
+		results = append(results, r.Type)
+	}
+
+	results = append(results, "error")
+
+	if len(results) == 1 {
+		return "error"
+	}
+
+	return "(" + strings.Join(results, ", ") + ")"
+}
+
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string // the names of the imported packages, keyed by their path
+	names   map[string]string // the paths of the imported packages, keyed by their name
+}
+
+const (
+	contextPath = "golang.org/x/net/context"
+	corePath    = "github.com/flier/bucky/core"
+	rpcPath     = "github.com/flier/bucky/rpc"
+	syncPath    = "sync"
+)
+
+// The identifiers of the generated code, which are renamed when a parameter uses them.
+var reserved = map[string]bool{
+	"ctxt": true, "client": true, "server": true, "mock": true, "req": true, "resp": true, "err": true,
+	"context": true, "core": true, "rpc": true, "sync": true,
+}
+
+func generate(pkg *types.Package, name string, iface *types.Interface) ([]byte, error) {
+	g := &generator{pkg: pkg, imports: make(map[string]string), names: make(map[string]string)}
+
+	for _, path := range []string{syncPath, contextPath, corePath, rpcPath} {
+		g.importName(path, filepath.Base(path))
+	}
+
+	data := struct {
+		Package   string
+		Interface string
+		Imports   []string
+		Methods   []*method
+	}{Package: pkg.Name(), Interface: name}
+
+	for i := 0; i < iface.NumMethods(); i++ {
+		data.Methods = append(data.Methods, g.method(iface.Method(i)))
+	}
+
+	var paths []string
+
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+
+	// the packages of the standard library come first
+	sort.Slice(paths, func(i, j int) bool {
+		if std := isStd(paths[i]); std != isStd(paths[j]) {
+			return std
+		}
+
+		return paths[i] < paths[j]
+	})
+
+	for i, path := range paths {
+		if i > 0 && isStd(paths[i-1]) && !isStd(path) {
+			data.Imports = append(data.Imports, "")
+		}
+
+		if name := g.imports[path]; filepath.Base(path) == name {
+			data.Imports = append(data.Imports, strconv.Quote(path))
+		} else {
+			data.Imports = append(data.Imports, name+" "+strconv.Quote(path))
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := codeTemplate.Execute(&buf, &data); err != nil {
+		return nil, err
+	}
+
+	code, err := format.Source(buf.Bytes())
+
+	if err != nil {
+		return nil, fmt.Errorf("fail to format the generated code, %s", err)
+	}
+
+	return code, nil
+}
+
+// Return the name of an imported package, which is renamed when another package has the same name.
+func (g *generator) importName(path, name string) string {
+	if name, ok := g.imports[path]; ok {
+		return name
+	}
+
+	for i := 2; g.names[name] != ""; i++ {
+		name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), i)
+	}
+
+	g.imports[path], g.names[name] = name, path
+
+	return name
+}
+
+func (g *generator) qualifier(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+
+	path := pkg.Path()
+
+	// the context of the standard library is an alias of the one used by bucky
+	if path == "context" {
+		path = contextPath
+	}
+
+	return g.importName(path, pkg.Name())
+}
+
+func (g *generator) method(fn *types.Func) *method {
+	sig := fn.Type().(*types.Signature)
+
+	m := &method{Name: fn.Name()}
+
+	used := make(map[string]bool)
+
+	for i := 0; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+
+		if i == 0 && isContext(v.Type()) {
+			m.Context = types.TypeString(v.Type(), g.qualifier)
+			continue
+		}
+
+		p := g.param(v, i, "arg", used)
+
+		p.Variadic = sig.Variadic() && i == sig.Params().Len()-1
+		_, p.Chan = v.Type().Underlying().(*types.Chan)
+
+		m.Params = append(m.Params, p)
+	}
+
+	results := sig.Results()
+
+	for i := 0; i < results.Len(); i++ {
+		v := results.At(i)
+
+		if i == results.Len()-1 && types.Identical(v.Type(), types.Universe.Lookup("error").Type()) {
+			m.Error = true
+			continue
+		}
+
+		m.Results = append(m.Results, g.param(v, i, "result", used))
+	}
+
+	if len(m.Results) == 1 && sig.Results().At(0).Name() == "" {
+		m.Results[0].Ident, m.Results[0].Field, m.Results[0].JSON = "result", "Result", "result"
+	}
+
+	return m
+}
+
+// Return a parameter or a result named by the interface, or by its position.
+func (g *generator) param(v *types.Var, i int, prefix string, used map[string]bool) *param {
+	name := v.Name()
+
+	if strings.Trim(name, "_") == "" {
+		name = fmt.Sprintf("%s%d", prefix, i)
+	}
+
+	ident := name
+
+	for reserved[ident] || used[ident] {
+		ident += "_"
+	}
+
+	used[ident] = true
+
+	field := []rune(strings.TrimLeft(name, "_"))
+
+	field[0] = unicode.ToUpper(field[0])
+
+	return &param{
+		Ident: ident,
+		Field: string(field),
+		JSON:  name,
+		Type:  types.TypeString(v.Type(), g.qualifier),
+	}
+}
+
+func isStd(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	path := named.Obj().Pkg().Path()
+
+	return named.Obj().Name() == "Context" && (path == "context" || path == contextPath)
+}
+
+var codeTemplate = template.Must(template.New("code").Parse(`// Code generated by bucky gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{$iface := .Interface}}
+{{- range .Methods}}{{$m := .}}
+
+// {{$iface}}{{.Name}}Request is the request of {{$iface}}.{{.Name}}.
+type {{$iface}}{{.Name}}Request struct {
+{{- range .Args}}
+	{{.Field}} {{.Type}} ` + "`json:\"{{.JSON}}\"`" + `
+{{- end}}
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *{{$iface}}{{.Name}}Request) Args() []interface{} {
+	return []interface{}{ {{- range $i, $p := .Args}}{{if $i}}, {{end}}req.{{$p.Field}}{{end -}} }
+}
+
+// {{$iface}}{{.Name}}Response is the response of {{$iface}}.{{.Name}}.
+type {{$iface}}{{.Name}}Response struct {
+{{- range .Results}}
+	{{.Field}} {{.Type}} ` + "`json:\"{{.JSON}}\"`" + `
+{{- end}}
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *{{$iface}}{{.Name}}Response) Results() []interface{} {
+	return []interface{}{ {{- range $i, $r := .Results}}{{if $i}}, {{end}}&resp.{{$r.Field}}{{end -}} }
+}
+{{- end}}
+
+// {{.Interface}}Client calls the methods of a {{.Interface}} served by bucky.
+type {{.Interface}}Client struct {
+	Service core.Service
+}
+
+func New{{.Interface}}Client(service core.Service) *{{.Interface}}Client {
+	return &{{.Interface}}Client{service}
+}
+{{- range .Methods}}{{if not .Streaming}}
+
+// Call {{$iface}}.{{.Name}}.
+func (client *{{$iface}}Client) {{.Name}}(ctxt context.Context{{range .Params}}, {{.Decl}}{{end}}) {{.ClientResults}} {
+	req := &{{$iface}}{{.Name}}Request{ {{- range $i, $p := .Args}}{{if $i}}, {{end}}{{$p.Field}}: {{$p.Ident}}{{end -}} }
+
+	var resp {{$iface}}{{.Name}}Response
+
+	err := rpc.Invoke(ctxt, client.Service, "{{.Name}}", req.Args(), resp.Results()...)
+
+	return {{range .Results}}resp.{{.Field}}, {{end}}err
+}
+{{- end}}{{end}}
+
+// {{.Interface}}Server serves an implementation of {{.Interface}}, naming the parameters of its methods.
+type {{.Interface}}Server struct {
+	Impl {{.Interface}}
+}
+
+var _ = (rpc.ParamNamer)((*{{.Interface}}Server)(nil))
+var _ = (rpc.MethodOptioner)((*{{.Interface}}Server)(nil))
+
+func New{{.Interface}}Server(impl {{.Interface}}) *{{.Interface}}Server {
+	return &{{.Interface}}Server{impl}
+}
+{{- range .Methods}}
+
+func (server *{{$iface}}Server) {{.Name}}{{.Signature}} {
+	{{if or .Results .Error}}return {{end}}server.Impl.{{.Name}}({{.CallArgs}})
+}
+{{- end}}
+
+// Return the names of the parameters, without the context and the streams.
+func (server *{{.Interface}}Server) ParamNames() map[string][]string {
+	return map[string][]string{
+{{- range .Methods}}
+		"{{.Name}}": { {{- range $i, $p := .Args}}{{if $i}}, {{end}}"{{$p.JSON}}"{{end -}} },
+{{- end}}
+	}
+}
+
+// Return the options of the methods, set by the implementation.
+func (server *{{.Interface}}Server) MethodOptions() map[string]*rpc.MethodOptions {
+	if optioner, ok := server.Impl.(rpc.MethodOptioner); ok {
+		return optioner.MethodOptions()
+	}
+
+	return nil
+}
+
+// {{.Interface}}Mock mocks a {{.Interface}}, its methods call the functions of the same name and record their requests.
+type {{.Interface}}Mock struct {
+{{- range .Methods}}
+	{{.Name}}Func func{{.Signature}}
+{{- end}}
+
+	lock  sync.Mutex
+	calls struct {
+{{- range .Methods}}
+		{{.Name}} []*{{$iface}}{{.Name}}Request
+{{- end}}
+	}
+}
+
+var _ = ({{.Interface}})((*{{.Interface}}Mock)(nil))
+{{- range .Methods}}
+
+func (mock *{{$iface}}Mock) {{.Name}}{{.Signature}} {
+	mock.lock.Lock()
+	mock.calls.{{.Name}} = append(mock.calls.{{.Name}}, &{{$iface}}{{.Name}}Request{ {{- range $i, $p := .Args}}{{if $i}}, {{end}}{{$p.Field}}: {{$p.Ident}}{{end -}} })
+	mock.lock.Unlock()
+
+	if mock.{{.Name}}Func == nil {
+		panic("{{$iface}}Mock.{{.Name}}Func isn't set")
+	}
+
+	{{if or .Results .Error}}return {{end}}mock.{{.Name}}Func({{.CallArgs}})
+}
+
+// Return the requests of the {{.Name}} calls.
+func (mock *{{$iface}}Mock) {{.Name}}Calls() []*{{$iface}}{{.Name}}Request {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*{{$iface}}{{.Name}}Request(nil), mock.calls.{{.Name}}...)
+}
+{{- end}}
+`))
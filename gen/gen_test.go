@@ -0,0 +1,141 @@
+package gen
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/gen/testdata/store"
+	"github.com/flier/bucky/rpc"
+)
+
+type memStore struct {
+	items map[string]*store.Item
+}
+
+func (s *memStore) Get(ctxt context.Context, key string) (*store.Item, error) {
+	if item, ok := s.items[key]; ok {
+		return item, nil
+	}
+
+	return nil, errors.New("not found")
+}
+
+func (s *memStore) Put(ctxt context.Context, item *store.Item, ttl time.Duration) error {
+	s.items[item.Key] = item
+
+	return nil
+}
+
+func (s *memStore) Delete(keys ...string) (deleted int, err error) {
+	for _, key := range keys {
+		if _, ok := s.items[key]; ok {
+			delete(s.items, key)
+			deleted++
+		}
+	}
+
+	return
+}
+
+func (s *memStore) Scan(prefix string, limit int) ([]*store.Item, string, error) {
+	return nil, prefix, nil
+}
+
+func (s *memStore) Watch(ctxt context.Context, prefix string, events chan<- *store.Item) error {
+	return nil
+}
+
+func (s *memStore) Ping(string) {}
+
+func TestGenerate(t *testing.T) {
+	Convey("generate the code of an interface", t, func() {
+		for _, cfg := range []*Config{
+			{Dir: "testdata/store", Package: ".", Interface: "Store"},
+			{Dir: "../examples/stringsvc1", Package: ".", Interface: "StringService"},
+		} {
+			code, dir, err := Generate(cfg)
+
+			So(err, ShouldBeNil)
+
+			golden, err := ioutil.ReadFile(OutputOf(dir, cfg.Interface))
+
+			So(err, ShouldBeNil)
+			So(string(code), ShouldEqual, string(golden))
+		}
+
+		Convey("reject the unknown interfaces", func() {
+			_, _, err := Generate(&Config{Dir: "testdata/store", Package: ".", Interface: "Item"})
+
+			So(err, ShouldNotBeNil)
+
+			_, _, err = Generate(&Config{Dir: "testdata/store", Package: ".", Interface: "Cache"})
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("name the output after the interface", t, func() {
+		So(OutputOf("examples", "StringService"), ShouldEqual, filepath.Join("examples", "stringservice_bucky.go"))
+	})
+}
+
+func TestGenerated(t *testing.T) {
+	Convey("call a served implementation with the typed client", t, func() {
+		impl := &memStore{items: make(map[string]*store.Item)}
+		client := store.NewStoreClient(rpc.NativeFactory.Build(store.NewStoreServer(impl)))
+		ctxt := context.Background()
+
+		So(client.Put(ctxt, &store.Item{Key: "a", Value: []byte("1")}, time.Minute), ShouldBeNil)
+
+		item, err := client.Get(ctxt, "a")
+
+		So(err, ShouldBeNil)
+		So(item.Value, ShouldResemble, []byte("1"))
+
+		_, err = client.Get(ctxt, "b")
+
+		So(err, ShouldNotBeNil)
+
+		deleted, err := client.Delete(ctxt, "a", "b")
+
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 1)
+
+		items, next, err := client.Scan(ctxt, "c", 10)
+
+		So(err, ShouldBeNil)
+		So(items, ShouldBeNil)
+		So(next, ShouldEqual, "c")
+
+		So(client.Ping(ctxt, "hello"), ShouldBeNil)
+
+		Convey("name the parameters of the server", func() {
+			md := rpc.Describe(rpc.NativeFactory.Build(store.NewStoreServer(impl)))
+
+			m, ok := md.Method("Put")
+
+			So(ok, ShouldBeTrue)
+			So(m.Params, ShouldResemble, []string{"item", "ttl"})
+		})
+	})
+
+	Convey("record the calls of a mock", t, func() {
+		mock := &store.StoreMock{
+			DeleteFunc: func(keys ...string) (int, error) { return len(keys), nil },
+		}
+
+		deleted, err := mock.Delete("a", "b")
+
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 2)
+		So(mock.DeleteCalls(), ShouldResemble, []*store.StoreDeleteRequest{{Keys: []string{"a", "b"}}})
+		So(func() { mock.Ping("hello") }, ShouldPanic)
+		So(mock.PingCalls(), ShouldHaveLength, 1)
+	})
+}
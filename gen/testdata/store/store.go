@@ -0,0 +1,29 @@
+// Package store is an interface generated by the tests of `bucky gen`.
+package store
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate bucky gen Store
+
+type Item struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+type Store interface {
+	Get(ctxt context.Context, key string) (*Item, error)
+
+	Put(ctxt context.Context, item *Item, ttl time.Duration) error
+
+	Delete(keys ...string) (deleted int, err error)
+
+	Scan(prefix string, limit int) (items []*Item, next string, err error)
+
+	Watch(ctxt context.Context, prefix string, events chan<- *Item) error
+
+	Ping(string)
+}
@@ -0,0 +1,395 @@
+// Code generated by bucky gen. DO NOT EDIT.
+
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+	"golang.org/x/net/context"
+)
+
+// StoreDeleteRequest is the request of Store.Delete.
+type StoreDeleteRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StoreDeleteRequest) Args() []interface{} {
+	return []interface{}{req.Keys}
+}
+
+// StoreDeleteResponse is the response of Store.Delete.
+type StoreDeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StoreDeleteResponse) Results() []interface{} {
+	return []interface{}{&resp.Deleted}
+}
+
+// StoreGetRequest is the request of Store.Get.
+type StoreGetRequest struct {
+	Key string `json:"key"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StoreGetRequest) Args() []interface{} {
+	return []interface{}{req.Key}
+}
+
+// StoreGetResponse is the response of Store.Get.
+type StoreGetResponse struct {
+	Result *Item `json:"result"`
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StoreGetResponse) Results() []interface{} {
+	return []interface{}{&resp.Result}
+}
+
+// StorePingRequest is the request of Store.Ping.
+type StorePingRequest struct {
+	Arg0 string `json:"arg0"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StorePingRequest) Args() []interface{} {
+	return []interface{}{req.Arg0}
+}
+
+// StorePingResponse is the response of Store.Ping.
+type StorePingResponse struct {
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StorePingResponse) Results() []interface{} {
+	return []interface{}{}
+}
+
+// StorePutRequest is the request of Store.Put.
+type StorePutRequest struct {
+	Item *Item         `json:"item"`
+	Ttl  time.Duration `json:"ttl"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StorePutRequest) Args() []interface{} {
+	return []interface{}{req.Item, req.Ttl}
+}
+
+// StorePutResponse is the response of Store.Put.
+type StorePutResponse struct {
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StorePutResponse) Results() []interface{} {
+	return []interface{}{}
+}
+
+// StoreScanRequest is the request of Store.Scan.
+type StoreScanRequest struct {
+	Prefix string `json:"prefix"`
+	Limit  int    `json:"limit"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StoreScanRequest) Args() []interface{} {
+	return []interface{}{req.Prefix, req.Limit}
+}
+
+// StoreScanResponse is the response of Store.Scan.
+type StoreScanResponse struct {
+	Items []*Item `json:"items"`
+	Next  string  `json:"next"`
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StoreScanResponse) Results() []interface{} {
+	return []interface{}{&resp.Items, &resp.Next}
+}
+
+// StoreWatchRequest is the request of Store.Watch.
+type StoreWatchRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+// Return the arguments of the call, in the order of the parameters.
+func (req *StoreWatchRequest) Args() []interface{} {
+	return []interface{}{req.Prefix}
+}
+
+// StoreWatchResponse is the response of Store.Watch.
+type StoreWatchResponse struct {
+}
+
+// Return the pointers to the results of the call, in the order of the results.
+func (resp *StoreWatchResponse) Results() []interface{} {
+	return []interface{}{}
+}
+
+// StoreClient calls the methods of a Store served by bucky.
+type StoreClient struct {
+	Service core.Service
+}
+
+func NewStoreClient(service core.Service) *StoreClient {
+	return &StoreClient{service}
+}
+
+// Call Store.Delete.
+func (client *StoreClient) Delete(ctxt context.Context, keys ...string) (int, error) {
+	req := &StoreDeleteRequest{Keys: keys}
+
+	var resp StoreDeleteResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Delete", req.Args(), resp.Results()...)
+
+	return resp.Deleted, err
+}
+
+// Call Store.Get.
+func (client *StoreClient) Get(ctxt context.Context, key string) (*Item, error) {
+	req := &StoreGetRequest{Key: key}
+
+	var resp StoreGetResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Get", req.Args(), resp.Results()...)
+
+	return resp.Result, err
+}
+
+// Call Store.Ping.
+func (client *StoreClient) Ping(ctxt context.Context, arg0 string) error {
+	req := &StorePingRequest{Arg0: arg0}
+
+	var resp StorePingResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Ping", req.Args(), resp.Results()...)
+
+	return err
+}
+
+// Call Store.Put.
+func (client *StoreClient) Put(ctxt context.Context, item *Item, ttl time.Duration) error {
+	req := &StorePutRequest{Item: item, Ttl: ttl}
+
+	var resp StorePutResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Put", req.Args(), resp.Results()...)
+
+	return err
+}
+
+// Call Store.Scan.
+func (client *StoreClient) Scan(ctxt context.Context, prefix string, limit int) ([]*Item, string, error) {
+	req := &StoreScanRequest{Prefix: prefix, Limit: limit}
+
+	var resp StoreScanResponse
+
+	err := rpc.Invoke(ctxt, client.Service, "Scan", req.Args(), resp.Results()...)
+
+	return resp.Items, resp.Next, err
+}
+
+// StoreServer serves an implementation of Store, naming the parameters of its methods.
+type StoreServer struct {
+	Impl Store
+}
+
+var _ = (rpc.ParamNamer)((*StoreServer)(nil))
+var _ = (rpc.MethodOptioner)((*StoreServer)(nil))
+
+func NewStoreServer(impl Store) *StoreServer {
+	return &StoreServer{impl}
+}
+
+func (server *StoreServer) Delete(keys ...string) (int, error) {
+	return server.Impl.Delete(keys...)
+}
+
+func (server *StoreServer) Get(ctxt context.Context, key string) (*Item, error) {
+	return server.Impl.Get(ctxt, key)
+}
+
+func (server *StoreServer) Ping(arg0 string) {
+	server.Impl.Ping(arg0)
+}
+
+func (server *StoreServer) Put(ctxt context.Context, item *Item, ttl time.Duration) error {
+	return server.Impl.Put(ctxt, item, ttl)
+}
+
+func (server *StoreServer) Scan(prefix string, limit int) ([]*Item, string, error) {
+	return server.Impl.Scan(prefix, limit)
+}
+
+func (server *StoreServer) Watch(ctxt context.Context, prefix string, events chan<- *Item) error {
+	return server.Impl.Watch(ctxt, prefix, events)
+}
+
+// Return the names of the parameters, without the context and the streams.
+func (server *StoreServer) ParamNames() map[string][]string {
+	return map[string][]string{
+		"Delete": {"keys"},
+		"Get":    {"key"},
+		"Ping":   {"arg0"},
+		"Put":    {"item", "ttl"},
+		"Scan":   {"prefix", "limit"},
+		"Watch":  {"prefix"},
+	}
+}
+
+// Return the options of the methods, set by the implementation.
+func (server *StoreServer) MethodOptions() map[string]*rpc.MethodOptions {
+	if optioner, ok := server.Impl.(rpc.MethodOptioner); ok {
+		return optioner.MethodOptions()
+	}
+
+	return nil
+}
+
+// StoreMock mocks a Store, its methods call the functions of the same name and record their requests.
+type StoreMock struct {
+	DeleteFunc func(keys ...string) (int, error)
+	GetFunc    func(ctxt context.Context, key string) (*Item, error)
+	PingFunc   func(arg0 string)
+	PutFunc    func(ctxt context.Context, item *Item, ttl time.Duration) error
+	ScanFunc   func(prefix string, limit int) ([]*Item, string, error)
+	WatchFunc  func(ctxt context.Context, prefix string, events chan<- *Item) error
+
+	lock  sync.Mutex
+	calls struct {
+		Delete []*StoreDeleteRequest
+		Get    []*StoreGetRequest
+		Ping   []*StorePingRequest
+		Put    []*StorePutRequest
+		Scan   []*StoreScanRequest
+		Watch  []*StoreWatchRequest
+	}
+}
+
+var _ = (Store)((*StoreMock)(nil))
+
+func (mock *StoreMock) Delete(keys ...string) (int, error) {
+	mock.lock.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, &StoreDeleteRequest{Keys: keys})
+	mock.lock.Unlock()
+
+	if mock.DeleteFunc == nil {
+		panic("StoreMock.DeleteFunc isn't set")
+	}
+
+	return mock.DeleteFunc(keys...)
+}
+
+// Return the requests of the Delete calls.
+func (mock *StoreMock) DeleteCalls() []*StoreDeleteRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StoreDeleteRequest(nil), mock.calls.Delete...)
+}
+
+func (mock *StoreMock) Get(ctxt context.Context, key string) (*Item, error) {
+	mock.lock.Lock()
+	mock.calls.Get = append(mock.calls.Get, &StoreGetRequest{Key: key})
+	mock.lock.Unlock()
+
+	if mock.GetFunc == nil {
+		panic("StoreMock.GetFunc isn't set")
+	}
+
+	return mock.GetFunc(ctxt, key)
+}
+
+// Return the requests of the Get calls.
+func (mock *StoreMock) GetCalls() []*StoreGetRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StoreGetRequest(nil), mock.calls.Get...)
+}
+
+func (mock *StoreMock) Ping(arg0 string) {
+	mock.lock.Lock()
+	mock.calls.Ping = append(mock.calls.Ping, &StorePingRequest{Arg0: arg0})
+	mock.lock.Unlock()
+
+	if mock.PingFunc == nil {
+		panic("StoreMock.PingFunc isn't set")
+	}
+
+	mock.PingFunc(arg0)
+}
+
+// Return the requests of the Ping calls.
+func (mock *StoreMock) PingCalls() []*StorePingRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StorePingRequest(nil), mock.calls.Ping...)
+}
+
+func (mock *StoreMock) Put(ctxt context.Context, item *Item, ttl time.Duration) error {
+	mock.lock.Lock()
+	mock.calls.Put = append(mock.calls.Put, &StorePutRequest{Item: item, Ttl: ttl})
+	mock.lock.Unlock()
+
+	if mock.PutFunc == nil {
+		panic("StoreMock.PutFunc isn't set")
+	}
+
+	return mock.PutFunc(ctxt, item, ttl)
+}
+
+// Return the requests of the Put calls.
+func (mock *StoreMock) PutCalls() []*StorePutRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StorePutRequest(nil), mock.calls.Put...)
+}
+
+func (mock *StoreMock) Scan(prefix string, limit int) ([]*Item, string, error) {
+	mock.lock.Lock()
+	mock.calls.Scan = append(mock.calls.Scan, &StoreScanRequest{Prefix: prefix, Limit: limit})
+	mock.lock.Unlock()
+
+	if mock.ScanFunc == nil {
+		panic("StoreMock.ScanFunc isn't set")
+	}
+
+	return mock.ScanFunc(prefix, limit)
+}
+
+// Return the requests of the Scan calls.
+func (mock *StoreMock) ScanCalls() []*StoreScanRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StoreScanRequest(nil), mock.calls.Scan...)
+}
+
+func (mock *StoreMock) Watch(ctxt context.Context, prefix string, events chan<- *Item) error {
+	mock.lock.Lock()
+	mock.calls.Watch = append(mock.calls.Watch, &StoreWatchRequest{Prefix: prefix})
+	mock.lock.Unlock()
+
+	if mock.WatchFunc == nil {
+		panic("StoreMock.WatchFunc isn't set")
+	}
+
+	return mock.WatchFunc(ctxt, prefix, events)
+}
+
+// Return the requests of the Watch calls.
+func (mock *StoreMock) WatchCalls() []*StoreWatchRequest {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+
+	return append([]*StoreWatchRequest(nil), mock.calls.Watch...)
+}
@@ -0,0 +1,256 @@
+package grpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+)
+
+type grpcClientCodec struct {
+	*nethttp.Client
+
+	Uri      *url.URL
+	Name     string
+	Encoding core.Encoding
+}
+
+var _ = (core.ClientCodec)((*grpcClientCodec)(nil))
+
+func NewGrpcClientCodec(cfg *core.ClientCodecConfig) (*grpcClientCodec, error) {
+	var errs core.MultiError
+
+	errs.Merge("", cfg.Validate())
+
+	var secure bool
+
+	if cfg.Uri != nil {
+		switch cfg.Uri.Scheme {
+		case "", "grpc", "http":
+		case "grpcs", "https":
+			secure = true
+		default:
+			errs.Add("Uri", "unsupported scheme `%s`", cfg.Uri.Scheme)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.ErrorOrNil()
+	}
+
+	transport := &http2.Transport{TLSClientConfig: cfg.TLSConfig}
+
+	if !secure {
+		// HTTP/2 without TLS, known as h2c
+		transport.AllowHTTP = true
+		transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	} else if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	encoding := cfg.Encoding
+
+	if encoding == nil {
+		encoding = core.ProtobufEncoding
+	}
+
+	return &grpcClientCodec{&nethttp.Client{Transport: transport}, cfg.Uri, cfg.Name, encoding}, nil
+}
+
+func (c *grpcClientCodec) ClientDispatcher(transport core.Transport) core.Service {
+	return &grpcClientDispatcher{c}
+}
+
+type grpcClientDispatcher struct {
+	*grpcClientCodec
+}
+
+var _ = (core.Service)((*grpcClientDispatcher)(nil))
+
+// Return the URL of the method, /package.Service/Method where the service is the path of the URI,
+// the service of the call or the name of the client.
+func (d *grpcClientDispatcher) urlOf(call *core.Call) string {
+	service := strings.Trim(d.Uri.Path, "/")
+
+	if service == "" {
+		service = call.Service
+	}
+
+	if service == "" {
+		service = d.Name
+	}
+
+	scheme := "http"
+
+	if d.Uri.Scheme == "grpcs" || d.Uri.Scheme == "https" {
+		scheme = "https"
+	}
+
+	u := url.URL{Scheme: scheme, Host: d.Uri.Host, Path: "/" + service + "/" + call.Method}
+
+	return u.String()
+}
+
+func (d *grpcClientDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	if call.Stream != nil {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "gRPC streaming calls are unsupported"))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	if call.Encoding == nil {
+		call.Encoding = d.Encoding
+	}
+
+	var payload []byte
+	var err error
+
+	switch len(call.Args) {
+	case 0:
+		payload = call.Payload
+	case 1:
+		payload, err = call.Encoding.Marshal(call.Args[0])
+	default:
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "gRPC methods take a single message"))
+	}
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to encode arguments, %s", err))
+	}
+
+	var body bytes.Buffer
+
+	writeMessage(&body, payload)
+
+	r, err := nethttp.NewRequest("POST", d.urlOf(call), &body)
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to create request, %s", err))
+	}
+
+	http.HeaderToHttp(core.OutgoingHeader(ctxt), r.Header)
+
+	if deadline, ok := ctxt.Deadline(); ok {
+		r.Header.Set(TimeoutHeader, EncodeTimeout(deadline.Sub(time.Now())))
+	}
+
+	r.Header.Set("Content-Type", contentTypeOf(call.Encoding))
+	r.Header.Set("TE", "trailers")
+
+	if info, ok := core.OutgoingCallInfo(ctxt); ok {
+		info.Codec, info.Peer, info.RequestSize = "grpc", d.Uri.Host, len(payload)
+	}
+
+	return promise.Start(func() (interface{}, error) {
+		return d.roundTrip(r.WithContext(ctxt), call)
+	})
+}
+
+func (d *grpcClientDispatcher) roundTrip(r *nethttp.Request, call *core.Call) (interface{}, error) {
+	resp, err := d.Do(r)
+
+	if err != nil {
+		if ctxtErr := r.Context().Err(); ctxtErr != nil {
+			return nil, core.StatusOf(ctxtErr)
+		}
+
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, core.NewStatus(http.CodeOf(resp.StatusCode), "%s", resp.Status)
+	}
+
+	data, err := readMessage(resp.Body)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// the trailers are received with the end of the body
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "fail to read response, %s", err)
+	}
+
+	if info, ok := core.OutgoingCallInfo(r.Context()); ok {
+		info.Complete(len(data))
+	}
+
+	if status := statusOf(resp); status.Code != core.CodeOK {
+		return nil, status
+	}
+
+	if data == nil {
+		return nil, core.NewStatus(core.CodeInternal, "missing response message")
+	}
+
+	if call.Reply != nil {
+		if err := call.Encoding.Unmarshal(data, call.Reply); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+
+		return call.Reply, nil
+	}
+
+	var result interface{}
+
+	if err := call.Encoding.Unmarshal(data, &result); err != nil {
+		return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+	}
+
+	return result, nil
+}
+
+// Return the status of the response, from its trailers or its headers for the trailers only responses.
+func statusOf(resp *nethttp.Response) *core.Status {
+	h := resp.Trailer
+
+	if h.Get(StatusHeader) == "" {
+		h = resp.Header
+	}
+
+	value := h.Get(StatusHeader)
+
+	if value == "" {
+		return core.NewStatus(core.CodeInternal, "missing status")
+	}
+
+	code, err := strconv.Atoi(value)
+
+	if err != nil {
+		return core.NewStatus(core.CodeUnknown, "invalid status `%s`", value)
+	}
+
+	status := &core.Status{Code: core.Code(code), Message: decodeMessage(h.Get(MessageHeader))}
+
+	if ms, err := strconv.ParseInt(h.Get(PushbackHeader), 10, 64); err == nil && ms >= 0 {
+		status.WithRetryAfter(time.Duration(ms) * time.Millisecond)
+	}
+
+	return status
+}
@@ -0,0 +1,33 @@
+// Package grpc serves and calls the unary methods with the gRPC protocol over HTTP/2,
+// with TLS or in cleartext (h2c), the messages are encoded with protobuf or JSON.
+//
+// The metadata of the calls is the incoming and outgoing header of their context,
+// and their deadline is sent as the grpc-timeout header.
+package grpc
+
+import (
+	"github.com/flier/bucky/core"
+)
+
+var (
+	GrpcCodec = (core.CodecFactory)(&grpcCodecFactory{})
+)
+
+type grpcCodecFactory struct {
+}
+
+var _ = (core.CodecFactory)((*grpcCodecFactory)(nil))
+
+func (f *grpcCodecFactory) ClientCodec(cfg *core.ClientCodecConfig) core.ClientCodec {
+	codec, err := NewGrpcClientCodec(cfg)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return codec
+}
+
+func (f *grpcCodecFactory) ServerCodec(cfg *core.ServerCodecConfig) core.ServerCodec {
+	return &grpcServerCodec{cfg}
+}
@@ -0,0 +1,195 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+)
+
+type stringService struct{}
+
+func (stringService) Uppercase(s *wrappers.StringValue) (*wrappers.StringValue, error) {
+	if s.GetValue() == "" {
+		return nil, errors.New("empty string, 100%")
+	}
+
+	return &wrappers.StringValue{Value: strings.ToUpper(s.GetValue())}, nil
+}
+
+func (stringService) Sleep(d *wrappers.Int64Value) *wrappers.Int64Value {
+	time.Sleep(time.Duration(d.GetValue()))
+
+	return d
+}
+
+func (stringService) Busy(*wrappers.StringValue) (*wrappers.StringValue, error) {
+	return nil, core.NewStatus(core.CodeResourceExhausted, "too busy").WithRetryAfter(1500 * time.Millisecond)
+}
+
+func TestTimeout(t *testing.T) {
+	Convey("encode the grpc-timeout header", t, func() {
+		So(EncodeTimeout(100*time.Millisecond), ShouldEqual, "100000u")
+		So(EncodeTimeout(time.Second), ShouldEqual, "1000000u")
+		So(EncodeTimeout(2*time.Hour), ShouldEqual, "7200000m")
+		So(EncodeTimeout(0), ShouldEqual, "0n")
+
+		for _, value := range []string{"1H", "2M", "30S", "500m", "10u", "7n"} {
+			d, err := DecodeTimeout(value)
+
+			So(err, ShouldBeNil)
+			So(EncodeTimeout(d), ShouldNotBeEmpty)
+		}
+
+		d, _ := DecodeTimeout("500m")
+
+		So(d, ShouldEqual, 500*time.Millisecond)
+
+		_, err := DecodeTimeout("5s")
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("percent encode the grpc-message header", t, func() {
+		So(encodeMessage("café 100%"), ShouldEqual, "caf%C3%A9 100%25")
+		So(decodeMessage("caf%C3%A9 100%25"), ShouldEqual, "café 100%")
+	})
+}
+
+func TestGrpcCodec(t *testing.T) {
+	Convey("serve a native service with gRPC over h2c", t, func() {
+		headers := make(chan core.Header, 1)
+
+		service := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+			if core.MethodOf(req) == "Uppercase" {
+				headers <- core.IncomingHeader(ctxt)
+			}
+
+			return rpc.NativeFactory.Build(stringService{}).Apply(ctxt, req)
+		})
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{Name: "strings.StringService", Addr: addr, CodecFactory: GrpcCodec}).Build(service)
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("grpc://" + addr.String() + "/strings.StringService")
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: GrpcCodec}).Build()
+
+		call := func(ctxt context.Context, c *core.Call) (interface{}, error) {
+			for i := 0; i < 100; i++ {
+				result, err := client.Apply(ctxt, c).Get()
+
+				if core.CodeOf(err) != core.CodeUnavailable {
+					return result, err
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			return nil, errors.New("server isn't started")
+		}
+
+		var reply wrappers.StringValue
+
+		result, err := call(core.AppendOutgoingHeader(context.Background(), "x-request-id", "42"), &core.Call{
+			Method: "Uppercase",
+			Args:   []interface{}{&wrappers.StringValue{Value: "hello"}},
+			Reply:  &reply,
+		})
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, &reply)
+		So(reply.Value, ShouldEqual, "HELLO")
+
+		h := <-headers
+
+		So(h.Get("x-request-id"), ShouldEqual, "42")
+		So(h.Get("content-type"), ShouldBeEmpty)
+
+		Convey("return the status in the trailers", func() {
+			_, err := call(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{&wrappers.StringValue{}}, Reply: &reply})
+
+			So(err, ShouldResemble, &core.Status{Code: core.CodeUnknown, Message: "empty string, 100%"})
+
+			<-headers
+
+			_, err = call(context.Background(), &core.Call{Method: "Busy", Args: []interface{}{&wrappers.StringValue{}}, Reply: &reply})
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeResourceExhausted)
+
+			retryAfter, _ := core.RetryAfterOf(err)
+
+			So(retryAfter, ShouldEqual, 1500*time.Millisecond)
+
+			_, err = call(context.Background(), &core.Call{Method: "Unknown", Args: []interface{}{&wrappers.StringValue{}}})
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+		})
+
+		Convey("send the deadline as grpc-timeout", func() {
+			ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			var reply wrappers.Int64Value
+
+			_, err := call(ctxt, &core.Call{Method: "Sleep", Args: []interface{}{&wrappers.Int64Value{Value: int64(time.Second)}}, Reply: &reply})
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+		})
+
+		Convey("encode the messages as JSON", func() {
+			var reply struct{ Value string }
+
+			_, err := call(context.Background(), &core.Call{
+				Method:   "Uppercase",
+				Args:     []interface{}{map[string]string{"value": "json"}},
+				Encoding: core.JsonEncoding,
+				Reply:    &reply,
+			})
+
+			So(err, ShouldBeNil)
+			So(reply.Value, ShouldEqual, "JSON")
+
+			<-headers
+		})
+	})
+
+	Convey("serve a native service with gRPC over TLS", t, func() {
+		codec := GrpcCodec.ServerCodec(&core.ServerCodecConfig{Name: "strings.StringService", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewUnstartedServer(codec.ServerDispatcher(nil, rpc.NativeFactory.Build(stringService{})).(*grpcServerDispatcher))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		uri, _ := url.Parse(strings.Replace(server.URL, "https", "grpcs", 1))
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: GrpcCodec, TLSConfig: &tls.Config{InsecureSkipVerify: true}}).Build()
+
+		var reply wrappers.StringValue
+
+		_, err := client.Apply(context.Background(), &core.Call{Service: "strings.StringService", Method: "Uppercase", Args: []interface{}{&wrappers.StringValue{Value: "tls"}}, Reply: &reply}).Get()
+
+		So(err, ShouldBeNil)
+		So(reply.Value, ShouldEqual, "TLS")
+	})
+}
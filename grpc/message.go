@@ -0,0 +1,193 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	ContentType = "application/grpc"
+
+	// The maximum size of a message.
+	MaxMessageSize = 16 << 20
+
+	StatusHeader      = "grpc-status"
+	MessageHeader     = "grpc-message"
+	TimeoutHeader     = "grpc-timeout"
+	EncodingHeader    = "grpc-encoding"
+	PushbackHeader    = "grpc-retry-pushback-ms"
+	AcceptEncodingKey = "grpc-accept-encoding"
+)
+
+// The encodings of the content subtypes, such as application/grpc+json.
+var subtypes = map[string]core.Encoding{
+	"":      core.ProtobufEncoding,
+	"proto": core.ProtobufEncoding,
+	"json":  core.JsonEncoding,
+}
+
+// Return the encoding of a gRPC content type.
+func encodingOf(contentType string) (core.Encoding, bool) {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	if !strings.HasPrefix(contentType, ContentType) {
+		return nil, false
+	}
+
+	subtype := strings.TrimPrefix(contentType, ContentType)
+
+	if subtype != "" && subtype[0] != '+' {
+		return nil, false
+	}
+
+	encoding, ok := subtypes[strings.TrimPrefix(subtype, "+")]
+
+	return encoding, ok
+}
+
+// Return the gRPC content type of an encoding.
+func contentTypeOf(encoding core.Encoding) string {
+	switch encoding.ContentType() {
+	case core.JsonEncoding.ContentType():
+		return ContentType + "+json"
+	default:
+		return ContentType + "+proto"
+	}
+}
+
+// Prefix the message with its compressed flag and length.
+func writeMessage(w io.Writer, data []byte) (int, error) {
+	var prefix [5]byte
+
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+
+	if _, err := w.Write(prefix[:]); err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+
+	return n + len(prefix), err
+}
+
+// Read a length prefixed message, compressed messages aren't supported.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		return nil, core.NewStatus(core.CodeInternal, "fail to read message, %s", err)
+	}
+
+	if prefix[0] != 0 {
+		return nil, core.NewStatus(core.CodeUnimplemented, "compressed messages aren't supported")
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+
+	if length > MaxMessageSize {
+		return nil, core.NewStatus(core.CodeResourceExhausted, "message too large, %d bytes", length)
+	}
+
+	data := make([]byte, length)
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, core.NewStatus(core.CodeInternal, "fail to read message, %s", err)
+	}
+
+	return data, nil
+}
+
+var timeoutUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// Encode a timeout as the grpc-timeout header, at most 8 digits with the finest unit.
+func EncodeTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "0n"
+	}
+
+	for _, u := range timeoutUnits {
+		if n := (timeout + u.d - 1) / u.d; n < 1e8 {
+			return strconv.FormatInt(int64(n), 10) + string(u.unit)
+		}
+	}
+
+	return "99999999H"
+}
+
+// Decode the grpc-timeout header.
+func DecodeTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid timeout `%s`", value)
+	}
+
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid timeout `%s`", value)
+	}
+
+	for _, u := range timeoutUnits {
+		if u.unit == value[len(value)-1] {
+			return time.Duration(n) * u.d, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid timeout unit `%s`", value)
+}
+
+// Percent encode the grpc-message header, as the gRPC protocol requires.
+func encodeMessage(msg string) string {
+	var buf bytes.Buffer
+
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+
+	return buf.String()
+}
+
+func decodeMessage(msg string) string {
+	var buf bytes.Buffer
+
+	for i := 0; i < len(msg); i++ {
+		if msg[i] == '%' && i+2 < len(msg) {
+			if c, err := strconv.ParseUint(msg[i+1:i+3], 16, 8); err == nil {
+				buf.WriteByte(byte(c))
+				i += 2
+
+				continue
+			}
+		}
+
+		buf.WriteByte(msg[i])
+	}
+
+	return buf.String()
+}
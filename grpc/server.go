@@ -0,0 +1,241 @@
+package grpc
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/flier/bucky/core"
+)
+
+type grpcServerCodec struct {
+	*core.ServerCodecConfig
+}
+
+var _ = (core.ServerCodec)((*grpcServerCodec)(nil))
+
+func (c *grpcServerCodec) ServerDispatcher(transport core.Transport, service core.Service) core.Server {
+	server := &nethttp.Server{
+		Addr:      c.Addr.String(),
+		TLSConfig: c.TLSConfig,
+	}
+
+	server.SetKeepAlivesEnabled(c.KeepAlives)
+
+	d := &grpcServerDispatcher{
+		Server:   server,
+		Name:     c.Name,
+		CertFile: c.CertFile,
+		KeyFile:  c.KeyFile,
+		Service:  service,
+		conns:    make(map[net.Conn]time.Time),
+	}
+
+	if c.TLSConfig != nil {
+		// HTTP/2 is negotiated with ALPN
+		http2.ConfigureServer(server, &http2.Server{})
+
+		server.Handler = d
+	} else {
+		// HTTP/2 without TLS, known as h2c
+		server.Handler = h2c.NewHandler(d, &http2.Server{})
+	}
+
+	server.ConnState = d.trackConn
+
+	return d
+}
+
+// A grpcServerDispatcher serves the unary gRPC calls over HTTP/2.
+type grpcServerDispatcher struct {
+	*nethttp.Server
+
+	Name              string
+	CertFile, KeyFile string
+	Service           core.Service
+
+	lock  sync.Mutex
+	conns map[net.Conn]time.Time
+}
+
+var _ = (core.Server)((*grpcServerDispatcher)(nil))
+var _ = (core.ConnectionLister)((*grpcServerDispatcher)(nil))
+
+func (d *grpcServerDispatcher) trackConn(conn net.Conn, state nethttp.ConnState) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch state {
+	case nethttp.StateNew:
+		d.conns[conn] = time.Now()
+	case nethttp.StateHijacked, nethttp.StateClosed:
+		delete(d.conns, conn)
+	}
+}
+
+// Return the active connections, oldest first.
+func (d *grpcServerDispatcher) Connections() []*core.Connection {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return core.SortConnections(d.conns)
+}
+
+func (d *grpcServerDispatcher) Serve(ctxt context.Context) error {
+	done := make(chan error, 1)
+
+	go func() {
+		if d.TLSConfig != nil {
+			done <- d.ListenAndServeTLS(d.CertFile, d.KeyFile)
+		} else {
+			done <- d.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctxt.Done():
+		d.Shutdown(context.Background())
+
+		return ctxt.Err()
+	}
+}
+
+// Return the metadata of the call, the HTTP headers without the reserved ones.
+func metadataOf(header nethttp.Header) core.Header {
+	h := make(core.Header, len(header))
+
+	for key, values := range header {
+		key = strings.ToLower(key)
+
+		if key == "content-type" || key == "te" || strings.HasPrefix(key, "grpc-") {
+			continue
+		}
+
+		h[key] = values
+	}
+
+	return h
+}
+
+func (d *grpcServerDispatcher) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		nethttp.Error(w, "method not allowed", nethttp.StatusMethodNotAllowed)
+		return
+	}
+
+	encoding, ok := encodingOf(r.Header.Get("Content-Type"))
+
+	if !ok {
+		nethttp.Error(w, "unsupported content type", nethttp.StatusUnsupportedMediaType)
+		return
+	}
+
+	// the path is /package.Service/Method
+	path := strings.Trim(r.URL.Path, "/")
+	method := path[strings.LastIndexByte(path, '/')+1:]
+
+	w.Header().Set("Content-Type", contentTypeOf(encoding))
+	w.Header().Set(AcceptEncodingKey, "identity")
+
+	info := &core.CallInfo{Codec: "grpc", Peer: r.RemoteAddr, TLS: r.TLS}
+
+	info.Complete(d.dispatch(w, r, method, encoding, info))
+}
+
+// Dispatch the call to the service, and return the size of the written response.
+func (d *grpcServerDispatcher) dispatch(w nethttp.ResponseWriter, r *nethttp.Request, method string, encoding core.Encoding, info *core.CallInfo) int {
+	payload, err := readMessage(r.Body)
+
+	if err == io.EOF {
+		err = core.NewStatus(core.CodeInternal, "missing request message")
+	}
+
+	if err != nil {
+		return d.writeStatus(w, err)
+	}
+
+	if _, err := ioutil.ReadAll(r.Body); err != nil {
+		return d.writeStatus(w, core.NewStatus(core.CodeInternal, "fail to read request, %s", err))
+	}
+
+	info.RequestSize = len(payload)
+
+	ctxt := r.Context()
+
+	if value := r.Header.Get(TimeoutHeader); value != "" {
+		timeout, err := DecodeTimeout(value)
+
+		if err != nil {
+			return d.writeStatus(w, core.NewStatus(core.CodeInvalidArgument, "%s", err))
+		}
+
+		var cancel context.CancelFunc
+
+		ctxt, cancel = context.WithTimeout(ctxt, timeout)
+		defer cancel()
+	}
+
+	ctxt = core.WithIncomingHeader(ctxt, metadataOf(r.Header))
+	ctxt = core.WithIncomingCallInfo(ctxt, info)
+
+	call := &core.Call{
+		Service:  d.Name,
+		Method:   method,
+		Payload:  payload,
+		Encoding: encoding,
+	}
+
+	result, err := d.Service.Apply(ctxt, call).Get()
+
+	if err != nil {
+		return d.writeStatus(w, err)
+	}
+
+	data, err := encoding.Marshal(result)
+
+	if err != nil {
+		return d.writeStatus(w, core.NewStatus(core.CodeInternal, "fail to encode response, %s", err))
+	}
+
+	n, _ := writeMessage(w, data)
+
+	d.writeTrailer(w, core.StatusOf(nil))
+
+	return n
+}
+
+func (d *grpcServerDispatcher) writeStatus(w nethttp.ResponseWriter, err error) int {
+	w.WriteHeader(nethttp.StatusOK)
+
+	d.writeTrailer(w, core.StatusOf(err))
+
+	return 0
+}
+
+// Write the status as the trailers of the response.
+func (d *grpcServerDispatcher) writeTrailer(w nethttp.ResponseWriter, status *core.Status) {
+	h := w.Header()
+
+	h.Set(nethttp.TrailerPrefix+StatusHeader, strconv.Itoa(int(status.Code)))
+
+	if status.Message != "" {
+		h.Set(nethttp.TrailerPrefix+MessageHeader, encodeMessage(status.Message))
+	}
+
+	if retryAfter, ok := core.RetryAfterOf(status); ok {
+		h.Set(nethttp.TrailerPrefix+PushbackHeader, strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds()*1000)), 10))
+	}
+}
@@ -0,0 +1,269 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	LivenessMethod  = "healthz"
+	ReadinessMethod = "readyz"
+)
+
+type ServingStatus int
+
+const (
+	Unknown ServingStatus = iota
+	Serving
+	NotServing
+)
+
+var statusNames = []string{"UNKNOWN", "SERVING", "NOT_SERVING"}
+
+func (s ServingStatus) String() string {
+	if s >= 0 && int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+
+	return fmt.Sprintf("ServingStatus(%d)", int(s))
+}
+
+func (s ServingStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ServingStatus) UnmarshalText(text []byte) error {
+	for i, name := range statusNames {
+		if name == string(text) {
+			*s = ServingStatus(i)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown serving status `%s`", text)
+}
+
+// The Result of a health check.
+type Result struct {
+	Status  ServingStatus `json:"status" yaml:"status"`
+	Details string        `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// A Check reports the health of a component, such as a database or a dependency.
+type Check interface {
+	Check(ctxt context.Context) *Result
+}
+
+type CheckFunc func(ctxt context.Context) *Result
+
+func (f CheckFunc) Check(ctxt context.Context) *Result { return f(ctxt) }
+
+// Return a check which is serving as long as the function, such as a database ping, doesn't fail.
+func ErrorCheck(f func(ctxt context.Context) error) Check {
+	return CheckFunc(func(ctxt context.Context) *Result {
+		if err := f(ctxt); err != nil {
+			return &Result{NotServing, err.Error()}
+		}
+
+		return &Result{Status: Serving}
+	})
+}
+
+// A Report is the overall status of the checks with the result of each component.
+type Report struct {
+	Status     ServingStatus      `json:"status" yaml:"status"`
+	Components map[string]*Result `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+// Health holds the liveness and readiness checks of a server.
+//
+// A server is live as long as it doesn't need to be restarted,
+// and ready when it can serve calls, it isn't ready anymore once it starts shutting down.
+type Health struct {
+	// How long a check may run before its component is reported as UNKNOWN.
+	Timeout time.Duration
+
+	lock      sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+	shutdown  int32
+}
+
+func NewHealth() *Health {
+	return &Health{
+		Timeout:   5 * time.Second,
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+// Register a check deciding whether the server must be restarted.
+func (h *Health) RegisterLiveness(name string, check Check) {
+	h.lock.Lock()
+	h.liveness[name] = check
+	h.lock.Unlock()
+}
+
+// Register a check deciding whether the server can serve calls.
+func (h *Health) RegisterReadiness(name string, check Check) {
+	h.lock.Lock()
+	h.readiness[name] = check
+	h.lock.Unlock()
+}
+
+// Mark the server as not ready, for example when it starts shutting down.
+func (h *Health) Shutdown() {
+	atomic.StoreInt32(&h.shutdown, 1)
+}
+
+func (h *Health) IsShuttingDown() bool {
+	return atomic.LoadInt32(&h.shutdown) != 0
+}
+
+// Run the liveness checks.
+func (h *Health) Live(ctxt context.Context) *Report {
+	return h.run(ctxt, h.liveness)
+}
+
+// Run the readiness checks, the server isn't ready while it's shutting down.
+func (h *Health) Ready(ctxt context.Context) *Report {
+	report := h.run(ctxt, h.readiness)
+
+	if h.IsShuttingDown() {
+		report.Status = NotServing
+
+		if report.Components == nil {
+			report.Components = make(map[string]*Result)
+		}
+
+		report.Components["server"] = &Result{NotServing, "shutting down"}
+	}
+
+	return report
+}
+
+func (h *Health) run(ctxt context.Context, checks map[string]Check) *Report {
+	h.lock.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	h.lock.RUnlock()
+
+	sort.Strings(names)
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctxt, cancel = context.WithTimeout(ctxt, h.Timeout)
+		defer cancel()
+	}
+
+	results := make([]chan *Result, len(names))
+
+	for i, name := range names {
+		h.lock.RLock()
+		check := checks[name]
+		h.lock.RUnlock()
+
+		results[i] = make(chan *Result, 1)
+
+		go func(c chan *Result) {
+			c <- check.Check(ctxt)
+		}(results[i])
+	}
+
+	report := &Report{Status: Serving}
+
+	if len(names) > 0 {
+		report.Components = make(map[string]*Result, len(names))
+	}
+
+	for i, name := range names {
+		var result *Result
+
+		select {
+		case result = <-results[i]:
+		case <-ctxt.Done():
+			result = &Result{Unknown, "check timed out"}
+		}
+
+		if result == nil {
+			result = &Result{Status: Unknown}
+		}
+
+		report.Components[name] = result
+
+		// an unknown status, such as a check which timed out, isn't serving either
+		if result.Status != Serving {
+			report.Status = NotServing
+		}
+	}
+
+	return report
+}
+
+// Return a server filter answering the `healthz` and `readyz` calls,
+// served as the /healthz and /readyz paths by the HTTP codec and as methods by the stream codecs.
+//
+// The report is the result of a serving status, or the details of an UNAVAILABLE status otherwise.
+func (h *Health) Filter() core.Filter {
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		var report *Report
+
+		switch strings.ToLower(core.MethodOf(req)) {
+		case LivenessMethod:
+			report = h.Live(ctxt)
+		case ReadinessMethod:
+			report = h.Ready(ctxt)
+		default:
+			return service.Apply(ctxt, req)
+		}
+
+		if report.Status == Serving {
+			return core.Resolved(report)
+		}
+
+		return core.Rejected(core.NewStatus(core.CodeUnavailable, "%s", report.Status).WithDetail("report", report))
+	})
+}
+
+// Install the health checks on the server, which becomes not ready once it starts shutting down.
+func (h *Health) Install(b *core.ServerBuilder) {
+	b.Filters = append([]core.Filter{h.Filter()}, b.Filters...)
+	b.ShutdownHooks = append(b.ShutdownHooks, h.Shutdown)
+}
+
+// Return the report of a failed health call, decoded from the details of its status.
+func ReportOf(err error) (*Report, bool) {
+	status, ok := err.(*core.Status)
+
+	if !ok || status.Details["report"] == nil {
+		return nil, false
+	}
+
+	data, err := json.Marshal(status.Details["report"])
+
+	if err != nil {
+		return nil, false
+	}
+
+	var report Report
+
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, false
+	}
+
+	return &report, true
+}
@@ -0,0 +1,158 @@
+package health
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/transport"
+)
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return s }
+
+func TestHealth(t *testing.T) {
+	Convey("create Health", t, func() {
+		h := NewHealth()
+
+		So(h.Live(context.Background()), ShouldResemble, &Report{Status: Serving})
+		So(h.Ready(context.Background()), ShouldResemble, &Report{Status: Serving})
+
+		Convey("register checks", func() {
+			h.RegisterLiveness("goroutines", CheckFunc(func(ctxt context.Context) *Result { return &Result{Status: Serving} }))
+			h.RegisterReadiness("database", ErrorCheck(func(ctxt context.Context) error { return errors.New("connection refused") }))
+			h.RegisterReadiness("cache", CheckFunc(func(ctxt context.Context) *Result { return nil }))
+
+			So(h.Live(context.Background()).Status, ShouldEqual, Serving)
+			So(h.Ready(context.Background()), ShouldResemble, &Report{
+				Status: NotServing,
+				Components: map[string]*Result{
+					"cache":    {Status: Unknown},
+					"database": {NotServing, "connection refused"},
+				},
+			})
+		})
+
+		Convey("time out a slow check", func() {
+			h.Timeout = 10 * time.Millisecond
+
+			h.RegisterReadiness("slow", CheckFunc(func(ctxt context.Context) *Result {
+				time.Sleep(time.Second)
+
+				return &Result{Status: Serving}
+			}))
+
+			report := h.Ready(context.Background())
+
+			So(report.Status, ShouldEqual, NotServing)
+			So(report.Components["slow"], ShouldResemble, &Result{Unknown, "check timed out"})
+
+			_, err := core.WithFilters(nil, h.Filter()).Apply(context.Background(), &core.Call{Method: ReadinessMethod}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+		})
+
+		Convey("fail without a check result", func() {
+			h.RegisterReadiness("cache", CheckFunc(func(ctxt context.Context) *Result { return nil }))
+
+			So(h.Ready(context.Background()).Status, ShouldEqual, NotServing)
+		})
+
+		Convey("shut down", func() {
+			h.Shutdown()
+
+			So(h.Live(context.Background()).Status, ShouldEqual, Serving)
+			So(h.Ready(context.Background()).Status, ShouldEqual, NotServing)
+		})
+	})
+}
+
+func TestHealthOverTcp(t *testing.T) {
+	Convey("serve health checks over TCP", t, func() {
+		h := NewHealth()
+
+		ctxt, cancel := context.WithCancel(context.Background())
+
+		addr, done, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			b := &core.ServerBuilder{
+				Name:          "echo",
+				Addr:          addr,
+				CodecFactory:  transport.TcpCodec,
+				ShutdownDelay: time.Second,
+			}
+
+			h.Install(b)
+
+			return b.Build(rpc.NativeFactory.Build(echoService{}))
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: transport.TcpCodec}).Build()
+
+		call := func(method string) (*Report, error) {
+			var report Report
+
+			for i := 0; i < 100; i++ {
+				_, err := client.Apply(context.Background(), &core.Call{Method: method, Reply: &report}).Get()
+
+				if core.CodeOf(err) == core.CodeUnavailable {
+					if r, ok := ReportOf(err); ok {
+						return r, err
+					}
+
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+
+				return &report, err
+			}
+
+			return nil, errors.New("server isn't started")
+		}
+
+		report, err := call("healthz")
+
+		So(err, ShouldBeNil)
+		So(report.Status, ShouldEqual, Serving)
+
+		var reply string
+
+		_, err = client.Apply(context.Background(), &core.Call{Method: "Echo", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+		So(err, ShouldBeNil)
+		So(reply, ShouldEqual, "hello")
+
+		Convey("become not ready during graceful shutdown", func() {
+			cancel()
+
+			time.Sleep(50 * time.Millisecond)
+
+			report, err := call("readyz")
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnavailable)
+			So(report.Status, ShouldEqual, NotServing)
+			So(report.Components["server"], ShouldResemble, &Result{NotServing, "shutting down"})
+
+			report, err = call("healthz")
+
+			So(err, ShouldBeNil)
+			So(report.Status, ShouldEqual, Serving)
+
+			So(<-done, ShouldEqual, context.Canceled)
+		})
+
+		Reset(func() { cancel() })
+	})
+}
@@ -1,22 +1,56 @@
 package http
 
 import (
+	"bytes"
+	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
 
 	"github.com/flier/bucky/core"
 )
 
 type httpClientCodec struct {
 	*http.Client
+
+	Uri      *url.URL
+	Encoding core.Encoding
 }
 
 var _ = (core.ClientCodec)((*httpClientCodec)(nil))
 
 func NewHttpClientCodec(cfg *core.ClientCodecConfig) *httpClientCodec {
+	codec, err := NewHttpClientCodecE(cfg)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return codec
+}
+
+func NewHttpClientCodecE(cfg *core.ClientCodecConfig) (*httpClientCodec, error) {
+	var errs core.MultiError
+
+	errs.Merge("", cfg.Validate())
+
+	if cfg.Uri != nil && cfg.Uri.Scheme != "" && cfg.Uri.Scheme != "http" && cfg.Uri.Scheme != "https" {
+		errs.Add("Uri", "unsupported scheme `%s`", cfg.Uri.Scheme)
+	}
+
 	jar, err := cookiejar.New(nil)
 
-	core.Assert(err, "fail to create cookiejar")
+	if err != nil {
+		errs.Add("", "fail to create cookiejar, %s", err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.ErrorOrNil()
+	}
 
 	client := &http.Client{
 		Transport: &http.Transport{
@@ -26,9 +60,142 @@ func NewHttpClientCodec(cfg *core.ClientCodecConfig) *httpClientCodec {
 		Jar: jar,
 	}
 
-	return &httpClientCodec{client}
+	encoding := cfg.Encoding
+
+	if encoding == nil {
+		encoding = core.JsonEncoding
+	}
+
+	return &httpClientCodec{client, cfg.Uri, encoding}, nil
 }
 
 func (c *httpClientCodec) ClientDispatcher(transport core.Transport) core.Service {
-	return nil
+	return &httpClientDispatcher{c}
+}
+
+type httpClientDispatcher struct {
+	*httpClientCodec
+}
+
+var _ = (core.Service)((*httpClientDispatcher)(nil))
+
+func (d *httpClientDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	if call.Stream != nil {
+		// the streaming calls are encoded as JSON
+		call.Encoding = core.JsonEncoding
+	} else if call.Encoding == nil {
+		call.Encoding = d.Encoding
+	}
+
+	payload, err := call.EncodeArgs()
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to encode arguments, %s", err))
+	}
+
+	if call.Stream != nil {
+		h := core.OutgoingHeader(ctxt).Clone()
+
+		core.InjectDeadline(ctxt, h)
+
+		if info, ok := core.OutgoingCallInfo(ctxt); ok {
+			info.Codec, info.Peer, info.RequestSize = d.Uri.Scheme, d.Uri.Host, len(payload)
+		}
+
+		return promise.Start(func() (interface{}, error) {
+			return d.stream(ctxt, call, payload, h)
+		})
+	}
+
+	r, err := http.NewRequest("POST", d.urlOf(call.Method), bytes.NewReader(payload))
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to create request, %s", err))
+	}
+
+	h := core.OutgoingHeader(ctxt).Clone()
+
+	core.InjectDeadline(ctxt, h)
+
+	HeaderToHttp(h, r.Header)
+
+	r.Header.Set("Content-Type", call.Encoding.ContentType())
+
+	if info, ok := core.OutgoingCallInfo(ctxt); ok {
+		info.Codec, info.Peer, info.RequestSize = d.Uri.Scheme, d.Uri.Host, len(payload)
+	}
+
+	return promise.Start(func() (interface{}, error) {
+		return d.roundTrip(r.WithContext(ctxt), call)
+	})
+}
+
+func (d *httpClientDispatcher) urlOf(method string) string {
+	u := *d.Uri
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.ToLower(method)
+
+	return u.String()
+}
+
+func (d *httpClientDispatcher) roundTrip(r *http.Request, call *core.Call) (interface{}, error) {
+	resp, err := d.Do(r)
+
+	if err != nil {
+		if ctxtErr := r.Context().Err(); ctxtErr != nil {
+			return nil, core.StatusOf(ctxtErr)
+		}
+
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "fail to read response, %s", err)
+	}
+
+	if info, ok := core.OutgoingCallInfo(r.Context()); ok {
+		info.Complete(len(data))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var status core.Status
+
+		if err := call.Encoding.Unmarshal(data, &status); err != nil || status.Code == core.CodeOK {
+			return nil, core.NewStatus(CodeOf(resp.StatusCode), "%s", resp.Status)
+		}
+
+		return nil, &status
+	}
+
+	if call.Reply != nil {
+		if err := call.Encoding.Unmarshal(data, call.Reply); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+
+		return call.Reply, nil
+	}
+
+	var result interface{}
+
+	if len(data) > 0 {
+		if err := call.Encoding.Unmarshal(data, &result); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+	}
+
+	return result, nil
 }
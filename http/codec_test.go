@@ -0,0 +1,396 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+type stringService struct {
+	deadline chan time.Time
+}
+
+func (s *stringService) Uppercase(str string) (string, error) {
+	if str == "" {
+		return "", errors.New("empty string")
+	}
+
+	return strings.ToUpper(str), nil
+}
+
+func (s *stringService) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func TestHttpCodec(t *testing.T) {
+	Convey("serve a native service over HTTP", t, func() {
+		svc := &stringService{deadline: make(chan time.Time, 1)}
+
+		service := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+			if deadline, ok := ctxt.Deadline(); ok {
+				svc.deadline <- deadline
+			}
+
+			return rpc.NativeFactory.Build(svc).Apply(ctxt, req)
+		})
+
+		codec := NewHttpServerCodec(&core.ServerCodecConfig{Name: "stringsvc", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, service).(*httpServerDispatcher))
+		defer server.Close()
+
+		uri, _ := url.Parse(server.URL)
+
+		client := (&core.ClientBuilder{
+			Uri:          uri,
+			CodecFactory: HttpCodec,
+			Filters:      []core.Filter{&core.TimeoutFilter{Timeout: time.Minute, Methods: map[string]time.Duration{"Sleep": 50 * time.Millisecond}}},
+		}).Build()
+
+		Convey("call a method", func() {
+			var reply string
+
+			result, err := client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, &reply)
+			So(reply, ShouldEqual, "HELLO")
+
+			deadline := <-svc.deadline
+
+			So(deadline.Sub(time.Now()), ShouldBeBetween, 50*time.Second, time.Minute)
+		})
+
+		Convey("call a method which returns an error", func() {
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{""}}).Get()
+
+			So(err, ShouldResemble, &core.Status{Code: core.CodeUnknown, Message: "empty string"})
+		})
+
+		Convey("call an unknown method", func() {
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Lowercase"}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+		})
+
+		Convey("call a method beyond its deadline", func() {
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Sleep", Args: []interface{}{time.Second}}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+		})
+
+		Convey("tell when to retry a rejected call", func() {
+			rejecting := core.ServiceFunc(func(ctxt context.Context, req core.Request) *promise.Future {
+				return core.Rejected(core.NewStatus(core.CodeResourceExhausted, "rate limit exceeded").WithRetryAfter(1500 * time.Millisecond))
+			})
+
+			server := httptest.NewServer(codec.ServerDispatcher(nil, rejecting).(*httpServerDispatcher))
+			defer server.Close()
+
+			resp, err := nethttp.Post(server.URL+"/get", "application/json", nil)
+
+			So(err, ShouldBeNil)
+
+			resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, nethttp.StatusTooManyRequests)
+			So(resp.Header.Get("Retry-After"), ShouldEqual, "2")
+		})
+	})
+}
+
+type wordService struct {
+	done chan bool
+}
+
+func (s *wordService) Split(str string, out chan<- string) {
+	for _, word := range strings.Fields(str) {
+		out <- word
+	}
+}
+
+func (s *wordService) Join(sep string, in <-chan string) string {
+	var words []string
+
+	for word := range in {
+		words = append(words, word)
+	}
+
+	return strings.Join(words, sep)
+}
+
+func (s *wordService) Upper(in <-chan string, out chan<- string) {
+	defer func() { s.done <- true }()
+
+	for word := range in {
+		out <- strings.ToUpper(word)
+	}
+}
+
+func TestHttpStreaming(t *testing.T) {
+	Convey("serve the streaming methods over WebSocket", t, func() {
+		svc := &wordService{done: make(chan bool, 1)}
+
+		codec := NewHttpServerCodec(&core.ServerCodecConfig{Name: "wordsvc", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, rpc.NativeFactory.Build(svc)).(*httpServerDispatcher))
+		defer server.Close()
+
+		uri, _ := url.Parse(server.URL)
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: HttpCodec}).Build()
+
+		Convey("stream the messages of the server", func() {
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Split", Args: []interface{}{"hello streaming world"}})
+
+			var words []string
+
+			for {
+				var word string
+
+				if err := stream.Recv(&word); err == io.EOF {
+					break
+				} else {
+					So(err, ShouldBeNil)
+				}
+
+				words = append(words, word)
+			}
+
+			So(words, ShouldResemble, []string{"hello", "streaming", "world"})
+
+			_, err := future.Get()
+
+			So(err, ShouldBeNil)
+		})
+
+		Convey("stream the messages of the client", func() {
+			var reply string
+
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Join", Args: []interface{}{"-"}, Reply: &reply})
+
+			for _, word := range []string{"a", "b", "c"} {
+				So(stream.Send(word), ShouldBeNil)
+			}
+
+			stream.CloseSend()
+
+			_, err := future.Get()
+
+			So(err, ShouldBeNil)
+			So(reply, ShouldEqual, "a-b-c")
+		})
+
+		Convey("stream the messages in both directions, until the client cancels", func() {
+			ctxt, cancel := context.WithCancel(context.Background())
+
+			stream, future := core.OpenStream(ctxt, client, &core.Call{Method: "Upper"})
+
+			So(stream.Send("hello"), ShouldBeNil)
+
+			var word string
+
+			So(stream.Recv(&word), ShouldBeNil)
+			So(word, ShouldEqual, "HELLO")
+
+			cancel()
+
+			_, err := future.Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeCanceled)
+
+			select {
+			case <-svc.done:
+			case <-time.After(time.Second):
+				So(errors.New("the method wasn't canceled"), ShouldBeNil)
+			}
+		})
+
+		Convey("reject the WebSockets of the other origins", func() {
+			dial := func(origin string) error {
+				ws, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/split", "", origin)
+
+				if err == nil {
+					ws.Close()
+				}
+
+				return err
+			}
+
+			So(dial(server.URL), ShouldBeNil)
+			So(dial("http://evil.example.com"), ShouldNotBeNil)
+
+			codec.AllowedOrigins = []string{"http://evil.example.com"}
+
+			allowed := httptest.NewServer(codec.ServerDispatcher(nil, rpc.NativeFactory.Build(svc)).(*httpServerDispatcher))
+			defer allowed.Close()
+
+			ws, err := websocket.Dial(strings.Replace(allowed.URL, "http", "ws", 1)+"/split", "", "http://evil.example.com")
+
+			So(err, ShouldBeNil)
+
+			ws.Close()
+		})
+
+		Convey("stream the messages of the server as events", func() {
+			r, _ := nethttp.NewRequest("POST", server.URL+"/split", strings.NewReader(`"hello world"`))
+			r.Header.Set("Accept", "text/event-stream")
+
+			resp, err := nethttp.DefaultClient.Do(r)
+
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+			So(string(body), ShouldEqual, "event: message\ndata: \"hello\"\n\nevent: message\ndata: \"world\"\n\nevent: result\ndata: null\n\n")
+		})
+	})
+}
+
+type userService struct{}
+
+type User struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (userService) Get(ctxt context.Context, id int) (*User, error) {
+	return &User{id, core.IncomingHeader(ctxt).Get("x-user")}, nil
+}
+
+func (userService) Rename(id int, name string) *User { return &User{id, name} }
+
+func (userService) Find(ctxt context.Context) bool {
+	<-ctxt.Done()
+
+	return false
+}
+
+func (userService) MethodOptions() map[string]*rpc.MethodOptions {
+	return map[string]*rpc.MethodOptions{
+		"Get":    {HttpMethod: "GET", HttpPath: "/users/{id}"},
+		"Rename": {HttpMethod: "PUT", HttpPath: "/users/{id}/name"},
+		"Find":   {Timeout: 50 * time.Millisecond},
+	}
+}
+
+func (userService) ParamNames() map[string][]string {
+	return map[string][]string{"Rename": {"id", "name"}}
+}
+
+func TestHttpRoutes(t *testing.T) {
+	Convey("route the requests by the options of the methods", t, func() {
+		codec := NewHttpServerCodec(&core.ServerCodecConfig{Name: "users", Addr: &net.TCPAddr{}})
+
+		service := core.WithFilters(rpc.NativeFactory.Build(userService{}), &core.TimeoutFilter{Timeout: time.Minute})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, service).(*httpServerDispatcher))
+		defer server.Close()
+
+		do := func(method, path, body string) (int, string) {
+			r, _ := nethttp.NewRequest(method, server.URL+path, strings.NewReader(body))
+			r.Header.Set("X-User", "alice")
+
+			resp, err := nethttp.DefaultClient.Do(r)
+
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			data, _ := ioutil.ReadAll(resp.Body)
+
+			return resp.StatusCode, string(data)
+		}
+
+		Convey("pass the path parameters and the context", func() {
+			code, body := do("GET", "/users/42", "")
+
+			So(code, ShouldEqual, nethttp.StatusOK)
+			So(body, ShouldEqual, `{"id":42,"name":"alice"}`)
+		})
+
+		Convey("name the arguments with the path parameters and the body", func() {
+			code, body := do("PUT", "/users/7/name", `{"name": "bob"}`)
+
+			So(code, ShouldEqual, nethttp.StatusOK)
+			So(body, ShouldEqual, `{"id":7,"name":"bob"}`)
+
+			code, body = do("PUT", "/users/7/name?name=carol", "")
+
+			So(body, ShouldEqual, `{"id":7,"name":"carol"}`)
+		})
+
+		Convey("reject the other verbs", func() {
+			code, _ := do("DELETE", "/users/42", "")
+
+			So(code, ShouldEqual, nethttp.StatusMethodNotAllowed)
+		})
+
+		Convey("still serve the methods by name", func() {
+			code, body := do("POST", "/rename", `[1, "dave"]`)
+
+			So(code, ShouldEqual, nethttp.StatusOK)
+			So(body, ShouldEqual, `{"id":1,"name":"dave"}`)
+		})
+
+		Convey("apply the timeout of the method", func() {
+			code, _ := do("POST", "/find", "")
+
+			So(code, ShouldEqual, HttpStatusOf(core.CodeDeadlineExceeded))
+		})
+	})
+}
+
+func TestHttpMux(t *testing.T) {
+	Convey("serve many services by the prefix of their paths", t, func() {
+		mux := rpc.NewMux()
+		mux.Handle("strings", "v1", rpc.NativeFactory.Build(&stringService{}))
+		mux.Handle("users", "v1", rpc.NativeFactory.Build(userService{}))
+
+		codec := NewHttpServerCodec(&core.ServerCodecConfig{Name: "mux", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, mux).(*httpServerDispatcher))
+		defer server.Close()
+
+		uri, _ := url.Parse(server.URL + "/strings.v1")
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: HttpCodec}).Build()
+
+		var reply string
+
+		_, err := client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{"mux"}, Reply: &reply}).Get()
+
+		So(err, ShouldBeNil)
+		So(reply, ShouldEqual, "MUX")
+
+		Convey("route the requests by the options of the methods, under the prefix", func() {
+			resp, err := nethttp.Get(server.URL + "/users.v1/users/42")
+
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			So(string(body), ShouldEqual, `{"id":42,"name":""}`)
+		})
+	})
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/flier/bucky/core"
+)
+
+func HeaderFromHttp(h http.Header) core.Header {
+	header := make(core.Header, len(h))
+
+	for key, values := range h {
+		header[strings.ToLower(key)] = values
+	}
+
+	return header
+}
+
+func HeaderToHttp(h core.Header, header http.Header) {
+	for key, values := range h {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+}
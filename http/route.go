@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+// A route maps an HTTP verb and a path, such as `GET /users/{id}`, to a method with HTTP options.
+type route struct {
+	verb      string
+	segments  []string
+	namespace string // the name of the service when it's served by a catalog
+	method    *rpc.Method
+}
+
+// Return the routes of the methods with HTTP options, from the metadata of the service,
+// the paths of the services served by a catalog are prefixed by their name.
+func routesOf(service core.Service) []*route {
+	if catalog, ok := rpc.CatalogOf(service); ok {
+		var routes []*route
+
+		for _, md := range catalog.Services() {
+			routes = append(routes, methodRoutes(md.Name(), md)...)
+		}
+
+		return routes
+	}
+
+	if md := rpc.Describe(service); md != nil {
+		return methodRoutes("", md)
+	}
+
+	return nil
+}
+
+func methodRoutes(namespace string, md rpc.Metadata) []*route {
+	var routes []*route
+
+	for _, m := range md.Methods() {
+		verb, path, ok := RouteOf(m)
+
+		if !ok {
+			continue
+		}
+
+		if namespace != "" {
+			path = "/" + namespace + "/" + strings.TrimPrefix(path, "/")
+		}
+
+		routes = append(routes, &route{verb, strings.Split(strings.Trim(path, "/"), "/"), namespace, m})
+	}
+
+	return routes
+}
+
+// Return the HTTP route of a method with HTTP options, such as `GET /users/{id}`,
+// the verb defaults to POST and the path to the method name.
+func RouteOf(m *rpc.Method) (verb, path string, ok bool) {
+	if m.Options == nil || (m.Options.HttpMethod == "" && m.Options.HttpPath == "") {
+		return "", "", false
+	}
+
+	verb, path = strings.ToUpper(m.Options.HttpMethod), m.Options.HttpPath
+
+	if verb == "" {
+		verb = "POST"
+	}
+
+	if path == "" {
+		path = "/" + strings.ToLower(m.Name)
+	}
+
+	return verb, path, true
+}
+
+// Return the parameters captured by the path, or false if it doesn't match the route.
+func (r *route) match(path string) (map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// Return the type of a named parameter, or nil if it's unknown.
+func (r *route) paramType(name string) reflect.Type {
+	for i, param := range r.method.Params {
+		if strings.EqualFold(param, name) {
+			return r.method.In[i]
+		}
+	}
+
+	if len(r.method.In) == 1 {
+		return r.method.In[0]
+	}
+
+	return nil
+}
+
+// Return the value of a parameter, as a string for the string parameters, or as JSON if it's valid.
+func paramValue(s string, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t != nil && t.Kind() == reflect.String {
+		return s
+	}
+
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+
+	return v
+}
+
+// Return the call of a routed request, the arguments are named by the path and query parameters,
+// and by the fields of the body when it's an object.
+func (r *route) call(req *http.Request, params map[string]string, body []byte, encoding core.Encoding) (*core.Call, error) {
+	values := make(map[string]interface{})
+
+	if len(body) > 0 {
+		if err := encoding.Unmarshal(body, &values); err != nil {
+			return nil, core.NewStatus(core.CodeInvalidArgument, "the body of `%s` isn't an object, %s", r.method.Name, err)
+		}
+	}
+
+	for key, vs := range req.URL.Query() {
+		values[key] = paramValue(vs[0], r.paramType(key))
+	}
+
+	for key, value := range params {
+		values[key] = paramValue(value, r.paramType(key))
+	}
+
+	call := &core.Call{Method: r.method.Name, Encoding: core.JsonEncoding, Named: true}
+
+	if r.namespace != "" {
+		call.Method = r.namespace + "/" + r.method.Name
+	}
+
+	var v interface{} = values
+
+	// the single value of a single unnamed parameter isn't an object
+	if len(r.method.In) == 1 && len(r.method.Params) == 0 && len(body) == 0 && len(values) == 1 && !isObject(r.method.In[0]) {
+		for _, value := range values {
+			v = value
+		}
+
+		call.Named = false
+	}
+
+	var err error
+
+	if call.Payload, err = json.Marshal(v); err != nil {
+		return nil, core.NewStatus(core.CodeInvalidArgument, "fail to encode arguments, %s", err)
+	}
+
+	return call, nil
+}
+
+func isObject(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+}
@@ -1,7 +1,14 @@
 package http
 
 import (
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -11,7 +18,13 @@ import (
 type httpServerCodec struct {
 	*http.Server
 
+	Name              string
+	Encoding          core.Encoding
 	CertFile, KeyFile string
+
+	// The origins allowed to open a WebSocket, such as `https://example.com`, or `*` for any origin,
+	// besides the ones of the server host.
+	AllowedOrigins []string
 }
 
 var _ = (core.ServerCodec)((*httpServerCodec)(nil))
@@ -19,38 +32,232 @@ var _ = (core.ServerCodec)((*httpServerCodec)(nil))
 func NewHttpServerCodec(cfg *core.ServerCodecConfig) *httpServerCodec {
 	server := &http.Server{
 		Addr:      cfg.Addr.String(),
-		Handler:   http.NewServeMux(),
 		TLSConfig: cfg.TLSConfig,
 	}
 
 	server.SetKeepAlivesEnabled(cfg.KeepAlives)
 
-	return &httpServerCodec{Server: server, CertFile: cfg.CertFile, KeyFile: cfg.KeyFile}
+	encoding := cfg.Encoding
+
+	if encoding == nil {
+		encoding = core.JsonEncoding
+	}
+
+	return &httpServerCodec{
+		Server:   server,
+		Name:     cfg.Name,
+		Encoding: encoding,
+		CertFile: cfg.CertFile,
+		KeyFile:  cfg.KeyFile,
+	}
 }
 
 func (c *httpServerCodec) ServerDispatcher(transport core.Transport, service core.Service) core.Server {
-	return &httpServerDispatcher{
-		Server:    c.Server,
-		CertFile:  c.CertFile,
-		KeyFile:   c.KeyFile,
-		Transport: transport,
-		Service:   service,
+	d := &httpServerDispatcher{
+		Server:         c.Server,
+		Name:           c.Name,
+		Encoding:       c.Encoding,
+		CertFile:       c.CertFile,
+		KeyFile:        c.KeyFile,
+		AllowedOrigins: c.AllowedOrigins,
+		Transport:      transport,
+		Service:        service,
+		routes:         routesOf(service),
+		conns:          make(map[net.Conn]time.Time),
 	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/", d)
+
+	d.Handler = mux
+	d.ConnState = d.trackConn
+
+	return d
 }
 
 type httpServerDispatcher struct {
 	*http.Server
+	Name              string
+	Encoding          core.Encoding
 	CertFile, KeyFile string
 	Transport         core.Transport
 	Service           core.Service
+	AllowedOrigins    []string
+
+	routes []*route
+
+	lock  sync.Mutex
+	conns map[net.Conn]time.Time
 }
 
 var _ = (core.Server)((*httpServerDispatcher)(nil))
+var _ = (core.ConnectionLister)((*httpServerDispatcher)(nil))
+
+func (d *httpServerDispatcher) trackConn(conn net.Conn, state http.ConnState) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch state {
+	case http.StateNew:
+		d.conns[conn] = time.Now()
+	case http.StateHijacked, http.StateClosed:
+		delete(d.conns, conn)
+	}
+}
+
+// Return the active connections, oldest first.
+func (d *httpServerDispatcher) Connections() []*core.Connection {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return core.SortConnections(d.conns)
+}
 
 func (d *httpServerDispatcher) Serve(ctxt context.Context) error {
-	if d.TLSConfig != nil {
-		return d.ListenAndServeTLS(d.CertFile, d.KeyFile)
+	done := make(chan error, 1)
+
+	go func() {
+		if d.TLSConfig != nil {
+			done <- d.ListenAndServeTLS(d.CertFile, d.KeyFile)
+		} else {
+			done <- d.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctxt.Done():
+		d.Shutdown(context.Background())
+
+		return ctxt.Err()
+	}
+}
+
+func (d *httpServerDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+
+	for _, rt := range d.routes {
+		if params, ok := rt.match(r.URL.Path); !ok {
+			continue
+		} else if rt.verb != r.Method {
+			allowed = append(allowed, rt.verb)
+		} else {
+			d.serveRoute(w, r, rt, params)
+			return
+		}
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		d.write(w, http.StatusMethodNotAllowed, core.NewStatus(core.CodeUnimplemented, "method %s not allowed", r.Method))
+		return
+	}
+
+	method := strings.Trim(r.URL.Path, "/")
+
+	if method == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if isWebSocket(r) {
+		d.serveWebSocket(w, r, method)
+		return
+	}
+
+	if acceptsEvents(r) {
+		d.serveEvents(w, r, method)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		d.writeError(w, core.NewStatus(core.CodeInvalidArgument, "fail to read request, %s", err))
+		return
+	}
+
+	info := &core.CallInfo{Codec: codecOf(r), Peer: r.RemoteAddr, RequestSize: len(payload), TLS: r.TLS}
+
+	call := &core.Call{
+		Method:   method,
+		Payload:  payload,
+		Encoding: d.Encoding,
+	}
+
+	info.Complete(d.dispatch(w, r, call, info))
+}
+
+// Serve a request routed to a method by its HTTP options.
+func (d *httpServerDispatcher) serveRoute(w http.ResponseWriter, r *http.Request, rt *route, params map[string]string) {
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		d.writeError(w, core.NewStatus(core.CodeInvalidArgument, "fail to read request, %s", err))
+		return
+	}
+
+	call, err := rt.call(r, params, body, d.Encoding)
+
+	if err != nil {
+		d.writeError(w, err)
+		return
+	}
+
+	info := &core.CallInfo{Codec: codecOf(r), Peer: r.RemoteAddr, RequestSize: len(body), TLS: r.TLS}
+
+	info.Complete(d.dispatch(w, r, call, info))
+}
+
+// Dispatch the call to the service, and return the size of the written response.
+func (d *httpServerDispatcher) dispatch(w http.ResponseWriter, r *http.Request, call *core.Call, info *core.CallInfo) int {
+	h := HeaderFromHttp(r.Header)
+
+	ctxt, cancel, err := core.ExtractDeadline(r.Context(), h)
+
+	if err != nil {
+		return d.writeError(w, err)
+	}
+
+	defer cancel()
+
+	ctxt = core.WithIncomingHeader(ctxt, h)
+	ctxt = core.WithIncomingCallInfo(ctxt, info)
+
+	call.Service = d.Name
+
+	result, err := d.Service.Apply(ctxt, call).Get()
+
+	if err != nil {
+		return d.writeError(w, err)
+	}
+
+	return d.write(w, http.StatusOK, result)
+}
+
+func (d *httpServerDispatcher) writeError(w http.ResponseWriter, err error) int {
+	status := core.StatusOf(err)
+
+	if retryAfter, ok := core.RetryAfterOf(status); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 	}
 
-	return d.ListenAndServe()
+	return d.write(w, HttpStatusOf(status.Code), status)
+}
+
+func (d *httpServerDispatcher) write(w http.ResponseWriter, code int, v interface{}) int {
+	data, err := d.Encoding.Marshal(v)
+
+	if err != nil {
+		code = http.StatusInternalServerError
+		data, _ = d.Encoding.Marshal(core.NewStatus(core.CodeInternal, "fail to encode response, %s", err))
+	}
+
+	w.Header().Set("Content-Type", d.Encoding.ContentType())
+	w.WriteHeader(code)
+	w.Write(data)
+
+	return len(data)
 }
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/flier/bucky/core"
+)
+
+var httpStatus = map[core.Code]int{
+	core.CodeOK:                 http.StatusOK,
+	core.CodeCanceled:           499,
+	core.CodeUnknown:            http.StatusInternalServerError,
+	core.CodeInvalidArgument:    http.StatusBadRequest,
+	core.CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+	core.CodeNotFound:           http.StatusNotFound,
+	core.CodeAlreadyExists:      http.StatusConflict,
+	core.CodePermissionDenied:   http.StatusForbidden,
+	core.CodeResourceExhausted:  http.StatusTooManyRequests,
+	core.CodeFailedPrecondition: http.StatusBadRequest,
+	core.CodeAborted:            http.StatusConflict,
+	core.CodeOutOfRange:         http.StatusBadRequest,
+	core.CodeUnimplemented:      http.StatusNotImplemented,
+	core.CodeInternal:           http.StatusInternalServerError,
+	core.CodeUnavailable:        http.StatusServiceUnavailable,
+	core.CodeDataLoss:           http.StatusInternalServerError,
+	core.CodeUnauthenticated:    http.StatusUnauthorized,
+}
+
+// Return the HTTP status code of the status code.
+func HttpStatusOf(code core.Code) int {
+	if status, exists := httpStatus[code]; exists {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Return the status code of a HTTP status code, for the responses without status.
+func CodeOf(status int) core.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return core.CodeInvalidArgument
+	case http.StatusUnauthorized:
+		return core.CodeUnauthenticated
+	case http.StatusForbidden:
+		return core.CodePermissionDenied
+	case http.StatusNotFound:
+		return core.CodeNotFound
+	case http.StatusTooManyRequests:
+		return core.CodeResourceExhausted
+	case http.StatusNotImplemented:
+		return core.CodeUnimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return core.CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return core.CodeDeadlineExceeded
+	}
+
+	if status >= 200 && status < 300 {
+		return core.CodeOK
+	}
+
+	return core.CodeUnknown
+}
@@ -0,0 +1,410 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	"github.com/flier/bucky/core"
+)
+
+// A streamFrame is a text message of a streaming call over WebSocket, encoded as JSON like its messages.
+//
+// The client sends the arguments first, then its messages and the end of its side,
+// while the server sends its messages and the status with the result last.
+type streamFrame struct {
+	Args    json.RawMessage `json:"args,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+	End     bool            `json:"end,omitempty"`
+	Status  *core.Status    `json:"status,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// Is the request the opening handshake of a WebSocket?
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// Does the client accept the messages as server-sent events?
+func acceptsEvents(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// Serve a streaming call over WebSocket, the messages are exchanged in both directions.
+func (d *httpServerDispatcher) serveWebSocket(w http.ResponseWriter, r *http.Request, method string) {
+	server := websocket.Server{
+		Handshake: d.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			d.streamWebSocket(ws, r, method)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// Check the origin of a WebSocket, so that a page of another site can't call with the cookies of the user.
+//
+// The clients sending no origin aren't browsers, their calls are authenticated by the filters.
+func (d *httpServerDispatcher) checkOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return nil
+	}
+
+	for _, allowed := range d.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return nil
+		}
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	return fmt.Errorf("origin `%s` isn't allowed", origin)
+}
+
+func (d *httpServerDispatcher) streamWebSocket(ws *websocket.Conn, r *http.Request, method string) {
+	var first streamFrame
+
+	if err := websocket.JSON.Receive(ws, &first); err != nil {
+		return
+	}
+
+	info := &core.CallInfo{Codec: codecOf(r), Peer: r.RemoteAddr, RequestSize: len(first.Args), TLS: r.TLS}
+
+	ctxt, cancel, err := d.contextOf(r, info)
+
+	if err != nil {
+		websocket.JSON.Send(ws, &streamFrame{Status: core.StatusOf(err)})
+		return
+	}
+
+	defer cancel()
+
+	local, remote := core.NewPipe(ctxt, core.DefaultStreamWindow)
+
+	// the client is held back by the connection while the method doesn't receive its messages
+	go func() {
+		for {
+			var f streamFrame
+
+			if err := websocket.JSON.Receive(ws, &f); err != nil {
+				// the client has gone or canceled the call
+				cancel()
+				return
+			}
+
+			if f.Message != nil {
+				local.Send(&core.RawMessage{Data: f.Message, Encoding: core.JsonEncoding})
+			}
+
+			if f.End {
+				local.CloseSend()
+			}
+		}
+	}()
+
+	forwarded := make(chan error, 1)
+
+	go func() {
+		forwarded <- forwardMessages(local, func(data []byte) error {
+			return websocket.JSON.Send(ws, &streamFrame{Message: data})
+		})
+	}()
+
+	call := &core.Call{
+		Service:  d.Name,
+		Method:   method,
+		Payload:  first.Args,
+		Encoding: core.JsonEncoding,
+		Stream:   remote,
+	}
+
+	result, err := d.Service.Apply(ctxt, call).Get()
+
+	remote.CloseSend()
+
+	if e := <-forwarded; err == nil && e != nil {
+		err = e
+	}
+
+	final := &streamFrame{Status: core.StatusOf(err)}
+
+	if err == nil {
+		if final.Result, err = core.JsonEncoding.Marshal(result); err != nil {
+			final.Status = core.NewStatus(core.CodeInternal, "fail to encode response, %s", err)
+		}
+	}
+
+	websocket.JSON.Send(ws, final)
+
+	info.Complete(len(final.Result))
+}
+
+// Serve a call streaming the messages of the server as server-sent events,
+// each message is a `message` event, followed by a `result` or an `error` event.
+func (d *httpServerDispatcher) serveEvents(w http.ResponseWriter, r *http.Request, method string) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		d.writeError(w, core.NewStatus(core.CodeUnimplemented, "streaming unsupported"))
+		return
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		d.writeError(w, core.NewStatus(core.CodeInvalidArgument, "fail to read request, %s", err))
+		return
+	}
+
+	info := &core.CallInfo{Codec: codecOf(r), Peer: r.RemoteAddr, RequestSize: len(payload), TLS: r.TLS}
+
+	ctxt, cancel, err := d.contextOf(r, info)
+
+	if err != nil {
+		d.writeError(w, err)
+		return
+	}
+
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	local, remote := core.NewPipe(ctxt, core.DefaultStreamWindow)
+
+	// the client doesn't stream its messages
+	local.CloseSend()
+
+	var size int
+
+	writeEvent := func(event string, data []byte) error {
+		n, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+
+		size += n
+
+		flusher.Flush()
+
+		return err
+	}
+
+	forwarded := make(chan error, 1)
+
+	go func() {
+		forwarded <- forwardMessages(local, func(data []byte) error { return writeEvent("message", data) })
+	}()
+
+	call := &core.Call{
+		Service:  d.Name,
+		Method:   method,
+		Payload:  payload,
+		Encoding: core.JsonEncoding,
+		Stream:   remote,
+	}
+
+	result, err := d.Service.Apply(ctxt, call).Get()
+
+	remote.CloseSend()
+
+	if e := <-forwarded; err == nil && e != nil {
+		err = e
+	}
+
+	var data []byte
+
+	if err == nil {
+		if data, err = core.JsonEncoding.Marshal(result); err == nil {
+			writeEvent("result", data)
+		} else {
+			err = core.NewStatus(core.CodeInternal, "fail to encode response, %s", err)
+		}
+	}
+
+	if err != nil {
+		data, _ = core.JsonEncoding.Marshal(core.StatusOf(err))
+
+		writeEvent("error", data)
+	}
+
+	info.Complete(size)
+}
+
+func codecOf(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// Return the context of a streaming call, with the deadline and the header of the request.
+func (d *httpServerDispatcher) contextOf(r *http.Request, info *core.CallInfo) (context.Context, context.CancelFunc, error) {
+	h := HeaderFromHttp(r.Header)
+
+	ctxt, cancel, err := core.ExtractDeadline(r.Context(), h)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctxt, abort := context.WithCancel(ctxt)
+
+	ctxt = core.WithIncomingHeader(ctxt, h)
+	ctxt = core.WithIncomingCallInfo(ctxt, info)
+
+	return ctxt, func() { abort(); cancel() }, nil
+}
+
+// Write the messages received from the pipe, encoded as JSON, until it's closed.
+func forwardMessages(local core.Stream, write func(data []byte) error) error {
+	for {
+		var v interface{}
+
+		if err := local.Recv(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		data, err := core.EncodeMessage(v, core.JsonEncoding)
+
+		if err != nil {
+			return core.NewStatus(core.CodeInternal, "fail to encode message, %s", err)
+		}
+
+		if err := write(data); err != nil {
+			return core.NewStatus(core.CodeUnavailable, "%s", err)
+		}
+	}
+}
+
+// Call a streaming method over WebSocket, the messages are encoded as JSON.
+func (d *httpClientDispatcher) stream(ctxt context.Context, call *core.Call, payload []byte, h core.Header) (interface{}, error) {
+	u := *d.Uri
+
+	u.Scheme = "ws"
+
+	if d.Uri.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.ToLower(call.Method)
+
+	cfg, err := websocket.NewConfig(u.String(), d.Uri.String())
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeInvalidArgument, "fail to create request, %s", err)
+	}
+
+	HeaderToHttp(h, cfg.Header)
+
+	if t, ok := d.Transport.(*http.Transport); ok {
+		cfg.TlsConfig = t.TLSClientConfig
+	}
+
+	cfg.Dialer = &net.Dialer{}
+
+	if deadline, ok := ctxt.Deadline(); ok {
+		cfg.Dialer.Deadline = deadline
+	}
+
+	ws, err := websocket.DialConfig(cfg)
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	defer ws.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctxt.Done():
+			// the server cancels the call once the connection is closed
+			ws.Close()
+		case <-done:
+		}
+	}()
+
+	if err := websocket.JSON.Send(ws, &streamFrame{Args: payload}); err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	go func() {
+		err := forwardMessages(call.Stream, func(data []byte) error {
+			return websocket.JSON.Send(ws, &streamFrame{Message: data})
+		})
+
+		if err == nil {
+			websocket.JSON.Send(ws, &streamFrame{End: true})
+		}
+	}()
+
+	defer call.Stream.CloseSend()
+
+	for {
+		var f streamFrame
+
+		if err := websocket.JSON.Receive(ws, &f); err != nil {
+			if ctxtErr := ctxt.Err(); ctxtErr != nil {
+				return nil, core.StatusOf(ctxtErr)
+			}
+
+			return nil, core.NewStatus(core.CodeUnavailable, "connection lost, %s", err)
+		}
+
+		if f.Message != nil {
+			// the server is held back by the connection while the client doesn't receive its messages
+			call.Stream.Send(&core.RawMessage{Data: f.Message, Encoding: core.JsonEncoding})
+		}
+
+		if f.Status != nil {
+			if info, ok := core.OutgoingCallInfo(ctxt); ok {
+				info.Complete(len(f.Result))
+			}
+
+			return d.resultOf(call, &f)
+		}
+	}
+}
+
+func (d *httpClientDispatcher) resultOf(call *core.Call, f *streamFrame) (interface{}, error) {
+	if f.Status.Code != core.CodeOK {
+		return nil, f.Status
+	}
+
+	if call.Reply != nil {
+		if err := core.JsonEncoding.Unmarshal(f.Result, call.Reply); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+
+		return call.Reply, nil
+	}
+
+	var result interface{}
+
+	if len(f.Result) > 0 {
+		if err := core.JsonEncoding.Unmarshal(f.Result, &result); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,189 @@
+// Package netserver serves the connections of a stream oriented network, such as TCP or Unix sockets,
+// for the codecs framing their calls over them.
+package netserver
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// How long the calls in flight may complete once a server shuts down, before they are canceled.
+var DefaultShutdownGrace = 10 * time.Second
+
+// Listen on an address, with TLS when it has a config, whose certificate may be loaded from files.
+func Listen(addr net.Addr, cfg *tls.Config, certFile, keyFile string) (net.Listener, error) {
+	l, err := net.Listen(addr.Network(), addr.String())
+
+	if err != nil || cfg == nil {
+		return l, err
+	}
+
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+		if err != nil {
+			l.Close()
+
+			return nil, err
+		}
+
+		cfg = cfg.Clone()
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tls.NewListener(l, cfg), nil
+}
+
+// A Server accepts the connections of a listener, and tracks them with the calls they serve.
+//
+// Once it shuts down, the calls in flight may complete during the grace period,
+// the remaining ones are canceled afterward, and the connections are closed once all the calls returned.
+type Server struct {
+	// How long the calls in flight may complete once the server shuts down, DefaultShutdownGrace when 0.
+	ShutdownGrace time.Duration
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]time.Time
+	calls    sync.WaitGroup
+	closing  bool
+}
+
+// Return the address the server listens on, or nil if it isn't serving.
+func (s *Server) ListenAddr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+// Return the active connections, oldest first.
+func (s *Server) Connections() []*core.Connection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return core.SortConnections(s.conns)
+}
+
+// Serve the connections accepted by the listener until the context is done, then shut down.
+//
+// The connections are served with a context which is canceled once the grace period of the shutdown elapsed.
+func (s *Server) Serve(ctxt context.Context, name string, l net.Listener, serveConn func(ctxt context.Context, conn net.Conn)) error {
+	calls, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.lock.Lock()
+	s.listener = l
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]time.Time)
+	}
+	s.lock.Unlock()
+
+	go func() {
+		<-ctxt.Done()
+
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+
+		if err != nil {
+			if ctxt.Err() != nil {
+				s.shutdown(cancel)
+
+				return ctxt.Err()
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				core.Warnf("%s: fail to accept connection, %s", name, err)
+
+				continue
+			}
+
+			return err
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = time.Now()
+		s.lock.Unlock()
+
+		go func() {
+			defer func() {
+				s.lock.Lock()
+				delete(s.conns, conn)
+				s.lock.Unlock()
+
+				conn.Close()
+			}()
+
+			serveConn(calls, conn)
+		}()
+	}
+}
+
+// Register a call in flight, which must be followed by Done once it returned,
+// return false if the server is shutting down.
+func (s *Server) Begin() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closing {
+		return false
+	}
+
+	s.calls.Add(1)
+
+	return true
+}
+
+// Unregister a call in flight.
+func (s *Server) Done() {
+	s.calls.Done()
+}
+
+// Wait for the calls in flight during the grace period, cancel the remaining ones, and close the connections.
+func (s *Server) shutdown(cancel context.CancelFunc) {
+	s.lock.Lock()
+	s.closing = true
+	s.lock.Unlock()
+
+	grace := s.ShutdownGrace
+
+	if grace <= 0 {
+		grace = DefaultShutdownGrace
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		s.calls.Wait()
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		cancel()
+
+		<-done
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
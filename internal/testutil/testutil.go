@@ -0,0 +1,129 @@
+// Package testutil serves the servers of the tests on the ports chosen by the system.
+package testutil
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	// How long a server may take to accept the connections.
+	ListenTimeout = 5 * time.Second
+
+	// How many times a server is built again on other ports, when one of them was taken meanwhile.
+	MaxAttempts = 3
+)
+
+// Serve a server built on a loopback address chosen by the system until the context is done,
+// return the address once the server accepts the connections, and the channel of the error returned by Serve.
+func Serve(ctxt context.Context, build func(addr *net.TCPAddr) core.Server) (*net.TCPAddr, <-chan error, error) {
+	addrs, done, err := ServeAll(ctxt, 1, func(addrs []*net.TCPAddr) core.Server { return build(addrs[0]) })
+
+	if err != nil {
+		return nil, done, err
+	}
+
+	return addrs[0], done, nil
+}
+
+// Serve a server built on n loopback addresses chosen by the system, such as the ones of a server and its admin server,
+// until the context is done, return the addresses once the server accepts the connections on all of them,
+// and the channel of the error returned by Serve.
+//
+// The ports are chosen before the server listens, so the server is built again on other ports
+// when one of them was taken meanwhile.
+func ServeAll(ctxt context.Context, n int, build func(addrs []*net.TCPAddr) core.Server) ([]*net.TCPAddr, <-chan error, error) {
+	var err error
+
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		var addrs []*net.TCPAddr
+
+		if addrs, err = freeAddrs(n); err != nil {
+			return nil, nil, err
+		}
+
+		attemptCtxt, cancel := context.WithCancel(ctxt)
+
+		done := make(chan error, 1)
+
+		go func(server core.Server) {
+			err := server.Serve(attemptCtxt)
+
+			cancel()
+
+			done <- err
+		}(build(addrs))
+
+		if err = accepting(addrs, done); err == nil {
+			return addrs, done, nil
+		}
+
+		cancel()
+
+		<-done
+	}
+
+	done := make(chan error, 1)
+
+	done <- err
+
+	return nil, done, err
+}
+
+// Return n distinct loopback addresses with free ports.
+func freeAddrs(n int) ([]*net.TCPAddr, error) {
+	addrs := make([]*net.TCPAddr, 0, n)
+
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the listeners are closed once all the ports were chosen, so that they're distinct
+		defer l.Close()
+
+		addrs = append(addrs, l.Addr().(*net.TCPAddr))
+	}
+
+	return addrs, nil
+}
+
+// Wait until the connections are accepted on all the addresses, or the server stopped.
+func accepting(addrs []*net.TCPAddr, done chan error) error {
+	timeout := time.After(ListenTimeout)
+
+	for _, addr := range addrs {
+		for {
+			conn, err := net.Dial("tcp", addr.String())
+
+			if err == nil {
+				conn.Close()
+
+				break
+			}
+
+			select {
+			case err := <-done:
+				done <- err
+
+				if err == nil {
+					err = errors.New("the server stopped")
+				}
+
+				return err
+			case <-timeout:
+				return errors.New("the server doesn't accept the connections")
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,446 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+)
+
+const (
+	NotificationKey = "jsonrpc.notification"
+)
+
+// Return a context whose calls are sent as notifications, which the server doesn't answer.
+func WithNotification(ctxt context.Context) context.Context {
+	return context.WithValue(ctxt, NotificationKey, true)
+}
+
+func IsNotification(ctxt context.Context) bool {
+	b, _ := ctxt.Value(NotificationKey).(bool)
+
+	return b
+}
+
+// Encode the call as a request, with the arguments as positional params,
+// or as named params when the call is named and its single argument is an object.
+func newRequest(ctxt context.Context, call *core.Call, id uint64) ([]byte, error) {
+	req := &Request{Version: Version, Method: call.Method}
+
+	if !IsNotification(ctxt) {
+		req.Id = json.RawMessage(strconv.FormatUint(id, 10))
+	}
+
+	var err error
+
+	if call.Named && len(call.Args) == 1 {
+		req.Params, err = json.Marshal(call.Args[0])
+	} else if len(call.Args) > 0 {
+		req.Params, err = json.Marshal(call.Args)
+	}
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeInvalidArgument, "fail to encode arguments, %s", err)
+	}
+
+	return json.Marshal(req)
+}
+
+// Settle the call with the response.
+func settle(call *core.Call, resp *Response) (interface{}, error) {
+	if resp.Error != nil {
+		return nil, resp.Error.Status()
+	}
+
+	if call.Reply != nil {
+		if err := json.Unmarshal(resp.Result, call.Reply); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+
+		return call.Reply, nil
+	}
+
+	var result interface{}
+
+	if len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+		}
+	}
+
+	return result, nil
+}
+
+type httpClientCodec struct {
+	*nethttp.Client
+
+	Uri *url.URL
+}
+
+var _ = (core.ClientCodec)((*httpClientCodec)(nil))
+
+func (c *httpClientCodec) ClientDispatcher(transport core.Transport) core.Service {
+	return &httpClientDispatcher{httpClientCodec: c}
+}
+
+// A httpClientDispatcher POSTs the calls as JSON-RPC requests to the URI.
+type httpClientDispatcher struct {
+	*httpClientCodec
+
+	lock   sync.Mutex
+	nextId uint64
+}
+
+var _ = (core.Service)((*httpClientDispatcher)(nil))
+
+func (d *httpClientDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	if call.Stream != nil {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "JSON-RPC doesn't stream messages"))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	d.lock.Lock()
+	d.nextId++
+	id := d.nextId
+	d.lock.Unlock()
+
+	payload, err := newRequest(ctxt, call, id)
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	r, err := nethttp.NewRequest("POST", d.Uri.String(), bytes.NewReader(payload))
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to create request, %s", err))
+	}
+
+	h := core.OutgoingHeader(ctxt).Clone()
+
+	core.InjectDeadline(ctxt, h)
+
+	http.HeaderToHttp(h, r.Header)
+
+	r.Header.Set("Content-Type", "application/json")
+
+	if info, ok := core.OutgoingCallInfo(ctxt); ok {
+		info.Codec, info.Peer, info.RequestSize = "jsonrpc+"+d.Uri.Scheme, d.Uri.Host, len(payload)
+	}
+
+	return promise.Start(func() (interface{}, error) {
+		return d.roundTrip(r.WithContext(ctxt), call)
+	})
+}
+
+func (d *httpClientDispatcher) roundTrip(r *nethttp.Request, call *core.Call) (interface{}, error) {
+	resp, err := d.Do(r)
+
+	if err != nil {
+		if ctxtErr := r.Context().Err(); ctxtErr != nil {
+			return nil, core.StatusOf(ctxtErr)
+		}
+
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "fail to read response, %s", err)
+	}
+
+	if info, ok := core.OutgoingCallInfo(r.Context()); ok {
+		info.Complete(len(data))
+	}
+
+	if resp.StatusCode == nethttp.StatusNoContent && IsNotification(r.Context()) {
+		return nil, nil
+	}
+
+	var res Response
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		if resp.StatusCode != nethttp.StatusOK {
+			return nil, core.NewStatus(http.CodeOf(resp.StatusCode), "%s", resp.Status)
+		}
+
+		return nil, core.NewStatus(core.CodeInternal, "fail to decode response, %s", err)
+	}
+
+	return settle(call, &res)
+}
+
+type tcpClientCodec struct {
+	Network   string
+	Address   string
+	TLSConfig *tls.Config
+}
+
+var _ = (core.ClientCodec)((*tcpClientCodec)(nil))
+
+func (c *tcpClientCodec) ClientDispatcher(transport core.Transport) core.Service {
+	return &tcpClientDispatcher{tcpClientCodec: c}
+}
+
+// A tcpClientDispatcher sends the calls as lines over a connection, matching the responses by id,
+// the connection is dialed on the first call and dialed again after it failed.
+type tcpClientDispatcher struct {
+	*tcpClientCodec
+
+	lock    sync.Mutex
+	conn    *clientConn
+	closed  bool
+	nextId  uint64
+	dialing sync.Mutex
+}
+
+var _ = (core.Service)((*tcpClientDispatcher)(nil))
+
+type clientConn struct {
+	w       *lineWriter
+	lock    sync.Mutex
+	pending map[string]*pendingCall
+	err     error
+}
+
+type pendingCall struct {
+	call   *core.Call
+	info   *core.CallInfo
+	result *promise.Promise
+}
+
+func (d *tcpClientDispatcher) connect(ctxt context.Context) (*clientConn, error) {
+	d.dialing.Lock()
+	defer d.dialing.Unlock()
+
+	d.lock.Lock()
+	conn, closed := d.conn, d.closed
+	d.lock.Unlock()
+
+	if closed {
+		return nil, core.NewStatus(core.CodeUnavailable, "client is closed")
+	}
+
+	if conn != nil {
+		return conn, nil
+	}
+
+	var c net.Conn
+	var err error
+
+	dialer := &net.Dialer{}
+
+	if deadline, ok := ctxt.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	if d.TLSConfig != nil {
+		c, err = tls.DialWithDialer(dialer, d.Network, d.Address, d.TLSConfig)
+	} else {
+		c, err = dialer.Dial(d.Network, d.Address)
+	}
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	conn = &clientConn{w: &lineWriter{conn: c}, pending: make(map[string]*pendingCall)}
+
+	d.lock.Lock()
+	d.conn = conn
+	d.lock.Unlock()
+
+	go d.receive(conn, c)
+
+	return conn, nil
+}
+
+func (d *tcpClientDispatcher) receive(conn *clientConn, c net.Conn) {
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(nil, MaxLineSize)
+
+	for scanner.Scan() {
+		var resps []*Response
+
+		if isBatch(scanner.Bytes()) {
+			json.Unmarshal(scanner.Bytes(), &resps)
+		} else {
+			var resp Response
+
+			if json.Unmarshal(scanner.Bytes(), &resp) == nil {
+				resps = append(resps, &resp)
+			}
+		}
+
+		for _, resp := range resps {
+			conn.lock.Lock()
+			p := conn.pending[string(resp.Id)]
+			delete(conn.pending, string(resp.Id))
+			conn.lock.Unlock()
+
+			if p != nil {
+				if p.info != nil {
+					p.info.Complete(len(scanner.Bytes()))
+				}
+
+				if result, err := settle(p.call, resp); err != nil {
+					p.result.Reject(err)
+				} else {
+					p.result.Resolve(result)
+				}
+			}
+		}
+	}
+
+	err := scanner.Err()
+
+	if err == nil {
+		err = core.NewStatus(core.CodeUnavailable, "connection closed")
+	}
+
+	d.fail(conn, core.NewStatus(core.CodeUnavailable, "connection lost, %s", err))
+}
+
+// Reject the calls pending on a broken connection, the next call will dial again.
+func (d *tcpClientDispatcher) fail(conn *clientConn, err error) {
+	d.lock.Lock()
+	if d.conn == conn {
+		d.conn = nil
+	}
+	d.lock.Unlock()
+
+	conn.lock.Lock()
+	pending := conn.pending
+	conn.pending = nil
+	conn.err = err
+	conn.lock.Unlock()
+
+	conn.w.conn.Close()
+
+	for _, p := range pending {
+		p.result.Reject(err)
+	}
+}
+
+func (d *tcpClientDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	if call.Stream != nil {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "JSON-RPC doesn't stream messages"))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	d.lock.Lock()
+	d.nextId++
+	id := d.nextId
+	d.lock.Unlock()
+
+	payload, err := newRequest(ctxt, call, id)
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	conn, err := d.connect(ctxt)
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	info, ok := core.OutgoingCallInfo(ctxt)
+
+	if ok {
+		info.Codec, info.Peer, info.RequestSize = "jsonrpc+"+d.Network, d.Address, len(payload)
+	}
+
+	if IsNotification(ctxt) {
+		if err := conn.w.write(payload); err != nil {
+			d.fail(conn, core.NewStatus(core.CodeUnavailable, "%s", err))
+
+			return core.Rejected(core.NewStatus(core.CodeUnavailable, "%s", err))
+		}
+
+		if info != nil {
+			info.Complete(0)
+		}
+
+		return core.Resolved(nil)
+	}
+
+	key := strconv.FormatUint(id, 10)
+	p := &pendingCall{call, info, promise.NewPromise()}
+
+	conn.lock.Lock()
+	if conn.pending == nil {
+		conn.lock.Unlock()
+
+		return core.Rejected(conn.err)
+	}
+	conn.pending[key] = p
+	conn.lock.Unlock()
+
+	if done := ctxt.Done(); done != nil {
+		go func() {
+			select {
+			case <-done:
+				// the call is given up, its response is dropped if it ever comes
+				conn.lock.Lock()
+				if conn.pending[key] == p {
+					delete(conn.pending, key)
+				}
+				conn.lock.Unlock()
+			case <-p.result.Future.GetChan():
+			}
+		}()
+	}
+
+	if err := conn.w.write(payload); err != nil {
+		d.fail(conn, core.NewStatus(core.CodeUnavailable, "%s", err))
+	}
+
+	return core.WithContext(ctxt, p.result.Future)
+}
+
+func (d *tcpClientDispatcher) Close() error {
+	d.lock.Lock()
+	conn := d.conn
+	d.closed = true
+	d.lock.Unlock()
+
+	if conn != nil {
+		d.fail(conn, core.NewStatus(core.CodeUnavailable, "client is closed"))
+	}
+
+	return nil
+}
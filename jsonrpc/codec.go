@@ -0,0 +1,116 @@
+// Package jsonrpc serves and calls the services with JSON-RPC 2.0,
+// over HTTP POST or as newline framed messages over TCP.
+//
+// The positional params are the arguments of the method, and the named params
+// are matched with the parameter names of its rpc metadata.
+package jsonrpc
+
+import (
+	nethttp "net/http"
+	"net/http/cookiejar"
+
+	"github.com/flier/bucky/core"
+)
+
+var (
+	HttpCodec = (core.CodecFactory)(&httpCodecFactory{})
+	TcpCodec  = (core.CodecFactory)(&tcpCodecFactory{})
+)
+
+type httpCodecFactory struct {
+}
+
+var _ = (core.CodecFactory)((*httpCodecFactory)(nil))
+
+func (f *httpCodecFactory) ClientCodec(cfg *core.ClientCodecConfig) core.ClientCodec {
+	var errs core.MultiError
+
+	errs.Merge("", cfg.Validate())
+
+	if cfg.Uri != nil && cfg.Uri.Scheme != "" && cfg.Uri.Scheme != "http" && cfg.Uri.Scheme != "https" {
+		errs.Add("Uri", "unsupported scheme `%s`", cfg.Uri.Scheme)
+	}
+
+	jar, err := cookiejar.New(nil)
+
+	if err != nil {
+		errs.Add("", "fail to create cookiejar, %s", err)
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		panic(err)
+	}
+
+	client := &nethttp.Client{
+		Transport: &nethttp.Transport{
+			DisableKeepAlives: !cfg.KeepAlives,
+			TLSClientConfig:   cfg.TLSConfig,
+		},
+		Jar: jar,
+	}
+
+	return &httpClientCodec{client, cfg.Uri}
+}
+
+func (f *httpCodecFactory) ServerCodec(cfg *core.ServerCodecConfig) core.ServerCodec {
+	return &httpServerCodec{cfg}
+}
+
+type httpServerCodec struct {
+	*core.ServerCodecConfig
+}
+
+var _ = (core.ServerCodec)((*httpServerCodec)(nil))
+
+func (c *httpServerCodec) ServerDispatcher(transport core.Transport, service core.Service) core.Server {
+	server := &nethttp.Server{
+		Addr:      c.Addr.String(),
+		TLSConfig: c.TLSConfig,
+	}
+
+	server.SetKeepAlivesEnabled(c.KeepAlives)
+
+	d := &httpServerDispatcher{
+		Server:     server,
+		dispatcher: dispatcher{Name: c.Name, Service: service},
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+	}
+
+	server.Handler = d
+
+	return d
+}
+
+type tcpCodecFactory struct {
+}
+
+var _ = (core.CodecFactory)((*tcpCodecFactory)(nil))
+
+func (f *tcpCodecFactory) ClientCodec(cfg *core.ClientCodecConfig) core.ClientCodec {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+
+	return &tcpClientCodec{"tcp", cfg.Uri.Host, cfg.TLSConfig}
+}
+
+func (f *tcpCodecFactory) ServerCodec(cfg *core.ServerCodecConfig) core.ServerCodec {
+	return &tcpServerCodec{cfg}
+}
+
+type tcpServerCodec struct {
+	*core.ServerCodecConfig
+}
+
+var _ = (core.ServerCodec)((*tcpServerCodec)(nil))
+
+func (c *tcpServerCodec) ServerDispatcher(transport core.Transport, service core.Service) core.Server {
+	return &tcpServerDispatcher{
+		dispatcher: dispatcher{Name: c.Name, Service: service},
+		Addr:       c.Addr,
+		TLSConfig:  c.TLSConfig,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+	}
+}
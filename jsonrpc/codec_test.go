@@ -0,0 +1,285 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+)
+
+type mathService struct {
+	notified chan string
+	released chan struct{}
+}
+
+func (s *mathService) Uppercase(str string) (string, error) {
+	if str == "" {
+		return "", errors.New("empty string")
+	}
+
+	return strings.ToUpper(str), nil
+}
+
+func (s *mathService) Subtract(minuend, subtrahend int) int { return minuend - subtrahend }
+
+func (s *mathService) Notify(event string) { s.notified <- event }
+
+func (s *mathService) Wait(ctxt context.Context) {
+	s.Notify("wait")
+
+	select {
+	case <-s.released:
+	case <-ctxt.Done():
+	}
+}
+
+func (s *mathService) ParamNames() map[string][]string {
+	return map[string][]string{"Subtract": {"minuend", "subtrahend"}}
+}
+
+func post(url, body string) (int, string) {
+	resp, err := nethttp.Post(url, "application/json", strings.NewReader(body))
+
+	So(err, ShouldBeNil)
+
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(data)
+}
+
+func TestHttpCodec(t *testing.T) {
+	Convey("serve a native service with JSON-RPC over HTTP", t, func() {
+		svc := &mathService{notified: make(chan string, 1)}
+
+		codec := HttpCodec.ServerCodec(&core.ServerCodecConfig{Name: "mathsvc", Addr: &net.TCPAddr{}})
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, rpc.NativeFactory.Build(svc)).(nethttp.Handler))
+		defer server.Close()
+
+		Convey("call with positional params", func() {
+			code, body := post(server.URL, `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`)
+			So(code, ShouldEqual, 200)
+			So(body, ShouldEqual, `{"jsonrpc":"2.0","result":19,"id":1}`)
+
+			_, body = post(server.URL, `{"jsonrpc": "2.0", "method": "uppercase", "params": ["hello"], "id": "a"}`)
+			So(body, ShouldEqual, `{"jsonrpc":"2.0","result":"HELLO","id":"a"}`)
+		})
+
+		Convey("call with named params", func() {
+			_, body := post(server.URL, `{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": 3}`)
+			So(body, ShouldEqual, `{"jsonrpc":"2.0","result":19,"id":3}`)
+
+			_, body = post(server.URL, `{"jsonrpc": "2.0", "method": "subtract", "params": {"divisor": 23}, "id": 4}`)
+			So(body, ShouldContainSubstring, `"code":-32602`)
+		})
+
+		Convey("answer the errors with the standard codes", func() {
+			_, body := post(server.URL, `{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`)
+			So(body, ShouldContainSubstring, `"error":{"code":-32601,"message":"unknown method`)
+
+			_, body = post(server.URL, `{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`)
+			So(body, ShouldContainSubstring, `"error":{"code":-32700`)
+			So(body, ShouldEndWith, `"id":null}`)
+
+			_, body = post(server.URL, `{"jsonrpc": "2.0", "method": 1, "params": "bar"}`)
+			So(body, ShouldContainSubstring, `"error":{"code":-32600`)
+
+			_, body = post(server.URL, `{"jsonrpc": "2.0", "method": "uppercase", "params": [""], "id": 5}`)
+			So(body, ShouldEqual, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"empty string","data":{"status":"UNKNOWN"}},"id":5}`)
+
+			_, body = post(server.URL, `[]`)
+			So(body, ShouldContainSubstring, `"error":{"code":-32600,"message":"empty batch"}`)
+		})
+
+		Convey("serve a batch with notifications", func() {
+			code, body := post(server.URL, `[
+				{"jsonrpc": "2.0", "method": "uppercase", "params": ["hello"], "id": "1"},
+				{"jsonrpc": "2.0", "method": "notify", "params": ["event"]},
+				{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": "2"},
+				{"foo": "boo"},
+				{"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"}
+			]`)
+
+			So(code, ShouldEqual, 200)
+			So(<-svc.notified, ShouldEqual, "event")
+			So(body, ShouldStartWith, `[{"jsonrpc":"2.0","result":"HELLO","id":"1"},{"jsonrpc":"2.0","result":19,"id":"2"},{"jsonrpc":"2.0","error":{"code":-32600`)
+			So(body, ShouldContainSubstring, `{"jsonrpc":"2.0","error":{"code":-32601,`)
+
+			code, body = post(server.URL, `[{"jsonrpc": "2.0", "method": "notify", "params": ["batch"]}]`)
+
+			So(code, ShouldEqual, 204)
+			So(body, ShouldBeEmpty)
+			So(<-svc.notified, ShouldEqual, "batch")
+		})
+
+		Convey("call with a client", func() {
+			uri, _ := url.Parse(server.URL)
+
+			client := (&core.ClientBuilder{Uri: uri, CodecFactory: HttpCodec}).Build()
+
+			var reply string
+
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+			So(err, ShouldBeNil)
+			So(reply, ShouldEqual, "HELLO")
+
+			result, err := client.Apply(context.Background(), &core.Call{Method: "Subtract", Args: []interface{}{map[string]int{"minuend": 3, "subtrahend": 1}}, Named: true}).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, float64(2))
+
+			_, err = client.Apply(context.Background(), &core.Call{Method: "Unknown"}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+
+			result, err = client.Apply(WithNotification(context.Background()), &core.Call{Method: "Notify", Args: []interface{}{"client"}}).Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+			So(<-svc.notified, ShouldEqual, "client")
+		})
+	})
+}
+
+func TestTcpCodec(t *testing.T) {
+	Convey("serve a native service with JSON-RPC over TCP", t, func() {
+		svc := &mathService{notified: make(chan string, 1), released: make(chan struct{})}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{Name: "mathsvc", Addr: addr, CodecFactory: TcpCodec}).Build(rpc.NativeFactory.Build(svc))
+		})
+
+		So(err, ShouldBeNil)
+
+		conn, err := net.Dial("tcp", addr.String())
+
+		So(err, ShouldBeNil)
+
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+
+		Convey("serve the lines", func() {
+			conn.Write([]byte(`{"jsonrpc": "2.0", "method": "notify", "params": ["line"]}` + "\n"))
+			conn.Write([]byte(`[{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}, {"jsonrpc": "2.0", "method": "uppercase", "params": ["a"], "id": 2}]` + "\n"))
+
+			So(<-svc.notified, ShouldEqual, "line")
+
+			line, err := r.ReadString('\n')
+
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, `[{"jsonrpc":"2.0","result":19,"id":1},{"jsonrpc":"2.0","result":"A","id":2}]`+"\n")
+		})
+
+		Convey("call with a client", func() {
+			uri, _ := url.Parse("tcp://" + addr.String())
+
+			client := (&core.ClientBuilder{Uri: uri, CodecFactory: TcpCodec}).Build()
+
+			var reply string
+
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{"hello"}, Reply: &reply}).Get()
+
+			So(err, ShouldBeNil)
+			So(reply, ShouldEqual, "HELLO")
+
+			_, err = client.Apply(context.Background(), &core.Call{Method: "Uppercase", Args: []interface{}{""}}).Get()
+
+			So(err, ShouldResemble, core.NewStatus(core.CodeUnknown, "empty string"))
+
+			_, err = client.Apply(WithNotification(context.Background()), &core.Call{Method: "Notify", Args: []interface{}{"client"}}).Get()
+
+			So(err, ShouldBeNil)
+			So(<-svc.notified, ShouldEqual, "client")
+
+			Convey("forget the calls given up", func() {
+				defer close(svc.released)
+
+				timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				_, err := client.Apply(timeout, &core.Call{Method: "Wait"}).Get()
+
+				So(core.CodeOf(err), ShouldEqual, core.CodeDeadlineExceeded)
+
+				d := client.(*tcpClientDispatcher)
+
+				pending := func() int {
+					d.lock.Lock()
+					conn := d.conn
+					d.lock.Unlock()
+
+					conn.lock.Lock()
+					defer conn.lock.Unlock()
+
+					return len(conn.pending)
+				}
+
+				for i := 0; i < 100 && pending() > 0; i++ {
+					time.Sleep(time.Millisecond)
+				}
+
+				So(pending(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("build a client without URI", func() {
+			So(func() { TcpCodec.ClientCodec(&core.ClientCodecConfig{}) }, ShouldPanic)
+		})
+	})
+
+	Convey("shut down with a call in flight", t, func() {
+		svc := &mathService{notified: make(chan string, 1), released: make(chan struct{})}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, done, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			codec := TcpCodec.ServerCodec(&core.ServerCodecConfig{Name: "mathsvc", Addr: addr})
+			server := codec.ServerDispatcher(nil, rpc.NativeFactory.Build(svc)).(*tcpServerDispatcher)
+			server.ShutdownGrace = 20 * time.Millisecond
+
+			return server
+		})
+
+		So(err, ShouldBeNil)
+
+		conn, err := net.Dial("tcp", addr.String())
+
+		So(err, ShouldBeNil)
+
+		defer conn.Close()
+
+		conn.Write([]byte(`{"jsonrpc": "2.0", "method": "wait", "id": 1}` + "\n"))
+
+		So(<-svc.notified, ShouldEqual, "wait")
+
+		cancel()
+
+		select {
+		case err := <-done:
+			So(err, ShouldEqual, context.Canceled)
+		case <-time.After(time.Second):
+			So(errors.New("the server didn't shut down"), ShouldBeNil)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	Version = "2.0"
+)
+
+// The error codes defined by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000 // the other statuses, whose code is in the data of the error
+)
+
+// A Request calls a method, it's a notification without id, which isn't answered.
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      json.RawMessage `json:"id,omitempty"`
+}
+
+func (r *Request) IsNotification() bool { return len(r.Id) == 0 }
+
+// A Response holds either the result or the error of a request.
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// The data of an Error, which keeps the status of a failed call.
+type ErrorData struct {
+	Status  string                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// An Error is the JSON-RPC error of a failed call.
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error: code = %d message = %s", e.Code, e.Message)
+}
+
+func newError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Return the JSON-RPC error of a failed call, the status is kept in the data of the error.
+func ErrorOf(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	status := core.StatusOf(err)
+
+	code := CodeServerError
+
+	switch status.Code {
+	case core.CodeInvalidArgument:
+		code = CodeInvalidParams
+	case core.CodeUnimplemented:
+		code = CodeMethodNotFound
+	case core.CodeInternal:
+		code = CodeInternalError
+	}
+
+	return &Error{
+		Code:    code,
+		Message: status.Message,
+		Data:    &ErrorData{Status: status.Code.String(), Details: status.Details},
+	}
+}
+
+// Return the status of the error, from its data or its JSON-RPC code otherwise.
+func (e *Error) Status() *core.Status {
+	if e.Data != nil {
+		if code, ok := core.ParseCode(e.Data.Status); ok {
+			return &core.Status{Code: code, Message: e.Message, Details: e.Data.Details}
+		}
+	}
+
+	code := core.CodeUnknown
+
+	switch e.Code {
+	case CodeParseError, CodeInvalidRequest, CodeInvalidParams:
+		code = core.CodeInvalidArgument
+	case CodeMethodNotFound:
+		code = core.CodeUnimplemented
+	case CodeInternalError:
+		code = core.CodeInternal
+	}
+
+	return core.NewStatus(code, "%s", e.Message)
+}
+
+var null = json.RawMessage("null")
+
+func errorResponse(id json.RawMessage, err error) *Response {
+	if len(id) == 0 {
+		id = null
+	}
+
+	return &Response{Version: Version, Error: ErrorOf(err), Id: id}
+}
+
+// Is the message a batch of requests or responses?
+func isBatch(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+
+	return len(data) > 0 && data[0] == '['
+}
@@ -0,0 +1,335 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/internal/netserver"
+)
+
+const (
+	// The maximum size of a line on a TCP connection.
+	MaxLineSize = 16 << 20
+)
+
+var (
+	errShuttingDown = core.NewStatus(core.CodeUnavailable, "server is shutting down")
+)
+
+// The peer sending the requests, as described by the CallInfo of each call.
+type peer struct {
+	codec string
+	addr  string
+	tls   *tls.ConnectionState
+}
+
+// A dispatcher calls the service for the JSON-RPC requests, single or batched.
+type dispatcher struct {
+	Name    string
+	Service core.Service
+}
+
+// Handle a message, and return the answer or nil when it holds only notifications.
+func (d *dispatcher) handle(ctxt context.Context, p *peer, data []byte) []byte {
+	if !isBatch(data) {
+		return d.handleOne(ctxt, p, data)
+	}
+
+	var batch []json.RawMessage
+
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return marshal(errorResponse(nil, newError(CodeParseError, "%s", err)))
+	}
+
+	if len(batch) == 0 {
+		return marshal(errorResponse(nil, newError(CodeInvalidRequest, "empty batch")))
+	}
+
+	resps := make([][]byte, len(batch))
+
+	var wg sync.WaitGroup
+
+	for i, raw := range batch {
+		wg.Add(1)
+
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done()
+
+			resps[i] = d.handleOne(ctxt, p, raw)
+		}(i, raw)
+	}
+
+	wg.Wait()
+
+	var buf bytes.Buffer
+
+	for _, resp := range resps {
+		if resp == nil {
+			continue
+		}
+
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+
+		buf.Write(resp)
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	buf.WriteByte(']')
+
+	return buf.Bytes()
+}
+
+func (d *dispatcher) handleOne(ctxt context.Context, p *peer, data []byte) []byte {
+	var req Request
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return marshal(errorResponse(nil, newError(CodeParseError, "%s", err)))
+		}
+
+		return marshal(errorResponse(nil, newError(CodeInvalidRequest, "%s", err)))
+	}
+
+	if req.Version != Version || req.Method == "" {
+		return marshal(errorResponse(req.Id, newError(CodeInvalidRequest, "invalid request")))
+	}
+
+	info := &core.CallInfo{Codec: p.codec, Peer: p.addr, RequestSize: len(data), TLS: p.tls}
+
+	result, err := d.call(core.WithIncomingCallInfo(ctxt, info), &req)
+
+	if req.IsNotification() {
+		info.Complete(0)
+
+		return nil
+	}
+
+	var resp *Response
+
+	if err != nil {
+		resp = errorResponse(req.Id, err)
+	} else if data, err := json.Marshal(result); err != nil {
+		resp = errorResponse(req.Id, core.NewStatus(core.CodeInternal, "fail to encode response, %s", err))
+	} else {
+		resp = &Response{Version: Version, Result: data, Id: req.Id}
+	}
+
+	data = marshal(resp)
+
+	info.Complete(len(data))
+
+	return data
+}
+
+// Call the service with the params of the request, positional as a list, or named as an object.
+func (d *dispatcher) call(ctxt context.Context, req *Request) (interface{}, error) {
+	call := &core.Call{
+		Service:  d.Name,
+		Method:   req.Method,
+		Encoding: core.JsonEncoding,
+	}
+
+	params := bytes.TrimLeft(req.Params, " \t\r\n")
+
+	switch {
+	case len(params) == 0:
+	case params[0] == '[':
+		var args []json.RawMessage
+
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, newError(CodeInvalidParams, "%s", err)
+		}
+
+		// a single argument is encoded as itself
+		switch len(args) {
+		case 0:
+		case 1:
+			call.Payload = args[0]
+		default:
+			call.Payload = params
+		}
+
+	case params[0] == '{':
+		call.Payload, call.Named = params, true
+
+	default:
+		return nil, newError(CodeInvalidParams, "params must be an array or an object")
+	}
+
+	return d.Service.Apply(ctxt, call).Get()
+}
+
+func marshal(resp *Response) []byte {
+	data, _ := json.Marshal(resp)
+
+	return data
+}
+
+// A httpServerDispatcher serves the JSON-RPC requests POSTed over HTTP.
+type httpServerDispatcher struct {
+	*nethttp.Server
+	dispatcher
+
+	CertFile, KeyFile string
+}
+
+var _ = (core.Server)((*httpServerDispatcher)(nil))
+
+func (d *httpServerDispatcher) Serve(ctxt context.Context) error {
+	done := make(chan error, 1)
+
+	go func() {
+		if d.TLSConfig != nil {
+			done <- d.ListenAndServeTLS(d.CertFile, d.KeyFile)
+		} else {
+			done <- d.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctxt.Done():
+		d.Shutdown(context.Background())
+
+		return ctxt.Err()
+	}
+}
+
+func (d *httpServerDispatcher) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		nethttp.Error(w, "method not allowed", nethttp.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		d.write(w, marshal(errorResponse(nil, newError(CodeParseError, "fail to read request, %s", err))))
+		return
+	}
+
+	h := http.HeaderFromHttp(r.Header)
+
+	ctxt, cancel, err := core.ExtractDeadline(r.Context(), h)
+
+	if err != nil {
+		d.write(w, marshal(errorResponse(nil, err)))
+		return
+	}
+
+	defer cancel()
+
+	codec := "jsonrpc+http"
+
+	if r.TLS != nil {
+		codec = "jsonrpc+https"
+	}
+
+	d.write(w, d.handle(core.WithIncomingHeader(ctxt, h), &peer{codec, r.RemoteAddr, r.TLS}, data))
+}
+
+func (d *httpServerDispatcher) write(w nethttp.ResponseWriter, data []byte) {
+	if data == nil {
+		w.WriteHeader(nethttp.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// A tcpServerDispatcher serves the JSON-RPC requests as lines over TCP connections.
+type tcpServerDispatcher struct {
+	dispatcher
+	netserver.Server
+
+	Addr              net.Addr
+	TLSConfig         *tls.Config
+	CertFile, KeyFile string
+}
+
+var _ = (core.Server)((*tcpServerDispatcher)(nil))
+var _ = (core.ConnectionLister)((*tcpServerDispatcher)(nil))
+
+func (d *tcpServerDispatcher) Serve(ctxt context.Context) error {
+	l, err := netserver.Listen(d.Addr, d.TLSConfig, d.CertFile, d.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	return d.Server.Serve(ctxt, d.Name, l, d.serveConn)
+}
+
+func (d *tcpServerDispatcher) serveConn(ctxt context.Context, conn net.Conn) {
+	// the calls in flight are canceled once the client has gone, or the grace period of the shutdown elapsed
+	ctxt, cancel := context.WithCancel(ctxt)
+	defer cancel()
+
+	w := &lineWriter{conn: conn}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, MaxLineSize)
+
+	p := &peer{codec: "jsonrpc+" + d.Addr.Network(), addr: conn.RemoteAddr().String()}
+
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if tc, ok := conn.(*tls.Conn); ok && p.tls == nil {
+			// the handshake has completed once a line was read
+			cs := tc.ConnectionState()
+			p.tls = &cs
+		}
+
+		if !d.Begin() {
+			w.write(marshal(errorResponse(nil, errShuttingDown)))
+			continue
+		}
+
+		go func() {
+			defer d.Done()
+
+			if resp := d.handle(ctxt, p, line); resp != nil {
+				w.write(resp)
+			}
+		}()
+	}
+}
+
+type lineWriter struct {
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func (w *lineWriter) write(data []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, err := w.conn.Write(append(data, '\n'))
+
+	return err
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+const (
+	ServerNamespace = "bucky_server"
+	ClientNamespace = "bucky_client"
+
+	// The method label of the served calls whose method can't be resolved.
+	UnknownMethod = "unknown"
+)
+
+// A MetricsFilter records the rate, errors and duration of the calls,
+// the calls in flight and the sizes of the requests and responses reported by the codecs.
+//
+//	<namespace>_requests_total{service, method, codec, status}
+//	<namespace>_request_duration_seconds{service, method, codec}
+//	<namespace>_requests_in_flight{service, method}
+//	<namespace>_request_size_bytes{service, method, codec}
+//	<namespace>_response_size_bytes{service, method, codec}
+//
+// On the server side, the method is named as the metadata of the service names it,
+// so that the clients can't create unbounded series, the unknown methods are labeled UnknownMethod.
+type MetricsFilter struct {
+	// The name of the service when the calls don't carry it, such as on the client side.
+	Service string
+
+	client        bool
+	requests      *CounterVec
+	duration      *HistogramVec
+	inFlight      *GaugeVec
+	requestBytes  *HistogramVec
+	responseBytes *HistogramVec
+}
+
+var _ = (core.Filter)((*MetricsFilter)(nil))
+
+// Return a server filter recording its metrics to the registry, with the latency buckets in seconds.
+func NewServerFilter(registry *Registry, buckets ...float64) *MetricsFilter {
+	return newMetricsFilter(registry, ServerNamespace, false, buckets)
+}
+
+// Return a client filter recording its metrics to the registry, with the latency buckets in seconds.
+func NewClientFilter(registry *Registry, service string, buckets ...float64) *MetricsFilter {
+	f := newMetricsFilter(registry, ClientNamespace, true, buckets)
+
+	f.Service = service
+
+	return f
+}
+
+func newMetricsFilter(registry *Registry, namespace string, client bool, buckets []float64) *MetricsFilter {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	return &MetricsFilter{
+		client: client,
+		requests: registry.NewCounterVec(namespace+"_requests_total",
+			"Total number of calls by status.", "service", "method", "codec", "status"),
+		duration: registry.NewHistogramVec(namespace+"_request_duration_seconds",
+			"Duration of the calls in seconds.", buckets, "service", "method", "codec"),
+		inFlight: registry.NewGaugeVec(namespace+"_requests_in_flight",
+			"Number of calls in flight.", "service", "method"),
+		requestBytes: registry.NewHistogramVec(namespace+"_request_size_bytes",
+			"Size of the encoded requests in bytes.", DefaultSizeBuckets, "service", "method", "codec"),
+		responseBytes: registry.NewHistogramVec(namespace+"_response_size_bytes",
+			"Size of the encoded responses in bytes.", DefaultSizeBuckets, "service", "method", "codec"),
+	}
+}
+
+func (f *MetricsFilter) Apply(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+	name, method := f.Service, core.MethodOf(req)
+
+	if call, ok := req.(*core.Call); ok && call.Service != "" {
+		name = call.Service
+	}
+
+	if !f.client {
+		method = canonicalMethod(ctxt, service, method)
+	}
+
+	var info *core.CallInfo
+
+	if f.client {
+		ctxt, info = core.EnsureOutgoingCallInfo(ctxt)
+	} else {
+		info, _ = core.IncomingCallInfo(ctxt)
+	}
+
+	codec := "unknown"
+
+	if info != nil {
+		info.OnComplete(func(info *core.CallInfo) {
+			f.requestBytes.With(name, method, info.Codec).Observe(float64(info.RequestSize))
+			f.responseBytes.With(name, method, info.Codec).Observe(float64(info.ResponseSize()))
+		})
+	}
+
+	inFlight := f.inFlight.With(name, method)
+	inFlight.Inc()
+
+	started := time.Now()
+
+	return core.Finally(service.Apply(ctxt, req), func(result interface{}, err error) {
+		inFlight.Dec()
+
+		if info != nil && info.Codec != "" {
+			codec = info.Codec
+		}
+
+		f.requests.With(name, method, codec, core.CodeOf(err).String()).Inc()
+		f.duration.With(name, method, codec).Observe(time.Since(started).Seconds())
+	})
+}
+
+// Return the name of a served method as its metadata names it, prefixed by its service when it's served by a catalog,
+// such as `counter.v1/Next` on a mux, or UnknownMethod if it can't be resolved.
+func canonicalMethod(ctxt context.Context, service core.Service, method string) string {
+	if md := rpc.MetadataOf(ctxt); md != nil {
+		if m, ok := md.Method(method); ok {
+			return m.Name
+		}
+
+		return UnknownMethod
+	}
+
+	md, m, ok := rpc.Resolve(service, method)
+
+	if !ok {
+		return UnknownMethod
+	}
+
+	if rpc.Describe(service) == nil {
+		return md.Name() + "/" + m.Name
+	}
+
+	return m.Name
+}
@@ -0,0 +1,350 @@
+// Package metrics collects counters, gauges and histograms,
+// exposed in the Prometheus text format without depending on its client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// The default latency buckets, in seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// The default size buckets, from 64 bytes to 16 MB.
+	DefaultSizeBuckets = ExponentialBuckets(64, 4, 10)
+
+	DefaultRegistry = NewRegistry()
+)
+
+// Return count buckets, the first one is start and the next ones are multiplied by factor.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+
+	return buckets
+}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// A Registry holds the metric families exposed together.
+type Registry struct {
+	lock     sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Return the family of the given name, or register a new one,
+// it panics if the family was registered with another type or labels.
+func (r *Registry) family(name, help string, typ metricType, buckets []float64, labels []string) *family {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || strings.Join(f.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Errorf("metric `%s` was registered as %s with labels %v", name, f.typ, f.labels))
+		}
+
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		buckets: buckets,
+		labels:  labels,
+		metrics: make(map[string]*metric),
+	}
+
+	r.families[name] = f
+
+	return f
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.family(name, help, counterType, nil, labels)}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.family(name, help, gaugeType, nil, labels)}
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+
+	sort.Float64s(buckets)
+
+	return &HistogramVec{r.family(name, help, histogramType, buckets, labels)}
+}
+
+// Write the metrics in the Prometheus text format, sorted by name and labels.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.lock.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Return a handler serving the metrics, for example on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		r.WritePrometheus(w)
+	})
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	buckets []float64
+	labels  []string
+
+	lock    sync.RWMutex
+	metrics map[string]*metric
+}
+
+type metric struct {
+	values []string
+
+	// the value of a counter or gauge, or the sum of a histogram, as float64 bits
+	bits uint64
+
+	// the non cumulative counts of the histogram buckets, the last one is +Inf
+	counts []uint64
+}
+
+func (f *family) with(values []string) *metric {
+	if len(values) != len(f.labels) {
+		panic(fmt.Errorf("metric `%s` expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.lock.RLock()
+	m, ok := f.metrics[key]
+	f.lock.RUnlock()
+
+	if ok {
+		return m
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if m, ok = f.metrics[key]; !ok {
+		m = &metric{values: append([]string(nil), values...)}
+
+		if f.typ == histogramType {
+			m.counts = make([]uint64, len(f.buckets)+1)
+		}
+
+		f.metrics[key] = m
+	}
+
+	return m
+}
+
+func (m *metric) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&m.bits)
+
+		if atomic.CompareAndSwapUint64(&m.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (m *metric) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&m.bits))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (f *family) write(w io.Writer) {
+	f.lock.RLock()
+	keys := make([]string, 0, len(f.metrics))
+	for key := range f.metrics {
+		keys = append(keys, key)
+	}
+	f.lock.RUnlock()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.typ)
+
+	for _, key := range keys {
+		f.lock.RLock()
+		m := f.metrics[key]
+		f.lock.RUnlock()
+
+		if f.typ != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, m.values), formatFloat(m.value()))
+
+			continue
+		}
+
+		var count uint64
+
+		for i := range m.counts {
+			count += atomic.LoadUint64(&m.counts[i])
+
+			bound := math.Inf(1)
+
+			if i < len(f.buckets) {
+				bound = f.buckets[i]
+			}
+
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, m.values, "le", formatFloat(bound)), count)
+		}
+
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labels, m.values), formatFloat(m.value()))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labels, m.values), count)
+	}
+}
+
+// A CounterVec is a family of counters partitioned by their label values.
+type CounterVec struct{ *family }
+
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{v.with(values)}
+}
+
+// A Counter only goes up.
+type Counter struct{ m *metric }
+
+func (c *Counter) Inc() { c.m.add(1) }
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic(fmt.Errorf("counter cannot decrease"))
+	}
+
+	c.m.add(v)
+}
+
+func (c *Counter) Value() float64 { return c.m.value() }
+
+// A GaugeVec is a family of gauges partitioned by their label values.
+type GaugeVec struct{ *family }
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{v.with(values)}
+}
+
+// A Gauge goes up and down.
+type Gauge struct{ m *metric }
+
+func (g *Gauge) Set(v float64)  { atomic.StoreUint64(&g.m.bits, math.Float64bits(v)) }
+func (g *Gauge) Add(v float64)  { g.m.add(v) }
+func (g *Gauge) Inc()           { g.m.add(1) }
+func (g *Gauge) Dec()           { g.m.add(-1) }
+func (g *Gauge) Value() float64 { return g.m.value() }
+
+// A HistogramVec is a family of histograms partitioned by their label values.
+type HistogramVec struct{ *family }
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{v.family, v.with(values)}
+}
+
+// A Histogram counts the observations in buckets.
+type Histogram struct {
+	f *family
+	m *metric
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.f.buckets, v)
+
+	atomic.AddUint64(&h.m.counts[i], 1)
+
+	h.m.add(v)
+}
+
+// Return the number of observations.
+func (h *Histogram) Count() (count uint64) {
+	for i := range h.m.counts {
+		count += atomic.LoadUint64(&h.m.counts[i])
+	}
+
+	return
+}
+
+// Return the sum of the observations.
+func (h *Histogram) Sum() float64 { return h.m.value() }
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+	"github.com/flier/bucky/transport"
+)
+
+func exposition(r *Registry) string {
+	var buf bytes.Buffer
+
+	if err := r.WritePrometheus(&buf); err != nil {
+		panic(err)
+	}
+
+	return buf.String()
+}
+
+func TestRegistry(t *testing.T) {
+	Convey("expose metrics in the Prometheus text format", t, func() {
+		r := NewRegistry()
+
+		r.NewCounterVec("calls_total", "Total calls.", "method").With(`say "hi"`).Add(3)
+		r.NewGaugeVec("in_flight", "Calls in flight.").With().Set(2)
+
+		h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "method").With("echo")
+
+		h.Observe(0.05)
+		h.Observe(0.5)
+		h.Observe(5)
+
+		So(h.Count(), ShouldEqual, 3)
+		So(h.Sum(), ShouldEqual, 5.55)
+
+		So(exposition(r), ShouldEqual, `# HELP calls_total Total calls.
+# TYPE calls_total counter
+calls_total{method="say \"hi\""} 3
+# HELP in_flight Calls in flight.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="echo",le="0.1"} 1
+latency_seconds_bucket{method="echo",le="1"} 2
+latency_seconds_bucket{method="echo",le="+Inf"} 3
+latency_seconds_sum{method="echo"} 5.55
+latency_seconds_count{method="echo"} 3
+`)
+
+		Convey("register a family twice", func() {
+			So(r.NewCounterVec("calls_total", "Total calls.", "method").With(`say "hi"`).Value(), ShouldEqual, 3)
+			So(func() { r.NewGaugeVec("calls_total", "Total calls.", "method") }, ShouldPanic)
+			So(func() { r.NewCounterVec("calls_total", "Total calls.").With() }, ShouldPanic)
+		})
+	})
+}
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return strings.ToUpper(s) }
+
+func TestMetricsFilter(t *testing.T) {
+	Convey("record the metrics of the calls over TCP", t, func() {
+		r := NewRegistry()
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{
+				Name:         "echo",
+				Addr:         addr,
+				CodecFactory: transport.TcpCodec,
+				Filters:      []core.Filter{NewServerFilter(r)},
+			}).Build(rpc.NativeFactory.Build(echoService{}))
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{
+			Uri:          uri,
+			CodecFactory: transport.TcpCodec,
+			Filters:      []core.Filter{NewClientFilter(r, "echo", 0.1, 1)},
+		}).Build()
+
+		for i := 0; i < 100; i++ {
+			if _, err = client.Apply(ctxt, &core.Call{Method: "Echo", Args: []interface{}{"hello"}}).Get(); core.CodeOf(err) != core.CodeUnavailable {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		So(err, ShouldBeNil)
+
+		_, err = client.Apply(ctxt, &core.Call{Method: "Unknown"}).Get()
+
+		So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+
+		text := exposition(r)
+
+		So(text, ShouldContainSubstring, `bucky_server_requests_total{service="echo",method="Echo",codec="tcp",status="OK"} 1`)
+		So(text, ShouldContainSubstring, `bucky_server_requests_total{service="echo",method="unknown",codec="tcp",status="UNIMPLEMENTED"} 1`)
+		So(text, ShouldContainSubstring, `bucky_client_requests_total{service="echo",method="Echo",codec="tcp",status="OK"} 1`)
+		So(text, ShouldContainSubstring, `bucky_client_request_duration_seconds_bucket{service="echo",method="Echo",codec="tcp",le="+Inf"} 1`)
+		So(text, ShouldContainSubstring, `bucky_server_requests_in_flight{service="echo",method="Echo"} 0`)
+		So(text, ShouldContainSubstring, `bucky_server_request_size_bytes_sum{service="echo",method="Echo",codec="tcp"} 7`)
+		So(text, ShouldContainSubstring, `bucky_server_response_size_bytes_sum{service="echo",method="Echo",codec="tcp"} 7`)
+		So(text, ShouldContainSubstring, `bucky_client_response_size_bytes_sum{service="echo",method="Echo",codec="tcp"} 7`)
+
+		Convey("label the served methods with their canonical name", func() {
+			_, err := client.Apply(ctxt, &core.Call{Method: "eCHO", Args: []interface{}{"hello"}}).Get()
+
+			So(err, ShouldBeNil)
+
+			_, err = client.Apply(ctxt, &core.Call{Method: "Random"}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+
+			text := exposition(r)
+
+			So(text, ShouldContainSubstring, `bucky_server_requests_total{service="echo",method="Echo",codec="tcp",status="OK"} 2`)
+			So(text, ShouldContainSubstring, `bucky_server_requests_total{service="echo",method="unknown",codec="tcp",status="UNIMPLEMENTED"} 2`)
+			So(text, ShouldNotContainSubstring, `bucky_server_requests_total{service="echo",method="eCHO"`)
+			So(text, ShouldNotContainSubstring, `bucky_server_requests_total{service="echo",method="Random"`)
+
+			mux := rpc.NewMux()
+			mux.Handle("echo", "v1", rpc.NativeFactory.Build(echoService{}))
+
+			So(canonicalMethod(ctxt, mux, "ECHO.v1/echo"), ShouldEqual, "echo.v1/Echo")
+			So(canonicalMethod(ctxt, mux, "echo.v2/echo"), ShouldEqual, UnknownMethod)
+		})
+	})
+}
@@ -0,0 +1,336 @@
+// Package openapi generates the OpenAPI 3 document of the services served over HTTP,
+// from the metadata of their methods and their HTTP routes, and serves it as the /openapi.json path.
+//
+// The schemas of the arguments and the results are rendered from the Go types, by their fields and their json tags,
+// and the error responses are the statuses of the failed calls.
+// The streaming methods are served over WebSocket, and aren't described.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	bhttp "github.com/flier/bucky/http"
+	"github.com/flier/bucky/reflection"
+	"github.com/flier/bucky/rpc"
+)
+
+const (
+	Version = "3.1.0"
+
+	// The method serving the document, as the /openapi.json path over HTTP.
+	DocumentMethod = "openapi.json"
+
+	schemasRef   = "#/components/schemas/"
+	responsesRef = "#/components/responses/"
+	jsonType     = "application/json"
+)
+
+type Schema = reflection.Schema
+
+// A Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       *Info               `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// A PathItem is the operations of a path, keyed by their lower case HTTP verb.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// A Parameter is a path or a query parameter of an operation.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// A Response is the response of an operation, or a reference to a shared response.
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas   map[string]*Schema   `json:"schemas,omitempty"`
+	Responses map[string]*Response `json:"responses,omitempty"`
+}
+
+// Return the document of a service, or of the services served by a catalog, whose paths are prefixed by their name.
+func New(title, version string, service core.Service) *Document {
+	g := &generator{
+		schemas: reflection.NewSchemas(schemasRef),
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    &Info{title, version},
+			Paths:   make(map[string]PathItem),
+		},
+		responses: make(map[string]*Response),
+	}
+
+	if catalog, ok := rpc.CatalogOf(service); ok {
+		for _, md := range catalog.Services() {
+			g.addService(md.Name(), md)
+		}
+	} else if md := rpc.Describe(service); md != nil {
+		g.addService("", md)
+	}
+
+	g.doc.Components = &Components{Schemas: g.schemas.Definitions, Responses: g.responses}
+
+	return g.doc
+}
+
+type generator struct {
+	schemas   *reflection.Schemas
+	doc       *Document
+	responses map[string]*Response
+}
+
+func (g *generator) addService(namespace string, md rpc.Metadata) {
+	for _, m := range md.Methods() {
+		if m.IsStreaming() {
+			continue
+		}
+
+		op := &Operation{OperationID: m.Name, Tags: []string{md.Name()}, Responses: make(map[string]*Response)}
+
+		verb, path, routed := bhttp.RouteOf(m)
+
+		if routed {
+			g.addRouteParams(op, verb, path, m)
+		} else {
+			verb, path = "POST", "/"+strings.ToLower(m.Name)
+
+			g.addArgs(op, m)
+		}
+
+		if namespace != "" {
+			op.OperationID = namespace + "." + m.Name
+			path = "/" + namespace + "/" + strings.TrimPrefix(path, "/")
+		}
+
+		g.addResponses(op, m)
+
+		if g.doc.Paths[path] == nil {
+			g.doc.Paths[path] = make(PathItem)
+		}
+
+		g.doc.Paths[path][strings.ToLower(verb)] = op
+	}
+}
+
+// Add the arguments of a call to `POST /method`, which are an array unless the method has a single parameter.
+func (g *generator) addArgs(op *Operation, m *rpc.Method) {
+	switch len(m.In) {
+	case 0:
+	case 1:
+		op.RequestBody = jsonBody(g.schemas.SchemaOf(m.In[0]))
+	default:
+		op.RequestBody = jsonBody(g.schemas.TupleOf(m.In))
+	}
+}
+
+// Add the arguments of a routed call, which are named by the path parameters and the query parameters,
+// and by the fields of the body when it's an object.
+func (g *generator) addRouteParams(op *Operation, verb, path string, m *rpc.Method) {
+	inPath := make(map[string]bool)
+
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := segment[1 : len(segment)-1]
+
+			inPath[strings.ToLower(name)] = true
+
+			schema := &Schema{Type: "string"}
+
+			if i := paramIndex(m, name); i >= 0 {
+				schema = g.schemas.SchemaOf(m.In[i])
+			}
+
+			op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		}
+	}
+
+	if len(m.Params) != len(m.In) {
+		// the body of a single unnamed parameter is its value
+		if len(m.In) == 1 && hasBody(verb) {
+			op.RequestBody = jsonBody(g.schemas.SchemaOf(m.In[0]))
+		}
+
+		return
+	}
+
+	body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i, name := range m.Params {
+		if inPath[strings.ToLower(name)] {
+			continue
+		}
+
+		if hasBody(verb) {
+			body.Properties[name] = g.schemas.SchemaOf(m.In[i])
+		} else {
+			op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "query", Schema: g.schemas.SchemaOf(m.In[i])})
+		}
+	}
+
+	if len(body.Properties) > 0 {
+		op.RequestBody = &RequestBody{Content: jsonContent(body)}
+	}
+}
+
+func (g *generator) addResponses(op *Operation, m *rpc.Method) {
+	ok := &Response{Description: "OK"}
+
+	switch len(m.Out) {
+	case 0:
+	case 1:
+		ok.Content = jsonContent(g.schemas.SchemaOf(m.Out[0]))
+	default:
+		ok.Content = jsonContent(g.schemas.TupleOf(m.Out))
+	}
+
+	op.Responses["200"] = ok
+
+	if len(m.In) > 0 {
+		g.addError(op, http.StatusBadRequest)
+	}
+
+	if len(m.Options.Roles) > 0 {
+		g.addError(op, http.StatusUnauthorized)
+		g.addError(op, http.StatusForbidden)
+	}
+
+	if m.Options.Timeout > 0 {
+		g.addError(op, http.StatusGatewayTimeout)
+	}
+
+	op.Responses["default"] = g.errorResponse("Error", "The status of a failed call.")
+}
+
+// Add the error response of an HTTP status, which describes the status codes it's mapped from.
+func (g *generator) addError(op *Operation, status int) {
+	var codes []string
+
+	for code := core.CodeOK; code <= core.CodeUnauthenticated; code++ {
+		if code != core.CodeOK && bhttp.HttpStatusOf(code) == status {
+			codes = append(codes, code.String())
+		}
+	}
+
+	name := strings.Replace(http.StatusText(status), " ", "", -1)
+
+	op.Responses[strconv.Itoa(status)] = g.errorResponse(name, "The "+strings.Join(codes, " or ")+" status.")
+}
+
+// Return a reference to a shared error response, whose content is a status.
+func (g *generator) errorResponse(name, description string) *Response {
+	if _, ok := g.responses[name]; !ok {
+		g.responses[name] = &Response{Description: description, Content: jsonContent(g.statusSchema())}
+	}
+
+	return &Response{Ref: responsesRef + name}
+}
+
+func (g *generator) statusSchema() *Schema {
+	schema := g.schemas.SchemaOf(reflect.TypeOf(core.Status{}))
+
+	status := g.schemas.Definitions[strings.TrimPrefix(schema.Ref, schemasRef)]
+
+	if code := status.Properties["code"]; code.Enum == nil {
+		var names []string
+
+		for c := core.CodeOK; c <= core.CodeUnauthenticated; c++ {
+			code.Enum = append(code.Enum, int(c))
+			names = append(names, strconv.Itoa(int(c))+" "+c.String())
+		}
+
+		code.Description = "The status code, " + strings.Join(names, ", ") + "."
+		status.Required = []string{"code", "message"}
+	}
+
+	return schema
+}
+
+// Return the index of a named parameter, or -1.
+func paramIndex(m *rpc.Method, name string) int {
+	for i, param := range m.Params {
+		if strings.EqualFold(param, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func hasBody(verb string) bool {
+	switch verb {
+	case "GET", "HEAD", "DELETE":
+		return false
+	default:
+		return true
+	}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: jsonContent(schema)}
+}
+
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{jsonType: {schema}}
+}
+
+// Return a server filter answering the `openapi.json` calls with the document of the service it's applied to,
+// served as the /openapi.json path by the HTTP codec.
+func Filter(title, version string) core.Filter {
+	var once sync.Once
+	var doc *Document
+
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		if !strings.EqualFold(core.MethodOf(req), DocumentMethod) {
+			return service.Apply(ctxt, req)
+		}
+
+		once.Do(func() { doc = New(title, version, service) })
+
+		return core.Resolved(doc)
+	})
+}
+
+// Install the OpenAPI document on the server, titled by the name of the server.
+func Install(b *core.ServerBuilder, version string) {
+	b.Filters = append([]core.Filter{Filter(b.Name, version)}, b.Filters...)
+}
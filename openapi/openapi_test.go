@@ -0,0 +1,132 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+type User struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+type userService struct{}
+
+func (s *userService) Get(id int64) (*User, error) { return &User{ID: id}, nil }
+
+func (s *userService) Search(name string, limit int) []*User { return nil }
+
+func (s *userService) Rename(id int64, name string) error { return nil }
+
+func (s *userService) Count() int { return 0 }
+
+func (s *userService) Watch(id int64, out chan<- *User) {}
+
+func (s *userService) MethodOptions() map[string]*rpc.MethodOptions {
+	return map[string]*rpc.MethodOptions{
+		"Get":    {HttpMethod: "GET", HttpPath: "/users/{id}", Timeout: time.Second},
+		"Search": {HttpMethod: "GET", HttpPath: "/users"},
+		"Rename": {HttpMethod: "PUT", HttpPath: "/users/{id}", Roles: []string{"admin"}},
+	}
+}
+
+func (s *userService) ParamNames() map[string][]string {
+	return map[string][]string{"Get": {"id"}, "Search": {"name", "limit"}, "Rename": {"id", "name"}}
+}
+
+func TestOpenAPI(t *testing.T) {
+	Convey("generate the OpenAPI document of a service", t, func() {
+		doc := New("users", "1.0", rpc.NativeFactory.Build(&userService{}))
+
+		So(doc.OpenAPI, ShouldEqual, Version)
+		So(doc.Info, ShouldResemble, &Info{"users", "1.0"})
+		So(doc.Paths, ShouldHaveLength, 3)
+		So(doc.Components.Schemas, ShouldContainKey, "User")
+		So(doc.Components.Schemas, ShouldContainKey, "Status")
+
+		Convey("describe the routed methods", func() {
+			get := doc.Paths["/users/{id}"]["get"]
+
+			So(get.OperationID, ShouldEqual, "Get")
+			So(get.Parameters, ShouldResemble, []*Parameter{{"id", "path", true, &Schema{Type: "integer", Format: "int64"}}})
+			So(get.RequestBody, ShouldBeNil)
+			So(get.Responses["200"].Content["application/json"].Schema, ShouldResemble, &Schema{Ref: "#/components/schemas/User"})
+			So(get.Responses["504"], ShouldResemble, &Response{Ref: "#/components/responses/GatewayTimeout"})
+
+			search := doc.Paths["/users"]["get"]
+
+			So(search.Parameters, ShouldHaveLength, 2)
+			So(search.Parameters[1], ShouldResemble, &Parameter{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Format: "int64"}})
+
+			rename := doc.Paths["/users/{id}"]["put"]
+
+			So(rename.RequestBody.Content["application/json"].Schema.Properties, ShouldResemble, map[string]*Schema{"name": {Type: "string"}})
+			So(rename.Responses["200"].Content, ShouldBeNil)
+			So(rename.Responses, ShouldContainKey, "401")
+			So(rename.Responses, ShouldContainKey, "403")
+		})
+
+		Convey("describe the other methods as `POST /method`", func() {
+			count := doc.Paths["/count"]["post"]
+
+			So(count.RequestBody, ShouldBeNil)
+			So(count.Responses, ShouldNotContainKey, "400")
+			So(count.Responses["default"], ShouldResemble, &Response{Ref: "#/components/responses/Error"})
+
+			So(doc.Paths, ShouldNotContainKey, "/watch")
+		})
+
+		Convey("describe the errors by the status model", func() {
+			So(doc.Components.Responses["BadRequest"].Description, ShouldEqual, "The INVALID_ARGUMENT or FAILED_PRECONDITION or OUT_OF_RANGE status.")
+			So(doc.Components.Schemas["Status"].Properties["code"].Enum, ShouldHaveLength, 17)
+		})
+
+		Convey("prefix the paths of the services of a mux", func() {
+			mux := rpc.NewMux()
+			mux.Handle("users", "v1", rpc.NativeFactory.Build(&userService{}))
+
+			doc := New("users", "1.0", mux)
+
+			So(doc.Paths, ShouldContainKey, "/users.v1/users/{id}")
+			So(doc.Paths["/users.v1/count"]["post"].OperationID, ShouldEqual, "users.v1.Count")
+		})
+	})
+
+	Convey("serve the OpenAPI document over HTTP", t, func() {
+		b := &core.ServerBuilder{Name: "users"}
+
+		Install(b, "1.0")
+
+		codec := http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "users", Addr: &net.TCPAddr{}})
+
+		service := core.WithFilters(rpc.NativeFactory.Build(&userService{}), b.Filters...)
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, service).(nethttp.Handler))
+		defer server.Close()
+
+		resp, err := nethttp.Get(server.URL + "/openapi.json")
+
+		So(err, ShouldBeNil)
+
+		defer resp.Body.Close()
+
+		So(resp.StatusCode, ShouldEqual, nethttp.StatusOK)
+
+		var doc Document
+
+		So(json.NewDecoder(resp.Body).Decode(&doc), ShouldBeNil)
+		So(doc.Info.Title, ShouldEqual, "users")
+		So(doc.Paths["/users/{id}"], ShouldContainKey, "get")
+	})
+}
@@ -0,0 +1,247 @@
+// Package reflection serves the descriptions of the services of a server,
+// so the generic tools, such as a command line caller or a UI, may call them without compiled stubs.
+//
+// The reflection service is served as the `bucky.reflection.v1` namespace,
+// such as the `bucky.reflection.v1.ListServices` method over TCP or the `/bucky.reflection.v1/listservices` path over HTTP,
+//
+//	ListServices() []string                                   the names of the services
+//	DescribeService(name string) (*ServiceDescriptor, error)  the methods of a service, with their JSON Schemas
+//	Describe() []*ServiceDescriptor                           the methods of all the services
+package reflection
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/rpc"
+)
+
+// The namespace of the reflection methods.
+const ServiceName = "bucky.reflection.v1"
+
+// A ServiceDescriptor describes the methods of a service, its schemas refer to its definitions.
+type ServiceDescriptor struct {
+	Name        string              `json:"name"`
+	Methods     []*MethodDescriptor `json:"methods"`
+	Definitions map[string]*Schema  `json:"$defs,omitempty"`
+}
+
+// A MethodDescriptor describes the signature and the options of a method.
+//
+// The arguments are sent as an array in the order of the parameters, or as the value of a single parameter,
+// or as an object keyed by the names of the parameters, when they're named.
+type MethodDescriptor struct {
+	Name   string   `json:"name"`
+	Params []*Param `json:"params,omitempty"`
+	Result *Schema  `json:"result,omitempty"` // the tuple of the results when there are many
+
+	// The schemas of the streamed messages.
+	ClientStream *Schema `json:"clientStream,omitempty"`
+	ServerStream *Schema `json:"serverStream,omitempty"`
+
+	Timeout    string     `json:"timeout,omitempty"`
+	Idempotent bool       `json:"idempotent,omitempty"`
+	Http       *HttpRoute `json:"http,omitempty"`
+	Roles      []string   `json:"roles,omitempty"`
+}
+
+// A Param is a parameter of a method, unnamed unless the service named them.
+type Param struct {
+	Name   string  `json:"name,omitempty"`
+	Schema *Schema `json:"schema"`
+}
+
+// The HTTP route of a method.
+type HttpRoute struct {
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// Return the descriptor of a service from its metadata.
+func DescribeService(md rpc.Metadata) *ServiceDescriptor {
+	schemas := NewSchemas(DefinitionsRef)
+
+	desc := &ServiceDescriptor{Name: md.Name(), Methods: []*MethodDescriptor{}}
+
+	for _, m := range md.Methods() {
+		desc.Methods = append(desc.Methods, describeMethod(schemas, m))
+	}
+
+	if len(schemas.Definitions) > 0 {
+		desc.Definitions = schemas.Definitions
+	}
+
+	return desc
+}
+
+func describeMethod(schemas *Schemas, m *rpc.Method) *MethodDescriptor {
+	desc := &MethodDescriptor{Name: m.Name}
+
+	for i, t := range m.In {
+		param := &Param{Schema: schemas.SchemaOf(t)}
+
+		if len(m.Params) == len(m.In) {
+			param.Name = m.Params[i]
+		}
+
+		desc.Params = append(desc.Params, param)
+	}
+
+	switch len(m.Out) {
+	case 0:
+	case 1:
+		desc.Result = schemas.SchemaOf(m.Out[0])
+	default:
+		desc.Result = schemas.TupleOf(m.Out)
+	}
+
+	if m.Recv != nil {
+		desc.ClientStream = schemas.SchemaOf(m.Recv)
+	}
+
+	if m.Send != nil {
+		desc.ServerStream = schemas.SchemaOf(m.Send)
+	}
+
+	if opts := m.Options; opts != nil {
+		if opts.Timeout > 0 {
+			desc.Timeout = opts.Timeout.String()
+		}
+
+		desc.Idempotent = opts.Idempotent
+		desc.Roles = opts.Roles
+
+		if opts.HttpMethod != "" || opts.HttpPath != "" {
+			desc.Http = &HttpRoute{strings.ToUpper(opts.HttpMethod), opts.HttpPath}
+		}
+	}
+
+	return desc
+}
+
+// The reflection of the services behind a filter, the services of a catalog or the service itself.
+type reflectionService struct {
+	service core.Service
+
+	once     sync.Once
+	services []*ServiceDescriptor
+}
+
+func (s *reflectionService) describe() []*ServiceDescriptor {
+	s.once.Do(func() {
+		s.services = []*ServiceDescriptor{}
+
+		for _, md := range rpc.ServicesOf(s.service) {
+			s.services = append(s.services, DescribeService(md))
+		}
+	})
+
+	return s.services
+}
+
+func (s *reflectionService) ListServices() []string {
+	services := s.describe()
+
+	names := make([]string, len(services))
+
+	for i, desc := range services {
+		names[i] = desc.Name
+	}
+
+	return names
+}
+
+func (s *reflectionService) DescribeService(name string) (*ServiceDescriptor, error) {
+	for _, desc := range s.describe() {
+		if strings.EqualFold(desc.Name, name) {
+			return desc, nil
+		}
+	}
+
+	return nil, core.NewStatus(core.CodeNotFound, "unknown service `%s`", name)
+}
+
+func (s *reflectionService) Describe() []*ServiceDescriptor {
+	return s.describe()
+}
+
+func (s *reflectionService) MethodOptions() map[string]*rpc.MethodOptions {
+	options := make(map[string]*rpc.MethodOptions)
+
+	for _, name := range []string{"ListServices", "DescribeService", "Describe"} {
+		options[name] = &rpc.MethodOptions{Timeout: time.Second, Idempotent: true}
+	}
+
+	return options
+}
+
+func (s *reflectionService) ParamNames() map[string][]string {
+	return map[string][]string{"DescribeService": {"name"}}
+}
+
+// Return a server filter answering the calls of the reflection namespace,
+// which describe the services it's applied to, and passing the other calls through.
+func Filter() core.Filter {
+	var lock sync.Mutex
+
+	dispatchers := make(map[core.Service]core.Service)
+
+	dispatcherOf := func(service core.Service) core.Service {
+		lock.Lock()
+		defer lock.Unlock()
+
+		d, ok := dispatchers[service]
+
+		if !ok {
+			d = rpc.NativeFactory.Build(&reflectionService{service: service})
+
+			dispatchers[service] = d
+		}
+
+		return d
+	}
+
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		call, ok := req.(*core.Call)
+
+		if !ok {
+			return service.Apply(ctxt, req)
+		}
+
+		method, ok := reflectionMethod(call.Method)
+
+		if !ok {
+			return service.Apply(ctxt, req)
+		}
+
+		c := *call
+
+		c.Service, c.Method = ServiceName, method
+
+		return dispatcherOf(service).Apply(ctxt, &c)
+	})
+}
+
+// Return the name of a reflection method, such as `bucky.reflection.v1.ListServices` or `bucky.reflection.v1/listservices`.
+func reflectionMethod(method string) (string, bool) {
+	if len(method) <= len(ServiceName) || !strings.EqualFold(method[:len(ServiceName)], ServiceName) {
+		return "", false
+	}
+
+	switch method[len(ServiceName)] {
+	case '.', '/':
+		return method[len(ServiceName)+1:], true
+	default:
+		return "", false
+	}
+}
+
+// Install the reflection service on the server, in front of its other filters.
+func Install(b *core.ServerBuilder) {
+	b.Filters = append([]core.Filter{Filter()}, b.Filters...)
+}
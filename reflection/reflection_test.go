@@ -0,0 +1,194 @@
+package reflection
+
+import (
+	"encoding/json"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+type Address struct {
+	City string `json:"city"`
+}
+
+type User struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Password string            `json:"-"`
+	Avatar   []byte            `json:"avatar"`
+	Created  time.Time         `json:"created"`
+	Labels   map[string]string `json:"labels"`
+	Friends  []*User           `json:"friends"`
+	Extra    interface{}       `json:"extra"`
+	Count    int               `json:"count,string"`
+	Address
+}
+
+type userService struct{}
+
+func (s *userService) Get(ctxt context.Context, id int64) (*User, error) {
+	return &User{ID: id}, nil
+}
+
+func (s *userService) Rename(id int64, name string) (string, int) { return name, 1 }
+
+func (s *userService) Watch(id int64, out chan<- *User) error { return nil }
+
+func (s *userService) MethodOptions() map[string]*rpc.MethodOptions {
+	return map[string]*rpc.MethodOptions{
+		"Get": {Timeout: time.Second, Idempotent: true, HttpMethod: "get", HttpPath: "/users/{id}"},
+	}
+}
+
+func (s *userService) ParamNames() map[string][]string {
+	return map[string][]string{"Get": {"id"}, "Rename": {"id", "name"}}
+}
+
+func TestSchema(t *testing.T) {
+	Convey("render the JSON Schema of the Go types", t, func() {
+		schemas := NewSchemas(DefinitionsRef)
+
+		So(schemas.SchemaOf(reflect.TypeOf(0)), ShouldResemble, &Schema{Type: "integer", Format: "int64"})
+		So(schemas.SchemaOf(reflect.TypeOf([3]string{})).MaxItems, ShouldNotBeNil)
+		So(schemas.SchemaOf(reflect.TypeOf(&User{})), ShouldResemble, &Schema{Ref: "#/$defs/User"})
+
+		user := schemas.Definitions["User"]
+
+		So(user.Type, ShouldEqual, "object")
+		So(user.Properties, ShouldContainKey, "city")
+		So(user.Properties, ShouldNotContainKey, "Password")
+		So(user.Properties["name"], ShouldResemble, &Schema{Type: "string"})
+		So(user.Properties["avatar"], ShouldResemble, &Schema{Type: "string", Format: "byte"})
+		So(user.Properties["created"], ShouldResemble, &Schema{Type: "string", Format: "date-time"})
+		So(user.Properties["labels"], ShouldResemble, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}})
+		So(user.Properties["friends"], ShouldResemble, &Schema{Type: "array", Items: &Schema{Ref: "#/$defs/User"}})
+		So(user.Properties["extra"], ShouldResemble, &Schema{})
+		So(user.Properties["count"], ShouldResemble, &Schema{Type: "string"})
+
+		Convey("render the validation rules as constraints", func() {
+			type Account struct {
+				Name  string         `json:"name" validate:"required,min=3,max=8"`
+				Email string         `json:"email" validate:"email"`
+				Age   int            `json:"age" validate:"min=18"`
+				Level int            `json:"level" validate:"enum=1|2"`
+				Tags  []string       `json:"tags" validate:"max=2,dive,regex=^[a-z]+$"`
+				Home  *Address       `json:"home" validate:"required"`
+				Quota map[string]int `json:"quota" validate:"dive,max=10"`
+			}
+
+			schemas.SchemaOf(reflect.TypeOf(Account{}))
+
+			account := schemas.Definitions["Account"]
+			three, eight, two, eighteen, ten := 3, 8, 2, 18.0, 10.0
+
+			So(account.Required, ShouldResemble, []string{"name", "home"})
+			So(account.Properties["name"], ShouldResemble, &Schema{Type: "string", MinLength: &three, MaxLength: &eight})
+			So(account.Properties["email"], ShouldResemble, &Schema{Type: "string", Format: "email"})
+			So(account.Properties["age"], ShouldResemble, &Schema{Type: "integer", Format: "int64", Minimum: &eighteen})
+			So(account.Properties["level"].Enum, ShouldResemble, []interface{}{1.0, 2.0})
+			So(account.Properties["tags"], ShouldResemble, &Schema{Type: "array", MaxItems: &two, Items: &Schema{Type: "string", Pattern: "^[a-z]+$"}})
+			So(account.Properties["quota"].AdditionalProperties.Maximum, ShouldResemble, &ten)
+		})
+	})
+}
+
+func TestReflection(t *testing.T) {
+	Convey("describe the services of a server", t, func() {
+		service := core.WithFilters(rpc.NativeFactory.Build(&userService{}), Filter())
+
+		call := func(method string, args ...interface{}) (interface{}, error) {
+			return service.Apply(context.Background(), &core.Call{Method: method, Args: args}).Get()
+		}
+
+		names, err := call("bucky.reflection.v1.ListServices")
+
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"userService"})
+
+		result, err := call("bucky.reflection.v1/describeservice", "userservice")
+
+		So(err, ShouldBeNil)
+
+		desc := result.(*ServiceDescriptor)
+
+		So(desc.Name, ShouldEqual, "userService")
+		So(desc.Methods, ShouldHaveLength, 3)
+		So(desc.Definitions, ShouldContainKey, "User")
+
+		get := desc.Methods[0]
+
+		So(get.Params, ShouldResemble, []*Param{{"id", &Schema{Type: "integer", Format: "int64"}}})
+		So(get.Result, ShouldResemble, &Schema{Ref: "#/$defs/User"})
+		So(get.Timeout, ShouldEqual, "1s")
+		So(get.Idempotent, ShouldBeTrue)
+		So(get.Http, ShouldResemble, &HttpRoute{"GET", "/users/{id}"})
+
+		rename := desc.Methods[1]
+
+		So(rename.Params[1].Name, ShouldEqual, "name")
+		So(rename.Result.PrefixItems, ShouldResemble, []*Schema{{Type: "string"}, {Type: "integer", Format: "int64"}})
+
+		watch := desc.Methods[2]
+
+		So(watch.Params, ShouldResemble, []*Param{{Schema: &Schema{Type: "integer", Format: "int64"}}})
+		So(watch.ServerStream, ShouldResemble, &Schema{Ref: "#/$defs/User"})
+		So(watch.ClientStream, ShouldBeNil)
+
+		Convey("pass the other calls through", func() {
+			result, err := call("Rename", int64(1), "bob")
+
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, []interface{}{"bob", 1})
+		})
+
+		Convey("reject the unknown services", func() {
+			_, err := call("bucky.reflection.v1.DescribeService", "groupService")
+
+			So(err, ShouldResemble, core.NewStatus(core.CodeNotFound, "unknown service `groupService`"))
+		})
+
+		Convey("describe the services of a mux", func() {
+			mux := rpc.NewMux()
+			mux.Handle("users", "v1", rpc.NativeFactory.Build(&userService{}))
+			mux.Handle("users", "v2", rpc.NativeFactory.Build(&userService{}))
+
+			services, err := core.WithFilters(mux, Filter()).Apply(context.Background(), &core.Call{Method: "bucky.reflection.v1.Describe"}).Get()
+
+			So(err, ShouldBeNil)
+			So(services, ShouldHaveLength, 2)
+			So(services.([]*ServiceDescriptor)[1].Name, ShouldEqual, "users.v2")
+		})
+
+		Convey("serve the descriptions over HTTP", func() {
+			codec := http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "users", Addr: &net.TCPAddr{}})
+
+			server := httptest.NewServer(codec.ServerDispatcher(nil, service).(nethttp.Handler))
+			defer server.Close()
+
+			resp, err := nethttp.Post(server.URL+"/bucky.reflection.v1/describeservice", "application/json", strings.NewReader(`"userService"`))
+
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, nethttp.StatusOK)
+
+			var desc map[string]interface{}
+
+			So(json.NewDecoder(resp.Body).Decode(&desc), ShouldBeNil)
+			So(desc["name"], ShouldEqual, "userService")
+			So(desc["$defs"], ShouldContainKey, "User")
+		})
+	})
+}
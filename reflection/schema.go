@@ -0,0 +1,300 @@
+package reflection
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flier/bucky/validate"
+)
+
+// The reference prefix of the definitions in a JSON Schema document.
+const DefinitionsRef = "#/$defs/"
+
+// A Schema is the JSON Schema of a Go type, as it's encoded by `encoding/json`.
+//
+// An empty schema accepts any value, such as the one of an `interface{}`.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	PrefixItems          []*Schema          `json:"prefixItems,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// The Schemas of the Go types, the named structs are defined once and referenced by their name.
+type Schemas struct {
+	// The prefix of the references, such as `#/$defs/` or `#/components/schemas/`.
+	RefPrefix string
+
+	// The schemas of the named structs, keyed by their name.
+	Definitions map[string]*Schema
+
+	names map[reflect.Type]string
+}
+
+func NewSchemas(refPrefix string) *Schemas {
+	return &Schemas{
+		RefPrefix:   refPrefix,
+		Definitions: make(map[string]*Schema),
+		names:       make(map[reflect.Type]string),
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Return the schema of a type, the named structs are referenced and added to the definitions.
+func (s *Schemas) SchemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case implements(t, jsonMarshalerType):
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		schema := &Schema{Type: "array", Items: s.SchemaOf(t.Elem())}
+
+		if t.Kind() == reflect.Array {
+			n := t.Len()
+
+			schema.MinItems, schema.MaxItems = &n, &n
+		}
+
+		return schema
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.SchemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.objectOf(t)
+		}
+
+		return &Schema{Ref: s.RefPrefix + s.define(t)}
+	default:
+		// the interfaces accept any value, the channels and functions can't be encoded
+		return &Schema{}
+	}
+}
+
+// Return the schema of the values of a tuple, such as the arguments or the results of a method.
+func (s *Schemas) TupleOf(types []reflect.Type) *Schema {
+	n := len(types)
+
+	schema := &Schema{Type: "array", MinItems: &n, MaxItems: &n}
+
+	for _, t := range types {
+		schema.PrefixItems = append(schema.PrefixItems, s.SchemaOf(t))
+	}
+
+	return schema
+}
+
+// Define a named struct once, the types of different packages with the same name are qualified by their package.
+func (s *Schemas) define(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+
+	if _, ok := s.Definitions[name]; ok {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+
+	s.names[t] = name
+
+	// the definition is reserved before its fields, which may refer to the struct itself
+	s.Definitions[name] = &Schema{}
+	s.Definitions[name] = s.objectOf(t)
+
+	return name
+}
+
+func (s *Schemas) objectOf(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	s.addFields(schema, t)
+
+	return schema
+}
+
+// Add the encoded fields of a struct as properties, the fields of the embedded structs are promoted,
+// and their validation rules are rendered as constraints.
+func (s *Schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, opts := parseTag(f.Tag.Get("json"))
+
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		ft := f.Type
+
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.addFields(schema, ft)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		var property *Schema
+
+		if hasOption(opts, "string") {
+			property = &Schema{Type: "string"}
+		} else {
+			property = s.SchemaOf(f.Type)
+		}
+
+		// the invalid rules are reported by the validation
+		rules, _ := validate.ParseTag(f.Tag.Get(validate.TagName))
+
+		if constrain(property, rules) {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = property
+	}
+}
+
+// Render the validation rules of a value as constraints of its schema, return whether it's required.
+func constrain(schema *Schema, rules []*validate.Rule) (required bool) {
+	own, items, dive := validate.SplitDive(rules)
+
+	for _, rule := range own {
+		n := int(rule.Bound())
+		bound := rule.Bound()
+
+		switch {
+		case rule.Name == "required":
+			required = true
+		case rule.Name == "regex":
+			schema.Pattern = rule.Param
+		case rule.Name == "email":
+			schema.Format = "email"
+		case rule.Name == "url":
+			schema.Format = "uri"
+		case rule.Name == "enum":
+			schema.Enum = nil
+
+			for _, option := range rule.Options() {
+				if f, err := strconv.ParseFloat(option, 64); err == nil && (schema.Type == "integer" || schema.Type == "number") {
+					schema.Enum = append(schema.Enum, f)
+				} else {
+					schema.Enum = append(schema.Enum, option)
+				}
+			}
+		case schema.Type == "string":
+			setBounds(rule.Name, n, &schema.MinLength, &schema.MaxLength)
+		case schema.Type == "array":
+			setBounds(rule.Name, n, &schema.MinItems, &schema.MaxItems)
+		case schema.Type == "integer" || schema.Type == "number":
+			switch rule.Name {
+			case "min":
+				schema.Minimum = &bound
+			case "max":
+				schema.Maximum = &bound
+			}
+		}
+	}
+
+	if dive {
+		if schema.Items != nil {
+			constrain(schema.Items, items)
+		} else if schema.AdditionalProperties != nil {
+			constrain(schema.AdditionalProperties, items)
+		}
+	}
+
+	return
+}
+
+func setBounds(rule string, n int, min, max **int) {
+	switch rule {
+	case "min":
+		*min = &n
+	case "max":
+		*max = &n
+	case "len":
+		*min, *max = &n, &n
+	}
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func parseTag(tag string) (name, opts string) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+
+	return tag, ""
+}
+
+func hasOption(opts, option string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"reflect"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// Call a method of a service with the arguments, and store its results into the pointers,
+// such as the typed clients generated by `bucky gen`.
+//
+// The results are decoded from the reply by the client codecs, or assigned from the values
+// returned by the services which don't decode a reply, such as a native service.
+func Invoke(ctxt context.Context, service core.Service, method string, args []interface{}, results ...interface{}) error {
+	call := &core.Call{Method: method, Args: args}
+
+	switch len(results) {
+	case 0:
+	case 1:
+		call.Reply = results[0]
+	default:
+		// the items of the reply are decoded into the pointers
+		reply := append([]interface{}(nil), results...)
+
+		call.Reply = &reply
+	}
+
+	result, err := service.Apply(ctxt, call).Get()
+
+	if err != nil || len(results) == 0 || result == call.Reply {
+		return err
+	}
+
+	values := []interface{}{result}
+
+	if len(results) > 1 {
+		var ok bool
+
+		if values, ok = result.([]interface{}); !ok || len(values) != len(results) {
+			return core.NewStatus(core.CodeInternal, "method `%s` returned %T, expected %d results", method, result, len(results))
+		}
+	}
+
+	for i, value := range values {
+		if err := assign(results[i], value); err != nil {
+			return core.NewStatus(core.CodeInternal, "fail to decode result #%d of `%s`, %s", i, method, err)
+		}
+	}
+
+	return nil
+}
+
+// Assign a value to a pointer, or decode it as JSON when its type differs, such as a generic map.
+func assign(ptr, value interface{}) error {
+	v := reflect.ValueOf(ptr).Elem()
+
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+
+		return nil
+	}
+
+	if rv := reflect.ValueOf(value); rv.Type().AssignableTo(v.Type()) {
+		v.Set(rv)
+
+		return nil
+	}
+
+	data, err := core.JsonEncoding.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	return core.JsonEncoding.Unmarshal(data, ptr)
+}
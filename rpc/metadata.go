@@ -1,8 +1,74 @@
 package rpc
 
+import (
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
 const (
 	MetadataKey = "rpc.metadata"
 )
 
+// Metadata describes the methods exposed by a service.
 type Metadata interface {
+	// Return the name of the service.
+	Name() string
+
+	// Return the methods of the service, sorted by name.
+	Methods() []*Method
+
+	// Return the method with the given name, which is matched case insensitively.
+	Method(name string) (*Method, bool)
+}
+
+// A Method describes the signature of a service method.
+type Method struct {
+	Name   string
+	Params []string       // the parameter names, if the service named them
+	In     []reflect.Type // the parameter types, without the receiver
+	Out    []reflect.Type // the result types, without the trailing error
+
+	// The message types of a streaming method, from its trailing <-chan and chan<- parameters.
+	Recv reflect.Type // the messages received from the client, nil unless it streams them
+	Send reflect.Type // the messages sent to the client, nil unless it streams them
+
+	Options *MethodOptions // never nil
+
+	index       int
+	withContext bool
+	withError   bool
+	streams     []reflect.ChanDir // the directions of the stream parameters, in order
+}
+
+// Does the method take the context of the call as its first parameter?
+func (m *Method) TakesContext() bool { return m.withContext }
+
+// Does the method return an error as its last result?
+func (m *Method) ReturnsError() bool { return m.withError }
+
+// Does the method stream its messages, from or to the client?
+func (m *Method) IsStreaming() bool { return m.Recv != nil || m.Send != nil }
+
+// A Describer is implemented by the services that expose their metadata.
+type Describer interface {
+	Metadata() Metadata
+}
+
+// A ParamNamer is implemented by the services that name the parameters of their methods,
+// which the reflection can't find, such as the adapters generated from an interface.
+type ParamNamer interface {
+	// Return the parameter names of the methods, keyed by the method names.
+	ParamNames() map[string][]string
+}
+
+// Return the metadata of the service handling the call, or nil.
+func MetadataOf(ctxt context.Context) Metadata {
+	md, _ := ctxt.Value(MetadataKey).(Metadata)
+
+	return md
+}
+
+func WithMetadata(ctxt context.Context, md Metadata) context.Context {
+	return context.WithValue(ctxt, MetadataKey, md)
 }
@@ -0,0 +1,272 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A Catalog is implemented by the services serving other services, such as a Mux.
+type Catalog interface {
+	// Return the metadata of the served services, sorted by name.
+	Services() []Metadata
+}
+
+// Return the catalog of a service, or of the service wrapped by its filters.
+func CatalogOf(service core.Service) (Catalog, bool) {
+	for ; service != nil; service = core.Unwrap(service) {
+		if catalog, ok := service.(Catalog); ok {
+			return catalog, true
+		}
+	}
+
+	return nil, false
+}
+
+// Return the metadata of the services served by a catalog, or of the service itself if it describes itself.
+func ServicesOf(service core.Service) []Metadata {
+	if catalog, ok := CatalogOf(service); ok {
+		return catalog.Services()
+	}
+
+	if md := Describe(service); md != nil {
+		return []Metadata{md}
+	}
+
+	return nil
+}
+
+// Resolve the metadata and the method called on a service, or on the service served by its catalog
+// when the method is namespaced, such as `stringsvc.v1/uppercase`.
+func Resolve(service core.Service, method string) (Metadata, *Method, bool) {
+	if md := Describe(service); md != nil {
+		m, ok := md.Method(method)
+
+		return md, m, ok
+	}
+
+	catalog, ok := CatalogOf(service)
+
+	if !ok {
+		return nil, nil, false
+	}
+
+	namespace, name := splitMethod(method)
+
+	if namespace == "" {
+		return nil, nil, false
+	}
+
+	var md Metadata
+
+	if mux, ok := catalog.(*Mux); ok {
+		if e := mux.lookup(namespace); e != nil {
+			md = e.metadata
+		}
+	} else {
+		for _, service := range catalog.Services() {
+			if strings.EqualFold(service.Name(), namespace) {
+				md = service
+			}
+		}
+	}
+
+	if md == nil {
+		return nil, nil, false
+	}
+
+	m, ok := md.Method(name)
+
+	return md, m, ok
+}
+
+// A Mux serves many services on one server, named by their name and version such as `stringsvc.v1`.
+//
+// The calls are dispatched by the namespace of their method, which is a path prefix on HTTP,
+// such as `/stringsvc.v1/uppercase`, or a name prefix on TCP, such as `stringsvc.v1.Uppercase`.
+// A namespace without version is dispatched to the latest version of the service.
+//
+// The services are registered before the server is built, which reads the HTTP routes of their methods.
+type Mux struct {
+	lock    sync.RWMutex
+	entries []*muxEntry
+}
+
+var _ = (core.Service)((*Mux)(nil))
+var _ = (Catalog)((*Mux)(nil))
+
+type muxEntry struct {
+	name     string
+	version  string
+	service  core.Service
+	metadata Metadata
+}
+
+func (e *muxEntry) fullName() string {
+	if e.version == "" {
+		return e.name
+	}
+
+	return e.name + "." + e.version
+}
+
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Register a service by its name and its version, which may be empty, panic if it was registered already.
+func (m *Mux) Handle(name, version string, service core.Service) {
+	if name == "" || service == nil {
+		panic("rpc: invalid service")
+	}
+
+	e := &muxEntry{name: name, version: version, service: service}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, other := range m.entries {
+		if strings.EqualFold(other.fullName(), e.fullName()) {
+			panic(fmt.Sprintf("rpc: service `%s` registered twice", e.fullName()))
+		}
+	}
+
+	e.metadata = &namedMetadata{Describe(service), e.fullName()}
+
+	m.entries = append(m.entries, e)
+
+	sort.Sort(entriesByName(m.entries))
+}
+
+// Return the service registered with the full name, or the latest version of the named service.
+func (m *Mux) Lookup(name string) (core.Service, bool) {
+	if e := m.lookup(name); e != nil {
+		return e.service, true
+	}
+
+	return nil, false
+}
+
+func (m *Mux) lookup(name string) *muxEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var latest *muxEntry
+
+	for _, e := range m.entries {
+		if strings.EqualFold(e.fullName(), name) {
+			return e
+		}
+
+		if strings.EqualFold(e.name, name) && (latest == nil || versionLess(latest.version, e.version)) {
+			latest = e
+		}
+	}
+
+	return latest
+}
+
+// Return the metadata of the registered services, named by their full name.
+func (m *Mux) Services() []Metadata {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	services := make([]Metadata, len(m.entries))
+
+	for i, e := range m.entries {
+		services[i] = e.metadata
+	}
+
+	return services
+}
+
+// Split a namespaced method, such as `stringsvc.v1/uppercase` or `stringsvc.v1.Uppercase`.
+func splitMethod(method string) (namespace, name string) {
+	i := strings.LastIndexByte(method, '/')
+
+	if i < 0 {
+		i = strings.LastIndexByte(method, '.')
+	}
+
+	if i < 0 {
+		return "", method
+	}
+
+	return method[:i], method[i+1:]
+}
+
+func (m *Mux) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	namespace, method := splitMethod(call.Method)
+
+	if namespace == "" {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "method `%s` has no service", call.Method))
+	}
+
+	e := m.lookup(namespace)
+
+	if e == nil {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "unknown service `%s`", namespace))
+	}
+
+	c := *call
+
+	c.Service, c.Method = e.fullName(), method
+
+	return e.service.Apply(ctxt, &c)
+}
+
+// Is the version a older than b? The versions are compared by their number, such as v2 < v10.
+func versionLess(a, b string) bool {
+	x, errX := strconv.Atoi(strings.TrimLeft(a, "vV"))
+	y, errY := strconv.Atoi(strings.TrimLeft(b, "vV"))
+
+	if errX == nil && errY == nil {
+		return x < y
+	}
+
+	return a < b
+}
+
+// A namedMetadata is the metadata of a service registered under another name,
+// without methods if the service doesn't describe itself.
+type namedMetadata struct {
+	metadata Metadata
+	name     string
+}
+
+func (m *namedMetadata) Name() string { return m.name }
+
+func (m *namedMetadata) Methods() []*Method {
+	if m.metadata == nil {
+		return nil
+	}
+
+	return m.metadata.Methods()
+}
+
+func (m *namedMetadata) Method(name string) (*Method, bool) {
+	if m.metadata == nil {
+		return nil, false
+	}
+
+	return m.metadata.Method(name)
+}
+
+type entriesByName []*muxEntry
+
+func (s entriesByName) Len() int           { return len(s) }
+func (s entriesByName) Less(i, j int) bool { return s[i].fullName() < s[j].fullName() }
+func (s entriesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
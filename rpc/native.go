@@ -1,7 +1,12 @@
 package rpc
 
 import (
+	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/fanliao/go-promise"
 	"github.com/flier/bucky/core"
@@ -10,6 +15,9 @@ import (
 
 var (
 	NativeFactory = &nativeFactory{}
+
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 type nativeFactory struct {
@@ -23,26 +31,378 @@ func (f *nativeFactory) Build(v interface{}) core.Service {
 
 type nativeDispatcher struct {
 	metadata Metadata
-	target   interface{}
+	target   reflect.Value
 }
 
+var _ = (core.Service)((*nativeDispatcher)(nil))
+var _ = (Describer)((*nativeDispatcher)(nil))
+
 func NewNativeDispatcher(v interface{}) *nativeDispatcher {
 	return &nativeDispatcher{
-		metadata: NewNativeMetadata(reflect.TypeOf(v)),
-		target:   v,
+		metadata: newNativeMetadata(v),
+		target:   reflect.ValueOf(v),
 	}
 }
 
+func (d *nativeDispatcher) Metadata() Metadata { return d.metadata }
+
 func (d *nativeDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
-	result := promise.NewPromise()
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	method, ok := d.metadata.Method(call.Method)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeUnimplemented, "unknown method `%s`", call.Method))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	if method.IsStreaming() && call.Stream == nil {
+		return core.Rejected(core.NewStatus(core.CodeFailedPrecondition, "method `%s` streams its messages", call.Method))
+	} else if !method.IsStreaming() && call.Stream != nil {
+		return core.Rejected(core.NewStatus(core.CodeFailedPrecondition, "method `%s` doesn't stream its messages", call.Method))
+	}
+
+	var args []interface{}
+	var err error
+
+	if call.Named {
+		args, err = call.DecodeNamedArgs(method.Params, method.In)
+	} else {
+		args, err = call.DecodeArgs(method.In)
+	}
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	ctxt = WithMetadata(ctxt, d.metadata)
+
+	if timeout := method.Options.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctxt, cancel = context.WithTimeout(ctxt, timeout)
+
+		return core.Finally(d.start(ctxt, method, args, call.Stream), func(interface{}, error) { cancel() })
+	}
+
+	return d.start(ctxt, method, args, call.Stream)
+}
+
+func (d *nativeDispatcher) start(ctxt context.Context, method *Method, args []interface{}, stream core.Stream) *promise.Future {
+	if stream != nil {
+		return core.WithContext(ctxt, promise.Start(func() (interface{}, error) {
+			return d.invokeStreaming(ctxt, method, args, stream)
+		}))
+	}
+
+	return core.WithContext(ctxt, promise.Start(func() (interface{}, error) {
+		return d.invoke(ctxt, method, args)
+	}))
+}
+
+// Invoke a streaming method, its channels are fed from and drained to the stream,
+// the channel of the received messages is closed once the client closed its side or the call is done,
+// and the one of the sent messages is closed by the dispatcher once the method returned.
+//
+// A message which can't be received, such as a malformed one, cancels the call, which fails with its error.
+func (d *nativeDispatcher) invokeStreaming(ctxt context.Context, method *Method, args []interface{}, stream core.Stream) (interface{}, error) {
+	ctxt, cancel := context.WithCancel(ctxt)
+	defer cancel()
+
+	var sent sync.WaitGroup
+	var out reflect.Value
+
+	failed := make(chan error, 1)
 
-	return result.Future
+	for _, dir := range method.streams {
+		switch dir {
+		case reflect.RecvDir:
+			ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, method.Recv), core.DefaultStreamWindow)
+
+			go func() {
+				if err := receiveMessages(ctxt, stream, ch, method.Recv); err != nil {
+					if _, ok := err.(*core.Status); !ok {
+						err = core.NewStatus(core.CodeInvalidArgument, "fail to receive a message of `%s`, %s", method.Name, err)
+					}
+
+					failed <- err
+
+					cancel()
+				}
+
+				ch.Close()
+			}()
+
+			args = append(args, ch.Interface())
+
+		case reflect.SendDir:
+			out = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, method.Send), core.DefaultStreamWindow)
+
+			sent.Add(1)
+
+			go func(ch reflect.Value) {
+				defer sent.Done()
+
+				sendMessages(stream, ch)
+			}(out)
+
+			args = append(args, out.Interface())
+		}
+	}
+
+	result, err := d.invoke(ctxt, method, args)
+
+	if out.IsValid() {
+		out.Close()
+
+		sent.Wait()
+	}
+
+	stream.CloseSend()
+
+	select {
+	case err := <-failed:
+		return nil, err
+	default:
+		return result, err
+	}
+}
+
+// Feed the channel with the messages received from the stream, until the client closed its side or the call is done,
+// return the error of a message which couldn't be received otherwise.
+func receiveMessages(ctxt context.Context, stream core.Stream, ch reflect.Value, t reflect.Type) error {
+	done := reflect.ValueOf(ctxt.Done())
+
+	for {
+		v := reflect.New(t)
+
+		if err := stream.Recv(v.Interface()); err == io.EOF || ctxt.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: ch, Send: v.Elem()},
+			{Dir: reflect.SelectRecv, Chan: done},
+		})
+
+		if chosen == 1 {
+			return nil
+		}
+	}
+}
+
+// Send the messages of the channel to the stream, and drop them once it failed so the method never blocks.
+func sendMessages(stream core.Stream, ch reflect.Value) {
+	var err error
+
+	for {
+		v, ok := ch.Recv()
+
+		if !ok {
+			return
+		}
+
+		if err == nil {
+			err = stream.Send(v.Interface())
+		}
+	}
+}
+
+func (d *nativeDispatcher) invoke(ctxt context.Context, method *Method, args []interface{}) (result interface{}, err error) {
+	var in []reflect.Value
+
+	if method.withContext {
+		in = append(in, reflect.ValueOf(&ctxt).Elem())
+	}
+
+	for i, arg := range args {
+		if arg == nil {
+			in = append(in, reflect.Zero(method.In[i]))
+		} else {
+			in = append(in, reflect.ValueOf(arg))
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = core.NewStatus(core.CodeInternal, "method `%s` panicked, %v", method.Name, r)
+		}
+	}()
+
+	fn := d.target.Method(method.index)
+
+	var out []reflect.Value
+
+	// the variadic arguments are decoded as a slice
+	if fn.Type().IsVariadic() {
+		out = fn.CallSlice(in)
+	} else {
+		out = fn.Call(in)
+	}
+
+	if method.withError {
+		if e := out[len(out)-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+
+		out = out[:len(out)-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return out[0].Interface(), nil
+	default:
+		results := make([]interface{}, len(out))
+
+		for i, v := range out {
+			results[i] = v.Interface()
+		}
+
+		return results, nil
+	}
 }
 
 type nativeMetadata struct {
-	t reflect.Type
+	t       reflect.Type
+	methods []*Method
+}
+
+var _ = (Metadata)((*nativeMetadata)(nil))
+
+func newNativeMetadata(v interface{}) *nativeMetadata {
+	md := NewNativeMetadata(reflect.TypeOf(v))
+
+	if optioner, ok := v.(MethodOptioner); ok {
+		options := optioner.MethodOptions()
+
+		for _, method := range md.methods {
+			if opts, ok := options[method.Name]; ok && opts != nil {
+				method.Options = opts
+			}
+		}
+	}
+
+	if namer, ok := v.(ParamNamer); ok {
+		names := namer.ParamNames()
+
+		for _, method := range md.methods {
+			if params, ok := names[method.Name]; ok && len(params) == len(method.In) {
+				method.Params = params
+			}
+		}
+	}
+
+	return md
 }
 
 func NewNativeMetadata(t reflect.Type) *nativeMetadata {
-	return &nativeMetadata{t}
+	md := &nativeMetadata{t: t}
+
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+
+		if m.PkgPath != "" || isHook(t, m.Name) {
+			continue
+		}
+
+		method := &Method{Name: m.Name, Options: &MethodOptions{}, index: i}
+
+		first, n := 1, m.Type.NumIn()
+
+		if n > 1 && m.Type.In(1) == contextType {
+			method.withContext = true
+			first++
+		}
+
+		// the trailing channels are the streams of the method
+	streams:
+		for ; n > first && m.Type.In(n-1).Kind() == reflect.Chan; n-- {
+			t := m.Type.In(n - 1)
+
+			switch {
+			case t.ChanDir() == reflect.RecvDir && method.Recv == nil:
+				method.Recv = t.Elem()
+			case t.ChanDir() == reflect.SendDir && method.Send == nil:
+				method.Send = t.Elem()
+			default:
+				break streams
+			}
+
+			method.streams = append([]reflect.ChanDir{t.ChanDir()}, method.streams...)
+		}
+
+		for j := first; j < n; j++ {
+			method.In = append(method.In, m.Type.In(j))
+		}
+
+		for j := 0; j < m.Type.NumOut(); j++ {
+			if j == m.Type.NumOut()-1 && m.Type.Out(j) == errorType {
+				method.withError = true
+			} else {
+				method.Out = append(method.Out, m.Type.Out(j))
+			}
+		}
+
+		md.methods = append(md.methods, method)
+	}
+
+	sort.Sort(methodsByName(md.methods))
+
+	return md
+}
+
+var hooks = map[string]reflect.Type{
+	"MethodOptions": reflect.TypeOf((*MethodOptioner)(nil)).Elem(),
+	"ParamNames":    reflect.TypeOf((*ParamNamer)(nil)).Elem(),
+	"Metadata":      reflect.TypeOf((*Describer)(nil)).Elem(),
+}
+
+// Is the method a hook describing the service to the dispatcher, which isn't served as a method?
+func isHook(t reflect.Type, name string) bool {
+	iface, ok := hooks[name]
+
+	return ok && t.Implements(iface)
+}
+
+func (m *nativeMetadata) Name() string {
+	t := m.t
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Name() == "" {
+		return fmt.Sprintf("%s", m.t)
+	}
+
+	return t.Name()
 }
+
+func (m *nativeMetadata) Methods() []*Method { return m.methods }
+
+func (m *nativeMetadata) Method(name string) (*Method, bool) {
+	for _, method := range m.methods {
+		if strings.EqualFold(method.Name, name) {
+			return method, true
+		}
+	}
+
+	return nil, false
+}
+
+type methodsByName []*Method
+
+func (s methodsByName) Len() int           { return len(s) }
+func (s methodsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s methodsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/flier/bucky/core"
+)
+
+// The options of a method, applied to its calls by the dispatcher, the filters and the codecs.
+type MethodOptions struct {
+	// How long the calls may run, the native dispatcher sets it as their deadline.
+	Timeout time.Duration
+
+	// The calls can be sent again without side effects, so they may be retried or hedged.
+	Idempotent bool
+
+	// The HTTP route of the method, such as `GET /users/{id}`, in addition to `POST /method`.
+	//
+	// The arguments are then named by the path parameters and the query parameters,
+	// and by the fields of the body when it's an object.
+	HttpMethod string
+	HttpPath   string
+
+	// The roles allowed to call the method, anyone if empty.
+	Roles []string
+}
+
+// A MethodOptioner is implemented by the services that set options on their methods.
+type MethodOptioner interface {
+	// Return the options of the methods, keyed by the method names.
+	MethodOptions() map[string]*MethodOptions
+}
+
+// Return the metadata of a service, or of the service wrapped by its filters, or nil.
+func Describe(service core.Service) Metadata {
+	for service != nil {
+		if describer, ok := service.(Describer); ok {
+			return describer.Metadata()
+		}
+
+		service = core.Unwrap(service)
+	}
+
+	return nil
+}
+
+// Return the timeouts of the methods which set one, such as the methods of a TimeoutFilter.
+func Timeouts(md Metadata) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+
+	for _, m := range md.Methods() {
+		if m.Options.Timeout > 0 {
+			timeouts[m.Name] = m.Options.Timeout
+		}
+	}
+
+	return timeouts
+}
+
+// Return whether a method is idempotent, such as the policies of a RetryFilter or a HedgeFilter.
+func Idempotent(md Metadata) func(method string) bool {
+	return func(method string) bool {
+		m, ok := md.Method(method)
+
+		return ok && m.Options.Idempotent
+	}
+}
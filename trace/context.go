@@ -0,0 +1,161 @@
+// Package trace follows the calls across the services with the W3C Trace Context,
+// propagated as the `traceparent` and `tracestate` headers over HTTP and as frame metadata over TCP.
+package trace
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+
+	traceVersion = "00"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+type Flags byte
+
+const (
+	FlagSampled Flags = 1
+)
+
+// A SpanContext identifies a span across the services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      Flags
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+func (sc SpanContext) IsSampled() bool { return sc.Flags&FlagSampled != 0 }
+
+// Return the `traceparent` of the span context, such as 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceVersion, sc.TraceID, sc.SpanID, byte(sc.Flags))
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("malformed `%s`", s)
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+
+	return err
+}
+
+// Parse a `traceparent`, the fields appended by the future versions are ignored.
+func ParseTraceParent(s string) (sc SpanContext, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+
+	if len(parts) < 4 || parts[0] == "ff" || (parts[0] == traceVersion && len(parts) != 4) {
+		return sc, fmt.Errorf("malformed traceparent `%s`", s)
+	}
+
+	var version, flags [1]byte
+
+	if err = decodeHex(version[:], parts[0]); err != nil {
+		return
+	}
+
+	if err = decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return
+	}
+
+	if err = decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return
+	}
+
+	if err = decodeHex(flags[:], parts[3]); err != nil {
+		return
+	}
+
+	sc.Flags = Flags(flags[0])
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent `%s`", s)
+	}
+
+	return sc, nil
+}
+
+// Extract the span context from the header of a call.
+func Extract(h core.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(h.Get(TraceParentHeader))
+
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	sc.TraceState = strings.Join(h[TraceStateHeader], ",")
+
+	return sc, true
+}
+
+// Inject the span context into the header of a call.
+func Inject(sc SpanContext, h core.Header) {
+	h.Set(TraceParentHeader, sc.TraceParent())
+
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+}
+
+var (
+	randLock sync.Mutex
+	random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func newTraceID() (id TraceID) {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], random.Uint64())
+		binary.BigEndian.PutUint64(id[8:], random.Uint64())
+	}
+
+	return
+}
+
+func newSpanID() (id SpanID) {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], random.Uint64())
+	}
+
+	return
+}
+
+func sample(ratio float64) bool {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	return random.Float64() < ratio
+}
@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/flier/bucky/core"
+)
+
+// An Exporter receives the finished spans.
+type Exporter interface {
+	Export(span *Span) error
+}
+
+type ExporterFunc func(span *Span) error
+
+func (f ExporterFunc) Export(span *Span) error { return f(span) }
+
+// An InMemoryExporter keeps the finished spans, for example to check them in tests.
+type InMemoryExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+var _ = (Exporter)((*InMemoryExporter)(nil))
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span *Span) error {
+	e.lock.Lock()
+	e.spans = append(e.spans, span)
+	e.lock.Unlock()
+
+	return nil
+}
+
+// Return the finished spans, in the order they finished.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.lock.Lock()
+	e.spans = nil
+	e.lock.Unlock()
+}
+
+// A FileExporter appends the spans to a file, one OTLP/JSON ExportTraceServiceRequest per line.
+type FileExporter struct {
+	Service string
+
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+var _ = (Exporter)((*FileExporter)(nil))
+
+func NewFileExporter(path, service string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileExporter{Service: service, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (e *FileExporter) Export(span *Span) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.encoder.Encode(OTLPRequest(e.Service, span))
+}
+
+func (e *FileExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.file.Close()
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, len(keys))
+
+	for i, key := range keys {
+		result[i] = otlpAttribute{key, otlpValue{attrs[key]}}
+	}
+
+	return result
+}
+
+// Return the OTLP/JSON export request of a span.
+func OTLPRequest(service string, span *Span) interface{} {
+	s := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		TraceState:        span.TraceState,
+		Name:              span.Name,
+		Kind:              int(span.Kind) + 1, // SPAN_KIND_SERVER = 2, SPAN_KIND_CLIENT = 3
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        otlpAttributes(span.AttributesCopy()),
+	}
+
+	if span.Parent.IsValid() {
+		s.ParentSpanID = span.Parent.String()
+	}
+
+	if span.Status != nil {
+		if span.Status.Code == core.CodeOK {
+			s.Status.Code = 1 // STATUS_CODE_OK
+		} else {
+			s.Status = otlpStatus{2, span.Status.Message} // STATUS_CODE_ERROR
+		}
+	}
+
+	return &otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpAttribute{{"service.name", otlpValue{service}}}},
+		ScopeSpans: []otlpScopeSpans{{otlpScope{"github.com/flier/bucky/trace"}, []otlpSpan{s}}},
+	}}}
+}
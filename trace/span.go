@@ -0,0 +1,91 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	SpanKey = "trace.span"
+)
+
+type SpanKind int
+
+const (
+	SpanKindServer SpanKind = iota + 1
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "unknown"
+	}
+}
+
+// A Span records a call served or sent by a service.
+type Span struct {
+	SpanContext
+
+	Parent     SpanID
+	Name       string
+	Kind       SpanKind
+	Start, End time.Time
+	Attributes map[string]string
+	Status     *core.Status
+
+	lock sync.Mutex
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+
+	s.Attributes[key] = value
+}
+
+// Return a copy of the attributes of the span.
+func (s *Span) AttributesCopy() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	attrs := make(map[string]string, len(s.Attributes))
+
+	for key, value := range s.Attributes {
+		attrs[key] = value
+	}
+
+	return attrs
+}
+
+// Return the span of the call, or nil.
+func SpanOf(ctxt context.Context) *Span {
+	span, _ := ctxt.Value(SpanKey).(*Span)
+
+	return span
+}
+
+func WithSpan(ctxt context.Context, span *Span) context.Context {
+	return context.WithValue(ctxt, SpanKey, span)
+}
+
+// Return the trace ID of the call, or an empty string.
+func TraceIDOf(ctxt context.Context) string {
+	if span := SpanOf(ctxt); span != nil {
+		return span.TraceID.String()
+	}
+
+	return ""
+}
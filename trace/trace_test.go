@@ -0,0 +1,197 @@
+package trace
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/http"
+	"github.com/flier/bucky/rpc"
+)
+
+func TestTraceParent(t *testing.T) {
+	Convey("parse a traceparent", t, func() {
+		sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		So(err, ShouldBeNil)
+		So(sc.TraceID.String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(sc.SpanID.String(), ShouldEqual, "00f067aa0ba902b7")
+		So(sc.IsSampled(), ShouldBeTrue)
+		So(sc.TraceParent(), ShouldEqual, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		_, err = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+
+		So(err, ShouldBeNil)
+
+		for _, s := range []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		} {
+			_, err := ParseTraceParent(s)
+
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("inject and extract a span context", t, func() {
+		sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled, TraceState: "vendor=value"}
+
+		h := make(core.Header)
+
+		Inject(sc, h)
+
+		extracted, ok := Extract(h)
+
+		So(ok, ShouldBeTrue)
+		So(extracted, ShouldResemble, sc)
+	})
+}
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return strings.ToUpper(s) }
+
+func TestTracer(t *testing.T) {
+	Convey("follow a call across services over HTTP", t, func() {
+		serverSpans := NewInMemoryExporter()
+		clientSpans := NewInMemoryExporter()
+
+		codec := http.NewHttpServerCodec(&core.ServerCodecConfig{Name: "echo", Addr: &net.TCPAddr{}})
+		service := core.WithFilters(rpc.NativeFactory.Build(echoService{}), NewTracer("echo", serverSpans).ServerFilter())
+
+		server := httptest.NewServer(codec.ServerDispatcher(nil, service).(nethttp.Handler))
+		defer server.Close()
+
+		uri, _ := url.Parse(server.URL)
+
+		client := (&core.ClientBuilder{
+			Uri:          uri,
+			CodecFactory: http.HttpCodec,
+			Filters:      []core.Filter{NewTracer("echo", clientSpans).ClientFilter()},
+		}).Build()
+
+		_, err := client.Apply(context.Background(), &core.Call{Method: "Echo", Args: []interface{}{"hello"}}).Get()
+
+		So(err, ShouldBeNil)
+
+		So(clientSpans.Spans(), ShouldHaveLength, 1)
+		So(serverSpans.Spans(), ShouldHaveLength, 1)
+
+		clientSpan, serverSpan := clientSpans.Spans()[0], serverSpans.Spans()[0]
+
+		So(clientSpan.Kind, ShouldEqual, SpanKindClient)
+		So(clientSpan.Parent.IsValid(), ShouldBeFalse)
+		So(clientSpan.AttributesCopy(), ShouldResemble, map[string]string{
+			"rpc.system":       "bucky",
+			"rpc.service":      "echo",
+			"rpc.method":       "Echo",
+			"rpc.codec":        "http",
+			"rpc.status_code":  "OK",
+			"net.peer.address": uri.Host,
+		})
+
+		So(serverSpan.Kind, ShouldEqual, SpanKindServer)
+		So(serverSpan.TraceID, ShouldEqual, clientSpan.TraceID)
+		So(serverSpan.Parent, ShouldEqual, clientSpan.SpanID)
+		So(serverSpan.AttributesCopy()["rpc.method"], ShouldEqual, "echo")
+		So(serverSpan.AttributesCopy()["net.peer.address"], ShouldNotBeEmpty)
+
+		Convey("continue the trace of the context", func() {
+			parent := &Span{SpanContext: SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled}}
+
+			_, err := client.Apply(WithSpan(context.Background(), parent), &core.Call{Method: "Unknown"}).Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+
+			clientSpan, serverSpan := clientSpans.Spans()[1], serverSpans.Spans()[1]
+
+			So(clientSpan.TraceID, ShouldEqual, parent.TraceID)
+			So(clientSpan.Parent, ShouldEqual, parent.SpanID)
+			So(clientSpan.Status.Code, ShouldEqual, core.CodeUnimplemented)
+			So(serverSpan.TraceID, ShouldEqual, parent.TraceID)
+			So(serverSpan.AttributesCopy()["rpc.status_code"], ShouldEqual, "UNIMPLEMENTED")
+		})
+
+		Convey("don't export the spans of an unsampled trace", func() {
+			parent := &Span{SpanContext: SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}}
+
+			_, err := client.Apply(WithSpan(context.Background(), parent), &core.Call{Method: "Echo", Args: []interface{}{"hello"}}).Get()
+
+			So(err, ShouldBeNil)
+			So(clientSpans.Spans(), ShouldHaveLength, 1)
+			So(serverSpans.Spans(), ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestFileExporter(t *testing.T) {
+	Convey("export spans as OTLP/JSON", t, func() {
+		dir, err := ioutil.TempDir("", "trace")
+
+		So(err, ShouldBeNil)
+
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "spans.json")
+
+		exporter, err := NewFileExporter(path, "echo")
+
+		So(err, ShouldBeNil)
+
+		tracer := NewTracer("echo", exporter)
+
+		span := tracer.Start("Echo", SpanKindServer, SpanContext{})
+
+		span.SetAttribute("rpc.method", "Echo")
+
+		tracer.Finish(span, core.NewStatus(core.CodeNotFound, "missing"))
+
+		So(exporter.Close(), ShouldBeNil)
+
+		data, err := ioutil.ReadFile(path)
+
+		So(err, ShouldBeNil)
+
+		var req struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []otlpAttribute
+				}
+				ScopeSpans []struct {
+					Spans []otlpSpan
+				}
+			}
+		}
+
+		So(json.Unmarshal(data, &req), ShouldBeNil)
+		So(req.ResourceSpans[0].Resource.Attributes, ShouldResemble, []otlpAttribute{{"service.name", otlpValue{"echo"}}})
+
+		s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+
+		So(s.TraceID, ShouldEqual, span.TraceID.String())
+		So(s.SpanID, ShouldEqual, span.SpanID.String())
+		So(s.ParentSpanID, ShouldBeEmpty)
+		So(s.Kind, ShouldEqual, 2)
+		So(s.Status, ShouldResemble, otlpStatus{2, "missing"})
+		So(s.Attributes, ShouldResemble, []otlpAttribute{
+			{"rpc.method", otlpValue{"Echo"}},
+			{"rpc.status_code", otlpValue{"NOT_FOUND"}},
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"time"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A Tracer creates a span per call, served or sent, and exports the sampled ones.
+type Tracer struct {
+	// The name of the traced service.
+	Service string
+
+	// The finished spans are exported to the exporter.
+	Exporter Exporter
+
+	// The ratio of the new traces to sample, the calls follow the decision of their parent otherwise.
+	SampleRatio float64
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{Service: service, Exporter: exporter, SampleRatio: 1}
+}
+
+// Start a span, child of the given parent if valid.
+func (t *Tracer) Start(name string, kind SpanKind, parent SpanContext) *Span {
+	span := &Span{Name: name, Kind: kind, Start: time.Now()}
+
+	if parent.IsValid() {
+		span.SpanContext = parent
+		span.Parent = parent.SpanID
+	} else {
+		span.TraceID = newTraceID()
+
+		if sample(t.SampleRatio) {
+			span.Flags |= FlagSampled
+		}
+	}
+
+	span.SpanID = newSpanID()
+
+	return span
+}
+
+// Finish the span with the outcome of the call, and export it if sampled.
+func (t *Tracer) Finish(span *Span, err error) {
+	span.End = time.Now()
+	span.Status = core.StatusOf(err)
+
+	span.SetAttribute("rpc.status_code", span.Status.Code.String())
+
+	if span.IsSampled() && t.Exporter != nil {
+		if err := t.Exporter.Export(span); err != nil {
+			core.Warnf("fail to export span %s, %s", span.SpanID, err)
+		}
+	}
+}
+
+func (t *Tracer) trace(ctxt context.Context, req core.Request, service core.Service, span *Span, info *core.CallInfo) *promise.Future {
+	method := core.MethodOf(req)
+
+	span.SetAttribute("rpc.system", "bucky")
+	span.SetAttribute("rpc.method", method)
+
+	if call, ok := req.(*core.Call); ok && call.Service != "" {
+		span.SetAttribute("rpc.service", call.Service)
+	} else if t.Service != "" {
+		span.SetAttribute("rpc.service", t.Service)
+	}
+
+	return core.Finally(service.Apply(WithSpan(ctxt, span), req), func(result interface{}, err error) {
+		if info != nil {
+			if info.Peer != "" {
+				span.SetAttribute("net.peer.address", info.Peer)
+			}
+
+			if info.Codec != "" {
+				span.SetAttribute("rpc.codec", info.Codec)
+			}
+		}
+
+		t.Finish(span, err)
+	})
+}
+
+// Return a server filter continuing the trace of the incoming calls.
+func (t *Tracer) ServerFilter() core.Filter {
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		parent, _ := Extract(core.IncomingHeader(ctxt))
+
+		span := t.Start(core.MethodOf(req), SpanKindServer, parent)
+
+		info, _ := core.IncomingCallInfo(ctxt)
+
+		return t.trace(ctxt, req, service, span, info)
+	})
+}
+
+// Return a client filter propagating the trace of the context to the outgoing calls.
+func (t *Tracer) ClientFilter() core.Filter {
+	return core.FilterFunc(func(ctxt context.Context, req core.Request, service core.Service) *promise.Future {
+		var parent SpanContext
+
+		if span := SpanOf(ctxt); span != nil {
+			parent = span.SpanContext
+		}
+
+		span := t.Start(core.MethodOf(req), SpanKindClient, parent)
+
+		h := core.OutgoingHeader(ctxt).Clone()
+
+		Inject(span.SpanContext, h)
+
+		ctxt, info := core.EnsureOutgoingCallInfo(core.WithOutgoingHeader(ctxt, h))
+
+		return t.trace(ctxt, req, service, span, info)
+	})
+}
@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/flier/bucky/core"
+)
+
+const (
+	MaxFrameSize = 16 << 20
+)
+
+type frameKind byte
+
+const (
+	frameRequest       frameKind = iota + 1 // a call to a method
+	frameResponse                           // the result of a call
+	frameError                              // the status of a failed call
+	frameStreamRequest                      // a call to a streaming method
+	frameMessage                            // a message of a streaming call
+	frameEnd                                // the sender closed its side of a streaming call
+	frameWindow                             // the receiver grants the sender more messages, as an uvarint payload
+	frameCancel                             // the client canceled the call
+)
+
+var (
+	errFrameTooLarge = errors.New("frame too large")
+	errFrameCorrupt  = errors.New("corrupt frame")
+)
+
+// A frame is the unit exchanged on a stream connection,
+//
+//	length uint32 | kind byte | id uvarint | method string | header count uvarint | (key string, value string)* | payload
+//
+// where the strings are prefixed by their uvarint length, the calls are multiplexed by id.
+type frame struct {
+	kind    frameKind
+	id      uint64
+	method  string
+	header  core.Header
+	payload []byte
+}
+
+func (f *frame) String() string {
+	return fmt.Sprintf("frame(kind=%d, id=%d, method=%s, payload=%d bytes)", f.kind, f.id, f.method, len(f.payload))
+}
+
+func appendUvarint(buf []byte, n uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], n)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+
+	return append(buf, s...)
+}
+
+func (f *frame) marshal() []byte {
+	buf := make([]byte, 4, 64+len(f.payload))
+
+	buf = append(buf, byte(f.kind))
+	buf = appendUvarint(buf, f.id)
+	buf = appendString(buf, f.method)
+
+	var count int
+
+	for _, values := range f.header {
+		count += len(values)
+	}
+
+	buf = appendUvarint(buf, uint64(count))
+
+	keys := make([]string, 0, len(f.header))
+
+	for key := range f.header {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range f.header[key] {
+			buf = appendString(buf, key)
+			buf = appendString(buf, value)
+		}
+	}
+
+	buf = append(buf, f.payload...)
+
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+
+	return buf
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	n, size := binary.Uvarint(buf)
+
+	if size <= 0 || uint64(len(buf)-size) < n {
+		return "", nil, errFrameCorrupt
+	}
+
+	return string(buf[size : size+int(n)]), buf[size+int(n):], nil
+}
+
+func readFrame(r *bufio.Reader) (*frame, error) {
+	var prefix [4]byte
+
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(prefix[:])
+
+	if length > MaxFrameSize {
+		return nil, errFrameTooLarge
+	}
+
+	buf := make([]byte, length)
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	if len(buf) < 1 {
+		return nil, errFrameCorrupt
+	}
+
+	f := &frame{kind: frameKind(buf[0])}
+
+	buf = buf[1:]
+
+	id, size := binary.Uvarint(buf)
+
+	if size <= 0 {
+		return nil, errFrameCorrupt
+	}
+
+	f.id, buf = id, buf[size:]
+
+	var err error
+
+	if f.method, buf, err = readString(buf); err != nil {
+		return nil, err
+	}
+
+	count, size := binary.Uvarint(buf)
+
+	if size <= 0 {
+		return nil, errFrameCorrupt
+	}
+
+	buf = buf[size:]
+
+	if count > 0 {
+		f.header = make(core.Header)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		var key, value string
+
+		if key, buf, err = readString(buf); err != nil {
+			return nil, err
+		}
+
+		if value, buf, err = readString(buf); err != nil {
+			return nil, err
+		}
+
+		f.header.Add(key, value)
+	}
+
+	f.payload = buf
+
+	return f, nil
+}
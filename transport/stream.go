@@ -0,0 +1,592 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/fanliao/go-promise"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/netserver"
+)
+
+var (
+	errShuttingDown = core.NewStatus(core.CodeUnavailable, "server is shutting down")
+)
+
+// A streamServerCodec serves the calls as frames over a stream oriented network, such as TCP or Unix sockets.
+type streamServerCodec struct {
+	Name              string
+	Addr              net.Addr
+	Encoding          core.Encoding
+	TLSConfig         *tls.Config
+	CertFile, KeyFile string
+}
+
+var _ = (core.ServerCodec)((*streamServerCodec)(nil))
+
+func newStreamServerCodec(cfg *core.ServerCodecConfig) *streamServerCodec {
+	encoding := cfg.Encoding
+
+	if encoding == nil {
+		encoding = core.JsonEncoding
+	}
+
+	return &streamServerCodec{
+		Name:      cfg.Name,
+		Addr:      cfg.Addr,
+		Encoding:  encoding,
+		TLSConfig: cfg.TLSConfig,
+		CertFile:  cfg.CertFile,
+		KeyFile:   cfg.KeyFile,
+	}
+}
+
+func (c *streamServerCodec) ServerDispatcher(transport core.Transport, service core.Service) core.Server {
+	return &streamServerDispatcher{
+		streamServerCodec: c,
+		Transport:         transport,
+		Service:           service,
+	}
+}
+
+type streamServerDispatcher struct {
+	*streamServerCodec
+	netserver.Server
+
+	Transport core.Transport
+	Service   core.Service
+}
+
+var _ = (core.Server)((*streamServerDispatcher)(nil))
+var _ = (core.ConnectionLister)((*streamServerDispatcher)(nil))
+
+func (d *streamServerDispatcher) Serve(ctxt context.Context) error {
+	l, err := netserver.Listen(d.Addr, d.TLSConfig, d.CertFile, d.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	return d.Server.Serve(ctxt, d.Name, l, d.serveConn)
+}
+
+func (d *streamServerDispatcher) serveConn(ctxt context.Context, conn net.Conn) {
+	// the calls in flight are canceled once the client has gone, or the grace period of the shutdown elapsed
+	ctxt, cancel := context.WithCancel(ctxt)
+	defer cancel()
+
+	w := &frameWriter{conn: conn}
+	r := bufio.NewReader(conn)
+	peer := conn.RemoteAddr().String()
+
+	var state *tls.ConnectionState
+
+	calls := newConnCalls()
+
+	for {
+		f, err := readFrame(r)
+
+		if err != nil {
+			return
+		}
+
+		switch f.kind {
+		case frameRequest, frameStreamRequest:
+		case frameMessage, frameEnd:
+			if s := calls.stream(f.id); s != nil && !s.push(f) {
+				core.Warnf("%s: %s overran the window of call #%d", d.Name, peer, f.id)
+
+				return
+			}
+
+			continue
+		case frameWindow:
+			if s := calls.stream(f.id); s != nil {
+				s.grant(f)
+			}
+
+			continue
+		case frameCancel:
+			calls.cancel(f.id)
+
+			continue
+		default:
+			continue
+		}
+
+		if tc, ok := conn.(*tls.Conn); ok && state == nil {
+			// the handshake has completed once a frame was read
+			cs := tc.ConnectionState()
+			state = &cs
+		}
+
+		if !d.Begin() {
+			w.write(d.errorFrame(f.id, errShuttingDown))
+			continue
+		}
+
+		// the call and its stream are registered before the next frame is read
+		callCtxt, cancel := context.WithCancel(ctxt)
+
+		var stream *wireStream
+		var remote core.Stream
+
+		if f.kind == frameStreamRequest {
+			var local core.Stream
+
+			local, remote = core.NewPipe(callCtxt, core.DefaultStreamWindow)
+			stream = newWireStream(callCtxt, f.id, w, d.Encoding, local)
+		}
+
+		calls.add(f.id, cancel, stream)
+
+		go func(f *frame) {
+			defer d.Done()
+			defer cancel()
+			defer calls.remove(f.id)
+
+			w.write(d.dispatch(callCtxt, peer, state, f, stream, remote))
+		}(f)
+	}
+}
+
+func (d *streamServerDispatcher) dispatch(ctxt context.Context, peer string, state *tls.ConnectionState, f *frame, stream *wireStream, remote core.Stream) *frame {
+	info := &core.CallInfo{Codec: d.Addr.Network(), Peer: peer, RequestSize: len(f.payload), TLS: state}
+
+	result := d.call(core.WithIncomingCallInfo(ctxt, info), f, stream, remote)
+
+	info.Complete(len(result.payload))
+
+	return result
+}
+
+func (d *streamServerDispatcher) call(ctxt context.Context, f *frame, stream *wireStream, remote core.Stream) *frame {
+	h := f.header
+
+	if h == nil {
+		h = make(core.Header)
+	}
+
+	ctxt, cancel, err := core.ExtractDeadline(ctxt, h)
+
+	if err != nil {
+		return d.errorFrame(f.id, err)
+	}
+
+	defer cancel()
+
+	ctxt = core.WithIncomingHeader(ctxt, h)
+
+	call := &core.Call{
+		Service:  d.Name,
+		Method:   f.method,
+		Payload:  f.payload,
+		Encoding: d.Encoding,
+		Stream:   remote,
+	}
+
+	var forwarded chan error
+
+	if stream != nil {
+		forwarded = make(chan error, 1)
+
+		go stream.deliver()
+		go func() { forwarded <- stream.forward() }()
+	}
+
+	result, err := d.Service.Apply(ctxt, call).Get()
+
+	if stream != nil {
+		// the messages sent by the method precede its result
+		remote.CloseSend()
+
+		select {
+		case e := <-forwarded:
+			if err == nil && e != nil {
+				err = e
+			}
+		case <-ctxt.Done():
+			stream.abort()
+
+			if err == nil {
+				err = core.StatusOf(ctxt.Err())
+			}
+		}
+	}
+
+	if err != nil {
+		return d.errorFrame(f.id, err)
+	}
+
+	payload, err := d.Encoding.Marshal(result)
+
+	if err != nil {
+		return d.errorFrame(f.id, core.NewStatus(core.CodeInternal, "fail to encode response, %s", err))
+	}
+
+	return &frame{kind: frameResponse, id: f.id, payload: payload}
+}
+
+func (d *streamServerDispatcher) errorFrame(id uint64, err error) *frame {
+	payload, _ := d.Encoding.Marshal(core.StatusOf(err))
+
+	return &frame{kind: frameError, id: id, payload: payload}
+}
+
+type frameWriter struct {
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func (w *frameWriter) write(f *frame) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, err := w.conn.Write(f.marshal())
+
+	return err
+}
+
+// A streamClientCodec multiplexes the calls as frames over a connection,
+// which is dialed on the first call and dialed again after it failed.
+//
+// The path of a TCP URI is the namespace of the methods, such as `tcp://host:port/stringsvc.v1`
+// calling `stringsvc.v1.Uppercase` on a server serving many services.
+type streamClientCodec struct {
+	Network   string
+	Address   string
+	Namespace string
+	Encoding  core.Encoding
+	TLSConfig *tls.Config
+}
+
+var _ = (core.ClientCodec)((*streamClientCodec)(nil))
+
+func newStreamClientCodec(network string, cfg *core.ClientCodecConfig) *streamClientCodec {
+	encoding := cfg.Encoding
+
+	if encoding == nil {
+		encoding = core.JsonEncoding
+	}
+
+	address, namespace := cfg.Uri.Host, strings.Trim(cfg.Uri.Path, "/")
+
+	if network == "unix" {
+		address, namespace = cfg.Uri.Path, ""
+	}
+
+	return &streamClientCodec{network, address, namespace, encoding, cfg.TLSConfig}
+}
+
+func (c *streamClientCodec) ClientDispatcher(transport core.Transport) core.Service {
+	return &streamClientDispatcher{streamClientCodec: c}
+}
+
+type streamClientDispatcher struct {
+	*streamClientCodec
+
+	lock    sync.Mutex
+	conn    *clientConn
+	closed  bool
+	nextId  uint64
+	dialing sync.Mutex
+}
+
+var _ = (core.Service)((*streamClientDispatcher)(nil))
+
+type clientConn struct {
+	w       *frameWriter
+	lock    sync.Mutex
+	pending map[uint64]*pendingCall
+	err     error
+}
+
+type pendingCall struct {
+	call   *core.Call
+	info   *core.CallInfo
+	result *promise.Promise
+	stream *wireStream // the stream of a streaming call, or nil
+}
+
+func (d *streamClientDispatcher) connect(ctxt context.Context) (*clientConn, error) {
+	d.dialing.Lock()
+	defer d.dialing.Unlock()
+
+	d.lock.Lock()
+	conn, closed := d.conn, d.closed
+	d.lock.Unlock()
+
+	if closed {
+		return nil, core.NewStatus(core.CodeUnavailable, "client is closed")
+	}
+
+	if conn != nil {
+		return conn, nil
+	}
+
+	var c net.Conn
+	var err error
+
+	dialer := &net.Dialer{}
+
+	if deadline, ok := ctxt.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	if d.TLSConfig != nil {
+		c, err = tls.DialWithDialer(dialer, d.Network, d.Address, d.TLSConfig)
+	} else {
+		c, err = dialer.Dial(d.Network, d.Address)
+	}
+
+	if err != nil {
+		return nil, core.NewStatus(core.CodeUnavailable, "%s", err)
+	}
+
+	conn = &clientConn{w: &frameWriter{conn: c}, pending: make(map[uint64]*pendingCall)}
+
+	d.lock.Lock()
+	d.conn = conn
+	d.lock.Unlock()
+
+	go d.receive(conn, bufio.NewReader(c))
+
+	return conn, nil
+}
+
+func (d *streamClientDispatcher) receive(conn *clientConn, r *bufio.Reader) {
+	for {
+		f, err := readFrame(r)
+
+		if err != nil {
+			d.fail(conn, core.NewStatus(core.CodeUnavailable, "connection lost, %s", err))
+
+			return
+		}
+
+		final := f.kind == frameResponse || f.kind == frameError
+
+		conn.lock.Lock()
+		p := conn.pending[f.id]
+		if final {
+			delete(conn.pending, f.id)
+		}
+		conn.lock.Unlock()
+
+		if p == nil {
+			continue
+		}
+
+		switch {
+		case p.stream == nil:
+			if final {
+				d.settle(p, f)
+			}
+		case f.kind == frameWindow:
+			p.stream.grant(f)
+		case f.kind == frameMessage || f.kind == frameEnd || final:
+			// the final frame follows the messages of the stream
+			if !p.stream.push(f) && final {
+				p.stream.abort()
+
+				d.settle(p, f)
+			}
+		}
+	}
+}
+
+func (d *streamClientDispatcher) settle(p *pendingCall, f *frame) {
+	if p.info != nil {
+		p.info.Complete(len(f.payload))
+	}
+
+	switch f.kind {
+	case frameResponse:
+		if p.call.Reply != nil {
+			if err := p.call.Encoding.Unmarshal(f.payload, p.call.Reply); err != nil {
+				p.result.Reject(core.NewStatus(core.CodeInternal, "fail to decode response, %s", err))
+			} else {
+				p.result.Resolve(p.call.Reply)
+			}
+
+			return
+		}
+
+		var result interface{}
+
+		if err := p.call.Encoding.Unmarshal(f.payload, &result); err != nil {
+			p.result.Reject(core.NewStatus(core.CodeInternal, "fail to decode response, %s", err))
+		} else {
+			p.result.Resolve(result)
+		}
+
+	case frameError:
+		var status core.Status
+
+		if err := p.call.Encoding.Unmarshal(f.payload, &status); err != nil {
+			p.result.Reject(core.NewStatus(core.CodeInternal, "fail to decode status, %s", err))
+		} else {
+			p.result.Reject(&status)
+		}
+	}
+}
+
+// Reject the calls pending on a broken connection, the next call will dial again.
+func (d *streamClientDispatcher) fail(conn *clientConn, err error) {
+	d.lock.Lock()
+	if d.conn == conn {
+		d.conn = nil
+	}
+	d.lock.Unlock()
+
+	conn.lock.Lock()
+	pending := conn.pending
+	conn.pending = nil
+	conn.err = err
+	conn.lock.Unlock()
+
+	conn.w.conn.Close()
+
+	for _, p := range pending {
+		if p.stream != nil {
+			p.stream.abort()
+		}
+
+		p.result.Reject(err)
+	}
+}
+
+func (d *streamClientDispatcher) Apply(ctxt context.Context, req core.Request) *promise.Future {
+	call, ok := req.(*core.Call)
+
+	if !ok {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "unsupported request %T", req))
+	}
+
+	if err := ctxt.Err(); err != nil {
+		return core.Rejected(core.StatusOf(err))
+	}
+
+	if call.Encoding == nil {
+		call.Encoding = d.Encoding
+	}
+
+	payload, err := call.EncodeArgs()
+
+	if err != nil {
+		return core.Rejected(core.NewStatus(core.CodeInvalidArgument, "fail to encode arguments, %s", err))
+	}
+
+	conn, err := d.connect(ctxt)
+
+	if err != nil {
+		return core.Rejected(err)
+	}
+
+	h := core.OutgoingHeader(ctxt).Clone()
+
+	core.InjectDeadline(ctxt, h)
+
+	d.lock.Lock()
+	d.nextId++
+	id := d.nextId
+	d.lock.Unlock()
+
+	info, ok := core.OutgoingCallInfo(ctxt)
+
+	if ok {
+		info.Codec, info.Peer, info.RequestSize = d.Network, d.Address, len(payload)
+	}
+
+	p := &pendingCall{call: call, info: info, result: promise.NewPromise()}
+
+	kind := frameRequest
+
+	if call.Stream != nil {
+		kind = frameStreamRequest
+		p.stream = newWireStream(ctxt, id, conn.w, call.Encoding, call.Stream)
+	}
+
+	conn.lock.Lock()
+	if conn.pending == nil {
+		conn.lock.Unlock()
+
+		return core.Rejected(conn.err)
+	}
+	conn.pending[id] = p
+	conn.lock.Unlock()
+
+	method := call.Method
+
+	if d.Namespace != "" {
+		method = d.Namespace + "." + method
+	}
+
+	if err := conn.w.write(&frame{kind: kind, id: id, method: method, header: h, payload: payload}); err != nil {
+		d.fail(conn, core.NewStatus(core.CodeUnavailable, "%s", err))
+	} else if p.stream != nil {
+		go d.stream(conn, p)
+	} else if done := ctxt.Done(); done != nil {
+		go d.watch(conn, id, p, done)
+	}
+
+	return core.WithContext(ctxt, p.result.Future)
+}
+
+// Forget a unary call given up before its result, and cancel it on the server.
+func (d *streamClientDispatcher) watch(conn *clientConn, id uint64, p *pendingCall, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-p.result.Future.GetChan():
+		return
+	}
+
+	conn.lock.Lock()
+	pending := conn.pending[id] == p
+	if pending {
+		delete(conn.pending, id)
+	}
+	conn.lock.Unlock()
+
+	if pending {
+		conn.w.write(&frame{kind: frameCancel, id: id})
+	}
+}
+
+// Pump the messages of a streaming call, and cancel it on the server once it's done before its result.
+func (d *streamClientDispatcher) stream(conn *clientConn, p *pendingCall) {
+	go func() {
+		if err := p.stream.forward(); err != nil && p.stream.ctxt.Err() == nil {
+			p.result.Reject(err)
+			p.stream.abort()
+		}
+	}()
+
+	if f := p.stream.deliver(); f != nil {
+		d.settle(p, f)
+	} else {
+		conn.lock.Lock()
+		delete(conn.pending, p.stream.id)
+		conn.lock.Unlock()
+
+		conn.w.write(&frame{kind: frameCancel, id: p.stream.id})
+	}
+}
+
+func (d *streamClientDispatcher) Close() error {
+	d.lock.Lock()
+	conn := d.conn
+	d.closed = true
+	d.lock.Unlock()
+
+	if conn != nil {
+		d.fail(conn, core.NewStatus(core.CodeUnavailable, "client is closed"))
+	}
+
+	return nil
+}
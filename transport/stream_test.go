@@ -0,0 +1,375 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+	"github.com/flier/bucky/internal/testutil"
+	"github.com/flier/bucky/rpc"
+)
+
+type record struct {
+	Level   string
+	Message string
+}
+
+type logService struct {
+	produced int32
+	started  chan struct{}
+	done     chan string
+}
+
+func (s *logService) Tail(n int, out chan<- int) error {
+	for i := 0; i < n; i++ {
+		atomic.AddInt32(&s.produced, 1)
+
+		out <- i
+	}
+
+	return nil
+}
+
+func (s *logService) Ingest(level string, in <-chan record) (int, error) {
+	var count int
+
+	for r := range in {
+		if r.Level != level {
+			return count, core.NewStatus(core.CodeInvalidArgument, "unexpected level `%s`", r.Level)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (s *logService) Upper(in <-chan string, out chan<- string) {
+	defer func() { s.done <- "Upper" }()
+
+	for line := range in {
+		out <- strings.ToUpper(line)
+	}
+}
+
+func (s *logService) Echo(line string) string { return line }
+
+func (s *logService) Wait(ctxt context.Context) {
+	s.started <- struct{}{}
+
+	<-ctxt.Done()
+
+	s.done <- "Wait"
+}
+
+func TestStreaming(t *testing.T) {
+	Convey("serve the streaming methods over TCP", t, func() {
+		service := &logService{started: make(chan struct{}, 1), done: make(chan string, 1)}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{Name: "logs", Addr: addr, CodecFactory: TcpCodec}).Build(rpc.NativeFactory.Build(service))
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: TcpCodec}).Build()
+
+		Convey("stream the messages of the server", func() {
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Tail", Args: []interface{}{3}})
+
+			var values []int
+
+			for {
+				var n int
+
+				if err := stream.Recv(&n); err == io.EOF {
+					break
+				} else {
+					So(err, ShouldBeNil)
+				}
+
+				values = append(values, n)
+			}
+
+			So(values, ShouldResemble, []int{0, 1, 2})
+
+			_, err := future.Get()
+
+			So(err, ShouldBeNil)
+		})
+
+		Convey("stream the messages of the client", func() {
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Ingest", Args: []interface{}{"info"}})
+
+			for i := 0; i < 100; i++ {
+				So(stream.Send(&record{"info", "hello"}), ShouldBeNil)
+			}
+
+			So(stream.CloseSend(), ShouldBeNil)
+
+			result, err := future.Get()
+
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, 100)
+
+			Convey("fail with the status of the method", func() {
+				stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Ingest", Args: []interface{}{"info"}})
+
+				stream.Send(&record{"debug", "hello"})
+				stream.CloseSend()
+
+				_, err := future.Get()
+
+				So(err, ShouldResemble, &core.Status{Code: core.CodeInvalidArgument, Message: "unexpected level `debug`"})
+			})
+
+			Convey("fail with a malformed message", func() {
+				stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Ingest", Args: []interface{}{"info"}})
+
+				stream.Send(&record{"info", "hello"})
+				stream.Send("not a record")
+				stream.CloseSend()
+
+				_, err := future.Get()
+
+				So(core.CodeOf(err), ShouldEqual, core.CodeInvalidArgument)
+				So(err.Error(), ShouldContainSubstring, "fail to decode message")
+			})
+		})
+
+		Convey("stream the messages in both directions", func() {
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Upper"})
+
+			for _, line := range []string{"hello", "world"} {
+				So(stream.Send(line), ShouldBeNil)
+
+				var reply string
+
+				So(stream.Recv(&reply), ShouldBeNil)
+				So(reply, ShouldEqual, strings.ToUpper(line))
+			}
+
+			stream.CloseSend()
+
+			var reply string
+
+			So(stream.Recv(&reply), ShouldEqual, io.EOF)
+
+			_, err := future.Get()
+
+			So(err, ShouldBeNil)
+			So(<-service.done, ShouldEqual, "Upper")
+		})
+
+		Convey("cancel the stream on the server", func() {
+			ctxt, cancel := context.WithCancel(context.Background())
+
+			stream, future := core.OpenStream(ctxt, client, &core.Call{Method: "Upper"})
+
+			So(stream.Send("hello"), ShouldBeNil)
+
+			var reply string
+
+			So(stream.Recv(&reply), ShouldBeNil)
+
+			cancel()
+
+			_, err := future.Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeCanceled)
+
+			select {
+			case method := <-service.done:
+				So(method, ShouldEqual, "Upper")
+			case <-time.After(time.Second):
+				So(errors.New("the method wasn't canceled"), ShouldBeNil)
+			}
+		})
+
+		Convey("hold back the server while the client doesn't receive", func() {
+			stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Tail", Args: []interface{}{1000}})
+
+			var n int
+
+			So(stream.Recv(&n), ShouldBeNil)
+
+			time.Sleep(100 * time.Millisecond)
+
+			So(atomic.LoadInt32(&service.produced), ShouldBeLessThan, 200)
+
+			for err := stream.Recv(&n); err != io.EOF; err = stream.Recv(&n) {
+				So(err, ShouldBeNil)
+			}
+
+			So(n, ShouldEqual, 999)
+
+			_, err := future.Get()
+
+			So(err, ShouldBeNil)
+		})
+
+		Convey("cancel a unary call on the server", func() {
+			ctxt, cancel := context.WithCancel(context.Background())
+
+			future := client.Apply(ctxt, &core.Call{Method: "Wait"})
+
+			<-service.started
+
+			cancel()
+
+			_, err := future.Get()
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeCanceled)
+
+			select {
+			case method := <-service.done:
+				So(method, ShouldEqual, "Wait")
+			case <-time.After(time.Second):
+				So(errors.New("the method wasn't canceled"), ShouldBeNil)
+			}
+
+			d := client.(*streamClientDispatcher)
+
+			d.lock.Lock()
+			conn := d.conn
+			d.lock.Unlock()
+
+			conn.lock.Lock()
+			defer conn.lock.Unlock()
+
+			So(conn.pending, ShouldBeEmpty)
+		})
+
+		Convey("reject a unary call to a streaming method", func() {
+			_, err := client.Apply(context.Background(), &core.Call{Method: "Tail", Args: []interface{}{3}}).Get()
+
+			So(err, ShouldResemble, &core.Status{Code: core.CodeFailedPrecondition, Message: "method `Tail` streams its messages"})
+		})
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("shut down during an open bidirectional stream", t, func() {
+		service := &logService{done: make(chan string, 1)}
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, done, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			codec := TcpCodec.ServerCodec(&core.ServerCodecConfig{Name: "logs", Addr: addr})
+			server := codec.ServerDispatcher(nil, rpc.NativeFactory.Build(service)).(*streamServerDispatcher)
+			server.ShutdownGrace = 20 * time.Millisecond
+
+			return server
+		})
+
+		So(err, ShouldBeNil)
+
+		uri, _ := url.Parse("tcp://" + addr.String())
+
+		client := (&core.ClientBuilder{Uri: uri, CodecFactory: TcpCodec}).Build()
+
+		stream, future := core.OpenStream(context.Background(), client, &core.Call{Method: "Upper"})
+
+		So(stream.Send("hello"), ShouldBeNil)
+
+		var reply string
+
+		So(stream.Recv(&reply), ShouldBeNil)
+
+		cancel()
+
+		select {
+		case err := <-done:
+			So(err, ShouldEqual, context.Canceled)
+		case <-time.After(time.Second):
+			So(errors.New("the server didn't shut down"), ShouldBeNil)
+		}
+
+		So(<-service.done, ShouldEqual, "Upper")
+
+		select {
+		case <-future.GetChan():
+		case <-time.After(time.Second):
+			So(errors.New("the stream wasn't closed"), ShouldBeNil)
+		}
+	})
+}
+
+type counterService struct{ step int }
+
+func (s *counterService) Next(n int) int { return n + s.step }
+
+func TestMux(t *testing.T) {
+	Convey("serve many services by the namespace of their methods", t, func() {
+		mux := rpc.NewMux()
+		mux.Handle("counter", "v1", rpc.NativeFactory.Build(&counterService{1}))
+		mux.Handle("counter", "v2", rpc.NativeFactory.Build(&counterService{2}))
+		mux.Handle("logs", "", rpc.NativeFactory.Build(&logService{}))
+
+		ctxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, _, err := testutil.Serve(ctxt, func(addr *net.TCPAddr) core.Server {
+			return (&core.ServerBuilder{Name: "mux", Addr: addr, CodecFactory: TcpCodec}).Build(mux)
+		})
+
+		So(err, ShouldBeNil)
+
+		call := func(namespace, method string, args ...interface{}) (interface{}, error) {
+			uri, _ := url.Parse("tcp://" + addr.String() + "/" + namespace)
+
+			client := (&core.ClientBuilder{Uri: uri, CodecFactory: TcpCodec}).Build()
+
+			return client.Apply(context.Background(), &core.Call{Method: method, Args: args}).Get()
+		}
+
+		result, err := call("counter.v1", "Next", 1)
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 2)
+
+		result, _ = call("counter.v2", "Next", 1)
+
+		So(result, ShouldEqual, 3)
+
+		Convey("dispatch to the latest version", func() {
+			result, _ := call("counter", "Next", 1)
+
+			So(result, ShouldEqual, 3)
+		})
+
+		Convey("reject the unknown services", func() {
+			_, err := call("counter.v3", "Next", 1)
+
+			So(err, ShouldResemble, core.NewStatus(core.CodeUnimplemented, "unknown service `counter.v3`"))
+
+			_, err = call("", "Next", 1)
+
+			So(core.CodeOf(err), ShouldEqual, core.CodeUnimplemented)
+		})
+
+		Convey("list the registered services", func() {
+			services := rpc.ServicesOf(mux)
+
+			So(services, ShouldHaveLength, 3)
+			So(services[0].Name(), ShouldEqual, "counter.v1")
+			So(services[2].Name(), ShouldEqual, "logs")
+			So(services[2].Methods(), ShouldHaveLength, 5)
+		})
+	})
+}
@@ -0,0 +1,204 @@
+package transport
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/flier/bucky/core"
+)
+
+// A wireStream pumps the messages of a streaming call between a pipe end and the connection.
+//
+// The sender spends a credit per message, starting with a window of credits,
+// and the receiver grants it back once the message was delivered to the pipe,
+// so that a slow reader holds back its peer instead of buffering its messages.
+type wireStream struct {
+	ctxt     context.Context
+	abort    context.CancelFunc
+	id       uint64
+	w        *frameWriter
+	encoding core.Encoding
+	local    core.Stream
+
+	lock    sync.Mutex
+	credits int
+	granted chan struct{}
+	inbox   chan *frame
+}
+
+func newWireStream(ctxt context.Context, id uint64, w *frameWriter, encoding core.Encoding, local core.Stream) *wireStream {
+	ctxt, abort := context.WithCancel(ctxt)
+
+	return &wireStream{
+		ctxt:     ctxt,
+		abort:    abort,
+		id:       id,
+		w:        w,
+		encoding: encoding,
+		local:    local,
+		credits:  core.DefaultStreamWindow,
+		granted:  make(chan struct{}, 1),
+		// the messages of the window, the end of the stream and the final result
+		inbox: make(chan *frame, core.DefaultStreamWindow+2),
+	}
+}
+
+// Queue a received frame to be delivered, or return false if the peer sent more than it was granted.
+func (s *wireStream) push(f *frame) bool {
+	select {
+	case s.inbox <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// Add the credits granted by the peer.
+func (s *wireStream) grant(f *frame) {
+	n, size := binary.Uvarint(f.payload)
+
+	if size <= 0 {
+		return
+	}
+
+	s.lock.Lock()
+	s.credits += int(n)
+	s.lock.Unlock()
+
+	select {
+	case s.granted <- struct{}{}:
+	default:
+	}
+}
+
+// Wait for a credit to send a message, or return false once the stream is done.
+func (s *wireStream) acquire() bool {
+	for {
+		s.lock.Lock()
+		if s.credits > 0 {
+			s.credits--
+			s.lock.Unlock()
+
+			return true
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-s.granted:
+		case <-s.ctxt.Done():
+			return false
+		}
+	}
+}
+
+// Deliver the received messages to the pipe, and close it once the peer closed its side.
+//
+// Return the final frame of the call, or nil if the stream was done before.
+func (s *wireStream) deliver() *frame {
+	for {
+		select {
+		case f := <-s.inbox:
+			switch f.kind {
+			case frameMessage:
+				if err := s.local.Send(&core.RawMessage{Data: f.payload, Encoding: s.encoding}); err != nil {
+					continue
+				}
+
+				s.w.write(&frame{kind: frameWindow, id: s.id, payload: appendUvarint(nil, 1)})
+
+			case frameEnd:
+				s.local.CloseSend()
+
+			default:
+				s.local.CloseSend()
+
+				return f
+			}
+
+		case <-s.ctxt.Done():
+			s.local.CloseSend()
+
+			return nil
+		}
+	}
+}
+
+// Forward the messages sent to the pipe to the peer, until the pipe is closed or the stream is done.
+func (s *wireStream) forward() error {
+	for {
+		var v interface{}
+
+		if err := s.local.Recv(&v); err == io.EOF {
+			return s.w.write(&frame{kind: frameEnd, id: s.id})
+		} else if err != nil {
+			return err
+		}
+
+		if !s.acquire() {
+			return core.StatusOf(s.ctxt.Err())
+		}
+
+		payload, err := core.EncodeMessage(v, s.encoding)
+
+		if err != nil {
+			return core.NewStatus(core.CodeInternal, "fail to encode message, %s", err)
+		}
+
+		if err := s.w.write(&frame{kind: frameMessage, id: s.id, payload: payload}); err != nil {
+			return core.NewStatus(core.CodeUnavailable, "%s", err)
+		}
+	}
+}
+
+// The calls in flight on a server connection, to deliver the frames of their streams and cancel them.
+type connCalls struct {
+	lock    sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	streams map[uint64]*wireStream
+}
+
+func newConnCalls() *connCalls {
+	return &connCalls{
+		cancels: make(map[uint64]context.CancelFunc),
+		streams: make(map[uint64]*wireStream),
+	}
+}
+
+func (c *connCalls) add(id uint64, cancel context.CancelFunc, stream *wireStream) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.cancels[id] = cancel
+
+	if stream != nil {
+		c.streams[id] = stream
+	}
+}
+
+func (c *connCalls) remove(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.cancels, id)
+	delete(c.streams, id)
+}
+
+func (c *connCalls) stream(id uint64) *wireStream {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.streams[id]
+}
+
+func (c *connCalls) cancel(id uint64) {
+	c.lock.Lock()
+	cancel := c.cancels[id]
+	c.lock.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
@@ -14,9 +14,9 @@ type tcpCodecFactory struct {
 var _ = (core.CodecFactory)((*tcpCodecFactory)(nil))
 
 func (f *tcpCodecFactory) ClientCodec(cfg *core.ClientCodecConfig) core.ClientCodec {
-	return nil
+	return newStreamClientCodec("tcp", cfg)
 }
 
 func (f *tcpCodecFactory) ServerCodec(cfg *core.ServerCodecConfig) core.ServerCodec {
-	return nil
+	return newStreamServerCodec(cfg)
 }
@@ -14,9 +14,9 @@ type unixCodecFactory struct {
 var _ = (core.CodecFactory)((*unixCodecFactory)(nil))
 
 func (f *unixCodecFactory) ClientCodec(cfg *core.ClientCodecConfig) core.ClientCodec {
-	return nil
+	return newStreamClientCodec("unix", cfg)
 }
 
 func (f *unixCodecFactory) ServerCodec(cfg *core.ServerCodecConfig) core.ServerCodec {
-	return nil
+	return newStreamServerCodec(cfg)
 }
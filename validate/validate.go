@@ -0,0 +1,483 @@
+// Package validate checks the values against the rules of their struct tags, such as
+//
+//	type User struct {
+//		Name   string            `json:"name" validate:"required,max=64"`
+//		Email  string            `json:"email" validate:"required,email"`
+//		Role   string            `json:"role" validate:"enum=admin|user"`
+//		Age    int               `json:"age" validate:"min=18"`
+//		Code   string            `json:"code" validate:"omitempty,len=6,regex=^[0-9]+$"`
+//		Tags   []string          `json:"tags" validate:"max=10,dive,min=1"`
+//		Labels map[string]string `json:"labels" validate:"dive,max=256"`
+//		Home   *Address          `json:"home"`
+//	}
+//
+// The rules are
+//
+//	required   the value isn't zero, such as a nil pointer, an empty string or an empty slice
+//	omitempty  the other rules are skipped when the value is zero
+//	min=N      a number is at least N, a string has at least N characters, a slice or a map has at least N items
+//	max=N      a number is at most N, a string has at most N characters, a slice or a map has at most N items
+//	len=N      a string has N characters, a slice or a map has N items
+//	regex=RE   a string matches the regular expression, which is the last rule as it may contain commas
+//	enum=A|B   the value is one of the options
+//	email      a string is an email address
+//	url        a string is an absolute URL
+//	dive       the following rules are checked on the items of a slice or the values of a map
+//
+// The nested structs are validated, and the items of a slice or a map are validated with `dive`.
+// The violations are reported with the path of their field, named by the json tags, such as `home.city` or `tags[2]`.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The struct tag of the rules.
+const TagName = "validate"
+
+// A Rule is a rule of a struct tag, such as `min=3`.
+type Rule struct {
+	Name  string
+	Param string
+
+	n  float64
+	re *regexp.Regexp
+}
+
+func (r *Rule) String() string {
+	if r.Param == "" {
+		return r.Name
+	}
+
+	return r.Name + "=" + r.Param
+}
+
+// Return the options of an `enum` rule.
+func (r *Rule) Options() []string {
+	return strings.Split(r.Param, "|")
+}
+
+// Return the bound of a `min`, `max` or `len` rule.
+func (r *Rule) Bound() float64 {
+	return r.n
+}
+
+// Parse the rules of a struct tag.
+func ParseTag(tag string) ([]*Rule, error) {
+	var rules []*Rule
+
+	for tag != "" {
+		var token string
+
+		if strings.HasPrefix(tag, "regex=") {
+			token, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			token, tag = tag[:i], tag[i+1:]
+		} else {
+			token, tag = tag, ""
+		}
+
+		rule := &Rule{Name: token}
+
+		if i := strings.IndexByte(token, '='); i >= 0 {
+			rule.Name, rule.Param = token[:i], token[i+1:]
+		}
+
+		var err error
+
+		switch rule.Name {
+		case "required", "omitempty", "email", "url", "dive":
+			if rule.Param != "" {
+				err = fmt.Errorf("unexpected parameter")
+			}
+		case "min", "max", "len":
+			rule.n, err = strconv.ParseFloat(rule.Param, 64)
+		case "regex":
+			rule.re, err = regexp.Compile(rule.Param)
+		case "enum":
+			if rule.Param == "" {
+				err = fmt.Errorf("missing options")
+			}
+		default:
+			err = fmt.Errorf("unknown rule")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("validate: invalid rule `%s`, %s", token, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Split the rules of a value from the rules of its items, which follow `dive`.
+func SplitDive(rules []*Rule) (own, items []*Rule, dive bool) {
+	for i, rule := range rules {
+		if rule.Name == "dive" {
+			return rules[:i], rules[i+1:], true
+		}
+	}
+
+	return rules, nil, false
+}
+
+// A Violation is a rule a field doesn't satisfy.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v *Violation) String() string {
+	if v.Field == "" {
+		return v.Message
+	}
+
+	return v.Field + " " + v.Message
+}
+
+// The Violations of a value, returned as an error.
+type Violations []*Violation
+
+func (v Violations) Error() string {
+	messages := make([]string, len(v))
+
+	for i, violation := range v {
+		messages[i] = violation.String()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Validate a value against the rules of its fields,
+// return the Violations, or an error if its rules are invalid.
+func Struct(v interface{}) error {
+	var c checker
+
+	c.check("", reflect.ValueOf(v), nil)
+
+	return c.result()
+}
+
+// Validate the arguments of a method, their violations are reported with the parameter names,
+// or with their index when the parameters aren't named and there are many.
+func Args(names []string, args []interface{}) error {
+	var c checker
+
+	for i, arg := range args {
+		path := ""
+
+		if len(names) == len(args) {
+			path = names[i]
+		} else if len(args) > 1 {
+			path = fmt.Sprintf("args[%d]", i)
+		}
+
+		c.check(path, reflect.ValueOf(arg), nil)
+	}
+
+	return c.result()
+}
+
+type checker struct {
+	violations Violations
+	err        error
+}
+
+func (c *checker) result() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	if len(c.violations) > 0 {
+		return c.violations
+	}
+
+	return nil
+}
+
+func (c *checker) violate(path string, rule *Rule, format string, args ...interface{}) {
+	c.violations = append(c.violations, &Violation{path, rule.String(), fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) check(path string, v reflect.Value, rules []*Rule) {
+	own, items, dive := SplitDive(rules)
+
+	zero := !v.IsValid() || v.IsZero()
+
+	for _, rule := range own {
+		switch rule.Name {
+		case "required":
+			if zero {
+				c.violate(path, rule, "is required")
+				return
+			}
+		case "omitempty":
+			if zero {
+				return
+			}
+		}
+	}
+
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return
+	}
+
+	for _, rule := range own {
+		if c.err == nil {
+			c.apply(path, v, rule)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.checkItem(fmt.Sprintf("%s[%d]", path, i), v.Index(i), items, dive)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			c.checkItem(fmt.Sprintf("%s[%v]", path, key.Interface()), v.MapIndex(key), items, dive)
+		}
+	case reflect.Struct:
+		c.checkFields(path, v)
+	}
+}
+
+// Check the items with the rules following `dive`, the items without rules are only checked when they're structs.
+func (c *checker) checkItem(path string, v reflect.Value, rules []*Rule, dive bool) {
+	if dive || isStruct(v.Type()) {
+		c.check(path, v, rules)
+	}
+}
+
+func (c *checker) checkFields(path string, v reflect.Value) {
+	fields, err := fieldsOf(v.Type())
+
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+
+		if !ok {
+			continue
+		}
+
+		name := f.name
+
+		if path != "" {
+			name = path + "." + f.name
+		}
+
+		c.check(name, fv, f.rules)
+	}
+}
+
+func (c *checker) apply(path string, v reflect.Value, rule *Rule) {
+	switch rule.Name {
+	case "required", "omitempty", "dive":
+	case "min", "max", "len":
+		n, unit, ok := measure(v, rule.Name != "len")
+
+		if !ok {
+			c.err = fmt.Errorf("validate: rule `%s` of `%s` doesn't apply to %s", rule, path, v.Type())
+			return
+		}
+
+		switch {
+		case rule.Name == "min" && n < rule.n:
+			c.violate(path, rule, "must be at least %s%s", rule.Param, unit)
+		case rule.Name == "max" && n > rule.n:
+			c.violate(path, rule, "must be at most %s%s", rule.Param, unit)
+		case rule.Name == "len" && n != rule.n:
+			c.violate(path, rule, "must be exactly %s%s", rule.Param, unit)
+		}
+	case "regex", "email", "url":
+		if v.Kind() != reflect.String {
+			c.err = fmt.Errorf("validate: rule `%s` of `%s` doesn't apply to %s", rule, path, v.Type())
+			return
+		}
+
+		s := v.String()
+
+		switch rule.Name {
+		case "regex":
+			if !rule.re.MatchString(s) {
+				c.violate(path, rule, "must match `%s`", rule.Param)
+			}
+		case "email":
+			if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+				c.violate(path, rule, "must be an email address")
+			}
+		case "url":
+			if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+				c.violate(path, rule, "must be a URL")
+			}
+		}
+	case "enum":
+		s := fmt.Sprint(v.Interface())
+
+		for _, option := range rule.Options() {
+			if s == option {
+				return
+			}
+		}
+
+		c.violate(path, rule, "must be one of %s", strings.Join(rule.Options(), ", "))
+	}
+}
+
+// Return the measure of a value compared by the `min`, `max` and `len` rules, and its unit.
+func measure(v reflect.Value, numbers bool) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", numbers
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), "", numbers
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", numbers
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters long", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	default:
+		return 0, "", false
+	}
+}
+
+// A field of a struct, named by its json tag, with its rules.
+type field struct {
+	index []int
+	name  string
+	rules []*Rule
+}
+
+type fieldsEntry struct {
+	fields []*field
+	err    error
+}
+
+var (
+	fieldsLock  sync.RWMutex
+	fieldsCache = make(map[reflect.Type]*fieldsEntry)
+)
+
+// Return the fields of a struct, the fields of its embedded structs are promoted.
+func fieldsOf(t reflect.Type) ([]*field, error) {
+	fieldsLock.RLock()
+	e, ok := fieldsCache[t]
+	fieldsLock.RUnlock()
+
+	if !ok {
+		e = &fieldsEntry{}
+		e.fields, e.err = collectFields(t, nil)
+
+		fieldsLock.Lock()
+		fieldsCache[t] = e
+		fieldsLock.Unlock()
+	}
+
+	return e.fields, e.err
+}
+
+func collectFields(t reflect.Type, index []int) ([]*field, error) {
+	var fields []*field
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := f.Tag.Get("json")
+
+		if j := strings.IndexByte(name, ','); j >= 0 {
+			name = name[:j]
+		}
+
+		if name == "-" && f.Tag.Get("json") == "-" {
+			continue
+		}
+
+		ft := f.Type
+
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		fi := append(append([]int(nil), index...), i)
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			promoted, err := collectFields(ft, fi)
+
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, promoted...)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		rules, err := ParseTag(f.Tag.Get(TagName))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s.%s", err, t, f.Name)
+		}
+
+		fields = append(fields, &field{fi, name, rules})
+	}
+
+	return fields, nil
+}
+
+// Return a field by its index, or false if it's promoted from a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+
+				v = v.Elem()
+			}
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		if t.Kind() == reflect.Interface {
+			return true
+		}
+
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct
+}
@@ -0,0 +1,124 @@
+package validate
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type Address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"omitempty,len=5,regex=^[0-9]{3,5}$"`
+}
+
+type Base struct {
+	ID int64 `json:"id" validate:"min=1"`
+}
+
+type User struct {
+	Base
+
+	Name    string            `json:"name" validate:"required,max=8"`
+	Email   string            `json:"email" validate:"email"`
+	Site    string            `json:"site,omitempty" validate:"omitempty,url"`
+	Role    string            `json:"role" validate:"enum=admin|user"`
+	Age     int               `json:"age" validate:"min=18,max=150"`
+	Home    *Address          `json:"home"`
+	Others  []Address         `json:"others"`
+	Tags    []string          `json:"tags" validate:"max=2,dive,required"`
+	Labels  map[string]string `json:"labels" validate:"dive,max=3"`
+	Comment string            `json:"-" validate:"required"`
+}
+
+func validUser() *User {
+	return &User{
+		Base:  Base{ID: 1},
+		Name:  "bob",
+		Email: "bob@example.com",
+		Role:  "user",
+		Age:   42,
+		Home:  &Address{City: "Paris"},
+		Tags:  []string{"a"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	Convey("validate a value by the rules of its struct tags", t, func() {
+		So(Struct(validUser()), ShouldBeNil)
+
+		Convey("report every violation with its field path", func() {
+			u := &User{
+				Name:   "alexander",
+				Email:  "Bob <bob@example.com>",
+				Site:   "example.com",
+				Role:   "root",
+				Age:    12,
+				Home:   &Address{Zip: "12a45"},
+				Others: []Address{{City: "Lyon"}, {}},
+				Tags:   []string{"a", "", "c"},
+				Labels: map[string]string{"k": "long"},
+			}
+
+			err := Struct(u)
+
+			So(err, ShouldHaveSameTypeAs, Violations{})
+
+			var fields []string
+
+			for _, v := range err.(Violations) {
+				fields = append(fields, v.Field+" "+v.Rule)
+			}
+
+			So(fields, ShouldResemble, []string{
+				"id min=1",
+				"name max=8",
+				"email email",
+				"site url",
+				"role enum=admin|user",
+				"age min=18",
+				"home.city required",
+				"home.zip regex=^[0-9]{3,5}$",
+				"others[1].city required",
+				"tags max=2",
+				"tags[1] required",
+				"labels[k] max=3",
+			})
+
+			So(err.(Violations)[0].Message, ShouldEqual, "must be at least 1")
+			So(err.(Violations)[1].Message, ShouldEqual, "must be at most 8 characters long")
+			So(err.Error(), ShouldStartWith, "id must be at least 1; name must be at most 8 characters long;")
+		})
+
+		Convey("skip the nil pointers unless they're required", func() {
+			u := validUser()
+			u.Home = nil
+
+			So(Struct(u), ShouldBeNil)
+		})
+
+		Convey("validate the arguments of a method", func() {
+			So(Args([]string{"user", "n"}, []interface{}{&User{}, 3}), ShouldHaveLength, 5)
+
+			err := Args(nil, []interface{}{&Address{}})
+
+			So(err.(Violations)[0].Field, ShouldEqual, "city")
+
+			err = Args(nil, []interface{}{1, Address{}})
+
+			So(err.(Violations)[0].Field, ShouldEqual, "args[1].city")
+		})
+
+		Convey("fail on the invalid rules", func() {
+			_, err := ParseTag("min=x")
+
+			So(err, ShouldNotBeNil)
+
+			err = Struct(&struct {
+				Ok bool `validate:"min=1"`
+			}{})
+
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotHaveSameTypeAs, Violations{})
+		})
+	})
+}